@@ -17,7 +17,9 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strconv"
+	"time"
 
 	"github.com/pkg/errors"
 
@@ -56,7 +58,47 @@ func main() {
 	contentType, _ := util.ParseEnvVar(common.ImporterContentType, false)
 	imageSize, _ := util.ParseEnvVar(common.ImporterImageSize, false)
 	certDir, _ := util.ParseEnvVar(common.ImporterCertDirVar, false)
+	clientCertDir, _ := util.ParseEnvVar(common.ImporterClientCertDirVar, false)
 	insecureTLS, _ := strconv.ParseBool(os.Getenv(common.InsecureTLSVar))
+	checksum, _ := util.ParseEnvVar(common.ImporterChecksum, false)
+	diskPath, _ := util.ParseEnvVar(common.ImporterDiskPath, false)
+	httpConnections, _ := strconv.Atoi(os.Getenv(common.ImporterHTTPConnections))
+	s3Endpoint, _ := util.ParseEnvVar(common.ImporterS3Endpoint, false)
+	s3Region, _ := util.ParseEnvVar(common.ImporterS3Region, false)
+	s3AddressingStyle, _ := util.ParseEnvVar(common.ImporterS3AddressingStyle, false)
+	s3Secure, _ := strconv.ParseBool(os.Getenv(common.ImporterS3Secure))
+	s3RoleARN, _ := util.ParseEnvVar(common.ImporterS3RoleARN, false)
+	s3STSEndpoint, _ := util.ParseEnvVar(common.ImporterS3STSEndpoint, false)
+	sessionToken, _ := util.ParseEnvVar(common.ImporterSessionToken, false)
+	gcsEndpoint, _ := util.ParseEnvVar(common.ImporterGCSEndpoint, false)
+	azureAccount, _ := util.ParseEnvVar(common.ImporterAzureAccount, false)
+	azureSASToken, _ := util.ParseEnvVar(common.ImporterAzureSASToken, false)
+	azureAccountKey, _ := util.ParseEnvVar(common.ImporterAzureAccountKey, false)
+	sftpHostKey, _ := util.ParseEnvVar(common.ImporterSFTPHostKey, false)
+	registryPlatform, _ := util.ParseEnvVar(common.ImporterRegistryPlatform, false)
+	retryOptions := importer.RetryOptions{
+		Retries:    common.DefaultImportRetries,
+		Backoff:    common.DefaultImportRetryBackoff,
+		MaxBackoff: common.DefaultImportRetryMaxBackoff,
+	}
+	if retries, err := strconv.Atoi(os.Getenv(common.ImporterRetries)); err == nil {
+		retryOptions.Retries = retries
+	}
+	if backoff, err := time.ParseDuration(os.Getenv(common.ImporterRetryBackoff)); err == nil {
+		retryOptions.Backoff = backoff
+	}
+	if maxBackoff, err := time.ParseDuration(os.Getenv(common.ImporterRetryMaxBackoff)); err == nil {
+		retryOptions.MaxBackoff = maxBackoff
+	}
+	importer.SetRetryOptions(retryOptions)
+	var extraHeaders []string
+	for i := 0; ; i++ {
+		header, ok := os.LookupEnv(common.ImporterExtraHeader + strconv.Itoa(i))
+		if !ok {
+			break
+		}
+		extraHeaders = append(extraHeaders, header)
+	}
 
 	//Registry import currently support kubevirt content type only
 	if contentType != string(cdiv1.DataVolumeKubeVirt) && source == controller.SourceRegistry {
@@ -80,6 +122,7 @@ func main() {
 
 	dataDir := common.ImporterDataDir
 	availableDestSpace := util.GetAvailableSpaceByVolumeMode(volumeMode)
+	result := &util.ImportResult{Message: "Import Complete"}
 	if source == controller.SourceNone && contentType == string(cdiv1.DataVolumeKubeVirt) {
 		requestImageSizeQuantity := resource.MustParse(imageSize)
 		minSizeQuantity := util.MinQuantity(resource.NewScaledQuantity(availableDestSpace, 0), &requestImageSizeQuantity)
@@ -90,72 +133,146 @@ func main() {
 		err := image.CreateBlankImage(common.ImporterWritePath, minSizeQuantity)
 		if err != nil {
 			klog.Errorf("%+v", err)
-			err = util.WriteTerminationMessage(fmt.Sprintf("Unable to create blank image: %+v", err))
-			if err != nil {
-				klog.Errorf("%+v", err)
-			}
-			os.Exit(1)
+			exitWithError(1, "Unable to create blank image: %+v", err)
 		}
 	} else if source == controller.SourceNone && contentType == string(cdiv1.DataVolumeArchive) {
 		klog.Errorf("%+v", errors.New("Cannot create empty disk with content type archive"))
-		err = util.WriteTerminationMessage("Cannot create empty disk with content type archive")
-		if err != nil {
-			klog.Errorf("%+v", err)
-		}
-		os.Exit(1)
+		exitWithError(1, "Cannot create empty disk with content type archive")
 	} else {
 		klog.V(1).Infoln("begin import process")
 		var dp importer.DataSourceInterface
 		switch source {
 		case controller.SourceHTTP:
-			dp, err = importer.NewHTTPDataSource(ep, acc, sec, certDir, cdiv1.DataVolumeContentType(contentType))
+			// The secret extra headers are mounted, so they never show up in the environment of the pod
+			var secretExtraHeaders []string
+			secretExtraHeaders, err = importer.ReadSecretExtraHeaders(common.ImporterSecretExtraHeadersDir)
+			if err == nil {
+				dp, err = importer.NewHTTPDataSource(ep, acc, sec, cdiv1.DataVolumeContentType(contentType), importer.HTTPOptions{
+					CertDir:            certDir,
+					ClientCertDir:      clientCertDir,
+					Checksum:           checksum,
+					DiskPath:           diskPath,
+					Connections:        httpConnections,
+					ExtraHeaders:       extraHeaders,
+					SecretExtraHeaders: secretExtraHeaders,
+				})
+			}
 			if err != nil {
 				klog.Errorf("%+v", err)
-				err = util.WriteTerminationMessage(fmt.Sprintf("Unable to connect to http data source: %+v", err))
-				if err != nil {
-					klog.Errorf("%+v", err)
-				}
-				os.Exit(1)
+				exitWithError(1, "Unable to connect to http data source: %+v", err)
 			}
 		case controller.SourceRegistry:
-			dp = importer.NewRegistryDataSource(ep, acc, sec, certDir, insecureTLS)
-		case controller.SourceS3:
-			dp, err = importer.NewS3DataSource(ep, acc, sec)
+			dp, err = importer.NewRegistryDataSource(ep, acc, sec, importer.RegistryOptions{
+				CertDir:       certDir,
+				ClientCertDir: clientCertDir,
+				InsecureTLS:   insecureTLS,
+				Platform:      registryPlatform,
+				DiskPath:      diskPath,
+			})
 			if err != nil {
 				klog.Errorf("%+v", err)
-				err = util.WriteTerminationMessage(fmt.Sprintf("Unable to connect to s3 data source: %+v", err))
-				if err != nil {
-					klog.Errorf("%+v", err)
+				if errors.Cause(err) == importer.ErrAmbiguousDiskImage {
+					// Importing again will not fix an ambiguous disk path
+					exitWithError(common.NonRetriableErrorExitCode, "Unable to connect to registry data source: %v", err)
 				}
-				os.Exit(1)
+				exitWithError(1, "Unable to connect to registry data source: %+v", err)
 			}
-		default:
-			klog.Errorf("Unknown source type %s\n", source)
-			err = util.WriteTerminationMessage(fmt.Sprintf("Unknown data source: %s", source))
+		case controller.SourceS3:
+			dp, err = importer.NewS3DataSource(ep, acc, sec, checksum, diskPath, importer.S3Options{
+				Endpoint:             s3Endpoint,
+				Region:               s3Region,
+				AddressingStyle:      cdiv1.S3AddressingStyle(s3AddressingStyle),
+				Secure:               s3Secure,
+				CertDir:              certDir,
+				SessionToken:         sessionToken,
+				RoleARN:              s3RoleARN,
+				STSEndpoint:          s3STSEndpoint,
+				WebIdentityTokenFile: filepath.Join(common.ImporterS3TokenDir, common.ImporterS3TokenFile),
+			})
 			if err != nil {
 				klog.Errorf("%+v", err)
+				exitWithError(1, "Unable to connect to s3 data source: %+v", err)
 			}
-			os.Exit(1)
+		case controller.SourceGCS:
+			dp, err = importer.NewGCSDataSource(ep, checksum, diskPath, importer.GCSOptions{
+				Endpoint:        gcsEndpoint,
+				CredentialsFile: filepath.Join(common.ImporterGCSCredentialsDir, common.ImporterGCSCredentialsFile),
+			})
+			if err != nil {
+				klog.Errorf("%+v", err)
+				exitWithError(1, "Unable to connect to gcs data source: %+v", err)
+			}
+		case controller.SourceAzureBlob:
+			dp, err = importer.NewAzureBlobDataSource(ep, checksum, diskPath, importer.AzureBlobOptions{
+				Account:    azureAccount,
+				SASToken:   azureSASToken,
+				AccountKey: azureAccountKey,
+			})
+			if err != nil {
+				klog.Errorf("%+v", err)
+				exitWithError(1, "Unable to connect to azure blob data source: %+v", err)
+			}
+		case controller.SourceNBD:
+			dp, err = importer.NewNBDDataSource(ep, common.ImporterNBDTLSDir)
+			if err != nil {
+				klog.Errorf("%+v", err)
+				exitWithError(1, "Unable to connect to nbd data source: %+v", err)
+			}
+		case controller.SourceSFTP:
+			dp, err = importer.NewSFTPDataSource(ep, checksum, diskPath, importer.SFTPOptions{
+				HostKey:        sftpHostKey,
+				CredentialsDir: common.ImporterSFTPCredentialsDir,
+			})
+			if err != nil {
+				klog.Errorf("%+v", err)
+				exitWithError(1, "Unable to connect to sftp data source: %+v", err)
+			}
+		default:
+			klog.Errorf("Unknown source type %s\n", source)
+			exitWithError(1, "Unknown data source: %s", source)
 		}
 		defer dp.Close()
+		if rd, ok := dp.(*importer.RegistryDataSource); ok {
+			result.ImageDigest = rd.ImageDigest()
+		}
 		processor := importer.NewDataProcessor(dp, dest, dataDir, common.ScratchDataDir, imageSize)
 		err = processor.ProcessData()
+		result.Retries = importer.RetryCount()
 		if err != nil {
 			klog.Errorf("%+v", err)
 			if err == importer.ErrRequiresScratchSpace {
+				// The image digest is reported, so the import restarted with scratch space pulls the same image.
+				result.Message = "Scratch space required"
+				if err := util.WriteImportResult(result); err != nil {
+					klog.Errorf("%+v", err)
+				}
 				os.Exit(common.ScratchSpaceNeededExitCode)
 			}
-			err = util.WriteTerminationMessage(fmt.Sprintf("Unable to process data: %+v", err))
-			if err != nil {
-				klog.Errorf("%+v", err)
+			if errors.Cause(err) == importer.ErrChecksumMismatch || errors.Cause(err) == importer.ErrAmbiguousDiskImage {
+				// Importing again will not fix a checksum mismatch or an ambiguous disk path, so fail the import
+				// instead of restarting.
+				exitWithError(common.NonRetriableErrorExitCode, "Unable to process data: %v", err)
 			}
-			os.Exit(1)
+			exitWithError(1, "Unable to process data: %+v", err)
 		}
 	}
-	err = util.WriteTerminationMessage("Import Complete")
+	err = util.WriteImportResult(result)
 	if err != nil {
 		klog.Errorf("%+v", err)
 		os.Exit(1)
 	}
 	klog.V(1).Infoln("Import complete")
 }
+
+// exitWithError reports the failure of the import, along with the number of retries of the requests to the source, in
+// the termination message, and exits with the passed in exit code.
+func exitWithError(exitCode int, format string, args ...interface{}) {
+	result := &util.ImportResult{
+		Message: fmt.Sprintf(format, args...),
+		Retries: importer.RetryCount(),
+	}
+	if err := util.WriteImportResult(result); err != nil {
+		klog.Errorf("%+v", err)
+	}
+	os.Exit(exitCode)
+}
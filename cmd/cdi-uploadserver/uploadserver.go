@@ -57,6 +57,7 @@ func main() {
 		os.Getenv("CLIENT_CERT"),
 		os.Getenv("CLIENT_NAME"),
 		os.Getenv(common.UploadImageSize),
+		os.Getenv(common.UploadChecksum),
 	)
 
 	klog.Infof("Upload destination: %s", destination)
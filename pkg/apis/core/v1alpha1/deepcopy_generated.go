@@ -23,6 +23,7 @@ package v1alpha1
 import (
 	conditionsv1 "github.com/openshift/custom-resource-status/conditions/v1"
 	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
@@ -133,6 +134,21 @@ func (in *CDIConfigSpec) DeepCopyInto(out *CDIConfigSpec) {
 		*out = new(v1.ResourceRequirements)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.HTTPConnections != nil {
+		in, out := &in.HTTPConnections, &out.HTTPConnections
+		*out = new(int32)
+		**out = **in
+	}
+	if in.ImportProxy != nil {
+		in, out := &in.ImportProxy, &out.ImportProxy
+		*out = new(ImportProxy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ImportRetry != nil {
+		in, out := &in.ImportRetry, &out.ImportRetry
+		*out = new(ImportRetry)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -159,6 +175,11 @@ func (in *CDIConfigStatus) DeepCopyInto(out *CDIConfigStatus) {
 		*out = new(v1.ResourceRequirements)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.ImportProxy != nil {
+		in, out := &in.ImportProxy, &out.ImportProxy
+		*out = new(ImportProxy)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -332,17 +353,37 @@ func (in *DataVolumeSource) DeepCopyInto(out *DataVolumeSource) {
 	if in.HTTP != nil {
 		in, out := &in.HTTP, &out.HTTP
 		*out = new(DataVolumeSourceHTTP)
-		**out = **in
+		(*in).DeepCopyInto(*out)
 	}
 	if in.S3 != nil {
 		in, out := &in.S3, &out.S3
 		*out = new(DataVolumeSourceS3)
 		**out = **in
 	}
+	if in.GCS != nil {
+		in, out := &in.GCS, &out.GCS
+		*out = new(DataVolumeSourceGCS)
+		**out = **in
+	}
+	if in.AzureBlob != nil {
+		in, out := &in.AzureBlob, &out.AzureBlob
+		*out = new(DataVolumeSourceAzureBlob)
+		**out = **in
+	}
+	if in.NBD != nil {
+		in, out := &in.NBD, &out.NBD
+		*out = new(DataVolumeSourceNBD)
+		**out = **in
+	}
+	if in.SFTP != nil {
+		in, out := &in.SFTP, &out.SFTP
+		*out = new(DataVolumeSourceSFTP)
+		**out = **in
+	}
 	if in.Registry != nil {
 		in, out := &in.Registry, &out.Registry
 		*out = new(DataVolumeSourceRegistry)
-		**out = **in
+		(*in).DeepCopyInto(*out)
 	}
 	if in.PVC != nil {
 		in, out := &in.PVC, &out.PVC
@@ -372,9 +413,51 @@ func (in *DataVolumeSource) DeepCopy() *DataVolumeSource {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DataVolumeSourceAzureBlob) DeepCopyInto(out *DataVolumeSourceAzureBlob) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DataVolumeSourceAzureBlob.
+func (in *DataVolumeSourceAzureBlob) DeepCopy() *DataVolumeSourceAzureBlob {
+	if in == nil {
+		return nil
+	}
+	out := new(DataVolumeSourceAzureBlob)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DataVolumeSourceGCS) DeepCopyInto(out *DataVolumeSourceGCS) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DataVolumeSourceGCS.
+func (in *DataVolumeSourceGCS) DeepCopy() *DataVolumeSourceGCS {
+	if in == nil {
+		return nil
+	}
+	out := new(DataVolumeSourceGCS)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *DataVolumeSourceHTTP) DeepCopyInto(out *DataVolumeSourceHTTP) {
 	*out = *in
+	if in.ExtraHeaders != nil {
+		in, out := &in.ExtraHeaders, &out.ExtraHeaders
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.SecretExtraHeaders != nil {
+		in, out := &in.SecretExtraHeaders, &out.SecretExtraHeaders
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 	return
 }
 
@@ -388,6 +471,22 @@ func (in *DataVolumeSourceHTTP) DeepCopy() *DataVolumeSourceHTTP {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DataVolumeSourceNBD) DeepCopyInto(out *DataVolumeSourceNBD) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DataVolumeSourceNBD.
+func (in *DataVolumeSourceNBD) DeepCopy() *DataVolumeSourceNBD {
+	if in == nil {
+		return nil
+	}
+	out := new(DataVolumeSourceNBD)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *DataVolumeSourcePVC) DeepCopyInto(out *DataVolumeSourcePVC) {
 	*out = *in
@@ -407,6 +506,11 @@ func (in *DataVolumeSourcePVC) DeepCopy() *DataVolumeSourcePVC {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *DataVolumeSourceRegistry) DeepCopyInto(out *DataVolumeSourceRegistry) {
 	*out = *in
+	if in.Platform != nil {
+		in, out := &in.Platform, &out.Platform
+		*out = new(ImagePlatform)
+		**out = **in
+	}
 	return
 }
 
@@ -436,6 +540,22 @@ func (in *DataVolumeSourceS3) DeepCopy() *DataVolumeSourceS3 {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DataVolumeSourceSFTP) DeepCopyInto(out *DataVolumeSourceSFTP) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DataVolumeSourceSFTP.
+func (in *DataVolumeSourceSFTP) DeepCopy() *DataVolumeSourceSFTP {
+	if in == nil {
+		return nil
+	}
+	out := new(DataVolumeSourceSFTP)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *DataVolumeSourceUpload) DeepCopyInto(out *DataVolumeSourceUpload) {
 	*out = *in
@@ -489,3 +609,91 @@ func (in *DataVolumeStatus) DeepCopy() *DataVolumeStatus {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ImagePlatform) DeepCopyInto(out *ImagePlatform) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ImagePlatform.
+func (in *ImagePlatform) DeepCopy() *ImagePlatform {
+	if in == nil {
+		return nil
+	}
+	out := new(ImagePlatform)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ImportProxy) DeepCopyInto(out *ImportProxy) {
+	*out = *in
+	if in.HTTPProxy != nil {
+		in, out := &in.HTTPProxy, &out.HTTPProxy
+		*out = new(string)
+		**out = **in
+	}
+	if in.HTTPSProxy != nil {
+		in, out := &in.HTTPSProxy, &out.HTTPSProxy
+		*out = new(string)
+		**out = **in
+	}
+	if in.NoProxy != nil {
+		in, out := &in.NoProxy, &out.NoProxy
+		*out = new(string)
+		**out = **in
+	}
+	if in.CredentialsSecret != nil {
+		in, out := &in.CredentialsSecret, &out.CredentialsSecret
+		*out = new(string)
+		**out = **in
+	}
+	if in.TrustedCAProxy != nil {
+		in, out := &in.TrustedCAProxy, &out.TrustedCAProxy
+		*out = new(string)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ImportProxy.
+func (in *ImportProxy) DeepCopy() *ImportProxy {
+	if in == nil {
+		return nil
+	}
+	out := new(ImportProxy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ImportRetry) DeepCopyInto(out *ImportRetry) {
+	*out = *in
+	if in.Retries != nil {
+		in, out := &in.Retries, &out.Retries
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Backoff != nil {
+		in, out := &in.Backoff, &out.Backoff
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.MaxBackoff != nil {
+		in, out := &in.MaxBackoff, &out.MaxBackoff
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ImportRetry.
+func (in *ImportRetry) DeepCopy() *ImportRetry {
+	if in == nil {
+		return nil
+	}
+	out := new(ImportRetry)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -58,14 +58,18 @@ const (
 	DataVolumeArchive DataVolumeContentType = "archive"
 )
 
-// DataVolumeSource represents the source for our Data Volume, this can be HTTP, S3, Registry or an existing PVC
+// DataVolumeSource represents the source for our Data Volume, this can be HTTP, S3, GCS, Azure Blob, NBD, SFTP, Registry or an existing PVC
 type DataVolumeSource struct {
-	HTTP     *DataVolumeSourceHTTP     `json:"http,omitempty"`
-	S3       *DataVolumeSourceS3       `json:"s3,omitempty"`
-	Registry *DataVolumeSourceRegistry `json:"registry,omitempty"`
-	PVC      *DataVolumeSourcePVC      `json:"pvc,omitempty"`
-	Upload   *DataVolumeSourceUpload   `json:"upload,omitempty"`
-	Blank    *DataVolumeBlankImage     `json:"blank,omitempty"`
+	HTTP      *DataVolumeSourceHTTP      `json:"http,omitempty"`
+	S3        *DataVolumeSourceS3        `json:"s3,omitempty"`
+	GCS       *DataVolumeSourceGCS       `json:"gcs,omitempty"`
+	AzureBlob *DataVolumeSourceAzureBlob `json:"azureBlob,omitempty"`
+	NBD       *DataVolumeSourceNBD       `json:"nbd,omitempty"`
+	SFTP      *DataVolumeSourceSFTP      `json:"sftp,omitempty"`
+	Registry  *DataVolumeSourceRegistry  `json:"registry,omitempty"`
+	PVC       *DataVolumeSourcePVC       `json:"pvc,omitempty"`
+	Upload    *DataVolumeSourceUpload    `json:"upload,omitempty"`
+	Blank     *DataVolumeBlankImage      `json:"blank,omitempty"`
 }
 
 // DataVolumeSourcePVC provides the parameters to create a Data Volume from an existing PVC
@@ -79,6 +83,8 @@ type DataVolumeBlankImage struct{}
 
 // DataVolumeSourceUpload provides the parameters to create a Data Volume by uploading the source
 type DataVolumeSourceUpload struct {
+	//Checksum is the expected checksum of the uploaded data, in the form <algorithm>:<hex digest>, supported algorithms are md5, sha256 and sha512
+	Checksum string `json:"checksum,omitempty"`
 	//Target string `json:"shouldUpload,omitempty"`
 }
 
@@ -88,6 +94,92 @@ type DataVolumeSourceS3 struct {
 	URL string `json:"url,omitempty"`
 	//SecretRef provides the secret reference needed to access the S3 source
 	SecretRef string `json:"secretRef,omitempty"`
+	//Checksum is the expected checksum of the S3 source, in the form <algorithm>:<hex digest>, supported algorithms are md5, sha256 and sha512
+	Checksum string `json:"checksum,omitempty"`
+	//DiskPath is the path of the disk image in the tar archive, if the S3 source is a tar archive that contains more than one file
+	DiskPath string `json:"diskPath,omitempty"`
+	//Endpoint is the host and optional port of an S3 compatible object store, like MinIO or Ceph RGW, defaults to s3.amazonaws.com
+	Endpoint string `json:"endpoint,omitempty"`
+	//Region is the region of the bucket, it is discovered from the endpoint if not set
+	Region string `json:"region,omitempty"`
+	//AddressingStyle is how the bucket is addressed, either path or virtual-host, it is selected from the endpoint if not set
+	AddressingStyle S3AddressingStyle `json:"addressingStyle,omitempty"`
+	//Secure connects to the endpoint with TLS
+	Secure bool `json:"secure,omitempty"`
+	//CertConfigMap provides a reference to the certs of the CAs that signed the certificate of the endpoint
+	CertConfigMap string `json:"certConfigMap,omitempty"`
+	//RoleARN is the role assumed with the service account token of the importer pod, to get temporary credentials instead of the ones in the secret
+	RoleARN string `json:"roleARN,omitempty"`
+	//STSEndpoint is the URL of the STS service the role is assumed with, defaults to https://sts.amazonaws.com
+	STSEndpoint string `json:"stsEndpoint,omitempty"`
+}
+
+// S3AddressingStyle is how the bucket of an S3 source is addressed
+type S3AddressingStyle string
+
+const (
+	// S3AddressingPath addresses the bucket in the path of the request, like https://<endpoint>/<bucket>/<object>
+	S3AddressingPath S3AddressingStyle = "path"
+	// S3AddressingVirtualHost addresses the bucket in the host of the request, like https://<bucket>.<endpoint>/<object>
+	S3AddressingVirtualHost S3AddressingStyle = "virtual-host"
+)
+
+// DataVolumeSourceGCS provides the parameters to create a Data Volume from a Google Cloud Storage source
+type DataVolumeSourceGCS struct {
+	//URL is the url of the GCS object, like gs://<bucket>/<object>
+	URL string `json:"url,omitempty"`
+	//SecretRef provides the secret reference containing the service account key needed to access the GCS source, the object is read anonymously if not set
+	SecretRef string `json:"secretRef,omitempty"`
+	//Checksum is the expected checksum of the GCS source, in the form <algorithm>:<hex digest>, supported algorithms are md5, sha256 and sha512
+	Checksum string `json:"checksum,omitempty"`
+	//DiskPath is the path of the disk image in the tar archive, if the GCS source is a tar archive that contains more than one file
+	DiskPath string `json:"diskPath,omitempty"`
+	//Endpoint is the URL of a GCS compatible service, defaults to https://storage.googleapis.com
+	Endpoint string `json:"endpoint,omitempty"`
+}
+
+// DataVolumeSourceAzureBlob provides the parameters to create a Data Volume from an Azure Blob Storage source
+type DataVolumeSourceAzureBlob struct {
+	//Account is the name of the storage account
+	Account string `json:"account,omitempty"`
+	//Container is the name of the container of the blob
+	Container string `json:"container,omitempty"`
+	//Blob is the name of the blob
+	Blob string `json:"blob,omitempty"`
+	//SecretRef provides the secret reference containing the SAS token or the shared key needed to access the blob, the blob is read anonymously if not set
+	SecretRef string `json:"secretRef,omitempty"`
+	//Checksum is the expected checksum of the blob, in the form <algorithm>:<hex digest>, supported algorithms are md5, sha256 and sha512
+	Checksum string `json:"checksum,omitempty"`
+	//DiskPath is the path of the disk image in the tar archive, if the blob is a tar archive that contains more than one file
+	DiskPath string `json:"diskPath,omitempty"`
+	//Endpoint is the URL of the blob service of the account, like the one of Azurite, defaults to https://<account>.blob.core.windows.net
+	Endpoint string `json:"endpoint,omitempty"`
+}
+
+// DataVolumeSourceNBD provides the parameters to create a Data Volume from the export of a network block device server
+type DataVolumeSourceNBD struct {
+	//Host is the host name or IP address of the NBD server
+	Host string `json:"host,omitempty"`
+	//Port is the port of the NBD server, defaults to 10809
+	Port int32 `json:"port,omitempty"`
+	//ExportName is the name of the export, defaults to the default export of the server
+	ExportName string `json:"exportName,omitempty"`
+	//SecretRef provides the secret reference containing the TLS credentials of the NBD server, either a PSK file or CA certificates
+	SecretRef string `json:"secretRef,omitempty"`
+}
+
+// DataVolumeSourceSFTP provides the parameters to create a Data Volume from a file of an SFTP server
+type DataVolumeSourceSFTP struct {
+	//URL is the url of the file, like sftp://<host>:<port>/<path>, a path starting with /~/ is relative to the home directory of the user
+	URL string `json:"url,omitempty"`
+	//HostKey is the public key the server has to present, in the authorized_keys format, like ssh-ed25519 AAAA...
+	HostKey string `json:"hostKey,omitempty"`
+	//SecretRef provides the secret reference containing the credentials of the user, an optional username and either a password or a privateKey
+	SecretRef string `json:"secretRef,omitempty"`
+	//Checksum is the expected checksum of the SFTP source, in the form <algorithm>:<hex digest>, supported algorithms are md5, sha256 and sha512
+	Checksum string `json:"checksum,omitempty"`
+	//DiskPath is the path of the disk image in the tar archive, if the SFTP source is a tar archive that contains more than one file
+	DiskPath string `json:"diskPath,omitempty"`
 }
 
 // DataVolumeSourceRegistry provides the parameters to create a Data Volume from an registry source
@@ -98,6 +190,22 @@ type DataVolumeSourceRegistry struct {
 	SecretRef string `json:"secretRef,omitempty"`
 	//CertConfigMap provides a reference to the Registry certs
 	CertConfigMap string `json:"certConfigMap,omitempty"`
+	//ClientCertSecret is the name of a secret of type kubernetes.io/tls with the client certificate and key presented to the registry
+	ClientCertSecret string `json:"clientCertSecret,omitempty"`
+	//Platform selects the image of a multi-arch image, the platform of the node the importer runs on is used by default
+	Platform *ImagePlatform `json:"platform,omitempty"`
+	//DiskPath is the path of the disk image in the image, or a pattern like disk/*.qcow2 that has to match a single file, the file in the disk directory is used by default
+	DiskPath string `json:"diskPath,omitempty"`
+}
+
+// ImagePlatform is the platform the image of a manifest list or OCI index is selected for
+type ImagePlatform struct {
+	//OS is the operating system of the image, like linux
+	OS string `json:"os,omitempty"`
+	//Architecture is the cpu architecture of the image, like amd64 or arm64
+	Architecture string `json:"architecture,omitempty"`
+	//Variant is the variant of the cpu architecture, like v7 for arm, any variant is used if it is empty
+	Variant string `json:"variant,omitempty"`
 }
 
 // DataVolumeSourceHTTP provides the parameters to create a Data Volume from an HTTP source
@@ -108,6 +216,18 @@ type DataVolumeSourceHTTP struct {
 	SecretRef string `json:"secretRef,omitempty"`
 	//CertConfigMap provides a reference to the Registry certs
 	CertConfigMap string `json:"certConfigMap,omitempty"`
+	//ClientCertSecret is the name of a secret of type kubernetes.io/tls with the client certificate and key presented to the http source
+	ClientCertSecret string `json:"clientCertSecret,omitempty"`
+	//Checksum is the expected checksum of the http source, in the form <algorithm>:<hex digest>, supported algorithms are md5, sha256 and sha512
+	Checksum string `json:"checksum,omitempty"`
+	//Connections is the number of connections used to download the http source in parallel, if the server supports range requests. Defaults to the CDIConfig setting
+	Connections int32 `json:"connections,omitempty"`
+	//DiskPath is the path of the disk image in the tar archive, if the http source is a tar archive that contains more than one file
+	DiskPath string `json:"diskPath,omitempty"`
+	//ExtraHeaders is a list of extra headers to include with the requests to the http source, in the form <name>: <value>
+	ExtraHeaders []string `json:"extraHeaders,omitempty"`
+	//SecretExtraHeaders is a list of secrets with extra headers to include with the requests to the host of the http source. Each key of a secret holds a header in the form <name>: <value>, except the token key, which holds a bearer token
+	SecretExtraHeaders []string `json:"secretExtraHeaders,omitempty"`
 }
 
 // DataVolumeStatus provides the parameters to store the phase of the Data Volume
@@ -115,6 +235,10 @@ type DataVolumeStatus struct {
 	//Phase is the current phase of the data volume
 	Phase    DataVolumePhase    `json:"phase,omitempty"`
 	Progress DataVolumeProgress `json:"progress,omitempty"`
+	//ImageDigest is the digest of the image a registry source resolved to
+	ImageDigest string `json:"imageDigest,omitempty"`
+	//RetryCount is the number of times the importer retried a request to the source that failed with a transient error
+	RetryCount int32 `json:"retryCount,omitempty"`
 }
 
 //DataVolumeList provides the needed parameters to do request a list of Data Volumes from the system
@@ -275,6 +399,35 @@ type CDIConfigSpec struct {
 	UploadProxyURLOverride   *string                      `json:"uploadProxyURLOverride,omitempty"`
 	ScratchSpaceStorageClass *string                      `json:"scratchSpaceStorageClass,omitempty"`
 	PodResourceRequirements  *corev1.ResourceRequirements `json:"podResourceRequirements,omitempty"`
+	HTTPConnections          *int32                       `json:"httpConnections,omitempty"`
+	//ImportProxy is the proxy the importer pods reach the sources of imports through
+	ImportProxy *ImportProxy `json:"importProxy,omitempty"`
+	//ImportRetry is how the importer pods retry the requests to the sources of imports that fail with a transient error
+	ImportRetry *ImportRetry `json:"importRetry,omitempty"`
+}
+
+// ImportProxy provides the proxy settings of the importer pods
+type ImportProxy struct {
+	//HTTPProxy is the url of the proxy of http requests, like http://<host>:<port>
+	HTTPProxy *string `json:"httpProxy,omitempty"`
+	//HTTPSProxy is the url of the proxy of https requests, like http://<host>:<port>
+	HTTPSProxy *string `json:"httpsProxy,omitempty"`
+	//NoProxy is a comma separated list of hosts, domains and CIDRs that are reached without the proxy
+	NoProxy *string `json:"noProxy,omitempty"`
+	//CredentialsSecret is the name of a Secret in the CDI namespace with the username and password of the proxy
+	CredentialsSecret *string `json:"credentialsSecret,omitempty"`
+	//TrustedCAProxy is the name of a ConfigMap in the CDI namespace with the certificates of the CAs the importer pods trust in addition to the system CAs, like the CA of a proxy that intercepts TLS. It is copied to the namespace of an importer pod
+	TrustedCAProxy *string `json:"trustedCAProxy,omitempty"`
+}
+
+// ImportRetry provides the retry settings of the importer pods
+type ImportRetry struct {
+	//Retries is the number of times a request is retried, 0 disables the retries. Defaults to 5
+	Retries *int32 `json:"retries,omitempty"`
+	//Backoff is the delay before the first retry of a request, it doubles with every retry. Defaults to 1s
+	Backoff *metav1.Duration `json:"backoff,omitempty"`
+	//MaxBackoff is the longest delay between two retries of a request. Defaults to 1m
+	MaxBackoff *metav1.Duration `json:"maxBackoff,omitempty"`
 }
 
 //CDIConfigStatus provides
@@ -282,6 +435,9 @@ type CDIConfigStatus struct {
 	UploadProxyURL                 *string                      `json:"uploadProxyURL,omitempty"`
 	ScratchSpaceStorageClass       string                       `json:"scratchSpaceStorageClass,omitempty"`
 	DefaultPodResourceRequirements *corev1.ResourceRequirements `json:"defaultPodResourceRequirements,omitempty"`
+	HTTPConnections                int32                        `json:"httpConnections,omitempty"`
+	//ImportProxy is the proxy of the importer pods, the importProxy of the spec without the credentials in its urls
+	ImportProxy *ImportProxy `json:"importProxy,omitempty"`
 }
 
 //CDIConfigList provides the needed parameters to do request a list of CDIConfigs from the system
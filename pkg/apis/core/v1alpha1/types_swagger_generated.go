@@ -19,7 +19,7 @@ func (DataVolumeSpec) SwaggerDoc() map[string]string {
 
 func (DataVolumeSource) SwaggerDoc() map[string]string {
 	return map[string]string{
-		"": "DataVolumeSource represents the source for our Data Volume, this can be HTTP, S3, Registry or an existing PVC",
+		"": "DataVolumeSource represents the source for our Data Volume, this can be HTTP, S3, GCS, Azure Blob, NBD, SFTP, Registry or an existing PVC",
 	}
 }
 
@@ -37,40 +37,115 @@ func (DataVolumeBlankImage) SwaggerDoc() map[string]string {
 
 func (DataVolumeSourceUpload) SwaggerDoc() map[string]string {
 	return map[string]string{
-		"": "DataVolumeSourceUpload provides the parameters to create a Data Volume by uploading the source",
+		"":         "DataVolumeSourceUpload provides the parameters to create a Data Volume by uploading the source",
+		"checksum": "Checksum is the expected checksum of the uploaded data, in the form <algorithm>:<hex digest>, supported algorithms are md5, sha256 and sha512",
 	}
 }
 
 func (DataVolumeSourceS3) SwaggerDoc() map[string]string {
 	return map[string]string{
-		"":          "DataVolumeSourceS3 provides the parameters to create a Data Volume from an S3 source",
-		"url":       "URL is the url of the S3 source",
-		"secretRef": "SecretRef provides the secret reference needed to access the S3 source",
+		"":                "DataVolumeSourceS3 provides the parameters to create a Data Volume from an S3 source",
+		"url":             "URL is the url of the S3 source",
+		"secretRef":       "SecretRef provides the secret reference needed to access the S3 source",
+		"checksum":        "Checksum is the expected checksum of the S3 source, in the form <algorithm>:<hex digest>, supported algorithms are md5, sha256 and sha512",
+		"diskPath":        "DiskPath is the path of the disk image in the tar archive, if the S3 source is a tar archive that contains more than one file",
+		"endpoint":        "Endpoint is the host and optional port of an S3 compatible object store, like MinIO or Ceph RGW, defaults to s3.amazonaws.com",
+		"region":          "Region is the region of the bucket, it is discovered from the endpoint if not set",
+		"addressingStyle": "AddressingStyle is how the bucket is addressed, either path or virtual-host, it is selected from the endpoint if not set",
+		"secure":          "Secure connects to the endpoint with TLS",
+		"certConfigMap":   "CertConfigMap provides a reference to the certs of the CAs that signed the certificate of the endpoint",
+		"roleARN":         "RoleARN is the role assumed with the service account token of the importer pod, to get temporary credentials instead of the ones in the secret",
+		"stsEndpoint":     "STSEndpoint is the URL of the STS service the role is assumed with, defaults to https://sts.amazonaws.com",
+	}
+}
+
+func (DataVolumeSourceGCS) SwaggerDoc() map[string]string {
+	return map[string]string{
+		"":          "DataVolumeSourceGCS provides the parameters to create a Data Volume from a Google Cloud Storage source",
+		"url":       "URL is the url of the GCS object, like gs://<bucket>/<object>",
+		"secretRef": "SecretRef provides the secret reference containing the service account key needed to access the GCS source, the object is read anonymously if not set",
+		"checksum":  "Checksum is the expected checksum of the GCS source, in the form <algorithm>:<hex digest>, supported algorithms are md5, sha256 and sha512",
+		"diskPath":  "DiskPath is the path of the disk image in the tar archive, if the GCS source is a tar archive that contains more than one file",
+		"endpoint":  "Endpoint is the URL of a GCS compatible service, defaults to https://storage.googleapis.com",
+	}
+}
+
+func (DataVolumeSourceAzureBlob) SwaggerDoc() map[string]string {
+	return map[string]string{
+		"":          "DataVolumeSourceAzureBlob provides the parameters to create a Data Volume from an Azure Blob Storage source",
+		"account":   "Account is the name of the storage account",
+		"container": "Container is the name of the container of the blob",
+		"blob":      "Blob is the name of the blob",
+		"secretRef": "SecretRef provides the secret reference containing the SAS token or the shared key needed to access the blob, the blob is read anonymously if not set",
+		"checksum":  "Checksum is the expected checksum of the blob, in the form <algorithm>:<hex digest>, supported algorithms are md5, sha256 and sha512",
+		"diskPath":  "DiskPath is the path of the disk image in the tar archive, if the blob is a tar archive that contains more than one file",
+		"endpoint":  "Endpoint is the URL of the blob service of the account, like the one of Azurite, defaults to https://<account>.blob.core.windows.net",
+	}
+}
+
+func (DataVolumeSourceNBD) SwaggerDoc() map[string]string {
+	return map[string]string{
+		"":           "DataVolumeSourceNBD provides the parameters to create a Data Volume from the export of a network block device server",
+		"host":       "Host is the host name or IP address of the NBD server",
+		"port":       "Port is the port of the NBD server, defaults to 10809",
+		"exportName": "ExportName is the name of the export, defaults to the default export of the server",
+		"secretRef":  "SecretRef provides the secret reference containing the TLS credentials of the NBD server, either a PSK file or CA certificates",
+	}
+}
+
+func (DataVolumeSourceSFTP) SwaggerDoc() map[string]string {
+	return map[string]string{
+		"":          "DataVolumeSourceSFTP provides the parameters to create a Data Volume from a file of an SFTP server",
+		"url":       "URL is the url of the file, like sftp://<host>:<port>/<path>, a path starting with /~/ is relative to the home directory of the user",
+		"hostKey":   "HostKey is the public key the server has to present, in the authorized_keys format, like ssh-ed25519 AAAA...",
+		"secretRef": "SecretRef provides the secret reference containing the credentials of the user, an optional username and either a password or a privateKey",
+		"checksum":  "Checksum is the expected checksum of the SFTP source, in the form <algorithm>:<hex digest>, supported algorithms are md5, sha256 and sha512",
+		"diskPath":  "DiskPath is the path of the disk image in the tar archive, if the SFTP source is a tar archive that contains more than one file",
 	}
 }
 
 func (DataVolumeSourceRegistry) SwaggerDoc() map[string]string {
 	return map[string]string{
-		"":              "DataVolumeSourceRegistry provides the parameters to create a Data Volume from an registry source",
-		"url":           "URL is the url of the Registry source",
-		"secretRef":     "SecretRef provides the secret reference needed to access the Registry source",
-		"certConfigMap": "CertConfigMap provides a reference to the Registry certs",
+		"":                 "DataVolumeSourceRegistry provides the parameters to create a Data Volume from an registry source",
+		"url":              "URL is the url of the Registry source",
+		"secretRef":        "SecretRef provides the secret reference needed to access the Registry source",
+		"certConfigMap":    "CertConfigMap provides a reference to the Registry certs",
+		"clientCertSecret": "ClientCertSecret is the name of a secret of type kubernetes.io/tls with the client certificate and key presented to the registry",
+		"platform":         "Platform selects the image of a multi-arch image, the platform of the node the importer runs on is used by default",
+		"diskPath":         "DiskPath is the path of the disk image in the image, or a pattern like disk/*.qcow2 that has to match a single file, the file in the disk directory is used by default",
+	}
+}
+
+func (ImagePlatform) SwaggerDoc() map[string]string {
+	return map[string]string{
+		"":             "ImagePlatform is the platform the image of a manifest list or OCI index is selected for",
+		"os":           "OS is the operating system of the image, like linux",
+		"architecture": "Architecture is the cpu architecture of the image, like amd64 or arm64",
+		"variant":      "Variant is the variant of the cpu architecture, like v7 for arm, any variant is used if it is empty",
 	}
 }
 
 func (DataVolumeSourceHTTP) SwaggerDoc() map[string]string {
 	return map[string]string{
-		"":              "DataVolumeSourceHTTP provides the parameters to create a Data Volume from an HTTP source",
-		"url":           "URL is the URL of the http source",
-		"secretRef":     "SecretRef provides the secret reference needed to access the HTTP source",
-		"certConfigMap": "CertConfigMap provides a reference to the Registry certs",
+		"":                   "DataVolumeSourceHTTP provides the parameters to create a Data Volume from an HTTP source",
+		"url":                "URL is the URL of the http source",
+		"secretRef":          "SecretRef provides the secret reference needed to access the HTTP source",
+		"certConfigMap":      "CertConfigMap provides a reference to the Registry certs",
+		"clientCertSecret":   "ClientCertSecret is the name of a secret of type kubernetes.io/tls with the client certificate and key presented to the http source",
+		"checksum":           "Checksum is the expected checksum of the http source, in the form <algorithm>:<hex digest>, supported algorithms are md5, sha256 and sha512",
+		"connections":        "Connections is the number of connections used to download the http source in parallel, if the server supports range requests. Defaults to the CDIConfig setting",
+		"diskPath":           "DiskPath is the path of the disk image in the tar archive, if the http source is a tar archive that contains more than one file",
+		"extraHeaders":       "ExtraHeaders is a list of extra headers to include with the requests to the http source, in the form <name>: <value>",
+		"secretExtraHeaders": "SecretExtraHeaders is a list of secrets with extra headers to include with the requests to the host of the http source. Each key of a secret holds a header in the form <name>: <value>, except the token key, which holds a bearer token",
 	}
 }
 
 func (DataVolumeStatus) SwaggerDoc() map[string]string {
 	return map[string]string{
-		"":      "DataVolumeStatus provides the parameters to store the phase of the Data Volume",
-		"phase": "Phase is the current phase of the data volume",
+		"":            "DataVolumeStatus provides the parameters to store the phase of the Data Volume",
+		"phase":       "Phase is the current phase of the data volume",
+		"imageDigest": "ImageDigest is the digest of the image a registry source resolved to",
+		"retryCount":  "RetryCount is the number of times the importer retried a request to the source that failed with a transient error",
 	}
 }
 
@@ -114,13 +189,36 @@ func (CDIConfig) SwaggerDoc() map[string]string {
 
 func (CDIConfigSpec) SwaggerDoc() map[string]string {
 	return map[string]string{
-		"": "CDIConfigSpec defines specification for user configuration",
+		"":            "CDIConfigSpec defines specification for user configuration",
+		"importProxy": "ImportProxy is the proxy the importer pods reach the sources of imports through",
+		"importRetry": "ImportRetry is how the importer pods retry the requests to the sources of imports that fail with a transient error",
+	}
+}
+
+func (ImportProxy) SwaggerDoc() map[string]string {
+	return map[string]string{
+		"":                  "ImportProxy provides the proxy settings of the importer pods",
+		"httpProxy":         "HTTPProxy is the url of the proxy of http requests, like http://<host>:<port>",
+		"httpsProxy":        "HTTPSProxy is the url of the proxy of https requests, like http://<host>:<port>",
+		"noProxy":           "NoProxy is a comma separated list of hosts, domains and CIDRs that are reached without the proxy",
+		"credentialsSecret": "CredentialsSecret is the name of a Secret in the CDI namespace with the username and password of the proxy",
+		"trustedCAProxy":    "TrustedCAProxy is the name of a ConfigMap in the CDI namespace with the certificates of the CAs the importer pods trust in addition to the system CAs, like the CA of a proxy that intercepts TLS. It is copied to the namespace of an importer pod",
+	}
+}
+
+func (ImportRetry) SwaggerDoc() map[string]string {
+	return map[string]string{
+		"":           "ImportRetry provides the retry settings of the importer pods",
+		"retries":    "Retries is the number of times a request is retried, 0 disables the retries. Defaults to 5",
+		"backoff":    "Backoff is the delay before the first retry of a request, it doubles with every retry. Defaults to 1s",
+		"maxBackoff": "MaxBackoff is the longest delay between two retries of a request. Defaults to 1m",
 	}
 }
 
 func (CDIConfigStatus) SwaggerDoc() map[string]string {
 	return map[string]string{
-		"": "CDIConfigStatus provides",
+		"":            "CDIConfigStatus provides",
+		"importProxy": "ImportProxy is the proxy of the importer pods, the importProxy of the spec without the credentials in its urls",
 	}
 }
 
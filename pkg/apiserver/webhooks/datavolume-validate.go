@@ -22,26 +22,46 @@ package webhooks
 import (
 	"encoding/json"
 	"fmt"
+	"net"
 	"net/url"
+	"path"
 	"reflect"
+	"regexp"
+	"strings"
 
+	"golang.org/x/net/http/httpguts"
 	"k8s.io/api/admission/v1beta1"
 	v1 "k8s.io/api/core/v1"
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
 	k8sfield "k8s.io/apimachinery/pkg/util/validation/field"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/klog"
 
 	cdicorev1alpha1 "kubevirt.io/containerized-data-importer/pkg/apis/core/v1alpha1"
 	"kubevirt.io/containerized-data-importer/pkg/controller"
+	"kubevirt.io/containerized-data-importer/pkg/util"
+)
+
+var (
+	// azureAccountRegexp matches the names of Azure storage accounts
+	azureAccountRegexp = regexp.MustCompile(`^[a-z0-9]{3,24}$`)
+	// azureContainerRegexp matches the names of Azure blob containers, their length is checked separately
+	azureContainerRegexp = regexp.MustCompile(`^(\$root|\$web|[a-z0-9](-?[a-z0-9])*)$`)
+	// imageNameRegexp matches the names of images with an optional registry and tag
+	imageNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9._:/-]*[a-zA-Z0-9_])?$`)
+	// imageDigestRegexp matches the digests images can be referenced by
+	imageDigestRegexp = regexp.MustCompile(`^sha256:[a-f0-9]{64}$`)
+	// imagePlatformRegexp matches the os, architecture and variant of the platform of an image
+	imagePlatformRegexp = regexp.MustCompile(`^[a-z0-9_.-]*$`)
 )
 
 type dataVolumeValidatingWebhook struct {
 	client kubernetes.Interface
 }
 
-func validateSourceURL(sourceURL string) string {
+func validateSourceURL(sourceURL string, schemes ...string) string {
 	if sourceURL == "" {
 		return "source URL is empty"
 	}
@@ -49,10 +69,176 @@ func validateSourceURL(sourceURL string) string {
 	if err != nil {
 		return fmt.Sprintf("Invalid source URL: %s", sourceURL)
 	}
-	if url.Scheme != "http" && url.Scheme != "https" {
-		return fmt.Sprintf("Invalid source URL scheme: %s", sourceURL)
+	for _, scheme := range schemes {
+		if url.Scheme == scheme {
+			return ""
+		}
+	}
+	return fmt.Sprintf("Invalid source URL scheme: %s", sourceURL)
+}
+
+func validateAzureBlobSource(field *k8sfield.Path, source *cdicorev1alpha1.DataVolumeSourceAzureBlob) *metav1.StatusCause {
+	invalid := func(child, message string) *metav1.StatusCause {
+		return &metav1.StatusCause{
+			Type:    metav1.CauseTypeFieldValueInvalid,
+			Message: fmt.Sprintf("%s %s", field.Child(child).String(), message),
+			Field:   field.Child(child).String(),
+		}
+	}
+	if !azureAccountRegexp.MatchString(source.Account) {
+		return invalid("account", "must be 3 to 24 lowercase letters and numbers")
+	}
+	if len(source.Container) < 3 || len(source.Container) > 63 || !azureContainerRegexp.MatchString(source.Container) {
+		return invalid("container", "must be 3 to 63 lowercase letters, numbers and single hyphens, starting and ending with a letter or number")
+	}
+	if source.Blob == "" || len(source.Blob) > 1024 {
+		return invalid("blob", "must be 1 to 1024 characters")
+	}
+	if source.Endpoint != "" {
+		if err := validateSourceURL(source.Endpoint, "http", "https"); err != "" {
+			return invalid("endpoint", err)
+		}
+	}
+	return nil
+}
+
+func validateNBDSource(field *k8sfield.Path, source *cdicorev1alpha1.DataVolumeSourceNBD) *metav1.StatusCause {
+	invalid := func(child, message string) *metav1.StatusCause {
+		return &metav1.StatusCause{
+			Type:    metav1.CauseTypeFieldValueInvalid,
+			Message: fmt.Sprintf("%s %s", field.Child(child).String(), message),
+			Field:   field.Child(child).String(),
+		}
+	}
+	if source.Host == "" {
+		return invalid("host", "is empty")
+	}
+	if u, err := url.Parse("nbd://" + net.JoinHostPort(source.Host, "0")); err != nil || u.Hostname() != source.Host {
+		return invalid("host", "must be a host name or IP address")
+	}
+	if source.Port < 0 || source.Port > 65535 {
+		return invalid("port", "must be between 1 and 65535")
+	}
+	return nil
+}
+
+func validateSFTPSource(field *k8sfield.Path, source *cdicorev1alpha1.DataVolumeSourceSFTP) *metav1.StatusCause {
+	invalid := func(child, message string) *metav1.StatusCause {
+		return &metav1.StatusCause{
+			Type:    metav1.CauseTypeFieldValueInvalid,
+			Message: fmt.Sprintf("%s %s", field.Child(child).String(), message),
+			Field:   field.Child(child).String(),
+		}
+	}
+	// The scheme of the url is checked with the urls of the other sources
+	u, _ := url.Parse(source.URL)
+	if u.Hostname() == "" || strings.HasPrefix(u.Hostname(), "-") {
+		return invalid("url", "must have a host name or IP address")
+	}
+	if strings.Trim(u.Path, "/") == "" {
+		return invalid("url", "must have the path of a file")
+	}
+	if source.HostKey == "" {
+		return invalid("hostKey", "is empty")
+	}
+	if _, err := util.ParseSSHPublicKey(source.HostKey); err != nil {
+		return invalid("hostKey", err.Error())
+	}
+	if source.SecretRef == "" {
+		return invalid("secretRef", "is empty")
 	}
-	return ""
+	return nil
+}
+
+func validateHTTPSource(field *k8sfield.Path, source *cdicorev1alpha1.DataVolumeSourceHTTP) *metav1.StatusCause {
+	invalid := func(child *k8sfield.Path, message string) *metav1.StatusCause {
+		return &metav1.StatusCause{
+			Type:    metav1.CauseTypeFieldValueInvalid,
+			Message: fmt.Sprintf("%s %s", child.String(), message),
+			Field:   child.String(),
+		}
+	}
+	if source.Connections < 0 {
+		return invalid(field.Child("connections"), "cannot be negative")
+	}
+	for i, header := range source.ExtraHeaders {
+		parts := strings.SplitN(header, ":", 2)
+		if len(parts) != 2 || !httpguts.ValidHeaderFieldName(strings.TrimSpace(parts[0])) {
+			return invalid(field.Child("extraHeaders").Index(i), "must be a header in the form <name>: <value>")
+		}
+		if !httpguts.ValidHeaderFieldValue(strings.TrimSpace(parts[1])) {
+			return invalid(field.Child("extraHeaders").Index(i), "has an invalid value")
+		}
+	}
+	if cause := validateClientCertSecret(field, source.ClientCertSecret); cause != nil {
+		return cause
+	}
+	for i, secretName := range source.SecretExtraHeaders {
+		if errs := validation.IsDNS1123Subdomain(secretName); len(errs) > 0 {
+			return invalid(field.Child("secretExtraHeaders").Index(i), "must be the name of a secret: "+strings.Join(errs, ", "))
+		}
+	}
+	return nil
+}
+
+func validateClientCertSecret(field *k8sfield.Path, secretName string) *metav1.StatusCause {
+	if secretName == "" {
+		return nil
+	}
+	if errs := validation.IsDNS1123Subdomain(secretName); len(errs) > 0 {
+		return &metav1.StatusCause{
+			Type:    metav1.CauseTypeFieldValueInvalid,
+			Message: fmt.Sprintf("%s must be the name of a secret: %s", field.Child("clientCertSecret").String(), strings.Join(errs, ", ")),
+			Field:   field.Child("clientCertSecret").String(),
+		}
+	}
+	return nil
+}
+
+func validateRegistrySource(field *k8sfield.Path, source *cdicorev1alpha1.DataVolumeSourceRegistry) *metav1.StatusCause {
+	invalid := func(child, message string) *metav1.StatusCause {
+		return &metav1.StatusCause{
+			Type:    metav1.CauseTypeFieldValueInvalid,
+			Message: fmt.Sprintf("%s %s", field.Child(child).String(), message),
+			Field:   field.Child(child).String(),
+		}
+	}
+	if !strings.HasPrefix(source.URL, "docker://") {
+		return invalid("url", "must start with docker://")
+	}
+	name := strings.TrimPrefix(source.URL, "docker://")
+	digest := ""
+	if i := strings.Index(name, "@"); i >= 0 {
+		name, digest = name[:i], name[i+1:]
+		if !imageDigestRegexp.MatchString(digest) {
+			return invalid("url", "must have a digest like sha256:<64 lowercase hex digits>")
+		}
+	}
+	if !imageNameRegexp.MatchString(name) {
+		return invalid("url", "must have the name of an image, like docker://<registry>/<repository>:<tag>")
+	}
+	if _, err := path.Match(source.DiskPath, ""); err != nil {
+		return invalid("diskPath", "is not a valid pattern")
+	}
+	if cause := validateClientCertSecret(field, source.ClientCertSecret); cause != nil {
+		return cause
+	}
+	if source.Platform != nil {
+		field = field.Child("platform")
+		if !imagePlatformRegexp.MatchString(source.Platform.OS) {
+			return invalid("os", "must be lowercase letters, numbers, '_', '.' and '-'")
+		}
+		if !imagePlatformRegexp.MatchString(source.Platform.Architecture) {
+			return invalid("architecture", "must be lowercase letters, numbers, '_', '.' and '-'")
+		}
+		if !imagePlatformRegexp.MatchString(source.Platform.Variant) {
+			return invalid("variant", "must be lowercase letters, numbers, '_', '.' and '-'")
+		}
+		if source.Platform.Variant != "" && source.Platform.Architecture == "" {
+			return invalid("variant", "requires an architecture")
+		}
+	}
+	return nil
 }
 
 func validateDataVolumeName(name string) []metav1.StatusCause {
@@ -97,15 +283,26 @@ func (wh *dataVolumeValidatingWebhook) validateDataVolumeSpec(request *v1beta1.A
 		return causes
 	}
 	// if source types are HTTP or S3, check if URL is valid
-	if spec.Source.HTTP != nil || spec.Source.S3 != nil {
+	if spec.Source.HTTP != nil || spec.Source.S3 != nil || spec.Source.GCS != nil || spec.Source.SFTP != nil {
+		schemes := []string{"http", "https"}
 		if spec.Source.HTTP != nil {
 			url = spec.Source.HTTP.URL
 			sourceType = field.Child("source", "HTTP", "url").String()
 		} else if spec.Source.S3 != nil {
 			url = spec.Source.S3.URL
 			sourceType = field.Child("source", "S3", "url").String()
+			// The host of an S3 URL is the bucket, the scheme does not matter
+			schemes = append(schemes, "s3")
+		} else if spec.Source.GCS != nil {
+			url = spec.Source.GCS.URL
+			sourceType = field.Child("source", "GCS", "url").String()
+			schemes = []string{"gs"}
+		} else if spec.Source.SFTP != nil {
+			url = spec.Source.SFTP.URL
+			sourceType = field.Child("source", "SFTP", "url").String()
+			schemes = []string{"sftp"}
 		}
-		err := validateSourceURL(url)
+		err := validateSourceURL(url, schemes...)
 		if err != "" {
 			causes = append(causes, metav1.StatusCause{
 				Type:    metav1.CauseTypeFieldValueInvalid,
@@ -116,6 +313,121 @@ func (wh *dataVolumeValidatingWebhook) validateDataVolumeSpec(request *v1beta1.A
 		}
 	}
 
+	var checksum string
+	switch {
+	case spec.Source.HTTP != nil:
+		checksum = spec.Source.HTTP.Checksum
+		sourceType = field.Child("source", "HTTP", "checksum").String()
+	case spec.Source.S3 != nil:
+		checksum = spec.Source.S3.Checksum
+		sourceType = field.Child("source", "S3", "checksum").String()
+	case spec.Source.GCS != nil:
+		checksum = spec.Source.GCS.Checksum
+		sourceType = field.Child("source", "GCS", "checksum").String()
+	case spec.Source.AzureBlob != nil:
+		checksum = spec.Source.AzureBlob.Checksum
+		sourceType = field.Child("source", "AzureBlob", "checksum").String()
+	case spec.Source.SFTP != nil:
+		checksum = spec.Source.SFTP.Checksum
+		sourceType = field.Child("source", "SFTP", "checksum").String()
+	case spec.Source.Upload != nil:
+		checksum = spec.Source.Upload.Checksum
+		sourceType = field.Child("source", "Upload", "checksum").String()
+	}
+	if _, err := util.ParseChecksum(checksum); err != nil {
+		causes = append(causes, metav1.StatusCause{
+			Type:    metav1.CauseTypeFieldValueInvalid,
+			Message: fmt.Sprintf("%s %s", sourceType, err.Error()),
+			Field:   sourceType,
+		})
+		return causes
+	}
+
+	if spec.Source.S3 != nil {
+		switch spec.Source.S3.AddressingStyle {
+		case "", cdicorev1alpha1.S3AddressingPath, cdicorev1alpha1.S3AddressingVirtualHost:
+		default:
+			causes = append(causes, metav1.StatusCause{
+				Type:    metav1.CauseTypeFieldValueInvalid,
+				Message: fmt.Sprintf("%s not one of: %s, %s", field.Child("source", "S3", "addressingStyle").String(), cdicorev1alpha1.S3AddressingPath, cdicorev1alpha1.S3AddressingVirtualHost),
+				Field:   field.Child("source", "S3", "addressingStyle").String(),
+			})
+			return causes
+		}
+		if spec.Source.S3.STSEndpoint != "" {
+			if spec.Source.S3.RoleARN == "" {
+				causes = append(causes, metav1.StatusCause{
+					Type:    metav1.CauseTypeFieldValueInvalid,
+					Message: fmt.Sprintf("%s requires %s", field.Child("source", "S3", "stsEndpoint").String(), field.Child("source", "S3", "roleARN").String()),
+					Field:   field.Child("source", "S3", "stsEndpoint").String(),
+				})
+				return causes
+			}
+			if err := validateSourceURL(spec.Source.S3.STSEndpoint, "http", "https"); err != "" {
+				causes = append(causes, metav1.StatusCause{
+					Type:    metav1.CauseTypeFieldValueInvalid,
+					Message: fmt.Sprintf("%s %s", field.Child("source", "S3", "stsEndpoint").String(), err),
+					Field:   field.Child("source", "S3", "stsEndpoint").String(),
+				})
+				return causes
+			}
+		}
+		if spec.Source.S3.CertConfigMap != "" && !spec.Source.S3.Secure {
+			causes = append(causes, metav1.StatusCause{
+				Type:    metav1.CauseTypeFieldValueInvalid,
+				Message: fmt.Sprintf("%s requires %s", field.Child("source", "S3", "certConfigMap").String(), field.Child("source", "S3", "secure").String()),
+				Field:   field.Child("source", "S3", "certConfigMap").String(),
+			})
+			return causes
+		}
+	}
+
+	if spec.Source.GCS != nil && spec.Source.GCS.Endpoint != "" {
+		if err := validateSourceURL(spec.Source.GCS.Endpoint, "http", "https"); err != "" {
+			causes = append(causes, metav1.StatusCause{
+				Type:    metav1.CauseTypeFieldValueInvalid,
+				Message: fmt.Sprintf("%s %s", field.Child("source", "GCS", "endpoint").String(), err),
+				Field:   field.Child("source", "GCS", "endpoint").String(),
+			})
+			return causes
+		}
+	}
+
+	if spec.Source.AzureBlob != nil {
+		if cause := validateAzureBlobSource(field.Child("source", "AzureBlob"), spec.Source.AzureBlob); cause != nil {
+			causes = append(causes, *cause)
+			return causes
+		}
+	}
+
+	if spec.Source.NBD != nil {
+		if cause := validateNBDSource(field.Child("source", "NBD"), spec.Source.NBD); cause != nil {
+			causes = append(causes, *cause)
+			return causes
+		}
+	}
+
+	if spec.Source.SFTP != nil {
+		if cause := validateSFTPSource(field.Child("source", "SFTP"), spec.Source.SFTP); cause != nil {
+			causes = append(causes, *cause)
+			return causes
+		}
+	}
+
+	if spec.Source.Registry != nil {
+		if cause := validateRegistrySource(field.Child("source", "Registry"), spec.Source.Registry); cause != nil {
+			causes = append(causes, *cause)
+			return causes
+		}
+	}
+
+	if spec.Source.HTTP != nil {
+		if cause := validateHTTPSource(field.Child("source", "HTTP"), spec.Source.HTTP); cause != nil {
+			causes = append(causes, *cause)
+			return causes
+		}
+	}
+
 	// Make sure contentType is either empty (kubevirt), or kubevirt or archive
 	if spec.ContentType != "" && string(spec.ContentType) != string(cdicorev1alpha1.DataVolumeKubeVirt) && string(spec.ContentType) != string(cdicorev1alpha1.DataVolumeArchive) {
 		sourceType = field.Child("contentType").String()
@@ -27,6 +27,7 @@ import (
 	"net/http/httptest"
 
 	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
 	. "github.com/onsi/gomega"
 
 	"k8s.io/api/admission/v1beta1"
@@ -38,6 +39,10 @@ import (
 	cdicorev1alpha1 "kubevirt.io/containerized-data-importer/pkg/apis/core/v1alpha1"
 )
 
+const testImageDigest = "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+const testSFTPHostKey = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIKVno3ZtsMKI5aSg0ao8jhBt8VU3nT6fg05nEY4E+a89"
+
 var _ = Describe("Validating Webhook", func() {
 	Context("with DataVolume admission review", func() {
 		It("should accept DataVolume with HTTP source on create", func() {
@@ -185,6 +190,370 @@ var _ = Describe("Validating Webhook", func() {
 			resp := validateDVs(ar)
 			Expect(resp.Allowed).To(Equal(false))
 		})
+		It("should accept DataVolume with a valid checksum on create", func() {
+			dataVolume := newHTTPDataVolume("testDV", "http://www.example.com")
+			dataVolume.Spec.Source.HTTP.Checksum = "sha256:2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+			dvBytes, _ := json.Marshal(&dataVolume)
+
+			ar := &v1beta1.AdmissionReview{
+				Request: &v1beta1.AdmissionRequest{
+					Resource: metav1.GroupVersionResource{
+						Group:    cdicorev1alpha1.SchemeGroupVersion.Group,
+						Version:  cdicorev1alpha1.SchemeGroupVersion.Version,
+						Resource: "datavolumes",
+					},
+					Object: runtime.RawExtension{
+						Raw: dvBytes,
+					},
+				},
+			}
+
+			resp := validateDVs(ar)
+			Expect(resp.Allowed).To(Equal(true))
+		})
+
+		It("should reject DataVolume with an invalid checksum on create", func() {
+			dataVolume := newHTTPDataVolume("testDV", "http://www.example.com")
+			dataVolume.Spec.Source.HTTP.Checksum = "sha1:2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c"
+			dvBytes, _ := json.Marshal(&dataVolume)
+
+			ar := &v1beta1.AdmissionReview{
+				Request: &v1beta1.AdmissionRequest{
+					Resource: metav1.GroupVersionResource{
+						Group:    cdicorev1alpha1.SchemeGroupVersion.Group,
+						Version:  cdicorev1alpha1.SchemeGroupVersion.Version,
+						Resource: "datavolumes",
+					},
+					Object: runtime.RawExtension{
+						Raw: dvBytes,
+					},
+				},
+			}
+
+			resp := validateDVs(ar)
+			Expect(resp.Allowed).To(Equal(false))
+		})
+
+		It("should reject DataVolume with negative http connections on create", func() {
+			dataVolume := newHTTPDataVolume("testDV", "http://www.example.com")
+			dataVolume.Spec.Source.HTTP.Connections = -1
+			dvBytes, _ := json.Marshal(&dataVolume)
+
+			ar := &v1beta1.AdmissionReview{
+				Request: &v1beta1.AdmissionRequest{
+					Resource: metav1.GroupVersionResource{
+						Group:    cdicorev1alpha1.SchemeGroupVersion.Group,
+						Version:  cdicorev1alpha1.SchemeGroupVersion.Version,
+						Resource: "datavolumes",
+					},
+					Object: runtime.RawExtension{
+						Raw: dvBytes,
+					},
+				},
+			}
+
+			resp := validateDVs(ar)
+			Expect(resp.Allowed).To(Equal(false))
+		})
+
+		table.DescribeTable("should validate the extra headers of the HTTP source on create", func(extraHeaders, secretExtraHeaders []string, allowed bool) {
+			dataVolume := newHTTPDataVolume("testDV", "http://www.example.com")
+			dataVolume.Spec.Source.HTTP.ExtraHeaders = extraHeaders
+			dataVolume.Spec.Source.HTTP.SecretExtraHeaders = secretExtraHeaders
+			dvBytes, _ := json.Marshal(&dataVolume)
+
+			ar := &v1beta1.AdmissionReview{
+				Request: &v1beta1.AdmissionRequest{
+					Resource: metav1.GroupVersionResource{
+						Group:    cdicorev1alpha1.SchemeGroupVersion.Group,
+						Version:  cdicorev1alpha1.SchemeGroupVersion.Version,
+						Resource: "datavolumes",
+					},
+					Object: runtime.RawExtension{
+						Raw: dvBytes,
+					},
+				},
+			}
+
+			resp := validateDVs(ar)
+			Expect(resp.Allowed).To(Equal(allowed))
+		},
+			table.Entry("accept headers and secrets", []string{"Accept: application/octet-stream", "X-Request-Id:1"}, []string{"artifactory-token"}, true),
+			table.Entry("accept an empty header value", []string{"X-Empty:"}, nil, true),
+			table.Entry("reject a header without a value", []string{"Accept"}, nil, false),
+			table.Entry("reject an invalid header name", []string{"Bad Header: value"}, nil, false),
+			table.Entry("reject a header value with a newline", []string{"Accept: text/plain\r\nX-Injected: value"}, nil, false),
+			table.Entry("reject an empty secret name", nil, []string{""}, false),
+			table.Entry("reject an invalid secret name", nil, []string{"Artifactory_Token"}, false),
+		)
+
+		table.DescribeTable("should validate the client certificate secret on create", func(source cdicorev1alpha1.DataVolumeSource, allowed bool) {
+			dataVolume := newDataVolume("testDV", source, newPVCSpec(5, "M"))
+			dvBytes, _ := json.Marshal(&dataVolume)
+
+			ar := &v1beta1.AdmissionReview{
+				Request: &v1beta1.AdmissionRequest{
+					Resource: metav1.GroupVersionResource{
+						Group:    cdicorev1alpha1.SchemeGroupVersion.Group,
+						Version:  cdicorev1alpha1.SchemeGroupVersion.Version,
+						Resource: "datavolumes",
+					},
+					Object: runtime.RawExtension{
+						Raw: dvBytes,
+					},
+				},
+			}
+
+			resp := validateDVs(ar)
+			Expect(resp.Allowed).To(Equal(allowed))
+		},
+			table.Entry("accept a secret of an http source", cdicorev1alpha1.DataVolumeSource{HTTP: &cdicorev1alpha1.DataVolumeSourceHTTP{URL: "https://www.example.com/disk.img", ClientCertSecret: "client-cert"}}, true),
+			table.Entry("reject an invalid secret of an http source", cdicorev1alpha1.DataVolumeSource{HTTP: &cdicorev1alpha1.DataVolumeSourceHTTP{URL: "https://www.example.com/disk.img", ClientCertSecret: "Client Cert"}}, false),
+			table.Entry("accept a secret of a registry source", cdicorev1alpha1.DataVolumeSource{Registry: &cdicorev1alpha1.DataVolumeSourceRegistry{URL: "docker://registry:5000/image", ClientCertSecret: "client-cert"}}, true),
+			table.Entry("reject an invalid secret of a registry source", cdicorev1alpha1.DataVolumeSource{Registry: &cdicorev1alpha1.DataVolumeSourceRegistry{URL: "docker://registry:5000/image", ClientCertSecret: "client_cert"}}, false),
+		)
+
+		table.DescribeTable("should validate the S3 source on create", func(source *cdicorev1alpha1.DataVolumeSourceS3, allowed bool) {
+			dataVolume := newDataVolume("testDV", cdicorev1alpha1.DataVolumeSource{S3: source}, newPVCSpec(5, "M"))
+			dvBytes, _ := json.Marshal(&dataVolume)
+
+			ar := &v1beta1.AdmissionReview{
+				Request: &v1beta1.AdmissionRequest{
+					Resource: metav1.GroupVersionResource{
+						Group:    cdicorev1alpha1.SchemeGroupVersion.Group,
+						Version:  cdicorev1alpha1.SchemeGroupVersion.Version,
+						Resource: "datavolumes",
+					},
+					Object: runtime.RawExtension{
+						Raw: dvBytes,
+					},
+				},
+			}
+
+			resp := validateDVs(ar)
+			Expect(resp.Allowed).To(Equal(allowed))
+		},
+			table.Entry("accept an s3 URL", &cdicorev1alpha1.DataVolumeSourceS3{URL: "s3://bucket/disk.img"}, true),
+			table.Entry("accept an S3 compatible endpoint",
+				&cdicorev1alpha1.DataVolumeSourceS3{URL: "s3://bucket/disk.img", Endpoint: "minio.example.com:9000", AddressingStyle: cdicorev1alpha1.S3AddressingPath, Secure: true, CertConfigMap: "s3-certs"}, true),
+			table.Entry("reject an unknown addressing style", &cdicorev1alpha1.DataVolumeSourceS3{URL: "s3://bucket/disk.img", AddressingStyle: "dns"}, false),
+			table.Entry("reject a cert config map without TLS", &cdicorev1alpha1.DataVolumeSourceS3{URL: "s3://bucket/disk.img", CertConfigMap: "s3-certs"}, false),
+			table.Entry("reject an ftp URL", &cdicorev1alpha1.DataVolumeSourceS3{URL: "ftp://bucket/disk.img"}, false),
+			table.Entry("accept a pre-signed URL", &cdicorev1alpha1.DataVolumeSourceS3{URL: "https://bucket.s3.amazonaws.com/disk.img?X-Amz-Signature=abcdef"}, true),
+			table.Entry("accept a role with an STS endpoint",
+				&cdicorev1alpha1.DataVolumeSourceS3{URL: "s3://bucket/disk.img", RoleARN: "arn:aws:iam::123456789012:role/importer", STSEndpoint: "https://sts.eu-central-1.amazonaws.com"}, true),
+			table.Entry("reject an STS endpoint without a role", &cdicorev1alpha1.DataVolumeSourceS3{URL: "s3://bucket/disk.img", STSEndpoint: "https://sts.amazonaws.com"}, false),
+			table.Entry("reject an invalid STS endpoint",
+				&cdicorev1alpha1.DataVolumeSourceS3{URL: "s3://bucket/disk.img", RoleARN: "arn:aws:iam::123456789012:role/importer", STSEndpoint: "sts.amazonaws.com"}, false),
+		)
+
+		table.DescribeTable("should validate the GCS source on create", func(source *cdicorev1alpha1.DataVolumeSourceGCS, allowed bool) {
+			dataVolume := newDataVolume("testDV", cdicorev1alpha1.DataVolumeSource{GCS: source}, newPVCSpec(5, "M"))
+			dvBytes, _ := json.Marshal(&dataVolume)
+
+			ar := &v1beta1.AdmissionReview{
+				Request: &v1beta1.AdmissionRequest{
+					Resource: metav1.GroupVersionResource{
+						Group:    cdicorev1alpha1.SchemeGroupVersion.Group,
+						Version:  cdicorev1alpha1.SchemeGroupVersion.Version,
+						Resource: "datavolumes",
+					},
+					Object: runtime.RawExtension{
+						Raw: dvBytes,
+					},
+				},
+			}
+
+			resp := validateDVs(ar)
+			Expect(resp.Allowed).To(Equal(allowed))
+		},
+			table.Entry("accept a gs URL", &cdicorev1alpha1.DataVolumeSourceGCS{URL: "gs://bucket/images/disk.img", SecretRef: "gcs-secret"}, true),
+			table.Entry("accept a GCS compatible endpoint", &cdicorev1alpha1.DataVolumeSourceGCS{URL: "gs://bucket/disk.img", Endpoint: "http://fake-gcs-server:4443"}, true),
+			table.Entry("reject an https URL", &cdicorev1alpha1.DataVolumeSourceGCS{URL: "https://storage.googleapis.com/bucket/disk.img"}, false),
+			table.Entry("reject an empty URL", &cdicorev1alpha1.DataVolumeSourceGCS{}, false),
+			table.Entry("reject an invalid endpoint", &cdicorev1alpha1.DataVolumeSourceGCS{URL: "gs://bucket/disk.img", Endpoint: "storage.googleapis.com"}, false),
+			table.Entry("reject an invalid checksum", &cdicorev1alpha1.DataVolumeSourceGCS{URL: "gs://bucket/disk.img", Checksum: "crc32:abcdef"}, false),
+		)
+
+		table.DescribeTable("should validate the Azure Blob source on create", func(source *cdicorev1alpha1.DataVolumeSourceAzureBlob, allowed bool) {
+			dataVolume := newDataVolume("testDV", cdicorev1alpha1.DataVolumeSource{AzureBlob: source}, newPVCSpec(5, "M"))
+			dvBytes, _ := json.Marshal(&dataVolume)
+
+			ar := &v1beta1.AdmissionReview{
+				Request: &v1beta1.AdmissionRequest{
+					Resource: metav1.GroupVersionResource{
+						Group:    cdicorev1alpha1.SchemeGroupVersion.Group,
+						Version:  cdicorev1alpha1.SchemeGroupVersion.Version,
+						Resource: "datavolumes",
+					},
+					Object: runtime.RawExtension{
+						Raw: dvBytes,
+					},
+				},
+			}
+
+			resp := validateDVs(ar)
+			Expect(resp.Allowed).To(Equal(allowed))
+		},
+			table.Entry("accept a blob", &cdicorev1alpha1.DataVolumeSourceAzureBlob{Account: "images", Container: "vhds", Blob: "hyper-v/disk.vhd", SecretRef: "azure-secret"}, true),
+			table.Entry("accept the Azurite endpoint",
+				&cdicorev1alpha1.DataVolumeSourceAzureBlob{Account: "devstoreaccount1", Container: "vhds", Blob: "disk.vhd", Endpoint: "http://azurite:10000/devstoreaccount1"}, true),
+			table.Entry("accept the root container", &cdicorev1alpha1.DataVolumeSourceAzureBlob{Account: "images", Container: "$root", Blob: "disk.vhd"}, true),
+			table.Entry("reject a missing account", &cdicorev1alpha1.DataVolumeSourceAzureBlob{Container: "vhds", Blob: "disk.vhd"}, false),
+			table.Entry("reject an invalid account", &cdicorev1alpha1.DataVolumeSourceAzureBlob{Account: "Images", Container: "vhds", Blob: "disk.vhd"}, false),
+			table.Entry("reject an invalid container", &cdicorev1alpha1.DataVolumeSourceAzureBlob{Account: "images", Container: "hyper--v", Blob: "disk.vhd"}, false),
+			table.Entry("reject a short container", &cdicorev1alpha1.DataVolumeSourceAzureBlob{Account: "images", Container: "vh", Blob: "disk.vhd"}, false),
+			table.Entry("reject a missing blob", &cdicorev1alpha1.DataVolumeSourceAzureBlob{Account: "images", Container: "vhds"}, false),
+			table.Entry("reject an invalid endpoint", &cdicorev1alpha1.DataVolumeSourceAzureBlob{Account: "images", Container: "vhds", Blob: "disk.vhd", Endpoint: "azurite:10000"}, false),
+			table.Entry("reject an invalid checksum", &cdicorev1alpha1.DataVolumeSourceAzureBlob{Account: "images", Container: "vhds", Blob: "disk.vhd", Checksum: "crc32:abcdef"}, false),
+		)
+
+		table.DescribeTable("should validate the NBD source on create", func(source *cdicorev1alpha1.DataVolumeSourceNBD, allowed bool) {
+			dataVolume := newDataVolume("testDV", cdicorev1alpha1.DataVolumeSource{NBD: source}, newPVCSpec(5, "M"))
+			dvBytes, _ := json.Marshal(&dataVolume)
+
+			ar := &v1beta1.AdmissionReview{
+				Request: &v1beta1.AdmissionRequest{
+					Resource: metav1.GroupVersionResource{
+						Group:    cdicorev1alpha1.SchemeGroupVersion.Group,
+						Version:  cdicorev1alpha1.SchemeGroupVersion.Version,
+						Resource: "datavolumes",
+					},
+					Object: runtime.RawExtension{
+						Raw: dvBytes,
+					},
+				},
+			}
+
+			resp := validateDVs(ar)
+			Expect(resp.Allowed).To(Equal(allowed))
+		},
+			table.Entry("accept an export", &cdicorev1alpha1.DataVolumeSourceNBD{Host: "nbd-server", Port: 10809, ExportName: "disk", SecretRef: "nbd-psk"}, true),
+			table.Entry("accept the default export of an IPv6 server", &cdicorev1alpha1.DataVolumeSourceNBD{Host: "fd00::1"}, true),
+			table.Entry("reject an empty host", &cdicorev1alpha1.DataVolumeSourceNBD{ExportName: "disk"}, false),
+			table.Entry("reject an invalid host", &cdicorev1alpha1.DataVolumeSourceNBD{Host: "nbd-server/disk"}, false),
+			table.Entry("reject an invalid port", &cdicorev1alpha1.DataVolumeSourceNBD{Host: "nbd-server", Port: 65536}, false),
+		)
+
+		table.DescribeTable("should validate the SFTP source on create", func(source *cdicorev1alpha1.DataVolumeSourceSFTP, allowed bool) {
+			dataVolume := newDataVolume("testDV", cdicorev1alpha1.DataVolumeSource{SFTP: source}, newPVCSpec(5, "M"))
+			dvBytes, _ := json.Marshal(&dataVolume)
+
+			ar := &v1beta1.AdmissionReview{
+				Request: &v1beta1.AdmissionRequest{
+					Resource: metav1.GroupVersionResource{
+						Group:    cdicorev1alpha1.SchemeGroupVersion.Group,
+						Version:  cdicorev1alpha1.SchemeGroupVersion.Version,
+						Resource: "datavolumes",
+					},
+					Object: runtime.RawExtension{
+						Raw: dvBytes,
+					},
+				},
+			}
+
+			resp := validateDVs(ar)
+			Expect(resp.Allowed).To(Equal(allowed))
+		},
+			table.Entry("accept a file", &cdicorev1alpha1.DataVolumeSourceSFTP{URL: "sftp://importer@sftp-server:2222/images/disk.img", HostKey: testSFTPHostKey, SecretRef: "sftp-credentials"}, true),
+			table.Entry("accept a file relative to the home directory", &cdicorev1alpha1.DataVolumeSourceSFTP{URL: "sftp://sftp-server/~/disk.img", HostKey: testSFTPHostKey + " root@sftp-server", SecretRef: "sftp-credentials"}, true),
+			table.Entry("reject another scheme", &cdicorev1alpha1.DataVolumeSourceSFTP{URL: "scp://sftp-server/images/disk.img", HostKey: testSFTPHostKey, SecretRef: "sftp-credentials"}, false),
+			table.Entry("reject a host that is an option", &cdicorev1alpha1.DataVolumeSourceSFTP{URL: "sftp://-oProxyCommand=true/images/disk.img", HostKey: testSFTPHostKey, SecretRef: "sftp-credentials"}, false),
+			table.Entry("reject a url without a path", &cdicorev1alpha1.DataVolumeSourceSFTP{URL: "sftp://sftp-server/", HostKey: testSFTPHostKey, SecretRef: "sftp-credentials"}, false),
+			table.Entry("reject an empty host key", &cdicorev1alpha1.DataVolumeSourceSFTP{URL: "sftp://sftp-server/images/disk.img", SecretRef: "sftp-credentials"}, false),
+			table.Entry("reject an invalid host key", &cdicorev1alpha1.DataVolumeSourceSFTP{URL: "sftp://sftp-server/images/disk.img", HostKey: "ssh-ed25519 AAAA", SecretRef: "sftp-credentials"}, false),
+			table.Entry("reject an empty secret", &cdicorev1alpha1.DataVolumeSourceSFTP{URL: "sftp://sftp-server/images/disk.img", HostKey: testSFTPHostKey}, false),
+			table.Entry("reject an invalid checksum", &cdicorev1alpha1.DataVolumeSourceSFTP{URL: "sftp://sftp-server/images/disk.img", HostKey: testSFTPHostKey, SecretRef: "sftp-credentials", Checksum: "crc32:abcdef"}, false),
+		)
+
+		table.DescribeTable("should validate the Registry source on create", func(url string, allowed bool) {
+			dataVolume := newRegistryDataVolume("testDV", url)
+			dvBytes, _ := json.Marshal(&dataVolume)
+
+			ar := &v1beta1.AdmissionReview{
+				Request: &v1beta1.AdmissionRequest{
+					Resource: metav1.GroupVersionResource{
+						Group:    cdicorev1alpha1.SchemeGroupVersion.Group,
+						Version:  cdicorev1alpha1.SchemeGroupVersion.Version,
+						Resource: "datavolumes",
+					},
+					Object: runtime.RawExtension{
+						Raw: dvBytes,
+					},
+				},
+			}
+
+			resp := validateDVs(ar)
+			Expect(resp.Allowed).To(Equal(allowed))
+		},
+			table.Entry("accept an image of docker hub", "docker://fedora", true),
+			table.Entry("accept an image with a tag", "docker://registry:5000/vmdisks/fedora:31", true),
+			table.Entry("accept an image with a digest", "docker://quay.io/kubevirt/cirros@"+testImageDigest, true),
+			table.Entry("accept an image with a tag and a digest", "docker://quay.io/kubevirt/cirros:v1@"+testImageDigest, true),
+			table.Entry("reject another scheme", "http://registry:5000/test", false),
+			table.Entry("reject a url without an image", "docker://", false),
+			table.Entry("reject a digest without an image", "docker://@"+testImageDigest, false),
+			table.Entry("reject a digest of another algorithm", "docker://registry:5000/test@md5:5d41402abc4b2a76b9719d911017c592", false),
+			table.Entry("reject a truncated digest", "docker://registry:5000/test@sha256:0123456789abcdef", false),
+			table.Entry("reject an uppercase digest", "docker://registry:5000/test@sha256:0123456789ABCDEF0123456789abcdef0123456789abcdef0123456789abcdef", false),
+			table.Entry("reject an image name with spaces", "docker://registry:5000/my test", false),
+		)
+
+		table.DescribeTable("should validate the platform of the Registry source on create", func(platform *cdicorev1alpha1.ImagePlatform, allowed bool) {
+			dataVolume := newRegistryDataVolume("testDV", "docker://registry:5000/test")
+			dataVolume.Spec.Source.Registry.Platform = platform
+			dvBytes, _ := json.Marshal(&dataVolume)
+
+			ar := &v1beta1.AdmissionReview{
+				Request: &v1beta1.AdmissionRequest{
+					Resource: metav1.GroupVersionResource{
+						Group:    cdicorev1alpha1.SchemeGroupVersion.Group,
+						Version:  cdicorev1alpha1.SchemeGroupVersion.Version,
+						Resource: "datavolumes",
+					},
+					Object: runtime.RawExtension{
+						Raw: dvBytes,
+					},
+				},
+			}
+
+			resp := validateDVs(ar)
+			Expect(resp.Allowed).To(Equal(allowed))
+		},
+			table.Entry("accept an os and architecture", &cdicorev1alpha1.ImagePlatform{OS: "linux", Architecture: "arm64"}, true),
+			table.Entry("accept a variant", &cdicorev1alpha1.ImagePlatform{OS: "linux", Architecture: "arm", Variant: "v7"}, true),
+			table.Entry("accept an architecture only", &cdicorev1alpha1.ImagePlatform{Architecture: "ppc64le"}, true),
+			table.Entry("reject an os with a slash", &cdicorev1alpha1.ImagePlatform{OS: "linux/arm64"}, false),
+			table.Entry("reject an uppercase architecture", &cdicorev1alpha1.ImagePlatform{OS: "linux", Architecture: "AMD64"}, false),
+			table.Entry("reject a variant without an architecture", &cdicorev1alpha1.ImagePlatform{OS: "linux", Variant: "v8"}, false),
+		)
+
+		table.DescribeTable("should validate the disk path of the Registry source on create", func(diskPath string, allowed bool) {
+			dataVolume := newRegistryDataVolume("testDV", "docker://registry:5000/test")
+			dataVolume.Spec.Source.Registry.DiskPath = diskPath
+			dvBytes, _ := json.Marshal(&dataVolume)
+
+			ar := &v1beta1.AdmissionReview{
+				Request: &v1beta1.AdmissionRequest{
+					Resource: metav1.GroupVersionResource{
+						Group:    cdicorev1alpha1.SchemeGroupVersion.Group,
+						Version:  cdicorev1alpha1.SchemeGroupVersion.Version,
+						Resource: "datavolumes",
+					},
+					Object: runtime.RawExtension{
+						Raw: dvBytes,
+					},
+				},
+			}
+
+			resp := validateDVs(ar)
+			Expect(resp.Allowed).To(Equal(allowed))
+		},
+			table.Entry("accept a path", "disk/vendor.qcow2", true),
+			table.Entry("accept a pattern", "/disk/*.qcow2", true),
+			table.Entry("reject an invalid pattern", "disk/[a", false),
+		)
+
 		It("should reject DataVolume with multiple sources on create", func() {
 			dataVolume := newDataVolumeWithMultipleSources("testDV")
 			dvBytes, _ := json.Marshal(&dataVolume)
@@ -39,10 +39,42 @@ const (
 	ImporterDataDir = "/data"
 	// ScratchDataDir provides a constant for the controller pkg to use as a hardcoded path to where scratch space is located.
 	ScratchDataDir = "/scratch"
-	// ImporterS3Host provides an S3 string used by importer/dataStream.go only
+	// ImporterS3Host is the default host of the object store of an S3 source
 	ImporterS3Host = "s3.amazonaws.com"
 	// ImporterCertDir is where the configmap containing certs will be mounted
 	ImporterCertDir = "/certs"
+	// ImporterProxyCertDir is where the copy of the trusted CA configmap of the import proxy will be mounted
+	ImporterProxyCertDir = "/proxycerts"
+	// ImporterS3TokenDir is where the service account token used to assume the role of an S3 source will be mounted
+	ImporterS3TokenDir = "/var/run/secrets/cdi.kubevirt.io/s3"
+	// ImporterS3TokenFile is the name of the service account token in ImporterS3TokenDir
+	ImporterS3TokenFile = "token"
+	// S3TokenAudience is the audience of the service account token used to assume the role of an S3 source
+	S3TokenAudience = "sts.amazonaws.com"
+	// DefaultS3STSEndpoint is the STS service the role of an S3 source is assumed with, if not configured otherwise
+	DefaultS3STSEndpoint = "https://sts.amazonaws.com"
+	// ImporterGCSCredentialsDir is where the service account key of a GCS source will be mounted
+	ImporterGCSCredentialsDir = "/var/run/secrets/cdi.kubevirt.io/gcs"
+	// ImporterGCSCredentialsFile is the name of the service account key in ImporterGCSCredentialsDir
+	ImporterGCSCredentialsFile = "credentials.json"
+	// DefaultGCSEndpoint is the service a GCS source is imported from, if not configured otherwise
+	DefaultGCSEndpoint = "https://storage.googleapis.com"
+	// ImporterNBDTLSDir is where the TLS credentials of an NBD source will be mounted
+	ImporterNBDTLSDir = "/var/run/secrets/cdi.kubevirt.io/nbd"
+	// DefaultNBDPort is the port of the server of an NBD source, if not configured otherwise
+	DefaultNBDPort = 10809
+	// ImporterSFTPCredentialsDir is where the credentials of the user of an SFTP source will be mounted
+	ImporterSFTPCredentialsDir = "/var/run/secrets/cdi.kubevirt.io/sftp"
+	// ImporterClientCertDir is where the client certificate of an HTTP or registry source will be mounted
+	ImporterClientCertDir = "/var/run/secrets/cdi.kubevirt.io/client-cert"
+	// ImporterClientCertFile is the name of the client certificate in ImporterClientCertDir
+	ImporterClientCertFile = "tls.crt"
+	// ImporterClientKeyFile is the name of the private key of the client certificate in ImporterClientCertDir
+	ImporterClientKeyFile = "tls.key"
+	// ImporterSecretExtraHeadersDir is where the secrets of the extra headers of an HTTP source will be mounted, each in its own subdirectory
+	ImporterSecretExtraHeadersDir = "/var/run/secrets/cdi.kubevirt.io/extraheaders"
+	// DefaultAzureBlobHost is the domain of the blob service endpoints of the storage accounts of an Azure Blob source
+	DefaultAzureBlobHost = "blob.core.windows.net"
 	// DefaultPullPolicy imports k8s "IfNotPresent" string for the import_controller_gingko_test and the cdi-controller executable
 	DefaultPullPolicy = string(v1.PullIfNotPresent)
 
@@ -62,6 +94,56 @@ const (
 	ImporterImageSize = "IMPORTER_IMAGE_SIZE"
 	// ImporterCertDirVar provides a constant to capture our env variable "IMPORTER_CERT_DIR"
 	ImporterCertDirVar = "IMPORTER_CERT_DIR"
+	// ImporterClientCertDirVar provides a constant to capture our env variable "IMPORTER_CLIENT_CERT_DIR"
+	ImporterClientCertDirVar = "IMPORTER_CLIENT_CERT_DIR"
+	// ImporterChecksum provides a constant to capture our env variable "IMPORTER_CHECKSUM"
+	ImporterChecksum = "IMPORTER_CHECKSUM"
+	// ImporterHTTPConnections provides a constant to capture our env variable "IMPORTER_HTTP_CONNECTIONS"
+	ImporterHTTPConnections = "IMPORTER_HTTP_CONNECTIONS"
+	// ImporterRetries provides a constant to capture our env variable "IMPORTER_RETRIES"
+	ImporterRetries = "IMPORTER_RETRIES"
+	// ImporterRetryBackoff provides a constant to capture our env variable "IMPORTER_RETRY_BACKOFF"
+	ImporterRetryBackoff = "IMPORTER_RETRY_BACKOFF"
+	// ImporterRetryMaxBackoff provides a constant to capture our env variable "IMPORTER_RETRY_MAX_BACKOFF"
+	ImporterRetryMaxBackoff = "IMPORTER_RETRY_MAX_BACKOFF"
+	// ImporterDiskPath provides a constant to capture our env variable "IMPORTER_DISK_PATH"
+	ImporterDiskPath = "IMPORTER_DISK_PATH"
+	// ImporterS3Endpoint provides a constant to capture our env variable "IMPORTER_S3_ENDPOINT"
+	ImporterS3Endpoint = "IMPORTER_S3_ENDPOINT"
+	// ImporterS3Region provides a constant to capture our env variable "IMPORTER_S3_REGION"
+	ImporterS3Region = "IMPORTER_S3_REGION"
+	// ImporterS3AddressingStyle provides a constant to capture our env variable "IMPORTER_S3_ADDRESSING_STYLE"
+	ImporterS3AddressingStyle = "IMPORTER_S3_ADDRESSING_STYLE"
+	// ImporterS3Secure provides a constant to capture our env variable "IMPORTER_S3_SECURE"
+	ImporterS3Secure = "IMPORTER_S3_SECURE"
+	// ImporterS3RoleARN provides a constant to capture our env variable "IMPORTER_S3_ROLE_ARN"
+	ImporterS3RoleARN = "IMPORTER_S3_ROLE_ARN"
+	// ImporterS3STSEndpoint provides a constant to capture our env variable "IMPORTER_S3_STS_ENDPOINT"
+	ImporterS3STSEndpoint = "IMPORTER_S3_STS_ENDPOINT"
+	// ImporterGCSEndpoint provides a constant to capture our env variable "IMPORTER_GCS_ENDPOINT"
+	ImporterGCSEndpoint = "IMPORTER_GCS_ENDPOINT"
+	// ImporterSFTPHostKey provides a constant to capture our env variable "IMPORTER_SFTP_HOST_KEY"
+	ImporterSFTPHostKey = "IMPORTER_SFTP_HOST_KEY"
+	// ImporterExtraHeader provides a constant to capture our env variables "IMPORTER_EXTRA_HEADER_<index>"
+	ImporterExtraHeader = "IMPORTER_EXTRA_HEADER_"
+	// ImporterProxyCertDirVar provides a constant to capture our env variable "IMPORTER_PROXY_CERT_DIR"
+	ImporterProxyCertDirVar = "IMPORTER_PROXY_CERT_DIR"
+	// ImportProxyHTTP is the env variable of the proxy of http requests
+	ImportProxyHTTP = "HTTP_PROXY"
+	// ImportProxyHTTPS is the env variable of the proxy of https requests
+	ImportProxyHTTPS = "HTTPS_PROXY"
+	// ImportProxyNoProxy is the env variable of the hosts that are reached without the proxy
+	ImportProxyNoProxy = "NO_PROXY"
+	// ImporterRegistryPlatform provides a constant to capture our env variable "IMPORTER_REGISTRY_PLATFORM"
+	ImporterRegistryPlatform = "IMPORTER_REGISTRY_PLATFORM"
+	// ImporterAzureAccount provides a constant to capture our env variable "IMPORTER_AZURE_ACCOUNT"
+	ImporterAzureAccount = "IMPORTER_AZURE_ACCOUNT"
+	// ImporterAzureSASToken provides a constant to capture our env variable "IMPORTER_AZURE_SAS_TOKEN"
+	ImporterAzureSASToken = "IMPORTER_AZURE_SAS_TOKEN"
+	// ImporterAzureAccountKey provides a constant to capture our env variable "IMPORTER_AZURE_ACCOUNT_KEY"
+	ImporterAzureAccountKey = "IMPORTER_AZURE_ACCOUNT_KEY"
+	// ImporterSessionToken provides a constant to capture our env variable "IMPORTER_SESSION_TOKEN"
+	ImporterSessionToken = "IMPORTER_SESSION_TOKEN"
 	// InsecureTLSVar provides a constant to capture our env variable "INSECURE_TLS"
 	InsecureTLSVar = "INSECURE_TLS"
 
@@ -94,6 +176,8 @@ const (
 	UploadServerServiceLabel = "service"
 	// UploadImageSize provides a constant to capture our env variable "UPLOAD_IMAGE_SIZE"
 	UploadImageSize = "UPLOAD_IMAGE_SIZE"
+	// UploadChecksum provides a constant to capture our env variable "UPLOAD_CHECKSUM"
+	UploadChecksum = "UPLOAD_CHECKSUM"
 
 	// ConfigName is the name of default CDI Config
 	ConfigName = "config"
@@ -105,14 +189,44 @@ const (
 	KeyAccess = "accessKeyId"
 	// KeySecret provides a constant to the secretKey label using in controller pkg and transport_test.go
 	KeySecret = "secretKey"
+	// KeySessionToken provides a constant to the optional sessionToken label of the secret of an S3 source
+	KeySessionToken = "sessionToken"
+	// KeyServiceAccount provides a constant to the serviceAccount label of the secret of a GCS source, containing the JSON service account key
+	KeyServiceAccount = "serviceAccount"
+	// KeySASToken provides a constant to the optional sasToken label of the secret of an Azure Blob source
+	KeySASToken = "sasToken"
+	// KeyAccountKey provides a constant to the optional accountKey label of the secret of an Azure Blob source, containing the shared key of the storage account
+	KeyAccountKey = "accountKey"
+	// KeyUsername provides a constant to the optional username label of the secret of an SFTP source
+	KeyUsername = "username"
+	// KeyPassword provides a constant to the password label of the secret of an SFTP source
+	KeyPassword = "password"
+	// KeyPrivateKey provides a constant to the privateKey label of the secret of an SFTP source, containing an unencrypted private key
+	KeyPrivateKey = "privateKey"
+	// KeyHTTPProxy provides a constant to the httpProxy label of the secret with the proxy urls of an importer pod
+	KeyHTTPProxy = "httpProxy"
+	// KeyHTTPSProxy provides a constant to the httpsProxy label of the secret with the proxy urls of an importer pod
+	KeyHTTPSProxy = "httpsProxy"
 
 	// DefaultResyncPeriod sets a 10 minute resync period, used in the controller pkg and the controller cmd executable
 	DefaultResyncPeriod = 10 * time.Minute
+	// DefaultHTTPConnections is the number of connections used to download an http source, if not configured otherwise
+	DefaultHTTPConnections = 1
+	// DefaultImportRetries is the number of times the importer retries a request to a source that failed with a
+	// transient error, if not configured otherwise
+	DefaultImportRetries = 5
+	// DefaultImportRetryBackoff is the delay before the first retry of a request, if not configured otherwise
+	DefaultImportRetryBackoff = time.Second
+	// DefaultImportRetryMaxBackoff is the longest delay between two retries of a request, if not configured otherwise
+	DefaultImportRetryMaxBackoff = time.Minute
 	// InsecureRegistryConfigMap is the name of the ConfigMap for insecure registries
 	InsecureRegistryConfigMap = "cdi-insecure-registries"
 
 	// ScratchSpaceNeededExitCode is the exit code that indicates the importer pod requires scratch space to function properly.
 	ScratchSpaceNeededExitCode = 42
+	// NonRetriableErrorExitCode is the exit code that indicates the importer pod failed with an error that retrying
+	// will not fix, like a checksum mismatch. The import is marked as failed instead of restarting the pod.
+	NonRetriableErrorExitCode = 43
 
 	// UploadTokenIssuer is the JWT issuer of upload tokens
 	UploadTokenIssuer = "cdi-apiserver"
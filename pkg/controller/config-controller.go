@@ -4,6 +4,7 @@ import (
 	"context"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
+	"net/url"
 	"reflect"
 
 	routev1 "github.com/openshift/api/route/v1"
@@ -20,6 +21,7 @@ import (
 	kubernetes "k8s.io/client-go/kubernetes"
 	cdiv1 "kubevirt.io/containerized-data-importer/pkg/apis/core/v1alpha1"
 	cdiclientset "kubevirt.io/containerized-data-importer/pkg/client/clientset/versioned"
+	"kubevirt.io/containerized-data-importer/pkg/common"
 	"kubevirt.io/containerized-data-importer/pkg/operator"
 	"kubevirt.io/containerized-data-importer/pkg/util"
 
@@ -90,6 +92,9 @@ func (r *CDIConfigReconciler) Reconcile(req reconcile.Request) (reconcile.Result
 		return reconcile.Result{}, err
 	}
 
+	r.reconcileHTTPConnections(config)
+	r.reconcileImportProxy(config)
+
 	if !reflect.DeepEqual(currentConfigCopy, config) {
 		// Updates have happened, update CDIConfig.
 		log.Info("Updating CDIConfig", "CDIConfig.Name", config.Name, "config", config)
@@ -206,6 +211,36 @@ func (r *CDIConfigReconciler) reconcileDefaultPodResourceRequirements(config *cd
 	return nil
 }
 
+func (r *CDIConfigReconciler) reconcileHTTPConnections(config *cdiv1.CDIConfig) {
+	config.Status.HTTPConnections = common.DefaultHTTPConnections
+	if config.Spec.HTTPConnections != nil && *config.Spec.HTTPConnections > 0 {
+		config.Status.HTTPConnections = *config.Spec.HTTPConnections
+	}
+}
+
+func (r *CDIConfigReconciler) reconcileImportProxy(config *cdiv1.CDIConfig) {
+	config.Status.ImportProxy = nil
+	if config.Spec.ImportProxy != nil {
+		config.Status.ImportProxy = config.Spec.ImportProxy.DeepCopy()
+		config.Status.ImportProxy.HTTPProxy = stripURLCredentials(config.Status.ImportProxy.HTTPProxy)
+		config.Status.ImportProxy.HTTPSProxy = stripURLCredentials(config.Status.ImportProxy.HTTPSProxy)
+	}
+}
+
+// stripURLCredentials removes the user info of a url, the credentials of the proxy come from its CredentialsSecret
+func stripURLCredentials(rawURL *string) *string {
+	if rawURL == nil {
+		return nil
+	}
+	u, err := url.Parse(*rawURL)
+	if err != nil || u.User == nil {
+		return rawURL
+	}
+	u.User = nil
+	stripped := u.String()
+	return &stripped
+}
+
 // createCDIConfig creates a new instance of the CDIConfig object if it doesn't exist already, and returns the existing one if found.
 // It also sets the operator to be the owner of the CDIConfig object.
 func (r *CDIConfigReconciler) createCDIConfig() (*cdiv1.CDIConfig, error) {
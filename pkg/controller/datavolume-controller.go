@@ -21,7 +21,9 @@ import (
 	"crypto/tls"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"net/url"
 	"reflect"
 	"regexp"
 	"strconv"
@@ -274,7 +276,7 @@ func (r *DatavolumeReconciler) reconcileProgressUpdate(datavolume *cdiv1.DataVol
 	if datavolume.Status.Progress == "" {
 		datavolume.Status.Progress = "N/A"
 	}
-	if datavolume.Spec.Source.HTTP != nil {
+	if datavolume.Spec.Source.HTTP != nil || datavolume.Spec.Source.S3 != nil || datavolume.Spec.Source.GCS != nil || datavolume.Spec.Source.AzureBlob != nil || datavolume.Spec.Source.NBD != nil || datavolume.Spec.Source.SFTP != nil || datavolume.Spec.Source.Registry != nil {
 		podNamespace = datavolume.Namespace
 	} else if datavolume.Spec.Source.PVC != nil {
 		podNamespace = datavolume.Spec.Source.PVC.Namespace
@@ -455,6 +457,15 @@ func (r *DatavolumeReconciler) updateImportStatusPhase(pvc *corev1.PersistentVol
 			event.message = fmt.Sprintf(MessageImportSucceeded, pvc.Name)
 		}
 	}
+	if digest, ok := pvc.Annotations[AnnRegistryImageDigest]; ok {
+		dataVolumeCopy.Status.ImageDigest = digest
+	}
+	dataVolumeCopy.Status.RetryCount = 0
+	if value, ok := pvc.Annotations[AnnImportRetries]; ok {
+		if retries, err := strconv.ParseInt(value, 10, 32); err == nil {
+			dataVolumeCopy.Status.RetryCount = int32(retries)
+		}
+	}
 }
 
 func (r *DatavolumeReconciler) updateSmartCloneStatusPhase(phase cdiv1.DataVolumePhase, dataVolume *cdiv1.DataVolume) error {
@@ -728,6 +739,33 @@ func buildHTTPClient() *http.Client {
 // It also sets the appropriate OwnerReferences on the resource
 // which allows handleObject to discover the DataVolume resource
 // that 'owns' it.
+// azureBlobURL returns the URL of the blob of an Azure Blob source, in the blob service endpoint of its account.
+func azureBlobURL(source *cdiv1.DataVolumeSourceAzureBlob) string {
+	endpoint := source.Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://%s.%s", source.Account, common.DefaultAzureBlobHost)
+	}
+	segments := strings.Split(source.Blob, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.TrimSuffix(endpoint, "/") + "/" + url.PathEscape(source.Container) + "/" + strings.Join(segments, "/")
+}
+
+// nbdURL returns the url of the export of an NBD source, like nbd://<host>:<port>/<export>.
+func nbdURL(source *cdiv1.DataVolumeSourceNBD) string {
+	port := source.Port
+	if port == 0 {
+		port = common.DefaultNBDPort
+	}
+	u := &url.URL{
+		Scheme: SourceNBD,
+		Host:   net.JoinHostPort(source.Host, strconv.Itoa(int(port))),
+		Path:   "/" + source.ExportName,
+	}
+	return u.String()
+}
+
 func newPersistentVolumeClaim(dataVolume *cdiv1.DataVolume) (*corev1.PersistentVolumeClaim, error) {
 	labels := map[string]string{
 		"cdi-controller": dataVolume.Name,
@@ -760,11 +798,100 @@ func newPersistentVolumeClaim(dataVolume *cdiv1.DataVolume) (*corev1.PersistentV
 		if dataVolume.Spec.Source.HTTP.CertConfigMap != "" {
 			annotations[AnnCertConfigMap] = dataVolume.Spec.Source.HTTP.CertConfigMap
 		}
+		if dataVolume.Spec.Source.HTTP.ClientCertSecret != "" {
+			annotations[AnnClientCertSecret] = dataVolume.Spec.Source.HTTP.ClientCertSecret
+		}
+		if dataVolume.Spec.Source.HTTP.Checksum != "" {
+			annotations[AnnChecksum] = dataVolume.Spec.Source.HTTP.Checksum
+		}
+		if dataVolume.Spec.Source.HTTP.Connections > 0 {
+			annotations[AnnHTTPConnections] = strconv.Itoa(int(dataVolume.Spec.Source.HTTP.Connections))
+		}
+		if dataVolume.Spec.Source.HTTP.DiskPath != "" {
+			annotations[AnnDiskPath] = dataVolume.Spec.Source.HTTP.DiskPath
+		}
+		setAnnotationList(annotations, AnnExtraHeaders, dataVolume.Spec.Source.HTTP.ExtraHeaders)
+		setAnnotationList(annotations, AnnSecretExtraHeaders, dataVolume.Spec.Source.HTTP.SecretExtraHeaders)
 	} else if dataVolume.Spec.Source.S3 != nil {
 		annotations[AnnEndpoint] = dataVolume.Spec.Source.S3.URL
+		annotations[AnnSource] = SourceS3
 		if dataVolume.Spec.Source.S3.SecretRef != "" {
 			annotations[AnnSecret] = dataVolume.Spec.Source.S3.SecretRef
 		}
+		if dataVolume.Spec.Source.S3.Checksum != "" {
+			annotations[AnnChecksum] = dataVolume.Spec.Source.S3.Checksum
+		}
+		if dataVolume.Spec.Source.S3.DiskPath != "" {
+			annotations[AnnDiskPath] = dataVolume.Spec.Source.S3.DiskPath
+		}
+		if dataVolume.Spec.Source.S3.Endpoint != "" {
+			annotations[AnnS3Endpoint] = dataVolume.Spec.Source.S3.Endpoint
+		}
+		if dataVolume.Spec.Source.S3.Region != "" {
+			annotations[AnnS3Region] = dataVolume.Spec.Source.S3.Region
+		}
+		if dataVolume.Spec.Source.S3.AddressingStyle != "" {
+			annotations[AnnS3AddressingStyle] = string(dataVolume.Spec.Source.S3.AddressingStyle)
+		}
+		if dataVolume.Spec.Source.S3.Secure {
+			annotations[AnnS3Secure] = "true"
+		}
+		if dataVolume.Spec.Source.S3.CertConfigMap != "" {
+			annotations[AnnCertConfigMap] = dataVolume.Spec.Source.S3.CertConfigMap
+		}
+		if dataVolume.Spec.Source.S3.RoleARN != "" {
+			annotations[AnnS3RoleARN] = dataVolume.Spec.Source.S3.RoleARN
+		}
+		if dataVolume.Spec.Source.S3.STSEndpoint != "" {
+			annotations[AnnS3STSEndpoint] = dataVolume.Spec.Source.S3.STSEndpoint
+		}
+	} else if dataVolume.Spec.Source.GCS != nil {
+		annotations[AnnEndpoint] = dataVolume.Spec.Source.GCS.URL
+		annotations[AnnSource] = SourceGCS
+		if dataVolume.Spec.Source.GCS.SecretRef != "" {
+			annotations[AnnSecret] = dataVolume.Spec.Source.GCS.SecretRef
+		}
+		if dataVolume.Spec.Source.GCS.Checksum != "" {
+			annotations[AnnChecksum] = dataVolume.Spec.Source.GCS.Checksum
+		}
+		if dataVolume.Spec.Source.GCS.DiskPath != "" {
+			annotations[AnnDiskPath] = dataVolume.Spec.Source.GCS.DiskPath
+		}
+		if dataVolume.Spec.Source.GCS.Endpoint != "" {
+			annotations[AnnGCSEndpoint] = dataVolume.Spec.Source.GCS.Endpoint
+		}
+	} else if dataVolume.Spec.Source.AzureBlob != nil {
+		annotations[AnnEndpoint] = azureBlobURL(dataVolume.Spec.Source.AzureBlob)
+		annotations[AnnSource] = SourceAzureBlob
+		annotations[AnnAzureAccount] = dataVolume.Spec.Source.AzureBlob.Account
+		if dataVolume.Spec.Source.AzureBlob.SecretRef != "" {
+			annotations[AnnSecret] = dataVolume.Spec.Source.AzureBlob.SecretRef
+		}
+		if dataVolume.Spec.Source.AzureBlob.Checksum != "" {
+			annotations[AnnChecksum] = dataVolume.Spec.Source.AzureBlob.Checksum
+		}
+		if dataVolume.Spec.Source.AzureBlob.DiskPath != "" {
+			annotations[AnnDiskPath] = dataVolume.Spec.Source.AzureBlob.DiskPath
+		}
+	} else if dataVolume.Spec.Source.NBD != nil {
+		annotations[AnnEndpoint] = nbdURL(dataVolume.Spec.Source.NBD)
+		annotations[AnnSource] = SourceNBD
+		if dataVolume.Spec.Source.NBD.SecretRef != "" {
+			annotations[AnnSecret] = dataVolume.Spec.Source.NBD.SecretRef
+		}
+	} else if dataVolume.Spec.Source.SFTP != nil {
+		annotations[AnnEndpoint] = dataVolume.Spec.Source.SFTP.URL
+		annotations[AnnSource] = SourceSFTP
+		annotations[AnnSFTPHostKey] = dataVolume.Spec.Source.SFTP.HostKey
+		if dataVolume.Spec.Source.SFTP.SecretRef != "" {
+			annotations[AnnSecret] = dataVolume.Spec.Source.SFTP.SecretRef
+		}
+		if dataVolume.Spec.Source.SFTP.Checksum != "" {
+			annotations[AnnChecksum] = dataVolume.Spec.Source.SFTP.Checksum
+		}
+		if dataVolume.Spec.Source.SFTP.DiskPath != "" {
+			annotations[AnnDiskPath] = dataVolume.Spec.Source.SFTP.DiskPath
+		}
 	} else if dataVolume.Spec.Source.Registry != nil {
 		annotations[AnnSource] = SourceRegistry
 		annotations[AnnEndpoint] = dataVolume.Spec.Source.Registry.URL
@@ -775,6 +902,16 @@ func newPersistentVolumeClaim(dataVolume *cdiv1.DataVolume) (*corev1.PersistentV
 		if dataVolume.Spec.Source.Registry.CertConfigMap != "" {
 			annotations[AnnCertConfigMap] = dataVolume.Spec.Source.Registry.CertConfigMap
 		}
+		if dataVolume.Spec.Source.Registry.ClientCertSecret != "" {
+			annotations[AnnClientCertSecret] = dataVolume.Spec.Source.Registry.ClientCertSecret
+		}
+		if dataVolume.Spec.Source.Registry.DiskPath != "" {
+			annotations[AnnDiskPath] = dataVolume.Spec.Source.Registry.DiskPath
+		}
+		if platform := dataVolume.Spec.Source.Registry.Platform; platform != nil && *platform != (cdiv1.ImagePlatform{}) {
+			// The importer uses the platform of the node for the parts that are missing
+			annotations[AnnRegistryPlatform] = strings.TrimRight(platform.OS+"/"+platform.Architecture+"/"+platform.Variant, "/")
+		}
 	} else if dataVolume.Spec.Source.PVC != nil {
 		sourceNamespace := dataVolume.Spec.Source.PVC.Namespace
 		if sourceNamespace == "" {
@@ -788,6 +925,9 @@ func newPersistentVolumeClaim(dataVolume *cdiv1.DataVolume) (*corev1.PersistentV
 		annotations[AnnCloneRequest] = sourceNamespace + "/" + dataVolume.Spec.Source.PVC.Name
 	} else if dataVolume.Spec.Source.Upload != nil {
 		annotations[AnnUploadRequest] = ""
+		if dataVolume.Spec.Source.Upload.Checksum != "" {
+			annotations[AnnChecksum] = dataVolume.Spec.Source.Upload.Checksum
+		}
 	} else if dataVolume.Spec.Source.Blank != nil {
 		annotations[AnnSource] = SourceNone
 		annotations[AnnContentType] = string(cdiv1.DataVolumeKubeVirt)
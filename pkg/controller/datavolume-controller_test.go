@@ -106,6 +106,206 @@ var _ = Describe("Datavolume controller reconcile loop", func() {
 		Expect(pvc.GetAnnotations()[AnnSource]).To(Equal(SourceHTTP))
 	})
 
+	It("Should pass the S3 endpoint settings from DV to created PVC", func() {
+		dv := newImportDataVolume("test-dv")
+		dv.Spec.Source = cdiv1.DataVolumeSource{
+			S3: &cdiv1.DataVolumeSourceS3{
+				URL:             "s3://bucket/disk.img",
+				Endpoint:        "minio.example.com:9000",
+				Region:          "eu-central-1",
+				AddressingStyle: cdiv1.S3AddressingPath,
+				Secure:          true,
+				CertConfigMap:   "s3-certs",
+				RoleARN:         "arn:aws:iam::123456789012:role/importer",
+				STSEndpoint:     "https://sts.eu-central-1.amazonaws.com",
+			},
+		}
+		reconciler = createDatavolumeReconciler(dv)
+		_, err := reconciler.Reconcile(reconcile.Request{NamespacedName: types.NamespacedName{Name: "test-dv", Namespace: metav1.NamespaceDefault}})
+		Expect(err).ToNot(HaveOccurred())
+		pvc := &corev1.PersistentVolumeClaim{}
+		err = reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: "test-dv", Namespace: metav1.NamespaceDefault}, pvc)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(pvc.GetAnnotations()[AnnSource]).To(Equal(SourceS3))
+		Expect(pvc.GetAnnotations()[AnnEndpoint]).To(Equal("s3://bucket/disk.img"))
+		Expect(pvc.GetAnnotations()[AnnS3Endpoint]).To(Equal("minio.example.com:9000"))
+		Expect(pvc.GetAnnotations()[AnnS3Region]).To(Equal("eu-central-1"))
+		Expect(pvc.GetAnnotations()[AnnS3AddressingStyle]).To(Equal("path"))
+		Expect(pvc.GetAnnotations()[AnnS3Secure]).To(Equal("true"))
+		Expect(pvc.GetAnnotations()[AnnCertConfigMap]).To(Equal("s3-certs"))
+		Expect(pvc.GetAnnotations()[AnnS3RoleARN]).To(Equal("arn:aws:iam::123456789012:role/importer"))
+		Expect(pvc.GetAnnotations()[AnnS3STSEndpoint]).To(Equal("https://sts.eu-central-1.amazonaws.com"))
+	})
+
+	It("Should pass the GCS source settings from DV to created PVC", func() {
+		dv := newImportDataVolume("test-dv")
+		dv.Spec.Source = cdiv1.DataVolumeSource{
+			GCS: &cdiv1.DataVolumeSourceGCS{
+				URL:       "gs://bucket/disk.img",
+				SecretRef: "gcs-secret",
+				Checksum:  "md5:5d41402abc4b2a76b9719d911017c592",
+				Endpoint:  "http://fake-gcs-server:4443",
+			},
+		}
+		reconciler = createDatavolumeReconciler(dv)
+		_, err := reconciler.Reconcile(reconcile.Request{NamespacedName: types.NamespacedName{Name: "test-dv", Namespace: metav1.NamespaceDefault}})
+		Expect(err).ToNot(HaveOccurred())
+		pvc := &corev1.PersistentVolumeClaim{}
+		err = reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: "test-dv", Namespace: metav1.NamespaceDefault}, pvc)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(pvc.GetAnnotations()[AnnSource]).To(Equal(SourceGCS))
+		Expect(pvc.GetAnnotations()[AnnEndpoint]).To(Equal("gs://bucket/disk.img"))
+		Expect(pvc.GetAnnotations()[AnnSecret]).To(Equal("gcs-secret"))
+		Expect(pvc.GetAnnotations()[AnnChecksum]).To(Equal("md5:5d41402abc4b2a76b9719d911017c592"))
+		Expect(pvc.GetAnnotations()[AnnGCSEndpoint]).To(Equal("http://fake-gcs-server:4443"))
+	})
+
+	It("Should pass the Azure Blob source settings from DV to created PVC", func() {
+		dv := newImportDataVolume("test-dv")
+		dv.Spec.Source = cdiv1.DataVolumeSource{
+			AzureBlob: &cdiv1.DataVolumeSourceAzureBlob{
+				Account:   "images",
+				Container: "vhds",
+				Blob:      "hyper-v/disk 1.vhd",
+				SecretRef: "azure-secret",
+				Checksum:  "md5:5d41402abc4b2a76b9719d911017c592",
+			},
+		}
+		reconciler = createDatavolumeReconciler(dv)
+		_, err := reconciler.Reconcile(reconcile.Request{NamespacedName: types.NamespacedName{Name: "test-dv", Namespace: metav1.NamespaceDefault}})
+		Expect(err).ToNot(HaveOccurred())
+		pvc := &corev1.PersistentVolumeClaim{}
+		err = reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: "test-dv", Namespace: metav1.NamespaceDefault}, pvc)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(pvc.GetAnnotations()[AnnSource]).To(Equal(SourceAzureBlob))
+		Expect(pvc.GetAnnotations()[AnnEndpoint]).To(Equal("https://images.blob.core.windows.net/vhds/hyper-v/disk%201.vhd"))
+		Expect(pvc.GetAnnotations()[AnnAzureAccount]).To(Equal("images"))
+		Expect(pvc.GetAnnotations()[AnnSecret]).To(Equal("azure-secret"))
+		Expect(pvc.GetAnnotations()[AnnChecksum]).To(Equal("md5:5d41402abc4b2a76b9719d911017c592"))
+	})
+
+	It("Should put the blob of an Azure Blob source in the endpoint of the account", func() {
+		source := &cdiv1.DataVolumeSourceAzureBlob{
+			Account:   "devstoreaccount1",
+			Container: "vhds",
+			Blob:      "disk.vhd",
+			Endpoint:  "http://azurite:10000/devstoreaccount1/",
+		}
+		Expect(azureBlobURL(source)).To(Equal("http://azurite:10000/devstoreaccount1/vhds/disk.vhd"))
+	})
+
+	It("Should pass the NBD source settings from DV to created PVC", func() {
+		dv := newImportDataVolume("test-dv")
+		dv.Spec.Source = cdiv1.DataVolumeSource{
+			NBD: &cdiv1.DataVolumeSourceNBD{
+				Host:       "fd00::1",
+				ExportName: "disk",
+				SecretRef:  "nbd-psk",
+			},
+		}
+		reconciler = createDatavolumeReconciler(dv)
+		_, err := reconciler.Reconcile(reconcile.Request{NamespacedName: types.NamespacedName{Name: "test-dv", Namespace: metav1.NamespaceDefault}})
+		Expect(err).ToNot(HaveOccurred())
+		pvc := &corev1.PersistentVolumeClaim{}
+		err = reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: "test-dv", Namespace: metav1.NamespaceDefault}, pvc)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(pvc.GetAnnotations()[AnnSource]).To(Equal(SourceNBD))
+		Expect(pvc.GetAnnotations()[AnnEndpoint]).To(Equal("nbd://[fd00::1]:10809/disk"))
+		Expect(pvc.GetAnnotations()[AnnSecret]).To(Equal("nbd-psk"))
+	})
+
+	It("Should pass the SFTP source settings from DV to created PVC", func() {
+		dv := newImportDataVolume("test-dv")
+		dv.Spec.Source = cdiv1.DataVolumeSource{
+			SFTP: &cdiv1.DataVolumeSourceSFTP{
+				URL:       "sftp://sftp-server/images/disk.img",
+				HostKey:   "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIKVno3ZtsMKI5aSg0ao8jhBt8VU3nT6fg05nEY4E+a89",
+				SecretRef: "sftp-credentials",
+				Checksum:  "sha256:2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824",
+			},
+		}
+		reconciler = createDatavolumeReconciler(dv)
+		_, err := reconciler.Reconcile(reconcile.Request{NamespacedName: types.NamespacedName{Name: "test-dv", Namespace: metav1.NamespaceDefault}})
+		Expect(err).ToNot(HaveOccurred())
+		pvc := &corev1.PersistentVolumeClaim{}
+		err = reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: "test-dv", Namespace: metav1.NamespaceDefault}, pvc)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(pvc.GetAnnotations()[AnnSource]).To(Equal(SourceSFTP))
+		Expect(pvc.GetAnnotations()[AnnEndpoint]).To(Equal("sftp://sftp-server/images/disk.img"))
+		Expect(pvc.GetAnnotations()[AnnSFTPHostKey]).To(Equal(dv.Spec.Source.SFTP.HostKey))
+		Expect(pvc.GetAnnotations()[AnnSecret]).To(Equal("sftp-credentials"))
+		Expect(pvc.GetAnnotations()[AnnChecksum]).To(Equal(dv.Spec.Source.SFTP.Checksum))
+	})
+
+	table.DescribeTable("Should pass the platform of a registry source from DV to created PVC", func(platform *cdiv1.ImagePlatform, expected string) {
+		dv := newImportDataVolume("test-dv")
+		dv.Spec.Source = cdiv1.DataVolumeSource{
+			Registry: &cdiv1.DataVolumeSourceRegistry{
+				URL:      "docker://registry:5000/image",
+				Platform: platform,
+			},
+		}
+		reconciler = createDatavolumeReconciler(dv)
+		_, err := reconciler.Reconcile(reconcile.Request{NamespacedName: types.NamespacedName{Name: "test-dv", Namespace: metav1.NamespaceDefault}})
+		Expect(err).ToNot(HaveOccurred())
+		pvc := &corev1.PersistentVolumeClaim{}
+		err = reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: "test-dv", Namespace: metav1.NamespaceDefault}, pvc)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(pvc.GetAnnotations()[AnnSource]).To(Equal(SourceRegistry))
+		value, ok := pvc.GetAnnotations()[AnnRegistryPlatform]
+		Expect(ok).To(Equal(expected != ""))
+		Expect(value).To(Equal(expected))
+	},
+		table.Entry("without a platform", nil, ""),
+		table.Entry("with an empty platform", &cdiv1.ImagePlatform{}, ""),
+		table.Entry("with an os and architecture", &cdiv1.ImagePlatform{OS: "linux", Architecture: "arm64"}, "linux/arm64"),
+		table.Entry("with a variant", &cdiv1.ImagePlatform{OS: "linux", Architecture: "arm", Variant: "v7"}, "linux/arm/v7"),
+		table.Entry("with only an architecture", &cdiv1.ImagePlatform{Architecture: "arm64"}, "/arm64"),
+	)
+
+	It("Should pass the disk path of a registry source from DV to created PVC", func() {
+		dv := newImportDataVolume("test-dv")
+		dv.Spec.Source = cdiv1.DataVolumeSource{
+			Registry: &cdiv1.DataVolumeSourceRegistry{
+				URL:      "docker://registry:5000/image",
+				DiskPath: "disk/*.qcow2",
+			},
+		}
+		reconciler = createDatavolumeReconciler(dv)
+		_, err := reconciler.Reconcile(reconcile.Request{NamespacedName: types.NamespacedName{Name: "test-dv", Namespace: metav1.NamespaceDefault}})
+		Expect(err).ToNot(HaveOccurred())
+		pvc := &corev1.PersistentVolumeClaim{}
+		err = reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: "test-dv", Namespace: metav1.NamespaceDefault}, pvc)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(pvc.GetAnnotations()[AnnDiskPath]).To(Equal("disk/*.qcow2"))
+	})
+
+	It("Should pass the extra headers of an http source from DV to created PVC", func() {
+		dv := newImportDataVolume("test-dv")
+		dv.Spec.Source.HTTP.ExtraHeaders = []string{"Accept: application/octet-stream", "X-Request-Id: 1"}
+		dv.Spec.Source.HTTP.SecretExtraHeaders = []string{"artifactory-token"}
+		reconciler = createDatavolumeReconciler(dv)
+		_, err := reconciler.Reconcile(reconcile.Request{NamespacedName: types.NamespacedName{Name: "test-dv", Namespace: metav1.NamespaceDefault}})
+		Expect(err).ToNot(HaveOccurred())
+		pvc := &corev1.PersistentVolumeClaim{}
+		err = reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: "test-dv", Namespace: metav1.NamespaceDefault}, pvc)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(getAnnotationList(pvc, AnnExtraHeaders)).To(Equal(dv.Spec.Source.HTTP.ExtraHeaders))
+		Expect(getAnnotationList(pvc, AnnSecretExtraHeaders)).To(Equal([]string{"artifactory-token"}))
+	})
+
+	It("Should pass the client certificate secret of an http source from DV to created PVC", func() {
+		dv := newImportDataVolume("test-dv")
+		dv.Spec.Source.HTTP.ClientCertSecret = "client-cert"
+		reconciler = createDatavolumeReconciler(dv)
+		_, err := reconciler.Reconcile(reconcile.Request{NamespacedName: types.NamespacedName{Name: "test-dv", Namespace: metav1.NamespaceDefault}})
+		Expect(err).ToNot(HaveOccurred())
+		pvc := &corev1.PersistentVolumeClaim{}
+		err = reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: "test-dv", Namespace: metav1.NamespaceDefault}, pvc)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(pvc.GetAnnotations()[AnnClientCertSecret]).To(Equal("client-cert"))
+	})
+
 	It("Should follow the phase of the created PVC", func() {
 		reconciler = createDatavolumeReconciler(newImportDataVolume("test-dv"))
 		_, err := reconciler.Reconcile(reconcile.Request{NamespacedName: types.NamespacedName{Name: "test-dv", Namespace: metav1.NamespaceDefault}})
@@ -251,6 +451,58 @@ var _ = Describe("Reconcile Datavolume status", func() {
 		Expect(event).To(ContainSubstring("Successfully imported into PVC test-dv"))
 	})
 
+	It("Should report the image digest of a registry import", func() {
+		digest := "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+		reconciler = createDatavolumeReconciler(newImportDataVolume("test-dv"))
+		_, err := reconciler.Reconcile(reconcile.Request{NamespacedName: types.NamespacedName{Name: "test-dv", Namespace: metav1.NamespaceDefault}})
+		Expect(err).ToNot(HaveOccurred())
+		dv := &cdiv1.DataVolume{}
+		err = reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: "test-dv", Namespace: metav1.NamespaceDefault}, dv)
+		Expect(err).ToNot(HaveOccurred())
+
+		pvc := &corev1.PersistentVolumeClaim{}
+		err = reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: "test-dv", Namespace: metav1.NamespaceDefault}, pvc)
+		Expect(err).ToNot(HaveOccurred())
+		pvc.Status.Phase = corev1.ClaimBound
+		pvc.GetAnnotations()[AnnImportPod] = "importer-test-dv"
+		pvc.GetAnnotations()[AnnPodPhase] = string(corev1.PodRunning)
+		pvc.GetAnnotations()[AnnRegistryImageDigest] = digest
+		err = reconciler.Client.Update(context.TODO(), pvc)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = reconciler.reconcileDataVolumeStatus(dv, pvc)
+		Expect(err).ToNot(HaveOccurred())
+		dv = &cdiv1.DataVolume{}
+		err = reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: "test-dv", Namespace: metav1.NamespaceDefault}, dv)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(dv.Status.Phase).To(Equal(cdiv1.ImportInProgress))
+		Expect(dv.Status.ImageDigest).To(Equal(digest))
+	})
+
+	It("Should report the retries of the importer", func() {
+		reconciler = createDatavolumeReconciler(newImportDataVolume("test-dv"))
+		_, err := reconciler.Reconcile(reconcile.Request{NamespacedName: types.NamespacedName{Name: "test-dv", Namespace: metav1.NamespaceDefault}})
+		Expect(err).ToNot(HaveOccurred())
+		dv := &cdiv1.DataVolume{}
+		err = reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: "test-dv", Namespace: metav1.NamespaceDefault}, dv)
+		Expect(err).ToNot(HaveOccurred())
+
+		pvc := &corev1.PersistentVolumeClaim{}
+		err = reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: "test-dv", Namespace: metav1.NamespaceDefault}, pvc)
+		Expect(err).ToNot(HaveOccurred())
+		pvc.Status.Phase = corev1.ClaimBound
+		pvc.GetAnnotations()[AnnImportPod] = "importer-test-dv"
+		pvc.GetAnnotations()[AnnPodPhase] = string(corev1.PodSucceeded)
+		pvc.GetAnnotations()[AnnImportRetries] = "3"
+		err = reconciler.Client.Update(context.TODO(), pvc)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = reconciler.reconcileDataVolumeStatus(dv, pvc)
+		Expect(err).ToNot(HaveOccurred())
+		dv = &cdiv1.DataVolume{}
+		err = reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: "test-dv", Namespace: metav1.NamespaceDefault}, dv)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(dv.Status.RetryCount).To(Equal(int32(3)))
+	})
+
 	table.DescribeTable("DV phase", func(testDv runtime.Object, current, expected cdiv1.DataVolumePhase, pvcPhase corev1.PersistentVolumeClaimPhase, podPhase corev1.PodPhase, ann string) {
 		reconciler = createDatavolumeReconciler(testDv)
 		_, err := reconciler.Reconcile(reconcile.Request{NamespacedName: types.NamespacedName{Name: "test-dv", Namespace: metav1.NamespaceDefault}})
@@ -486,6 +738,28 @@ var _ = Describe("Get Pod from PVC", func() {
 	})
 })
 
+var _ = Describe("Reconcile progress update", func() {
+	table.DescribeTable("Should", func(source cdiv1.DataVolumeSource, requeue bool) {
+		dv := newImportDataVolume("test-dv")
+		dv.Spec.Source = source
+		dv.Status.Phase = cdiv1.ImportInProgress
+		reconciler := createDatavolumeReconciler(dv)
+		result, err := reconciler.reconcileProgressUpdate(dv, types.UID("pvc-uid"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.RequeueAfter > 0).To(Equal(requeue))
+		Expect(dv.Status.Progress).To(BeEquivalentTo("N/A"))
+	},
+		table.Entry("update the progress of an http import", cdiv1.DataVolumeSource{HTTP: &cdiv1.DataVolumeSourceHTTP{URL: "http://example.com/data"}}, true),
+		table.Entry("update the progress of an s3 import", cdiv1.DataVolumeSource{S3: &cdiv1.DataVolumeSourceS3{URL: "http://example.com/data"}}, true),
+		table.Entry("update the progress of a gcs import", cdiv1.DataVolumeSource{GCS: &cdiv1.DataVolumeSourceGCS{URL: "gs://bucket/data"}}, true),
+		table.Entry("update the progress of an sftp import", cdiv1.DataVolumeSource{SFTP: &cdiv1.DataVolumeSourceSFTP{URL: "sftp://sftp-server/data"}}, true),
+		table.Entry("update the progress of an nbd import", cdiv1.DataVolumeSource{NBD: &cdiv1.DataVolumeSourceNBD{Host: "nbd-server"}}, true),
+		table.Entry("update the progress of an azure blob import", cdiv1.DataVolumeSource{AzureBlob: &cdiv1.DataVolumeSourceAzureBlob{Account: "images", Container: "vhds", Blob: "data"}}, true),
+		table.Entry("update the progress of a registry import", cdiv1.DataVolumeSource{Registry: &cdiv1.DataVolumeSourceRegistry{URL: "docker://example.com/data"}}, true),
+		table.Entry("not update the progress of a blank image", cdiv1.DataVolumeSource{Blank: &cdiv1.DataVolumeBlankImage{}}, false),
+	)
+})
+
 var _ = Describe("Update Progress from pod", func() {
 	var (
 		pvc *corev1.PersistentVolumeClaim
@@ -3,8 +3,10 @@ package controller
 import (
 	"context"
 	"fmt"
+	"path"
 	"reflect"
 	"strconv"
+	"strings"
 
 	"github.com/go-logr/logr"
 	"github.com/pkg/errors"
@@ -18,6 +20,7 @@ import (
 	"k8s.io/client-go/tools/record"
 	cdiclientset "kubevirt.io/containerized-data-importer/pkg/client/clientset/versioned"
 	"kubevirt.io/containerized-data-importer/pkg/common"
+	"kubevirt.io/containerized-data-importer/pkg/util"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
@@ -37,6 +40,46 @@ const (
 	AnnSecret = AnnAPIGroup + "/storage.import.secretName"
 	// AnnCertConfigMap is the name of a configmap containing tls certs
 	AnnCertConfigMap = AnnAPIGroup + "/storage.import.certConfigMap"
+	// AnnClientCertSecret is the name of a secret containing the client certificate presented to an http or registry import source
+	AnnClientCertSecret = AnnAPIGroup + "/storage.import.clientCertSecret"
+	// AnnChecksum provides a const for the expected checksum of the import source
+	AnnChecksum = AnnAPIGroup + "/storage.import.checksum"
+	// AnnHTTPConnections provides a const for the number of connections used to download an http source
+	AnnHTTPConnections = AnnAPIGroup + "/storage.import.httpConnections"
+	// AnnExtraHeaders provides a const for the prefix of the extra headers of an http import source, the annotations are
+	// suffixed with .<index>
+	AnnExtraHeaders = AnnAPIGroup + "/storage.import.extraHeaders"
+	// AnnSecretExtraHeaders provides a const for the prefix of the secrets of extra headers of an http import source, the
+	// annotations are suffixed with .<index>
+	AnnSecretExtraHeaders = AnnAPIGroup + "/storage.import.secretExtraHeaders"
+	// AnnDiskPath provides a const for the path of the disk image in a tar archive import source
+	AnnDiskPath = AnnAPIGroup + "/storage.import.diskPath"
+	// AnnS3Endpoint provides a const for the host of the object store of an S3 import source
+	AnnS3Endpoint = AnnAPIGroup + "/storage.import.s3Endpoint"
+	// AnnS3Region provides a const for the region of the bucket of an S3 import source
+	AnnS3Region = AnnAPIGroup + "/storage.import.s3Region"
+	// AnnS3AddressingStyle provides a const for how the bucket of an S3 import source is addressed
+	AnnS3AddressingStyle = AnnAPIGroup + "/storage.import.s3AddressingStyle"
+	// AnnS3Secure provides a const for connecting to the object store of an S3 import source with TLS
+	AnnS3Secure = AnnAPIGroup + "/storage.import.s3Secure"
+	// AnnS3RoleARN provides a const for the role assumed to get the credentials of an S3 import source
+	AnnS3RoleARN = AnnAPIGroup + "/storage.import.s3RoleARN"
+	// AnnS3STSEndpoint provides a const for the STS service the role of an S3 import source is assumed with
+	AnnS3STSEndpoint = AnnAPIGroup + "/storage.import.s3STSEndpoint"
+	// AnnGCSEndpoint provides a const for the service a GCS import source is imported from
+	AnnGCSEndpoint = AnnAPIGroup + "/storage.import.gcsEndpoint"
+	// AnnAzureAccount provides a const for the storage account of an Azure Blob import source
+	AnnAzureAccount = AnnAPIGroup + "/storage.import.azureAccount"
+	// AnnSFTPHostKey provides a const for the public key the server of an SFTP import source has to present
+	AnnSFTPHostKey = AnnAPIGroup + "/storage.import.sftpHostKey"
+	// AnnRegistryPlatform provides a const for the platform the image of a multi-arch registry import source is selected for
+	AnnRegistryPlatform = AnnAPIGroup + "/storage.import.registryPlatform"
+	// AnnRegistryImageDigest provides a const for the digest of the manifest the image of a registry import source resolved to
+	AnnRegistryImageDigest = AnnAPIGroup + "/storage.import.registryImageDigest"
+	// AnnImportRetries provides a const for the number of times the importer retried a request to the source
+	AnnImportRetries = AnnAPIGroup + "/storage.import.retries"
+	// AnnImportFailed provides a const for our PVC annotation marking an import that failed with an error retrying will not fix
+	AnnImportFailed = AnnAPIGroup + "/storage.import.failed"
 	// AnnContentType provides a const for the PVC content-type
 	AnnContentType = AnnAPIGroup + "/storage.contentType"
 	// AnnImportPod provides a const for our PVC importPodName annotation
@@ -69,8 +112,17 @@ type ImportReconciler struct {
 }
 
 type importPodEnvVar struct {
-	ep, secretName, source, contentType, imageSize, certConfigMap string
-	insecureTLS                                                   bool
+	ep, secretName, source, contentType, imageSize, certConfigMap, checksum, diskPath string
+	clientCertSecret                                                                  string
+	s3Endpoint, s3Region, s3AddressingStyle, s3RoleARN, s3STSEndpoint                 string
+	gcsEndpoint, azureAccount, sftpHostKey, registryPlatform                          string
+	httpProxy, httpsProxy, noProxy, proxySecret, proxyCAConfigMap                     string
+	retries, retryBackoff, retryMaxBackoff                                            string
+	extraHeaders, secretExtraHeaders                                                  []string
+	insecureTLS, s3Secure                                                             bool
+	httpConnections                                                                   int32
+	// the data of the trusted CA ConfigMap of the import proxy
+	proxyCAData map[string]string
 }
 
 // NewImportController creates a new instance of the import controller.
@@ -122,6 +174,13 @@ func isPVCComplete(pvc *corev1.PersistentVolumeClaim) bool {
 	return exists && (phase == string(corev1.PodSucceeded))
 }
 
+// isPVCFailed returns true if the importer exited with a non retriable error, and the importer pod was removed, since
+// running it again would fail the same way. A pod that failed for another reason, like an eviction, is recreated.
+func isPVCFailed(pvc *corev1.PersistentVolumeClaim) bool {
+	failed, exists := pvc.ObjectMeta.Annotations[AnnImportFailed]
+	return exists && failed == "true"
+}
+
 // Reconcile the reconcile loop for the CDIConfig object.
 func (r *ImportReconciler) Reconcile(req reconcile.Request) (reconcile.Result, error) {
 	log := r.Log.WithValues("PVC", req.NamespacedName)
@@ -186,6 +245,9 @@ func (r *ImportReconciler) reconcilePvc(pvc *corev1.PersistentVolumeClaim, log l
 		if isPVCComplete(pvc) {
 			// Don't create the POD if the PVC is completed already
 			log.V(1).Info("PVC is already complete")
+		} else if isPVCFailed(pvc) {
+			// Don't create the POD if the previous one failed with an error that retrying will not fix
+			log.V(1).Info("PVC import has failed")
 		} else if pvc.DeletionTimestamp == nil {
 			// Create importer pod, make sure the PVC owns it.
 			if err := r.createImporterPod(pvc); err != nil {
@@ -216,6 +278,7 @@ func (r *ImportReconciler) updatePvcFromPod(pvc *corev1.PersistentVolumeClaim, p
 	log.V(1).Info("Updating PVC from pod")
 	anno := pvc.GetAnnotations()
 	scratchExitCode := false
+	nonRetriableExitCode := false
 	if pod.Status.ContainerStatuses != nil && pod.Status.ContainerStatuses[0].LastTerminationState.Terminated != nil &&
 		pod.Status.ContainerStatuses[0].LastTerminationState.Terminated.ExitCode > 0 {
 		log.Info("Pod termination code", "pod.Name", pod.Name, "ExitCode", pod.Status.ContainerStatuses[0].LastTerminationState.Terminated.ExitCode)
@@ -224,13 +287,38 @@ func (r *ImportReconciler) updatePvcFromPod(pvc *corev1.PersistentVolumeClaim, p
 			scratchExitCode = true
 			anno[AnnRequiresScratch] = "true"
 		} else {
-			r.recorder.Event(pvc, corev1.EventTypeWarning, ErrImportFailedPVC, pod.Status.ContainerStatuses[0].LastTerminationState.Terminated.Message)
+			if pod.Status.ContainerStatuses[0].LastTerminationState.Terminated.ExitCode == common.NonRetriableErrorExitCode {
+				log.V(1).Info("Pod failed with a non retriable error, terminating pod", "pod.Name", pod.Name)
+				nonRetriableExitCode = true
+			}
+			message := pod.Status.ContainerStatuses[0].LastTerminationState.Terminated.Message
+			if result := util.ParseImportResult(message); result != nil {
+				message = result.Message
+			}
+			r.recorder.Event(pvc, corev1.EventTypeWarning, ErrImportFailedPVC, message)
+		}
+	}
+
+	if result := importResultFromPod(pod); result != nil {
+		if result.ImageDigest != "" {
+			anno[AnnRegistryImageDigest] = result.ImageDigest
+		}
+		// The retries are those of the last run of the importer, so the retries of an earlier run are removed.
+		if result.Retries > 0 {
+			anno[AnnImportRetries] = strconv.Itoa(result.Retries)
+		} else {
+			delete(anno, AnnImportRetries)
 		}
 	}
 
 	anno[AnnImportPod] = string(pod.Name)
 	// Even if scratch space is needed, the pod state will still remain running, until the new pod is started.
 	anno[AnnPodPhase] = string(pod.Status.Phase)
+	if nonRetriableExitCode {
+		// The pod would keep restarting and failing, mark the import as failed instead.
+		anno[AnnPodPhase] = string(corev1.PodFailed)
+		anno[AnnImportFailed] = "true"
+	}
 
 	// Check if the POD is waiting for scratch space, if so create some.
 	if pod.Status.Phase == corev1.PodPending && r.requiresScratchSpace(pvc) {
@@ -254,8 +342,8 @@ func (r *ImportReconciler) updatePvcFromPod(pvc *corev1.PersistentVolumeClaim, p
 		log.V(1).Info("Updated PVC", "pvc.anno.Phase", anno[AnnPodPhase])
 	}
 
-	if isPVCComplete(pvc) || scratchExitCode {
-		if !scratchExitCode {
+	if isPVCComplete(pvc) || scratchExitCode || nonRetriableExitCode {
+		if !scratchExitCode && !nonRetriableExitCode {
 			r.recorder.Event(pvc, corev1.EventTypeNormal, ImportSucceededPVC, "Import Successful")
 			log.V(1).Info("Completed successfully, deleting POD", "pod.Name", pod.Name)
 		}
@@ -266,6 +354,24 @@ func (r *ImportReconciler) updatePvcFromPod(pvc *corev1.PersistentVolumeClaim, p
 	return nil
 }
 
+// importResultFromPod returns the result the importer reported when it completed, failed, or exited to be restarted
+// with scratch space, nil if it did not report one.
+func importResultFromPod(pod *corev1.Pod) *util.ImportResult {
+	if len(pod.Status.ContainerStatuses) == 0 {
+		return nil
+	}
+	status := pod.Status.ContainerStatuses[0]
+	if status.State.Terminated != nil {
+		if result := util.ParseImportResult(status.State.Terminated.Message); result != nil {
+			return result
+		}
+	}
+	if status.LastTerminationState.Terminated != nil {
+		return util.ParseImportResult(status.LastTerminationState.Terminated.Message)
+	}
+	return nil
+}
+
 func (r *ImportReconciler) updatePVC(pvc *corev1.PersistentVolumeClaim, log logr.Logger) error {
 	log.V(1).Info("Phase is now", "pvc.anno.Phase", pvc.GetAnnotations()[AnnPodPhase])
 	if err := r.Client.Update(context.TODO(), pvc); err != nil {
@@ -289,6 +395,18 @@ func (r *ImportReconciler) createImporterPod(pvc *corev1.PersistentVolumeClaim)
 	if err != nil {
 		return err
 	}
+	if podEnvVar.source == SourceHTTP {
+		podEnvVar.httpConnections, err = getHTTPConnections(r.Client, pvc)
+		if err != nil {
+			return err
+		}
+	}
+	if err := setImportProxyEnvVar(r.Client, r.K8sClient, pvc, podEnvVar); err != nil {
+		return err
+	}
+	if err := setImportRetryEnvVar(r.Client, podEnvVar); err != nil {
+		return err
+	}
 
 	// all checks passed, let's create the importer pod!
 	pod, err := createImporterPod(r.Log, r.Client, r.CdiClient, r.Image, r.Verbose, r.PullPolicy, podEnvVar, pvc, scratchPvcName)
@@ -297,6 +415,13 @@ func (r *ImportReconciler) createImporterPod(pvc *corev1.PersistentVolumeClaim)
 		return err
 	}
 	r.Log.V(1).Info("Created POD", "pod.Name", pod.Name)
+	// The resources are owned by the pod, which cannot start without them, so it is created again if they cannot be
+	if err := createImportProxyResources(r.K8sClient, pod, podEnvVar); err != nil {
+		if err := r.Client.Delete(context.TODO(), pod); IgnoreNotFound(err) != nil {
+			r.Log.Error(err, "Unable to delete the importer POD", "pod.Name", pod.Name)
+		}
+		return err
+	}
 	if requiresScratch {
 		r.Log.V(1).Info("POD requires scratch space")
 		return r.createScratchPvcForPod(pvc, pod)
@@ -314,8 +439,6 @@ func (r *ImportReconciler) requiresScratchSpace(pvc *corev1.PersistentVolumeClai
 		switch getSource(pvc) {
 		case SourceGlance:
 			scratchRequired = true
-		case SourceRegistry:
-			scratchRequired = true
 		}
 	}
 	value, ok := pvc.Annotations[AnnRequiresScratch]
@@ -499,6 +622,178 @@ func makeImporterPodSpec(namespace, image, verbose, pullPolicy string, podEnvVar
 		pod.Spec.Containers[0].VolumeMounts = append(pod.Spec.Containers[0].VolumeMounts, vm)
 		pod.Spec.Volumes = append(pod.Spec.Volumes, vol)
 	}
+
+	if podEnvVar.proxyCAConfigMap != "" {
+		vm := corev1.VolumeMount{
+			Name:      ProxyCertVolName,
+			MountPath: common.ImporterProxyCertDir,
+			ReadOnly:  true,
+		}
+
+		vol := corev1.Volume{
+			Name: ProxyCertVolName,
+			VolumeSource: corev1.VolumeSource{
+				ConfigMap: &corev1.ConfigMapVolumeSource{
+					LocalObjectReference: corev1.LocalObjectReference{
+						Name: podEnvVar.proxyCAConfigMap,
+					},
+				},
+			},
+		}
+
+		pod.Spec.Containers[0].VolumeMounts = append(pod.Spec.Containers[0].VolumeMounts, vm)
+		pod.Spec.Volumes = append(pod.Spec.Volumes, vol)
+	}
+
+	if podEnvVar.clientCertSecret != "" {
+		// The private key is mounted instead of passed in the environment
+		vm := corev1.VolumeMount{
+			Name:      ClientCertVolName,
+			MountPath: common.ImporterClientCertDir,
+			ReadOnly:  true,
+		}
+
+		vol := corev1.Volume{
+			Name: ClientCertVolName,
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName: podEnvVar.clientCertSecret,
+					Items: []corev1.KeyToPath{
+						{
+							Key:  corev1.TLSCertKey,
+							Path: common.ImporterClientCertFile,
+						},
+						{
+							Key:  corev1.TLSPrivateKeyKey,
+							Path: common.ImporterClientKeyFile,
+						},
+					},
+				},
+			},
+		}
+
+		pod.Spec.Containers[0].VolumeMounts = append(pod.Spec.Containers[0].VolumeMounts, vm)
+		pod.Spec.Volumes = append(pod.Spec.Volumes, vol)
+	}
+
+	if podEnvVar.s3RoleARN != "" {
+		vm := corev1.VolumeMount{
+			Name:      S3TokenVolName,
+			MountPath: common.ImporterS3TokenDir,
+			ReadOnly:  true,
+		}
+
+		vol := corev1.Volume{
+			Name: S3TokenVolName,
+			VolumeSource: corev1.VolumeSource{
+				Projected: &corev1.ProjectedVolumeSource{
+					Sources: []corev1.VolumeProjection{
+						{
+							ServiceAccountToken: &corev1.ServiceAccountTokenProjection{
+								Audience:          common.S3TokenAudience,
+								ExpirationSeconds: &[]int64{3600}[0],
+								Path:              common.ImporterS3TokenFile,
+							},
+						},
+					},
+				},
+			},
+		}
+
+		pod.Spec.Containers[0].VolumeMounts = append(pod.Spec.Containers[0].VolumeMounts, vm)
+		pod.Spec.Volumes = append(pod.Spec.Volumes, vol)
+	}
+
+	if podEnvVar.source == SourceGCS && podEnvVar.secretName != "" {
+		// The service account key is a file, it is mounted instead of passed in the environment
+		vm := corev1.VolumeMount{
+			Name:      GCSCredentialsVolName,
+			MountPath: common.ImporterGCSCredentialsDir,
+			ReadOnly:  true,
+		}
+
+		vol := corev1.Volume{
+			Name: GCSCredentialsVolName,
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName: podEnvVar.secretName,
+					Items: []corev1.KeyToPath{
+						{
+							Key:  common.KeyServiceAccount,
+							Path: common.ImporterGCSCredentialsFile,
+						},
+					},
+				},
+			},
+		}
+
+		pod.Spec.Containers[0].VolumeMounts = append(pod.Spec.Containers[0].VolumeMounts, vm)
+		pod.Spec.Volumes = append(pod.Spec.Volumes, vol)
+	}
+
+	if podEnvVar.source == SourceNBD && podEnvVar.secretName != "" {
+		// qemu-img reads the TLS credentials from the files of a directory
+		vm := corev1.VolumeMount{
+			Name:      NBDTLSVolName,
+			MountPath: common.ImporterNBDTLSDir,
+			ReadOnly:  true,
+		}
+
+		vol := corev1.Volume{
+			Name: NBDTLSVolName,
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName: podEnvVar.secretName,
+				},
+			},
+		}
+
+		pod.Spec.Containers[0].VolumeMounts = append(pod.Spec.Containers[0].VolumeMounts, vm)
+		pod.Spec.Volumes = append(pod.Spec.Volumes, vol)
+	}
+
+	if podEnvVar.source == SourceSFTP && podEnvVar.secretName != "" {
+		// ssh reads the private key from a file, which must not be readable by others
+		vm := corev1.VolumeMount{
+			Name:      SFTPCredentialsVolName,
+			MountPath: common.ImporterSFTPCredentialsDir,
+			ReadOnly:  true,
+		}
+
+		vol := corev1.Volume{
+			Name: SFTPCredentialsVolName,
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName:  podEnvVar.secretName,
+					DefaultMode: &[]int32{0400}[0],
+				},
+			},
+		}
+
+		pod.Spec.Containers[0].VolumeMounts = append(pod.Spec.Containers[0].VolumeMounts, vm)
+		pod.Spec.Volumes = append(pod.Spec.Volumes, vol)
+	}
+
+	for index, secretName := range podEnvVar.secretExtraHeaders {
+		// The headers are mounted instead of passed in the environment, so they cannot be read from the pod
+		vm := corev1.VolumeMount{
+			Name:      fmt.Sprintf("%s-%d", SecretExtraHeadersVolName, index),
+			MountPath: path.Join(common.ImporterSecretExtraHeadersDir, strconv.Itoa(index)),
+			ReadOnly:  true,
+		}
+
+		vol := corev1.Volume{
+			Name: vm.Name,
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName: secretName,
+				},
+			},
+		}
+
+		pod.Spec.Containers[0].VolumeMounts = append(pod.Spec.Containers[0].VolumeMounts, vm)
+		pod.Spec.Volumes = append(pod.Spec.Volumes, vol)
+	}
 	return pod
 }
 
@@ -513,6 +808,16 @@ func addImportVolumeMounts() []v1.VolumeMount {
 	return volumeMounts
 }
 
+// hasAccessKeySecret returns true if the secret of the source holds an access key id and a secret key, which are passed
+// to the importer in its environment.
+func hasAccessKeySecret(source string) bool {
+	switch source {
+	case SourceGCS, SourceAzureBlob, SourceNBD, SourceSFTP:
+		return false
+	}
+	return true
+}
+
 // return the Env portion for the importer container.
 func makeImportEnv(podEnvVar *importPodEnvVar, uid types.UID) []v1.EnvVar {
 	env := []v1.EnvVar{
@@ -541,7 +846,129 @@ func makeImportEnv(podEnvVar *importPodEnvVar, uid types.UID) []v1.EnvVar {
 			Value: strconv.FormatBool(podEnvVar.insecureTLS),
 		},
 	}
-	if podEnvVar.secretName != "" {
+	if podEnvVar.checksum != "" {
+		env = append(env, v1.EnvVar{
+			Name:  common.ImporterChecksum,
+			Value: podEnvVar.checksum,
+		})
+	}
+	if podEnvVar.diskPath != "" {
+		env = append(env, v1.EnvVar{
+			Name:  common.ImporterDiskPath,
+			Value: podEnvVar.diskPath,
+		})
+	}
+	if podEnvVar.s3Endpoint != "" {
+		env = append(env, v1.EnvVar{
+			Name:  common.ImporterS3Endpoint,
+			Value: podEnvVar.s3Endpoint,
+		})
+	}
+	if podEnvVar.s3Region != "" {
+		env = append(env, v1.EnvVar{
+			Name:  common.ImporterS3Region,
+			Value: podEnvVar.s3Region,
+		})
+	}
+	if podEnvVar.s3AddressingStyle != "" {
+		env = append(env, v1.EnvVar{
+			Name:  common.ImporterS3AddressingStyle,
+			Value: podEnvVar.s3AddressingStyle,
+		})
+	}
+	if podEnvVar.s3Secure {
+		env = append(env, v1.EnvVar{
+			Name:  common.ImporterS3Secure,
+			Value: strconv.FormatBool(podEnvVar.s3Secure),
+		})
+	}
+	if podEnvVar.s3RoleARN != "" {
+		env = append(env, v1.EnvVar{
+			Name:  common.ImporterS3RoleARN,
+			Value: podEnvVar.s3RoleARN,
+		})
+	}
+	if podEnvVar.s3STSEndpoint != "" {
+		env = append(env, v1.EnvVar{
+			Name:  common.ImporterS3STSEndpoint,
+			Value: podEnvVar.s3STSEndpoint,
+		})
+	}
+	if podEnvVar.gcsEndpoint != "" {
+		env = append(env, v1.EnvVar{
+			Name:  common.ImporterGCSEndpoint,
+			Value: podEnvVar.gcsEndpoint,
+		})
+	}
+	if podEnvVar.azureAccount != "" {
+		env = append(env, v1.EnvVar{
+			Name:  common.ImporterAzureAccount,
+			Value: podEnvVar.azureAccount,
+		})
+	}
+	if podEnvVar.sftpHostKey != "" {
+		env = append(env, v1.EnvVar{
+			Name:  common.ImporterSFTPHostKey,
+			Value: podEnvVar.sftpHostKey,
+		})
+	}
+	if podEnvVar.registryPlatform != "" {
+		env = append(env, v1.EnvVar{
+			Name:  common.ImporterRegistryPlatform,
+			Value: podEnvVar.registryPlatform,
+		})
+	}
+	if podEnvVar.httpConnections > 1 {
+		env = append(env, v1.EnvVar{
+			Name:  common.ImporterHTTPConnections,
+			Value: strconv.Itoa(int(podEnvVar.httpConnections)),
+		})
+	}
+	for _, retryEnv := range []struct{ name, value string }{
+		{common.ImporterRetries, podEnvVar.retries},
+		{common.ImporterRetryBackoff, podEnvVar.retryBackoff},
+		{common.ImporterRetryMaxBackoff, podEnvVar.retryMaxBackoff},
+	} {
+		if retryEnv.value != "" {
+			env = append(env, v1.EnvVar{
+				Name:  retryEnv.name,
+				Value: retryEnv.value,
+			})
+		}
+	}
+	for index, header := range podEnvVar.extraHeaders {
+		env = append(env, v1.EnvVar{
+			Name:  common.ImporterExtraHeader + strconv.Itoa(index),
+			Value: header,
+		})
+	}
+	if podEnvVar.secretName != "" && podEnvVar.source == SourceAzureBlob {
+		// The secret holds either a SAS token or the shared key of the account
+		env = append(env, v1.EnvVar{
+			Name: common.ImporterAzureSASToken,
+			ValueFrom: &v1.EnvVarSource{
+				SecretKeyRef: &v1.SecretKeySelector{
+					LocalObjectReference: v1.LocalObjectReference{
+						Name: podEnvVar.secretName,
+					},
+					Key:      common.KeySASToken,
+					Optional: &[]bool{true}[0],
+				},
+			},
+		}, v1.EnvVar{
+			Name: common.ImporterAzureAccountKey,
+			ValueFrom: &v1.EnvVarSource{
+				SecretKeyRef: &v1.SecretKeySelector{
+					LocalObjectReference: v1.LocalObjectReference{
+						Name: podEnvVar.secretName,
+					},
+					Key:      common.KeyAccountKey,
+					Optional: &[]bool{true}[0],
+				},
+			},
+		})
+	}
+	if podEnvVar.secretName != "" && hasAccessKeySecret(podEnvVar.source) {
 		env = append(env, v1.EnvVar{
 			Name: common.ImporterAccessKeyID,
 			ValueFrom: &v1.EnvVarSource{
@@ -563,7 +990,21 @@ func makeImportEnv(podEnvVar *importPodEnvVar, uid types.UID) []v1.EnvVar {
 				},
 			},
 		})
-
+		if podEnvVar.source == SourceS3 {
+			// Temporary credentials come with a session token
+			env = append(env, v1.EnvVar{
+				Name: common.ImporterSessionToken,
+				ValueFrom: &v1.EnvVarSource{
+					SecretKeyRef: &v1.SecretKeySelector{
+						LocalObjectReference: v1.LocalObjectReference{
+							Name: podEnvVar.secretName,
+						},
+						Key:      common.KeySessionToken,
+						Optional: &[]bool{true}[0],
+					},
+				},
+			})
+		}
 	}
 	if podEnvVar.certConfigMap != "" {
 		env = append(env, v1.EnvVar{
@@ -571,5 +1012,45 @@ func makeImportEnv(podEnvVar *importPodEnvVar, uid types.UID) []v1.EnvVar {
 			Value: common.ImporterCertDir,
 		})
 	}
+	if podEnvVar.clientCertSecret != "" {
+		env = append(env, v1.EnvVar{
+			Name:  common.ImporterClientCertDirVar,
+			Value: common.ImporterClientCertDir,
+		})
+	}
+	return append(env, makeImportProxyEnv(podEnvVar)...)
+}
+
+// makeImportProxyEnv returns the proxy env variables of the importer container. They are set in upper and lower case,
+// since curl, which qemu-img reads http sources with, only reads http_proxy in lower case. The proxy urls are read
+// from the secret of the pod, since they may contain credentials.
+func makeImportProxyEnv(podEnvVar *importPodEnvVar) []v1.EnvVar {
+	var env []v1.EnvVar
+	for _, proxy := range []struct{ name, key, value string }{
+		{common.ImportProxyHTTP, common.KeyHTTPProxy, podEnvVar.httpProxy},
+		{common.ImportProxyHTTPS, common.KeyHTTPSProxy, podEnvVar.httpsProxy},
+	} {
+		if proxy.value == "" {
+			continue
+		}
+		source := &v1.EnvVarSource{
+			SecretKeyRef: &v1.SecretKeySelector{
+				LocalObjectReference: v1.LocalObjectReference{
+					Name: podEnvVar.proxySecret,
+				},
+				Key: proxy.key,
+			},
+		}
+		env = append(env, v1.EnvVar{Name: proxy.name, ValueFrom: source}, v1.EnvVar{Name: strings.ToLower(proxy.name), ValueFrom: source})
+	}
+	if podEnvVar.noProxy != "" {
+		env = append(env, v1.EnvVar{Name: common.ImportProxyNoProxy, Value: podEnvVar.noProxy}, v1.EnvVar{Name: strings.ToLower(common.ImportProxyNoProxy), Value: podEnvVar.noProxy})
+	}
+	if podEnvVar.proxyCAConfigMap != "" {
+		env = append(env, v1.EnvVar{
+			Name:  common.ImporterProxyCertDirVar,
+			Value: common.ImporterProxyCertDir,
+		})
+	}
 	return env
 }
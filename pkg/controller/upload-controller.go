@@ -589,6 +589,13 @@ func (r *UploadReconciler) makeUploadPodSpec(args UploadPodArgs, resourceRequire
 		pod.Spec.Containers[0].Resources = *resourceRequirements
 	}
 
+	if checksum := args.PVC.Annotations[AnnChecksum]; checksum != "" {
+		pod.Spec.Containers[0].Env = append(pod.Spec.Containers[0].Env, v1.EnvVar{
+			Name:  common.UploadChecksum,
+			Value: checksum,
+		})
+	}
+
 	if getVolumeMode(args.PVC) == v1.PersistentVolumeBlock {
 		pod.Spec.Containers[0].VolumeDevices = []v1.VolumeDevice{
 			{
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
@@ -36,6 +37,21 @@ const (
 	// CertVolName is the name of the volumecontaining certs
 	CertVolName = "cdi-cert-vol"
 
+	// S3TokenVolName is the name of the volume containing the service account token used to assume the role of an S3 source
+	S3TokenVolName = "cdi-s3-token-vol"
+	// GCSCredentialsVolName is the name of the volume containing the service account key of a GCS source
+	GCSCredentialsVolName = "cdi-gcs-credentials-vol"
+	// NBDTLSVolName is the name of the volume containing the TLS credentials of an NBD source
+	NBDTLSVolName = "cdi-nbd-tls-vol"
+	// SFTPCredentialsVolName is the name of the volume containing the credentials of the user of an SFTP source
+	SFTPCredentialsVolName = "cdi-sftp-credentials-vol"
+	// ClientCertVolName is the name of the volume containing the client certificate of an HTTP or registry source
+	ClientCertVolName = "cdi-client-cert-vol"
+	// SecretExtraHeadersVolName is the prefix of the names of the volumes containing the secret extra headers of an HTTP source
+	SecretExtraHeadersVolName = "cdi-secret-extra-headers-vol"
+	// ProxyCertVolName is the name of the volume containing the trusted CAs of the import proxy
+	ProxyCertVolName = "cdi-proxy-cert-vol"
+
 	// ScratchVolName provides a const to use for creating scratch pvc volumes in pod specs
 	ScratchVolName = "cdi-scratch-vol"
 
@@ -47,6 +63,14 @@ const (
 	SourceHTTP = "http"
 	// SourceS3 is the source type S3
 	SourceS3 = "s3"
+	// SourceGCS is the source type Google Cloud Storage
+	SourceGCS = "gcs"
+	// SourceAzureBlob is the source type Azure Blob Storage
+	SourceAzureBlob = "azure-blob"
+	// SourceNBD is the source type of the export of a network block device server
+	SourceNBD = "nbd"
+	// SourceSFTP is the source type of a file of an SFTP server
+	SourceSFTP = "sftp"
 	// SourceGlance is the source type of glance
 	SourceGlance = "glance"
 	// SourceNone means there is no source.
@@ -114,6 +138,10 @@ func getSource(pvc *v1.PersistentVolumeClaim) string {
 	case
 		SourceHTTP,
 		SourceS3,
+		SourceGCS,
+		SourceAzureBlob,
+		SourceNBD,
+		SourceSFTP,
 		SourceGlance,
 		SourceNone,
 		SourceRegistry:
@@ -330,6 +358,224 @@ func GetDefaultPodResourceRequirements(client client.Client) (*v1.ResourceRequir
 	return cdiconfig.Status.DefaultPodResourceRequirements, nil
 }
 
+// getHTTPConnections returns the number of connections to use to download an http source, the value requested for
+// the PVC takes precedence over the one in the CDI config.
+func getHTTPConnections(client client.Client, pvc *v1.PersistentVolumeClaim) (int32, error) {
+	if value, ok := pvc.Annotations[AnnHTTPConnections]; ok {
+		connections, err := strconv.ParseInt(value, 10, 32)
+		if err == nil && connections > 0 {
+			return int32(connections), nil
+		}
+		klog.Warningf("Ignoring invalid %s annotation %q on pvc \"%s/%s\"", AnnHTTPConnections, value, pvc.Namespace, pvc.Name)
+	}
+	cdiconfig := &cdiv1.CDIConfig{}
+	if err := client.Get(context.TODO(), types.NamespacedName{Name: common.ConfigName}, cdiconfig); err != nil {
+		klog.Errorf("Unable to find CDI configuration, %v\n", err)
+		return 0, err
+	}
+	return cdiconfig.Status.HTTPConnections, nil
+}
+
+// setImportRetryEnvVar sets the retry settings of the CDI config in the env variables of the importer pod, the
+// importer uses its defaults for the settings that are not set.
+func setImportRetryEnvVar(client client.Client, podEnvVar *importPodEnvVar) error {
+	cdiconfig := &cdiv1.CDIConfig{}
+	if err := client.Get(context.TODO(), types.NamespacedName{Name: common.ConfigName}, cdiconfig); err != nil {
+		klog.Errorf("Unable to find CDI configuration, %v\n", err)
+		return err
+	}
+	retry := cdiconfig.Spec.ImportRetry
+	if retry == nil {
+		return nil
+	}
+	if retry.Retries != nil {
+		podEnvVar.retries = strconv.Itoa(int(*retry.Retries))
+	}
+	if retry.Backoff != nil {
+		podEnvVar.retryBackoff = retry.Backoff.Duration.String()
+	}
+	if retry.MaxBackoff != nil {
+		podEnvVar.retryMaxBackoff = retry.MaxBackoff.Duration.String()
+	}
+	return nil
+}
+
+// getImportProxy returns the proxy of the importer pods in the status of the CDI config, nil if there is none.
+func getImportProxy(client client.Client) (*cdiv1.ImportProxy, error) {
+	cdiconfig := &cdiv1.CDIConfig{}
+	if err := client.Get(context.TODO(), types.NamespacedName{Name: common.ConfigName}, cdiconfig); err != nil {
+		klog.Errorf("Unable to find CDI configuration, %v\n", err)
+		return nil, err
+	}
+	return cdiconfig.Status.ImportProxy, nil
+}
+
+// setImportProxyEnvVar sets the proxy of the importer pods in the env variables of the importer pod of the PVC. The
+// pod reads the proxy urls, with the credentials of the CredentialsSecret of the proxy, from a secret, and mounts a copy
+// of the trusted CA ConfigMap, since it cannot mount a ConfigMap of the CDI namespace. Both are created by
+// createImportProxyResources.
+func setImportProxyEnvVar(client client.Client, k8sClient kubernetes.Interface, pvc *v1.PersistentVolumeClaim, podEnvVar *importPodEnvVar) error {
+	proxy, err := getImportProxy(client)
+	if err != nil || proxy == nil {
+		return err
+	}
+	if proxy.HTTPProxy != nil {
+		podEnvVar.httpProxy = *proxy.HTTPProxy
+	}
+	if proxy.HTTPSProxy != nil {
+		podEnvVar.httpsProxy = *proxy.HTTPSProxy
+	}
+	if proxy.NoProxy != nil {
+		podEnvVar.noProxy = *proxy.NoProxy
+	}
+	if podEnvVar.httpProxy != "" || podEnvVar.httpsProxy != "" {
+		podEnvVar.proxySecret = importProxyResourceName(pvc)
+		if err := setImportProxyCredentials(k8sClient, proxy, podEnvVar); err != nil {
+			return err
+		}
+	}
+	if proxy.TrustedCAProxy == nil || *proxy.TrustedCAProxy == "" {
+		return nil
+	}
+	configMap, err := k8sClient.CoreV1().ConfigMaps(util.GetNamespace()).Get(*proxy.TrustedCAProxy, metav1.GetOptions{})
+	if err != nil {
+		return errors.Wrapf(err, "unable to get the trusted CA ConfigMap %q of the import proxy", *proxy.TrustedCAProxy)
+	}
+	podEnvVar.proxyCAConfigMap = importProxyResourceName(pvc)
+	podEnvVar.proxyCAData = configMap.Data
+	return nil
+}
+
+// setImportProxyCredentials adds the username and password of the CredentialsSecret of the proxy, in the CDI
+// namespace, to the proxy urls of the importer pod.
+func setImportProxyCredentials(k8sClient kubernetes.Interface, proxy *cdiv1.ImportProxy, podEnvVar *importPodEnvVar) error {
+	if proxy.CredentialsSecret == nil || *proxy.CredentialsSecret == "" {
+		return nil
+	}
+	secret, err := k8sClient.CoreV1().Secrets(util.GetNamespace()).Get(*proxy.CredentialsSecret, metav1.GetOptions{})
+	if err != nil {
+		return errors.Wrapf(err, "unable to get the credentials secret %q of the import proxy", *proxy.CredentialsSecret)
+	}
+	username, ok := secret.Data[common.KeyUsername]
+	if !ok || len(username) == 0 {
+		return errors.Errorf("the credentials secret %q of the import proxy has no %s", *proxy.CredentialsSecret, common.KeyUsername)
+	}
+	credentials := url.UserPassword(string(username), string(secret.Data[common.KeyPassword]))
+	if podEnvVar.httpProxy, err = addURLCredentials(podEnvVar.httpProxy, credentials); err != nil {
+		return err
+	}
+	podEnvVar.httpsProxy, err = addURLCredentials(podEnvVar.httpsProxy, credentials)
+	return err
+}
+
+// addURLCredentials returns the url with the credentials as its user info.
+func addURLCredentials(rawURL string, credentials *url.Userinfo) (string, error) {
+	if rawURL == "" {
+		return "", nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", errors.Wrap(err, "unable to parse the url of the import proxy")
+	}
+	u.User = credentials
+	return u.String(), nil
+}
+
+// importProxyResourceName returns the name of the secret with the proxy urls, and of the copy of the trusted CA
+// ConfigMap, of the importer pod of the PVC.
+func importProxyResourceName(pvc *v1.PersistentVolumeClaim) string {
+	return importPodNameFromPvc(pvc) + "-proxy"
+}
+
+// createImportProxyResources creates the secret with the proxy urls, and the copy of the trusted CA ConfigMap, the
+// importer pod reads its proxy settings from. They are owned by the pod, so they are removed with it. A resource left
+// by a previous pod that was not removed yet is replaced, as long as CDI created it; any other resource with the same
+// name is left alone and fails the import.
+func createImportProxyResources(k8sClient kubernetes.Interface, pod *v1.Pod, podEnvVar *importPodEnvVar) error {
+	objectMeta := func(name string) metav1.ObjectMeta {
+		return metav1.ObjectMeta{
+			Name:      name,
+			Namespace: pod.Namespace,
+			Labels: map[string]string{
+				common.CDILabelKey: common.CDILabelValue,
+			},
+			OwnerReferences: []metav1.OwnerReference{
+				MakePodOwnerReference(pod),
+			},
+		}
+	}
+	if podEnvVar.proxySecret != "" {
+		secret := &v1.Secret{
+			ObjectMeta: objectMeta(podEnvVar.proxySecret),
+			Data:       map[string][]byte{},
+		}
+		if podEnvVar.httpProxy != "" {
+			secret.Data[common.KeyHTTPProxy] = []byte(podEnvVar.httpProxy)
+		}
+		if podEnvVar.httpsProxy != "" {
+			secret.Data[common.KeyHTTPSProxy] = []byte(podEnvVar.httpsProxy)
+		}
+		_, err := k8sClient.CoreV1().Secrets(pod.Namespace).Create(secret)
+		if k8serrors.IsAlreadyExists(err) {
+			var existing *v1.Secret
+			if existing, err = k8sClient.CoreV1().Secrets(pod.Namespace).Get(secret.Name, metav1.GetOptions{}); err == nil {
+				if !isImportProxyResource(&existing.ObjectMeta, pod) {
+					return errors.Errorf("the secret %s/%s of the import proxy already exists and was not created by CDI", pod.Namespace, secret.Name)
+				}
+				existing.ObjectMeta.Labels = addToMap(existing.ObjectMeta.Labels, secret.ObjectMeta.Labels)
+				existing.ObjectMeta.OwnerReferences = secret.ObjectMeta.OwnerReferences
+				existing.Data = secret.Data
+				_, err = k8sClient.CoreV1().Secrets(pod.Namespace).Update(existing)
+			}
+		}
+		if err != nil {
+			return errors.Wrap(err, "unable to create the secret of the import proxy")
+		}
+	}
+	if podEnvVar.proxyCAConfigMap != "" {
+		configMap := &v1.ConfigMap{
+			ObjectMeta: objectMeta(podEnvVar.proxyCAConfigMap),
+			Data:       podEnvVar.proxyCAData,
+		}
+		_, err := k8sClient.CoreV1().ConfigMaps(pod.Namespace).Create(configMap)
+		if k8serrors.IsAlreadyExists(err) {
+			var existing *v1.ConfigMap
+			if existing, err = k8sClient.CoreV1().ConfigMaps(pod.Namespace).Get(configMap.Name, metav1.GetOptions{}); err == nil {
+				if !isImportProxyResource(&existing.ObjectMeta, pod) {
+					return errors.Errorf("the ConfigMap %s/%s of the import proxy already exists and was not created by CDI", pod.Namespace, configMap.Name)
+				}
+				existing.ObjectMeta.Labels = addToMap(existing.ObjectMeta.Labels, configMap.ObjectMeta.Labels)
+				existing.ObjectMeta.OwnerReferences = configMap.ObjectMeta.OwnerReferences
+				existing.Data = configMap.Data
+				_, err = k8sClient.CoreV1().ConfigMaps(pod.Namespace).Update(existing)
+			}
+		}
+		if err != nil {
+			return errors.Wrap(err, "unable to copy the trusted CA ConfigMap of the import proxy")
+		}
+	}
+	return nil
+}
+
+// isImportProxyResource returns true if a proxy resource was created by CDI for an importer pod of the PVC of the pod:
+// it carries the CDI label, or it is owned by the pod, by a previous importer pod, or by the PVC.
+func isImportProxyResource(objectMeta *metav1.ObjectMeta, pod *v1.Pod) bool {
+	if objectMeta.Labels[common.CDILabelKey] == common.CDILabelValue {
+		return true
+	}
+	for _, ref := range objectMeta.OwnerReferences {
+		if ref.Kind == "Pod" && ref.Name == pod.Name {
+			return true
+		}
+		for _, podRef := range pod.OwnerReferences {
+			if podRef.Kind == "PersistentVolumeClaim" && ref.UID == podRef.UID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // this is being called for pods using PV with block volume mode
 func addVolumeDevices() []v1.VolumeDevice {
 	volumeDevices := []v1.VolumeDevice{
@@ -443,6 +689,39 @@ func createImportEnvVar(client kubernetes.Interface, pvc *v1.PersistentVolumeCla
 		if err != nil {
 			return nil, err
 		}
+		podEnvVar.checksum = pvc.Annotations[AnnChecksum]
+		podEnvVar.diskPath = pvc.Annotations[AnnDiskPath]
+		if podEnvVar.source == SourceHTTP || podEnvVar.source == SourceRegistry {
+			podEnvVar.clientCertSecret = pvc.Annotations[AnnClientCertSecret]
+		}
+		if podEnvVar.source == SourceHTTP {
+			podEnvVar.extraHeaders = getAnnotationList(pvc, AnnExtraHeaders)
+			podEnvVar.secretExtraHeaders = getAnnotationList(pvc, AnnSecretExtraHeaders)
+		}
+		if podEnvVar.source == SourceS3 {
+			podEnvVar.s3Endpoint = pvc.Annotations[AnnS3Endpoint]
+			podEnvVar.s3Region = pvc.Annotations[AnnS3Region]
+			podEnvVar.s3AddressingStyle = pvc.Annotations[AnnS3AddressingStyle]
+			podEnvVar.s3Secure, _ = strconv.ParseBool(pvc.Annotations[AnnS3Secure])
+			podEnvVar.s3RoleARN = pvc.Annotations[AnnS3RoleARN]
+			podEnvVar.s3STSEndpoint = pvc.Annotations[AnnS3STSEndpoint]
+		}
+		if podEnvVar.source == SourceGCS {
+			podEnvVar.gcsEndpoint = pvc.Annotations[AnnGCSEndpoint]
+		}
+		if podEnvVar.source == SourceAzureBlob {
+			podEnvVar.azureAccount = pvc.Annotations[AnnAzureAccount]
+		}
+		if podEnvVar.source == SourceSFTP {
+			podEnvVar.sftpHostKey = pvc.Annotations[AnnSFTPHostKey]
+		}
+		if podEnvVar.source == SourceRegistry {
+			podEnvVar.registryPlatform = pvc.Annotations[AnnRegistryPlatform]
+		}
+		if digest := pvc.Annotations[AnnRegistryImageDigest]; podEnvVar.source == SourceRegistry && digest != "" {
+			// A restarted importer pulls the image a previous one resolved, even if the tag was moved in the meantime
+			podEnvVar.ep = imageURLWithDigest(podEnvVar.ep, digest)
+		}
 	}
 	//get the requested image size.
 	podEnvVar.imageSize, err = getRequestedImageSize(pvc)
@@ -452,6 +731,34 @@ func createImportEnvVar(client kubernetes.Interface, pvc *v1.PersistentVolumeCla
 	return podEnvVar, nil
 }
 
+// getAnnotationList returns the values of the annotations with the passed in prefix, suffixed with .<index>, in the
+// order of their index, up to the first missing index.
+func getAnnotationList(pvc *v1.PersistentVolumeClaim, prefix string) []string {
+	var values []string
+	for index := 0; ; index++ {
+		value, ok := pvc.Annotations[fmt.Sprintf("%s.%d", prefix, index)]
+		if !ok {
+			return values
+		}
+		values = append(values, value)
+	}
+}
+
+// setAnnotationList sets the annotations with the passed in prefix, suffixed with .<index>, to the passed in values.
+func setAnnotationList(annotations map[string]string, prefix string, values []string) {
+	for index, value := range values {
+		annotations[fmt.Sprintf("%s.%d", prefix, index)] = value
+	}
+}
+
+// imageURLWithDigest returns the url of the image with the passed in digest, replacing the digest of the url if it has one.
+func imageURLWithDigest(imageURL, digest string) string {
+	if i := strings.LastIndex(imageURL, "@"); i >= 0 {
+		imageURL = imageURL[:i]
+	}
+	return imageURL + "@" + digest
+}
+
 func getCertConfigMap(client kubernetes.Interface, pvc *v1.PersistentVolumeClaim) (string, error) {
 	value, ok := pvc.Annotations[AnnCertConfigMap]
 	if !ok || value == "" {
@@ -137,6 +137,38 @@ func Test_getEndpoint(t *testing.T) {
 	}
 }
 
+func Test_imageURLWithDigest(t *testing.T) {
+	digest := "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	tests := []struct {
+		name     string
+		imageURL string
+		want     string
+	}{
+		{
+			name:     "image with a tag",
+			imageURL: "docker://registry:5000/image:v1",
+			want:     "docker://registry:5000/image:v1@" + digest,
+		},
+		{
+			name:     "image without a tag",
+			imageURL: "docker://fedora",
+			want:     "docker://fedora@" + digest,
+		},
+		{
+			name:     "image with a digest",
+			imageURL: "docker://registry:5000/image@sha256:fedcba9876543210fedcba9876543210fedcba9876543210fedcba9876543210",
+			want:     "docker://registry:5000/image@" + digest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := imageURLWithDigest(tt.imageURL, digest); got != tt.want {
+				t.Errorf("imageURLWithDigest() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func Test_getSource(t *testing.T) {
 	type args struct {
 		pvc *v1.PersistentVolumeClaim
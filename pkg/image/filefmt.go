@@ -39,6 +39,14 @@ var knownHeaders = Headers{
 		SizeOff:     124,
 		SizeLen:     8,
 	},
+	"zip": Header{
+		// The local file header of the first entry, a zip archive has to be read from its end to list its content.
+		Format:      "zip",
+		magicNumber: []byte{'P', 'K', 0x03, 0x04},
+		mgOffset:    0,
+		SizeOff:     0,
+		SizeLen:     0,
+	},
 	"xz": Header{
 		Format:      "xz",
 		magicNumber: []byte{0xFD, 0x37, 0x7A, 0x58, 0x5A, 0x00},
@@ -46,6 +54,52 @@ var knownHeaders = Headers{
 		SizeOff: 0,
 		SizeLen: 0,
 	},
+	"zst": Header{
+		Format:      "zst",
+		magicNumber: []byte{0x28, 0xB5, 0x2F, 0xFD},
+		// TODO: size is optional in the frame header
+		SizeOff: 0,
+		SizeLen: 0,
+	},
+	"bz2": Header{
+		Format:      "bz2",
+		magicNumber: []byte{'B', 'Z', 'h'},
+		// TODO: size not in hdr
+		SizeOff: 0,
+		SizeLen: 0,
+	},
+	"vmdk": Header{
+		Format:      "vmdk",
+		magicNumber: []byte{'K', 'D', 'M', 'V'},
+		mgOffset:    0,
+		// TODO: size is little endian and in sectors
+		SizeOff: 0,
+		SizeLen: 0,
+	},
+	"vhd": Header{
+		// The footer of a dynamic vhd is copied at the start of the file. A fixed vhd only has the footer.
+		Format:      "vhd",
+		magicNumber: []byte{'c', 'o', 'n', 'e', 'c', 't', 'i', 'x'},
+		mgOffset:    0,
+		SizeOff:     48,
+		SizeLen:     8,
+	},
+	"vhdx": Header{
+		Format:      "vhdx",
+		magicNumber: []byte{'v', 'h', 'd', 'x', 'f', 'i', 'l', 'e'},
+		mgOffset:    0,
+		// TODO: size is stored in the metadata region, not in hdr
+		SizeOff: 0,
+		SizeLen: 0,
+	},
+	"vdi": Header{
+		Format:      "vdi",
+		magicNumber: []byte{0x7F, 0x10, 0xDA, 0xBE},
+		mgOffset:    0x40,
+		// TODO: size is little endian
+		SizeOff: 0,
+		SizeLen: 0,
+	},
 }
 
 // Header represents our parameters for a file format header
@@ -1,6 +1,7 @@
 package image
 
 import (
+	"encoding/binary"
 	"math/rand"
 	"reflect"
 	"testing"
@@ -76,6 +77,30 @@ func TestHeader_Match(t *testing.T) {
 			args:   args{[]byte{0xFD, 0x37, 0x7A, 0x58, 0x5A, 0x00}},
 			want:   true,
 		},
+		{
+			name:   "match zst",
+			fields: fields{"zst", []byte{0x28, 0xB5, 0x2F, 0xFD}, 0, 0, 0},
+			args:   args{[]byte{0x28, 0xB5, 0x2F, 0xFD, 0x04, 0x68}},
+			want:   true,
+		},
+		{
+			name:   "match bz2",
+			fields: fields{"bz2", []byte{'B', 'Z', 'h'}, 0, 0, 0},
+			args:   args{[]byte{'B', 'Z', 'h', '9', '1', 'A'}},
+			want:   true,
+		},
+		{
+			name:   "match vmdk",
+			fields: fields{"vmdk", []byte{'K', 'D', 'M', 'V'}, 0, 0, 0},
+			args:   args{[]byte{'K', 'D', 'M', 'V', 0x01, 0x00}},
+			want:   true,
+		},
+		{
+			name:   "match vdi",
+			fields: fields{"vdi", []byte{0x7F, 0x10, 0xDA, 0xBE}, 0x40, 0, 0},
+			args:   args{append(make([]byte, 0x40), 0x7F, 0x10, 0xDA, 0xBE)},
+			want:   true,
+		},
 		{
 			name:   "failed match",
 			fields: fields{"gz", []byte{0x1F, 0x8B}, 0, 0, 0},
@@ -116,6 +141,10 @@ func TestHeader_Size(t *testing.T) {
 	qcowbyte := append(qcowMagic, token...)
 	qcowbyte = append(qcowbyte, qcowSize...)
 
+	vhdbyte := make([]byte, 512)
+	copy(vhdbyte, "conectix")
+	binary.BigEndian.PutUint64(vhdbyte[48:], 4294967296)
+
 	type args struct {
 		b []byte
 	}
@@ -133,6 +162,13 @@ func TestHeader_Size(t *testing.T) {
 			want:    3544391413610329398,
 			wantErr: false,
 		},
+		{
+			name:    "get size of vhd",
+			fields:  fields{"vhd", []byte("conectix"), 0, 48, 8},
+			args:    args{vhdbyte},
+			want:    4294967296,
+			wantErr: false,
+		},
 		{
 			name:    "does not implement size",
 			fields:  fields{"gz", []byte{0x1F, 0x8B}, 0, 0, 0},
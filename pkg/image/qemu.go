@@ -23,6 +23,7 @@ import (
 	"os"
 	"regexp"
 	"strconv"
+	"strings"
 
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
@@ -39,6 +40,8 @@ const (
 	maxMemory          = 1 << 30 //value from OpenStack Nova
 	maxCPUSecs         = 30      //value from OpenStack Nova
 	matcherString      = "\\((\\d?\\d\\.\\d\\d)\\/100%\\)"
+	// nbdTLSCredsID is the id of the TLS credentials object of an nbds:// url
+	nbdTLSCredsID = "tls0"
 )
 
 // ImgInfo contains the virtual image information.
@@ -51,6 +54,19 @@ type ImgInfo struct {
 	VirtualSize int64 `json:"virtual-size"`
 	// ActualSize is the size of the qcow2 image
 	ActualSize int64 `json:"actual-size"`
+	// FormatSpecific contains the information specific to the format of the image
+	FormatSpecific *FormatSpecificInfo `json:"format-specific,omitempty"`
+}
+
+// FormatSpecificInfo contains the format specific image information.
+type FormatSpecificInfo struct {
+	// Type is the format of the image
+	Type string `json:"type"`
+	// Data contains the format specific details of the image
+	Data struct {
+		// CreateType is the subformat of a vmdk image
+		CreateType string `json:"create-type,omitempty"`
+	} `json:"data"`
 }
 
 // QEMUOperations defines the interface for executing qemu subprocesses
@@ -113,9 +129,14 @@ func (o *qemuOperations) ConvertToRawStream(url *url.URL, dest string) error {
 		// File, instead of URL
 		return convertToRaw(url.String(), dest)
 	}
-	jsonArg := fmt.Sprintf("json: {\"file.driver\": \"%s\", \"file.url\": \"%s\", \"file.timeout\": %d}", url.Scheme, url, networkTimeoutSecs)
+	objects, imageArg, err := urlImageArgs(url)
+	if err != nil {
+		return err
+	}
+	args := append([]string{"convert"}, objects...)
+	args = append(args, "-t", "none", "-p", "-O", "raw", imageArg, dest)
 
-	_, err := qemuExecFunction(nil, reportProgress, "qemu-img", "convert", "-t", "none", "-p", "-O", "raw", jsonArg, dest)
+	_, err = qemuExecFunction(nil, reportProgress, "qemu-img", args...)
 	if err != nil {
 		// TODO: Determine what to do here, the conversion failed, and we need to clean up the mess, but we could be writing to a block device
 		os.Remove(dest)
@@ -125,6 +146,60 @@ func (o *qemuOperations) ConvertToRawStream(url *url.URL, dest string) error {
 	return nil
 }
 
+// urlImageArgs returns the objects qemu-img needs to read the image at the url, as --object arguments, and the argument
+// naming the image.
+func urlImageArgs(url *url.URL) ([]string, string, error) {
+	switch url.Scheme {
+	case "nbd", "nbds":
+		return nbdImageArgs(url)
+	}
+	// Make sure the timeout is long enough.
+	jsonArg := fmt.Sprintf("json: {\"file.driver\": \"%s\", \"file.url\": \"%s\", \"file.timeout\": %d}", url.Scheme, url, networkTimeoutSecs)
+	return nil, jsonArg, nil
+}
+
+// nbdImageArgs returns the arguments reading the export of an NBD server, from a url like nbd://<host>:<port>/<export>.
+// The export of an nbds:// url is read with TLS, using the credentials in the directory of the tls-creds-dir query
+// parameter. The credentials are either x509 certificates, or a PSK file if the tls-username query parameter is set.
+func nbdImageArgs(url *url.URL) ([]string, string, error) {
+	if url.Hostname() == "" {
+		return nil, "", errors.Errorf("invalid nbd url %q, the host is missing", url.String())
+	}
+	port := url.Port()
+	if port == "" {
+		port = strconv.Itoa(common.DefaultNBDPort)
+	}
+	options := map[string]string{
+		"file.driver":      "nbd",
+		"file.server.type": "inet",
+		"file.server.host": url.Hostname(),
+		"file.server.port": port,
+	}
+	if export := strings.TrimPrefix(url.Path, "/"); export != "" {
+		options["file.export"] = export
+	}
+	var objects []string
+	if url.Scheme == "nbds" {
+		query := url.Query()
+		dir := query.Get("tls-creds-dir")
+		if dir == "" {
+			return nil, "", errors.Errorf("invalid nbds url %q, the tls-creds-dir is missing", url.String())
+		}
+		// Commas are escaped by doubling them in the object options
+		object := fmt.Sprintf("tls-creds-x509,id=%s,endpoint=client,dir=%s", nbdTLSCredsID, strings.ReplaceAll(dir, ",", ",,"))
+		if username := query.Get("tls-username"); username != "" {
+			object = fmt.Sprintf("tls-creds-psk,id=%s,endpoint=client,dir=%s,username=%s", nbdTLSCredsID, strings.ReplaceAll(dir, ",", ",,"), strings.ReplaceAll(username, ",", ",,"))
+		}
+		objects = append(objects, "--object", object)
+		options["file.tls-creds"] = nbdTLSCredsID
+	}
+	jsonArg, err := json.Marshal(options)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "could not marshal the nbd options")
+	}
+	return objects, "json:" + string(jsonArg), nil
+}
+
 // convertQuantityToQemuSize translates a quantity string into a Qemu compatible string.
 func convertQuantityToQemuSize(size resource.Quantity) string {
 	int64Size, asInt := size.AsInt64()
@@ -148,9 +223,15 @@ func (o *qemuOperations) Info(url *url.URL) (*ImgInfo, error) {
 	var err error
 
 	if len(url.Scheme) > 0 {
-		// Image is a URL, make sure the timeout is long enough.
-		jsonArg := fmt.Sprintf("json: {\"file.driver\": \"%s\", \"file.url\": \"%s\", \"file.timeout\": %d}", url.Scheme, url, networkTimeoutSecs)
-		output, err = qemuExecFunction(qemuInfoLimits, nil, "qemu-img", "info", "--output=json", jsonArg)
+		var objects []string
+		var imageArg string
+		objects, imageArg, err = urlImageArgs(url)
+		if err != nil {
+			return nil, err
+		}
+		args := append([]string{"info"}, objects...)
+		args = append(args, "--output=json", imageArg)
+		output, err = qemuExecFunction(qemuInfoLimits, nil, "qemu-img", args...)
 	} else {
 		output, err = qemuExecFunction(qemuInfoLimits, nil, "qemu-img", "info", "--output=json", url.String())
 	}
@@ -168,7 +249,18 @@ func (o *qemuOperations) Info(url *url.URL) (*ImgInfo, error) {
 
 func isSupportedFormat(value string) bool {
 	switch value {
-	case "raw", "qcow2":
+	case "raw", "qcow2", "vmdk", "vpc", "vhdx", "vdi":
+		return true
+	default:
+		return false
+	}
+}
+
+// isSupportedVmdkCreateType returns true for the vmdk subformats that store all the data in a single file. The others
+// reference extents in other files, which are not imported.
+func isSupportedVmdkCreateType(value string) bool {
+	switch value {
+	case "monolithicSparse", "streamOptimized":
 		return true
 	default:
 		return false
@@ -189,6 +281,16 @@ func (o *qemuOperations) Validate(url *url.URL, availableSize int64) error {
 		return errors.Errorf("Image %s is invalid because it has backing file %s", url.String(), info.BackingFile)
 	}
 
+	if info.Format == "vmdk" {
+		createType := ""
+		if info.FormatSpecific != nil {
+			createType = info.FormatSpecific.Data.CreateType
+		}
+		if !isSupportedVmdkCreateType(createType) {
+			return errors.Errorf("Invalid vmdk create type %q for image %s", createType, url.String())
+		}
+	}
+
 	if availableSize < info.VirtualSize {
 		return errors.Errorf("Virtual image size %d is larger than available size %d, shrink not yet supported.", info.VirtualSize, availableSize)
 	}
@@ -212,11 +314,16 @@ func reportProgress(line string) {
 		klog.V(1).Info(matches[1])
 		// Don't need to check for an error, the regex made sure its a number we can parse.
 		v, _ := strconv.ParseFloat(matches[1], 64)
-		metric := &dto.Metric{}
-		err := progress.WithLabelValues(ownerUID).Write(metric)
-		if err == nil && v > 0 && v > *metric.Counter.Value {
-			progress.WithLabelValues(ownerUID).Add(v - *metric.Counter.Value)
-		}
+		updateProgress(v)
+	}
+}
+
+// updateProgress sets the import progress to the passed in percentage, if it is higher than the current progress.
+func updateProgress(v float64) {
+	metric := &dto.Metric{}
+	err := progress.WithLabelValues(ownerUID).Write(metric)
+	if err == nil && v > 0 && v > *metric.Counter.Value {
+		progress.WithLabelValues(ownerUID).Add(v - *metric.Counter.Value)
 	}
 }
 
@@ -119,6 +119,64 @@ const backingFileValidateJSON = `
 }
 `
 
+const vmdkValidateJSON = `
+{
+    "virtual-size": 4294967296,
+    "filename": "myimage.vmdk",
+    "cluster-size": 65536,
+    "format": "vmdk",
+    "actual-size": 262152192,
+    "format-specific": {
+        "type": "vmdk",
+        "data": {
+            "cid": 1208962926,
+            "parent-cid": 4294967295,
+            "create-type": "streamOptimized",
+            "extents": [
+                {
+                    "compressed": true,
+                    "virtual-size": 4294967296,
+                    "filename": "myimage.vmdk",
+                    "cluster-size": 65536,
+                    "format": ""
+                }
+            ]
+        }
+    },
+    "dirty-flag": false
+}
+`
+
+const vmdkSplitValidateJSON = `
+{
+    "virtual-size": 4294967296,
+    "filename": "myimage.vmdk",
+    "format": "vmdk",
+    "actual-size": 4096,
+    "format-specific": {
+        "type": "vmdk",
+        "data": {
+            "cid": 1208962926,
+            "parent-cid": 4294967295,
+            "create-type": "twoGbMaxExtentFlat",
+            "extents": []
+        }
+    },
+    "dirty-flag": false
+}
+`
+
+const vhdxValidateJSON = `
+{
+    "virtual-size": 4294967296,
+    "filename": "myimage.vhdx",
+    "cluster-size": 33554432,
+    "format": "vhdx",
+    "actual-size": 262152192,
+    "dirty-flag": false
+}
+`
+
 type execFunctionType func(*system.ProcessLimitValues, func(string), string, ...string) ([]byte, error)
 
 func init() {
@@ -173,6 +231,64 @@ var _ = Describe("Convert to Raw", func() {
 		})
 	})
 
+	It("should stream the export of an nbd url to destination", func() {
+		ep, err := url.Parse("nbd://nbd-server/disk")
+		Expect(err).NotTo(HaveOccurred())
+		jsonArg := `json:{"file.driver":"nbd","file.export":"disk","file.server.host":"nbd-server","file.server.port":"10809","file.server.type":"inet"}`
+		replaceExecFunction(mockExecFunction("", "", nil, "convert", "-p", "-O", "raw", jsonArg, "dest"), func() {
+			err = ConvertToRawStream(ep, "dest")
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+})
+
+var _ = Describe("NBD image arguments", func() {
+	table.DescribeTable("should read", func(rawURL string, expectedObjects []string, expectedJSON string) {
+		ep, err := url.Parse(rawURL)
+		Expect(err).NotTo(HaveOccurred())
+		objects, imageArg, err := nbdImageArgs(ep)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(objects).To(Equal(expectedObjects))
+		Expect(imageArg).To(Equal(expectedJSON))
+	},
+		table.Entry("the default export on the default port", "nbd://nbd-server", nil,
+			`json:{"file.driver":"nbd","file.server.host":"nbd-server","file.server.port":"10809","file.server.type":"inet"}`),
+		table.Entry("an export of an IPv6 server", "nbd://[fd00::1]:10900/disk",
+			nil, `json:{"file.driver":"nbd","file.export":"disk","file.server.host":"fd00::1","file.server.port":"10900","file.server.type":"inet"}`),
+		table.Entry("an export with x509 certificates", "nbds://nbd-server/disk?tls-creds-dir=/tls",
+			[]string{"--object", "tls-creds-x509,id=tls0,endpoint=client,dir=/tls"},
+			`json:{"file.driver":"nbd","file.export":"disk","file.server.host":"nbd-server","file.server.port":"10809","file.server.type":"inet","file.tls-creds":"tls0"}`),
+		table.Entry("an export with a PSK", "nbds://nbd-server/disk?tls-creds-dir=/tls&tls-username=user,1",
+			[]string{"--object", "tls-creds-psk,id=tls0,endpoint=client,dir=/tls,username=user,,1"},
+			`json:{"file.driver":"nbd","file.export":"disk","file.server.host":"nbd-server","file.server.port":"10809","file.server.type":"inet","file.tls-creds":"tls0"}`),
+	)
+
+	It("should fail on an nbds url without credentials", func() {
+		ep, err := url.Parse("nbds://nbd-server/disk")
+		Expect(err).NotTo(HaveOccurred())
+		_, _, err = nbdImageArgs(ep)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should get the info of an export with TLS", func() {
+		ep, err := url.Parse("nbds://nbd-server/disk?tls-creds-dir=/tls")
+		Expect(err).NotTo(HaveOccurred())
+		replaceExecFunction(mockExecFunction(goodValidateJSON, "", expectedLimits, "info", "--object", "tls-creds-x509,id=tls0,endpoint=client,dir=/tls", "--output=json"), func() {
+			info, err := qemuIterface.Info(ep)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Format).To(Equal("qcow2"))
+		})
+	})
+
+	It("should fail if qemu-img info of an export fails", func() {
+		ep, err := url.Parse("nbd://nbd-server/disk")
+		Expect(err).NotTo(HaveOccurred())
+		replaceExecFunction(mockExecFunction("", "exit 1", expectedLimits), func() {
+			_, err := qemuIterface.Info(ep)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Error getting info on image nbd://nbd-server/disk"))
+		})
+	})
 })
 
 var _ = Describe("Resize", func() {
@@ -226,6 +342,9 @@ var _ = Describe("Validate", func() {
 		table.Entry("should return error on bad json", mockExecFunction(badValidateJSON, "", expectedLimits), "unexpected end of JSON input", imageName),
 		table.Entry("should return error on bad format", mockExecFunction(badFormatValidateJSON, "", expectedLimits), fmt.Sprintf("Invalid format raw2 for image %s", imageName), imageName),
 		table.Entry("should return error on invalid backing file", mockExecFunction(backingFileValidateJSON, "", expectedLimits), fmt.Sprintf("Image %s is invalid because it has backing file backing-file.qcow2", imageName), imageName),
+		table.Entry("should return success for vmdk", mockExecFunction(vmdkValidateJSON, "", expectedLimits, "info", "--output=json", imageName.String()), "", imageName),
+		table.Entry("should return success for vhdx", mockExecFunction(vhdxValidateJSON, "", expectedLimits, "info", "--output=json", imageName.String()), "", imageName),
+		table.Entry("should return error on vmdk with extent files", mockExecFunction(vmdkSplitValidateJSON, "", expectedLimits), fmt.Sprintf("Invalid vmdk create type \"twoGbMaxExtentFlat\" for image %s", imageName), imageName),
 		table.Entry("should return error on shrink", mockExecFunction(hugeValidateJSON, "", expectedLimits), fmt.Sprintf("Virtual image size %d is larger than available size %d, shrink not yet supported.", 52949672960, 42949672960), imageName),
 	)
 
@@ -0,0 +1,286 @@
+package importer
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"k8s.io/klog"
+
+	cdiv1 "kubevirt.io/containerized-data-importer/pkg/apis/core/v1alpha1"
+	"kubevirt.io/containerized-data-importer/pkg/util"
+)
+
+const (
+	// azureAPIVersion is the version of the Blob service REST API the requests are made with
+	azureAPIVersion = "2019-02-02"
+)
+
+// AzureBlobOptions are the credentials an Azure Blob source is imported with. The blob is read anonymously if neither
+// a SAS token nor an account key is set.
+type AzureBlobOptions struct {
+	// Account is the name of the storage account, it is taken from the host of the endpoint if not set
+	Account string
+	// SASToken is a shared access signature granting read access to the blob, it takes precedence over the account key
+	SASToken string
+	// AccountKey is the base64 encoded shared key of the storage account
+	AccountKey string
+}
+
+// AzureBlobDataSource is the struct containing the information needed to import from an Azure Blob Storage data source.
+// Sequence of phases:
+// 1. Info -> Transfer
+// 2. Transfer -> Process
+// 3. Process -> Convert
+type AzureBlobDataSource struct {
+	// Azure Blob end point
+	ep *url.URL
+	// Reader
+	blobReader io.ReadCloser
+	// the size of the blob
+	size uint64
+	// stack of readers
+	readers *FormatReaders
+	// The image file in scratch space.
+	url *url.URL
+	// the expected checksum of the data, in the form <algorithm>:<hex digest>.
+	checksum string
+	// the path of the disk image, if the source is a tar archive.
+	diskPath string
+}
+
+// azureErrorResponse is the error returned by the Blob service.
+type azureErrorResponse struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+// NewAzureBlobDataSource creates a new instance of the AzureBlobDataSource, the endpoint is the URL of the blob, like
+// https://<account>.blob.core.windows.net/<container>/<blob>.
+func NewAzureBlobDataSource(endpoint, checksum, diskPath string, options AzureBlobOptions) (*AzureBlobDataSource, error) {
+	ep, err := ParseEndpoint(endpoint)
+	if err != nil {
+		return nil, errors.Wrapf(err, fmt.Sprintf("unable to parse endpoint %q", endpoint))
+	}
+	blobReader, size, err := createAzureBlobReader(ep, options)
+	if err != nil {
+		return nil, err
+	}
+	return &AzureBlobDataSource{
+		ep:         ep,
+		blobReader: blobReader,
+		size:       size,
+		checksum:   checksum,
+		diskPath:   diskPath,
+	}, nil
+}
+
+// Info is called to get initial information about the data.
+func (ad *AzureBlobDataSource) Info() (ProcessingPhase, error) {
+	var err error
+	ad.readers, err = NewFormatReaders(ad.blobReader, ad.size, ad.checksum, cdiv1.DataVolumeKubeVirt, ad.diskPath)
+	if err != nil {
+		klog.Errorf("Error creating readers: %v", err)
+		return ProcessingPhaseError, err
+	}
+	if !ad.readers.Convert {
+		// Downloading a raw file, we can write that directly to the target.
+		return ProcessingPhaseTransferDataFile, nil
+	}
+
+	return ProcessingPhaseTransferScratch, nil
+}
+
+// Transfer is called to transfer the data from the source to a temporary location.
+func (ad *AzureBlobDataSource) Transfer(path string) (ProcessingPhase, error) {
+	if util.GetAvailableSpace(path) <= int64(0) {
+		//Path provided is invalid.
+		return ProcessingPhaseError, ErrInvalidPath
+	}
+	file := filepath.Join(path, tempFile)
+	ad.readers.StartProgressUpdate()
+	err := util.StreamDataToFile(ad.readers.TopReader(), file)
+	if err != nil {
+		return ProcessingPhaseError, err
+	}
+	if err := ad.readers.VerifyChecksum(); err != nil {
+		return ProcessingPhaseError, err
+	}
+	if file, err = ad.readers.extractImageArchive(file); err != nil {
+		return ProcessingPhaseError, err
+	}
+	// If streaming succeeded, then parsing the file into URL will also succeed, no need to check error status
+	ad.url, _ = url.Parse(file)
+	return ProcessingPhaseProcess, nil
+}
+
+// TransferFile is called to transfer the data from the source to the passed in file.
+func (ad *AzureBlobDataSource) TransferFile(fileName string) (ProcessingPhase, error) {
+	ad.readers.StartProgressUpdate()
+	err := util.StreamDataToFile(ad.readers.TopReader(), fileName)
+	if err != nil {
+		return ProcessingPhaseError, err
+	}
+	if err := ad.readers.VerifyChecksum(); err != nil {
+		return ProcessingPhaseError, err
+	}
+	return ProcessingPhaseResize, nil
+}
+
+// Process is called to do any special processing before giving the url to the data back to the processor
+func (ad *AzureBlobDataSource) Process() (ProcessingPhase, error) {
+	return ProcessingPhaseConvert, nil
+}
+
+// GetURL returns the url that the data processor can use when converting the data.
+func (ad *AzureBlobDataSource) GetURL() *url.URL {
+	return ad.url
+}
+
+// Close closes any readers or other open resources.
+func (ad *AzureBlobDataSource) Close() error {
+	var err error
+	if ad.readers != nil {
+		err = ad.readers.Close()
+	} else if ad.blobReader != nil {
+		err = ad.blobReader.Close()
+	}
+	return err
+}
+
+// createAzureBlobReader gets the blob with the Blob service REST API, and returns a reader of the blob and its size.
+func createAzureBlobReader(ep *url.URL, options AzureBlobOptions) (io.ReadCloser, uint64, error) {
+	// The query of the url may hold a SAS token, it is not logged
+	blobURL := *ep
+	blobURL.RawQuery = ""
+	if strings.Count(strings.Trim(blobURL.Path, "/"), "/") < 1 {
+		return nil, uint64(0), errors.Errorf("invalid azure blob url %q, expected <endpoint>/<container>/<blob>", blobURL.String())
+	}
+	query := ep.Query()
+	if options.SASToken != "" {
+		sas, err := url.ParseQuery(strings.TrimPrefix(options.SASToken, "?"))
+		if err != nil {
+			return nil, uint64(0), errors.New("could not parse the SAS token")
+		}
+		for key, values := range sas {
+			query[key] = values
+		}
+	}
+	reqURL := blobURL
+	reqURL.RawQuery = query.Encode()
+	req, err := http.NewRequest(http.MethodGet, reqURL.String(), nil)
+	if err != nil {
+		return nil, uint64(0), errors.Wrapf(err, "could not create request for azure blob %q", blobURL.String())
+	}
+	req.Header.Set("x-ms-version", azureAPIVersion)
+	req.Header.Set("x-ms-date", time.Now().UTC().Format(http.TimeFormat))
+
+	switch {
+	case options.SASToken != "":
+		klog.V(2).Infoln("Using the SAS token to read the azure blob")
+	case options.AccountKey != "":
+		account := options.Account
+		if account == "" {
+			account = strings.Split(ep.Hostname(), ".")[0]
+		}
+		key, err := base64.StdEncoding.DecodeString(options.AccountKey)
+		if err != nil {
+			return nil, uint64(0), errors.New("could not decode the account key, expected a base64 encoded key")
+		}
+		klog.V(2).Infof("Using the shared key of account %s to read the azure blob\n", account)
+		signAzureRequest(req, account, key)
+	default:
+		klog.V(2).Infoln("No SAS token or account key, reading the azure blob anonymously")
+	}
+
+	klog.V(2).Infof("Attempting to get blob %q via Azure Blob service API\n", blobURL.String())
+	client, err := createHTTPClient("", "")
+	if err != nil {
+		return nil, uint64(0), err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		// The url of the request may hold a SAS token, it is left out of the error
+		if urlErr, ok := err.(*url.Error); ok {
+			err = urlErr.Err
+		}
+		return nil, uint64(0), errors.Wrapf(err, "could not get azure blob %q", blobURL.String())
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		var errResp azureErrorResponse
+		if err := xml.NewDecoder(resp.Body).Decode(&errResp); err == nil && errResp.Message != "" {
+			return nil, uint64(0), errors.Errorf("could not get azure blob %q, expected status code 200, got %d: %s: %s", blobURL.String(), resp.StatusCode, errResp.Code, strings.TrimSpace(errResp.Message))
+		}
+		return nil, uint64(0), errors.Errorf("could not get azure blob %q, expected status code 200, got %d. Status: %s", blobURL.String(), resp.StatusCode, resp.Status)
+	}
+	size := uint64(0)
+	if resp.ContentLength > 0 {
+		size = uint64(resp.ContentLength)
+	} else {
+		klog.Warningf("Unable to get the size of azure blob %q, progress will not be reported\n", blobURL.String())
+	}
+	return resp.Body, size, nil
+}
+
+// signAzureRequest authorizes a request with the shared key of a storage account, as described in
+// https://docs.microsoft.com/en-us/rest/api/storageservices/authorize-with-shared-key
+func signAzureRequest(req *http.Request, account string, key []byte) {
+	var b strings.Builder
+	b.WriteString(req.Method + "\n")
+	for _, header := range []string{"Content-Encoding", "Content-Language", "Content-Length", "Content-MD5", "Content-Type", "Date",
+		"If-Modified-Since", "If-Match", "If-None-Match", "If-Unmodified-Since", "Range"} {
+		value := req.Header.Get(header)
+		if header == "Content-Length" && value == "0" {
+			value = ""
+		}
+		b.WriteString(value + "\n")
+	}
+
+	// The x-ms- headers, sorted by their lowercase name
+	var headers []string
+	for name := range req.Header {
+		if strings.HasPrefix(strings.ToLower(name), "x-ms-") {
+			headers = append(headers, name)
+		}
+	}
+	sort.Slice(headers, func(i, j int) bool {
+		return strings.ToLower(headers[i]) < strings.ToLower(headers[j])
+	})
+	for _, name := range headers {
+		b.WriteString(strings.ToLower(name) + ":" + strings.TrimSpace(req.Header.Get(name)) + "\n")
+	}
+
+	// The resource, followed by the parameters of the query sorted by their lowercase name
+	b.WriteString("/" + account + req.URL.EscapedPath())
+	query := map[string][]string{}
+	var params []string
+	for name, values := range req.URL.Query() {
+		lower := strings.ToLower(name)
+		if _, ok := query[lower]; !ok {
+			params = append(params, lower)
+		}
+		query[lower] = append(query[lower], values...)
+	}
+	sort.Strings(params)
+	for _, name := range params {
+		values := query[name]
+		sort.Strings(values)
+		b.WriteString("\n" + name + ":" + strings.Join(values, ","))
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(b.String()))
+	req.Header.Set("Authorization", fmt.Sprintf("SharedKey %s:%s", account, base64.StdEncoding.EncodeToString(mac.Sum(nil))))
+}
@@ -0,0 +1,241 @@
+package importer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+const (
+	// azuriteAccount and azuriteAccountKey are the well known account of the Azurite emulator
+	azuriteAccount    = "devstoreaccount1"
+	azuriteAccountKey = "Eby8vdM02xNOcqFlqUwJPLlmEtlCDXJ1OUzFT50uSRZ6IFsuFq2UVErCz4I6tq/K1SZFPTOtr/KBHBeksoGMGw=="
+	testSASSignature  = "c2VjcmV0"
+	testSASToken      = "sv=2019-02-02&sr=b&sp=r&sig=" + testSASSignature
+)
+
+// fakeAzureBlobServer serves the blobs of an account the way Azurite does, with the account in the path. Blobs in
+// public containers are served anonymously, the others require a SAS token or the shared key of the account.
+type fakeAzureBlobServer struct {
+	*httptest.Server
+	blobs            map[string][]byte
+	publicContainers map[string]bool
+}
+
+func newFakeAzureBlobServer() *fakeAzureBlobServer {
+	s := &fakeAzureBlobServer{
+		blobs:            map[string][]byte{},
+		publicContainers: map[string]bool{},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// endpoint returns the blob service endpoint of the account.
+func (s *fakeAzureBlobServer) endpoint() string {
+	return s.URL + "/" + azuriteAccount
+}
+
+func (s *fakeAzureBlobServer) writeError(w http.ResponseWriter, code int, errorCode, message string) {
+	w.Header().Set("x-ms-error-code", errorCode)
+	w.WriteHeader(code)
+	fmt.Fprintf(w, `<?xml version="1.0" encoding="utf-8"?><Error><Code>%s</Code><Message>%s</Message></Error>`, errorCode, message)
+}
+
+func (s *fakeAzureBlobServer) authorized(r *http.Request) bool {
+	if r.URL.Query().Get("sig") != "" {
+		return r.URL.Query().Get("sig") == testSASSignature
+	}
+	auth := r.Header.Get("Authorization")
+	if auth == "" {
+		return false
+	}
+	// Sign the request again, without the authorization
+	req, _ := http.NewRequest(r.Method, r.URL.String(), nil)
+	for name, values := range r.Header {
+		if name != "Authorization" {
+			req.Header[name] = values
+		}
+	}
+	key, _ := base64.StdEncoding.DecodeString(azuriteAccountKey)
+	signAzureRequest(req, azuriteAccount, key)
+	return req.Header.Get("Authorization") == auth
+}
+
+func (s *fakeAzureBlobServer) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("x-ms-version") == "" {
+		s.writeError(w, http.StatusBadRequest, "MissingRequiredHeader", "An HTTP header that's mandatory for this request is not specified.")
+		return
+	}
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"+azuriteAccount+"/"), "/", 2)
+	if len(parts) != 2 {
+		s.writeError(w, http.StatusBadRequest, "InvalidUri", "The requested URI does not represent any resource on the server.")
+		return
+	}
+	if !s.publicContainers[parts[0]] && !s.authorized(r) {
+		s.writeError(w, http.StatusForbidden, "AuthenticationFailed", "Server failed to authenticate the request.")
+		return
+	}
+	data, ok := s.blobs[parts[0]+"/"+parts[1]]
+	if !ok {
+		s.writeError(w, http.StatusNotFound, "BlobNotFound", "The specified blob does not exist.")
+		return
+	}
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", len(data)))
+	w.Write(data)
+}
+
+var _ = Describe("Azure Blob data source", func() {
+	var (
+		ad     *AzureBlobDataSource
+		server *fakeAzureBlobServer
+		tmpDir string
+		err    error
+	)
+
+	BeforeEach(func() {
+		server = newFakeAzureBlobServer()
+		// Random data, so the compressed blob is larger than the headers that are checked
+		data := make([]byte, 4096)
+		_, err = rand.Read(data)
+		Expect(err).NotTo(HaveOccurred())
+		server.blobs["public/disk.vhd"] = data
+		server.blobs["private/images/disk.vhd"] = data
+		server.publicContainers["public"] = true
+		tmpDir, err = ioutil.TempDir("", "azure")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		if ad != nil {
+			ad.Close()
+			ad = nil
+		}
+		server.Close()
+		os.RemoveAll(tmpDir)
+	})
+
+	It("Should read a blob of a public container anonymously, and write raw data directly to the target", func() {
+		ad, err = NewAzureBlobDataSource(server.endpoint()+"/public/disk.vhd", "", "", AzureBlobOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ad.size).To(Equal(uint64(4096)))
+		phase, err := ad.Info()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(phase).To(Equal(ProcessingPhaseTransferDataFile))
+		Expect(ad.readers.progressReader).NotTo(BeNil())
+		target := filepath.Join(tmpDir, "disk.img")
+		phase, err = ad.TransferFile(target)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(phase).To(Equal(ProcessingPhaseResize))
+		data, err := ioutil.ReadFile(target)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(data).To(Equal(server.blobs["public/disk.vhd"]))
+	})
+
+	It("Should decompress a compressed blob", func() {
+		var buf bytes.Buffer
+		gzw := gzip.NewWriter(&buf)
+		_, err := gzw.Write(server.blobs["public/disk.vhd"])
+		Expect(err).NotTo(HaveOccurred())
+		Expect(gzw.Close()).To(Succeed())
+		server.blobs["public/disk.vhd.gz"] = buf.Bytes()
+
+		ad, err = NewAzureBlobDataSource(server.endpoint()+"/public/disk.vhd.gz", "", "", AzureBlobOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = ad.Info()
+		Expect(err).NotTo(HaveOccurred())
+		target := filepath.Join(tmpDir, "disk.img")
+		_, err = ad.TransferFile(target)
+		Expect(err).NotTo(HaveOccurred())
+		data, err := ioutil.ReadFile(target)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(data).To(Equal(server.blobs["public/disk.vhd"]))
+	})
+
+	It("Should verify the checksum of the blob", func() {
+		ad, err = NewAzureBlobDataSource(server.endpoint()+"/public/disk.vhd", "sha256:"+strings.Repeat("0", 64), "", AzureBlobOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = ad.Info()
+		Expect(err).NotTo(HaveOccurred())
+		_, err = ad.TransferFile(filepath.Join(tmpDir, "disk.img"))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Should read a private blob with a SAS token", func() {
+		ad, err = NewAzureBlobDataSource(server.endpoint()+"/private/images/disk.vhd", "", "", AzureBlobOptions{SASToken: "?" + testSASToken})
+		Expect(err).NotTo(HaveOccurred())
+		data, err := ioutil.ReadAll(ad.blobReader)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(data).To(Equal(server.blobs["private/images/disk.vhd"]))
+	})
+
+	It("Should not put the SAS token in the error", func() {
+		ad, err = NewAzureBlobDataSource(server.endpoint()+"/private/images/disk.vhd", "", "", AzureBlobOptions{SASToken: "sv=2019-02-02&sig=d3Jvbmc"})
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("AuthenticationFailed"))
+		Expect(err.Error()).NotTo(ContainSubstring("d3Jvbmc"))
+	})
+
+	It("Should read a private blob with the shared key of the account", func() {
+		ad, err = NewAzureBlobDataSource(server.endpoint()+"/private/images/disk.vhd", "", "", AzureBlobOptions{
+			Account:    azuriteAccount,
+			AccountKey: azuriteAccountKey,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		data, err := ioutil.ReadAll(ad.blobReader)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(data).To(Equal(server.blobs["private/images/disk.vhd"]))
+	})
+
+	It("Should fail with the message of the service, if the shared key is wrong", func() {
+		ad, err = NewAzureBlobDataSource(server.endpoint()+"/private/images/disk.vhd", "", "", AzureBlobOptions{
+			Account:    azuriteAccount,
+			AccountKey: base64.StdEncoding.EncodeToString([]byte("wrong key")),
+		})
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("Server failed to authenticate the request."))
+	})
+
+	It("Should fail on an account key that is not base64 encoded", func() {
+		ad, err = NewAzureBlobDataSource(server.endpoint()+"/private/images/disk.vhd", "", "", AzureBlobOptions{
+			Account:    azuriteAccount,
+			AccountKey: "not base64!",
+		})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Should fail with the message of the service, if the blob does not exist", func() {
+		ad, err = NewAzureBlobDataSource(server.endpoint()+"/public/other.vhd", "", "", AzureBlobOptions{})
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("BlobNotFound"))
+	})
+
+	It("Should fail on a url without a blob", func() {
+		ad, err = NewAzureBlobDataSource("https://account.blob.core.windows.net/container", "", "", AzureBlobOptions{})
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("Azure shared key", func() {
+	It("Should sign the request as described by the Blob service", func() {
+		req, err := http.NewRequest(http.MethodGet, "http://127.0.0.1:10000/devstoreaccount1/images/dir/disk%20a.vhd?timeout=30", nil)
+		Expect(err).NotTo(HaveOccurred())
+		req.Header.Set("x-ms-date", "Fri, 16 Oct 2026 12:00:00 GMT")
+		req.Header.Set("x-ms-version", "2019-02-02")
+		key, err := base64.StdEncoding.DecodeString(azuriteAccountKey)
+		Expect(err).NotTo(HaveOccurred())
+		signAzureRequest(req, azuriteAccount, key)
+		Expect(req.Header.Get("Authorization")).To(Equal("SharedKey devstoreaccount1:9DNRzP3D9vrpe2rtXMhez4EXShsDSiRQjDzUBZ2Iaoc="))
+	})
+})
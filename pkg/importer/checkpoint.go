@@ -0,0 +1,266 @@
+/*
+Copyright 2020 The CDI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package importer
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"k8s.io/klog"
+
+	"kubevirt.io/containerized-data-importer/pkg/util"
+)
+
+const (
+	// checkpointExt is appended to the name of a partially transferred file to get the name of its checkpoint file.
+	checkpointExt = ".checkpoint"
+)
+
+// may be overridden in tests
+var checkpointInterval = int64(64 * 1024 * 1024)
+
+// transferCheckpoint records how far a transfer into a file got, and enough information about the source to
+// determine if the transfer can be resumed.
+type transferCheckpoint struct {
+	// URL is the source the data is being transferred from.
+	URL string `json:"url"`
+	// Offset is the number of bytes that have been written to the file, and synced to disk.
+	Offset int64 `json:"offset"`
+	// ETag is the entity tag of the source, if the source supplied one.
+	ETag string `json:"etag,omitempty"`
+	// LastModified is the last modified time of the source, if the source supplied one.
+	LastModified string `json:"lastModified,omitempty"`
+	// ContentLength is the total size of the source.
+	ContentLength uint64 `json:"contentLength,omitempty"`
+	// Ranges are the parts of the source that are still missing, if it is transferred with multiple range requests.
+	// The Offset is not used in that case.
+	Ranges []byteRange `json:"ranges,omitempty"`
+}
+
+func checkpointFileName(fileName string) string {
+	return fileName + checkpointExt
+}
+
+// loadCheckpoint reads the checkpoint for the passed in file. If there is no checkpoint, nil is returned.
+func loadCheckpoint(fileName string) (*transferCheckpoint, error) {
+	data, err := ioutil.ReadFile(checkpointFileName(fileName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not read checkpoint for %q", fileName)
+	}
+	checkpoint := &transferCheckpoint{}
+	if err := json.Unmarshal(data, checkpoint); err != nil {
+		return nil, errors.Wrapf(err, "invalid checkpoint for %q", fileName)
+	}
+	return checkpoint, nil
+}
+
+// save atomically writes the checkpoint for the passed in file.
+func (c *transferCheckpoint) save(fileName string) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return errors.Wrap(err, "could not marshal checkpoint")
+	}
+	tmpFile := checkpointFileName(fileName) + ".tmp"
+	if err := ioutil.WriteFile(tmpFile, data, 0644); err != nil {
+		return errors.Wrapf(err, "could not write checkpoint for %q", fileName)
+	}
+	return os.Rename(tmpFile, checkpointFileName(fileName))
+}
+
+// removeCheckpoint removes the checkpoint for the passed in file, if one exists.
+func removeCheckpoint(fileName string) error {
+	if err := os.Remove(checkpointFileName(fileName)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// validator returns the value to use in an If-Range header when resuming from this checkpoint.
+func (c *transferCheckpoint) validator() string {
+	if c.ETag != "" {
+		return c.ETag
+	}
+	return c.LastModified
+}
+
+// matches returns true if the passed in checkpoint was made while transferring the same source as the receiver.
+func (c *transferCheckpoint) matches(other *transferCheckpoint) bool {
+	if other == nil || c.validator() == "" {
+		return false
+	}
+	return c.URL == other.URL && c.ETag == other.ETag && c.LastModified == other.LastModified && c.ContentLength == other.ContentLength
+}
+
+// checkpointWriter is a writer that periodically syncs the file it is writing to, and records the offset in a checkpoint.
+// The blocks that only contain zeroes are not written, a resumed transfer extends the file to the checkpoint offset.
+type checkpointWriter struct {
+	file       *os.File
+	writer     *util.SparseWriter
+	fileName   string
+	checkpoint *transferCheckpoint
+	lastSaved  int64
+}
+
+func (w *checkpointWriter) Write(p []byte) (int, error) {
+	n, err := w.writer.Write(p)
+	w.checkpoint.Offset += int64(n)
+	if err == nil && w.checkpoint.Offset-w.lastSaved >= checkpointInterval {
+		err = w.flush()
+	}
+	return n, err
+}
+
+// flush syncs the file and then saves the checkpoint, so the checkpoint never points past the data on disk.
+func (w *checkpointWriter) flush() error {
+	if err := w.writer.Flush(); err != nil {
+		return errors.Wrapf(err, "could not write %q", w.fileName)
+	}
+	if err := w.file.Sync(); err != nil {
+		return errors.Wrapf(err, "could not sync %q", w.fileName)
+	}
+	if err := w.checkpoint.save(w.fileName); err != nil {
+		return err
+	}
+	w.lastSaved = w.checkpoint.Offset
+	return nil
+}
+
+// streamDataToFileWithCheckpoint streams the reader into the file starting at the offset in the checkpoint. While
+// streaming the checkpoint is updated, if the stream fails the partial file and the checkpoint are left behind so a
+// later attempt can continue where this one stopped. Once the stream completes the checkpoint is removed.
+func streamDataToFileWithCheckpoint(r io.Reader, fileName string, checkpoint *transferCheckpoint) error {
+	var outFile *os.File
+	var err error
+	if checkpoint.Offset > 0 {
+		outFile, err = os.OpenFile(fileName, os.O_WRONLY, os.ModePerm)
+		if err == nil {
+			err = outFile.Truncate(checkpoint.Offset)
+		}
+	} else {
+		if err = os.Remove(fileName); err != nil && !os.IsNotExist(err) {
+			return errors.Wrapf(err, "could not remove stale file %q", fileName)
+		}
+		outFile, err = os.OpenFile(fileName, os.O_CREATE|os.O_EXCL|os.O_WRONLY, os.ModePerm)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "could not open file %q", fileName)
+	}
+	defer outFile.Close()
+	sparseWriter, err := util.NewSparseWriter(outFile, checkpoint.Offset)
+	if err != nil {
+		return err
+	}
+
+	writer := &checkpointWriter{
+		file:       outFile,
+		writer:     sparseWriter,
+		fileName:   fileName,
+		checkpoint: checkpoint,
+		lastSaved:  checkpoint.Offset,
+	}
+	// Save the initial checkpoint so an interruption before the first interval can still be detected.
+	if err := checkpoint.save(fileName); err != nil {
+		return err
+	}
+	klog.V(1).Infof("Writing data at offset %d...\n", checkpoint.Offset)
+	if _, err = io.Copy(writer, r); err != nil {
+		klog.Errorf("Unable to write file from dataReader: %v\n", err)
+		if flushErr := writer.flush(); flushErr != nil {
+			klog.Errorf("Unable to save checkpoint: %v\n", flushErr)
+		} else {
+			klog.V(1).Infof("Saved checkpoint for %q at offset %d\n", fileName, checkpoint.Offset)
+		}
+		return errors.Wrapf(err, "unable to write to file")
+	}
+	if err = sparseWriter.Flush(); err != nil {
+		return errors.Wrapf(err, "unable to write to file")
+	}
+	if err = outFile.Sync(); err != nil {
+		return err
+	}
+	return removeCheckpoint(fileName)
+}
+
+// resumeFunc requests the data of a source again, starting at the offset of the checkpoint of the passed in file. It
+// returns the reader of the data and the offset the data starts at, 0 if the source returned the entire content.
+type resumeFunc func(checkpoint *transferCheckpoint, fileName string) (io.Reader, int64, error)
+
+// streamDataToFileWithResume streams the reader into the file like streamDataToFileWithCheckpoint. If the stream
+// fails with a retryable error, like a connection that is reset while the data is read, the data is requested again
+// from the checkpoint the failed attempt left behind, as a retry of the transfer. If the reader is nil, the first
+// attempt already resumes from the checkpoint.
+func streamDataToFileWithResume(r io.Reader, fileName string, current *transferCheckpoint, resume resumeFunc) error {
+	return retry("transfer of "+current.URL, func() error {
+		if r == nil {
+			previous, err := loadCheckpoint(fileName)
+			if err != nil {
+				return err
+			}
+			if !current.matches(previous) {
+				return errors.Errorf("no checkpoint to resume the transfer of %q from", fileName)
+			}
+			var offset int64
+			if r, offset, err = resume(previous, fileName); err != nil {
+				return err
+			}
+			current.Offset = offset
+		}
+		// The reader is only read once, the next attempt resumes from the checkpoint this one saves.
+		reader := r
+		r = nil
+		return streamDataToFileWithCheckpoint(reader, fileName, current)
+	})
+}
+
+// CleanDirPreservingCheckpoints cleans the contents of a directory like CleanDir, except for transfer checkpoints and
+// the partially transferred files they belong to.
+func CleanDirPreservingCheckpoints(dest string) error {
+	dir, err := ioutil.ReadDir(dest)
+	if err != nil {
+		klog.Errorf("Unable read directory to clean: %s, %v", dest, err)
+		return err
+	}
+	preserve := make(map[string]bool)
+	for _, d := range dir {
+		if !d.IsDir() && strings.HasSuffix(d.Name(), checkpointExt) {
+			preserve[d.Name()] = true
+			preserve[strings.TrimSuffix(d.Name(), checkpointExt)] = true
+		}
+	}
+	for _, d := range dir {
+		if preserve[d.Name()] {
+			klog.V(1).Infoln("preserving file: " + filepath.Join(dest, d.Name()))
+			continue
+		}
+		klog.V(1).Infoln("deleting file: " + filepath.Join(dest, d.Name()))
+		err = os.RemoveAll(filepath.Join(dest, d.Name()))
+		if err != nil {
+			klog.Errorf("Unable to delete file: %s, %v", filepath.Join(dest, d.Name()), err)
+			return err
+		}
+	}
+	return nil
+}
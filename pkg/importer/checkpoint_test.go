@@ -0,0 +1,128 @@
+package importer
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+)
+
+var _ = Describe("Transfer checkpoint", func() {
+	var (
+		tmpDir   string
+		fileName string
+		err      error
+	)
+
+	BeforeEach(func() {
+		tmpDir, err = ioutil.TempDir("", "checkpoint")
+		Expect(err).NotTo(HaveOccurred())
+		fileName = filepath.Join(tmpDir, "disk.img")
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(tmpDir)
+	})
+
+	It("should return nil when loading a non existing checkpoint", func() {
+		checkpoint, err := loadCheckpoint(fileName)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(checkpoint).To(BeNil())
+	})
+
+	It("should load a saved checkpoint", func() {
+		checkpoint := &transferCheckpoint{URL: "http://test/disk.img", Offset: 1024, ETag: "\"abc\"", ContentLength: 4096}
+		Expect(checkpoint.save(fileName)).To(Succeed())
+		loaded, err := loadCheckpoint(fileName)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(loaded).To(Equal(checkpoint))
+		Expect(removeCheckpoint(fileName)).To(Succeed())
+		_, err = os.Stat(checkpointFileName(fileName))
+		Expect(os.IsNotExist(err)).To(BeTrue())
+	})
+
+	It("should fail loading an invalid checkpoint", func() {
+		Expect(ioutil.WriteFile(checkpointFileName(fileName), []byte("invalid"), 0644)).To(Succeed())
+		_, err := loadCheckpoint(fileName)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should only match checkpoints from the same unchanged source", func() {
+		checkpoint := &transferCheckpoint{URL: "http://test/disk.img", ETag: "\"abc\"", ContentLength: 4096}
+		Expect(checkpoint.matches(&transferCheckpoint{URL: "http://test/disk.img", Offset: 10, ETag: "\"abc\"", ContentLength: 4096})).To(BeTrue())
+		Expect(checkpoint.matches(&transferCheckpoint{URL: "http://test/disk.img", Offset: 10, ETag: "\"def\"", ContentLength: 4096})).To(BeFalse())
+		Expect(checkpoint.matches(&transferCheckpoint{URL: "http://other/disk.img", Offset: 10, ETag: "\"abc\"", ContentLength: 4096})).To(BeFalse())
+		Expect(checkpoint.matches(nil)).To(BeFalse())
+		noValidator := &transferCheckpoint{URL: "http://test/disk.img"}
+		Expect(noValidator.matches(&transferCheckpoint{URL: "http://test/disk.img"})).To(BeFalse())
+	})
+
+	It("should write the entire stream and remove the checkpoint", func() {
+		data := bytes.Repeat([]byte("0123456789"), 1000)
+		checkpoint := &transferCheckpoint{URL: "http://test/disk.img", ETag: "\"abc\""}
+		err = streamDataToFileWithCheckpoint(bytes.NewReader(data), fileName, checkpoint)
+		Expect(err).NotTo(HaveOccurred())
+		written, err := ioutil.ReadFile(fileName)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(written).To(Equal(data))
+		_, err = os.Stat(checkpointFileName(fileName))
+		Expect(os.IsNotExist(err)).To(BeTrue())
+	})
+
+	It("should continue writing at the checkpoint offset", func() {
+		data := bytes.Repeat([]byte("0123456789"), 1000)
+		// Garbage past the offset should be truncated.
+		Expect(ioutil.WriteFile(fileName, append(data[:5000], []byte("garbage")...), 0644)).To(Succeed())
+		checkpoint := &transferCheckpoint{URL: "http://test/disk.img", ETag: "\"abc\"", Offset: 5000}
+		err = streamDataToFileWithCheckpoint(bytes.NewReader(data[5000:]), fileName, checkpoint)
+		Expect(err).NotTo(HaveOccurred())
+		written, err := ioutil.ReadFile(fileName)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(written).To(Equal(data))
+	})
+
+	It("should keep the partial file and the checkpoint on a stream error", func() {
+		defer func(interval int64) { checkpointInterval = interval }(checkpointInterval)
+		checkpointInterval = 10
+		checkpoint := &transferCheckpoint{URL: "http://test/disk.img", ETag: "\"abc\""}
+		err = streamDataToFileWithCheckpoint(&failingReader{data: []byte("0123456789012345")}, fileName, checkpoint)
+		Expect(err).To(HaveOccurred())
+		loaded, err := loadCheckpoint(fileName)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(loaded.Offset).To(Equal(int64(16)))
+		info, err := os.Stat(fileName)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Size()).To(Equal(int64(16)))
+	})
+
+	It("should preserve checkpointed files when cleaning a directory", func() {
+		Expect(ioutil.WriteFile(fileName, []byte("partial"), 0644)).To(Succeed())
+		Expect((&transferCheckpoint{Offset: 7}).save(fileName)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(tmpDir, "other"), []byte("other"), 0644)).To(Succeed())
+		Expect(os.Mkdir(filepath.Join(tmpDir, "dir"), 0755)).To(Succeed())
+		Expect(CleanDirPreservingCheckpoints(tmpDir)).To(Succeed())
+		entries, err := ioutil.ReadDir(tmpDir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(HaveLen(2))
+		Expect(entries[0].Name()).To(Equal("disk.img"))
+		Expect(entries[1].Name()).To(Equal("disk.img" + checkpointExt))
+	})
+})
+
+// failingReader returns its data, and then fails instead of returning EOF.
+type failingReader struct {
+	data []byte
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, errors.New("connection reset")
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
@@ -63,6 +63,9 @@ var ErrRequiresScratchSpace = fmt.Errorf("scratch space required and none found"
 // ErrInvalidPath indicates that the path is invalid.
 var ErrInvalidPath = fmt.Errorf("invalid transfer path")
 
+// ErrChecksumMismatch indicates that the data does not match the expected checksum.
+var ErrChecksumMismatch = fmt.Errorf("checksum mismatch")
+
 // may be overridden in tests
 var getAvailableSpaceBlockFunc = util.GetAvailableSpaceBlock
 var getAvailableSpaceFunc = util.GetAvailableSpace
@@ -124,17 +127,18 @@ func NewDataProcessor(dataSource DataSourceInterface, dataFile, dataDir, scratch
 
 // ProcessData is the main synchronous processing loop
 func (dp *DataProcessor) ProcessData() error {
+	// Checkpointed transfers are preserved during clean up, so a later attempt can resume them.
 	if util.GetAvailableSpace(dp.scratchDataDir) > int64(0) {
 		// Clean up before trying to write, in case a previous attempt left a mess. Note the deferred cleanup is intentional.
-		if err := CleanDir(dp.scratchDataDir); err != nil {
+		if err := CleanDirPreservingCheckpoints(dp.scratchDataDir); err != nil {
 			return errors.Wrap(err, "Failure cleaning up temporary scratch space")
 		}
 		// Attempt to be a good citizen and clean up my mess at the end.
-		defer CleanDir(dp.scratchDataDir)
+		defer CleanDirPreservingCheckpoints(dp.scratchDataDir)
 	}
 	if util.GetAvailableSpace(dp.dataDir) > int64(0) {
 		// Clean up data dir before trying to write in case a previous attempt failed and left some stuff behind.
-		if err := CleanDir(dp.dataDir); err != nil {
+		if err := CleanDirPreservingCheckpoints(dp.dataDir); err != nil {
 			return errors.Wrap(err, "Failure cleaning up target space")
 		}
 	}
@@ -17,12 +17,18 @@ limitations under the License.
 package importer
 
 import (
+	"archive/tar"
 	"bytes"
+	"compress/bzip2"
 	"compress/gzip"
 	"encoding/hex"
+	"hash"
 	"io"
 	"io/ioutil"
+	"os"
+	"path"
 	"strconv"
+	"sync/atomic"
 
 	"github.com/pkg/errors"
 	"github.com/ulikunitz/xz"
@@ -30,10 +36,12 @@ import (
 	"k8s.io/klog"
 
 	"github.com/prometheus/client_golang/prometheus"
+	cdiv1 "kubevirt.io/containerized-data-importer/pkg/apis/core/v1alpha1"
 	"kubevirt.io/containerized-data-importer/pkg/common"
 	"kubevirt.io/containerized-data-importer/pkg/image"
 	"kubevirt.io/containerized-data-importer/pkg/util"
 	prometheusutil "kubevirt.io/containerized-data-importer/pkg/util/prometheus"
+	"kubevirt.io/containerized-data-importer/third_party/forked/golang/zstd"
 )
 
 var (
@@ -67,11 +75,30 @@ type reader struct {
 
 // FormatReaders contains the stack of readers needed to get information from the input stream (io.ReadCloser)
 type FormatReaders struct {
-	readers        []reader
-	buf            []byte // holds file headers
-	Convert        bool
-	Archived       bool
-	progressReader *prometheusutil.ProgressReader
+	readers         []reader
+	buf             []byte // holds file headers
+	Convert         bool
+	Archived        bool
+	RequiresScratch bool // the image is converted from scratch space, not directly from the endpoint
+	Zipped          bool // the stream is a zip archive, which has to be stored before it can be extracted
+	ImageArchive    bool // the stream is a docker-archive, oci-archive or OCI image layout tarball, which has to be stored before the disk image can be extracted
+	progressReader  *prometheusutil.ProgressReader
+	checksumReader  *checksumReader
+	contentType     cdiv1.DataVolumeContentType
+	diskPath        string // path of the disk image in a tar archive, if empty the archive has to contain a single file
+}
+
+// checksumReader hashes all the data read from the source stream, before any decompression.
+type checksumReader struct {
+	io.ReadCloser
+	checksum *util.Checksum
+	hash     hash.Hash
+}
+
+func (r *checksumReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.hash.Write(p[:n])
+	return n, err
 }
 
 const (
@@ -79,20 +106,43 @@ const (
 	rdrMulti
 	rdrXz
 	rdrStream
+	rdrZst
+	rdrBz2
+	rdrTar
 )
 
 // map scheme and format to rdrType
 var rdrTypM = map[string]int{
 	"gz":     rdrGz,
 	"xz":     rdrXz,
+	"zst":    rdrZst,
+	"bz2":    rdrBz2,
+	"tar":    rdrTar,
 	"stream": rdrStream,
 }
 
-// NewFormatReaders creates a new instance of FormatReaders using the input stream and content type passed in.
-func NewFormatReaders(stream io.ReadCloser, total uint64) (*FormatReaders, error) {
+// NewFormatReaders creates a new instance of FormatReaders using the input stream and content type passed in. If a
+// checksum in the form <algorithm>:<hex digest> is passed in, the stream is hashed while it is read, and can be verified
+// with VerifyChecksum once the data has been transferred. Unless the content type is archive, a tar archive is expected
+// to hold a disk image, which is either the file at diskPath, or the only file in the archive if diskPath is empty.
+func NewFormatReaders(stream io.ReadCloser, total uint64, checksum string, contentType cdiv1.DataVolumeContentType, diskPath string) (*FormatReaders, error) {
 	var err error
 	readers := &FormatReaders{
-		buf: make([]byte, image.MaxExpectedHdrSize),
+		buf:         make([]byte, image.MaxExpectedHdrSize),
+		contentType: contentType,
+		diskPath:    diskPath,
+	}
+	expected, err := util.ParseChecksum(checksum)
+	if err != nil {
+		return readers, err
+	}
+	if expected != nil {
+		readers.checksumReader = &checksumReader{
+			ReadCloser: stream,
+			checksum:   expected,
+			hash:       expected.NewHash(),
+		}
+		stream = readers.checksumReader
 	}
 	if total > uint64(0) {
 		readers.progressReader = prometheusutil.NewProgressReader(stream, total, progress, ownerUID)
@@ -116,10 +166,20 @@ func (fr *FormatReaders) constructReaders(r io.ReadCloser) error {
 			break // done processing headers, we have the orig source file
 		}
 		klog.V(2).Infof("found header of type %q\n", hdr.Format)
+		if hdr.Format == "tar" && fr.contentType != cdiv1.DataVolumeArchive {
+			// the disk image is read from the archive, and its own headers are checked next
+			if err := fr.appendTarDiskReader(); err != nil {
+				return err
+			}
+			if fr.ImageArchive {
+				break
+			}
+			continue
+		}
 		// create format-specific reader and append it to dataStream readers stack
 		fr.fileFormatSelector(hdr)
-		// exit loop if hdr is qcow2
-		if hdr.Format == "qcow2" {
+		// exit loop if hdr is a disk image format, or a zip archive whose entries are not a single stream
+		if fr.Convert || fr.Zipped {
 			break
 		}
 	}
@@ -154,7 +214,7 @@ func (fr *FormatReaders) TopReader() io.ReadCloser {
 }
 
 // Based on the passed in header, append the format-specific reader to the readers stack,
-// and update the receiver Size field. Note: a bool is set in the receiver for qcow2 files.
+// and update the receiver Size field. Note: a bool is set in the receiver for qcow2, vmdk, vhd, vhdx and vdi files, and for zip archives.
 func (fr *FormatReaders) fileFormatSelector(hdr *image.Header) {
 	var r io.Reader
 	var err error
@@ -168,11 +228,28 @@ func (fr *FormatReaders) fileFormatSelector(hdr *image.Header) {
 	case "qcow2":
 		r, err = fr.qcow2NopReader(hdr)
 		fr.Convert = true
+	case "vmdk", "vhd", "vhdx", "vdi":
+		// There is no reader for these formats, they are converted by qemu-img from scratch space.
+		fr.Convert = true
+		fr.RequiresScratch = true
+	case "zip":
+		// There is no reader for zip, the archive is extracted once it is stored in scratch space.
+		fr.Zipped = true
 	case "xz":
 		r, err = fr.xzReader()
 		if err == nil {
 			fr.Archived = true
 		}
+	case "zst":
+		r, err = fr.zstReader()
+		if err == nil {
+			fr.Archived = true
+		}
+	case "bz2":
+		r, err = fr.bz2Reader()
+		if err == nil {
+			fr.Archived = true
+		}
 	}
 	if err == nil && r != nil {
 		fr.appendReader(rdrTypM[fFmt], r)
@@ -219,6 +296,118 @@ func (fr *FormatReaders) xzReader() (io.Reader, error) {
 	return xz, nil
 }
 
+// Return the zstd reader of the endpoint "through the eye" of the previous reader. Concatenated frames
+// are read as a single stream. Note: the zstd reader is not a closer so we wrap a nop Closer around it.
+func (fr *FormatReaders) zstReader() (io.Reader, error) {
+	return zstd.NewReader(fr.TopReader()), nil
+}
+
+// Return the bzip2 reader of the endpoint "through the eye" of the previous reader. Note: the bzip2
+// reader is not a closer so we wrap a nop Closer around it.
+func (fr *FormatReaders) bz2Reader() (io.Reader, error) {
+	return bzip2.NewReader(fr.TopReader()), nil
+}
+
+// Append to the receiver's reader stack a reader of the disk image stored in the tar archive read "through the eye" of
+// the previous reader. The tar archive is treated like a compressed file, the data has to be written to its
+// destination before it can be converted. If the first file of the archive is a file of an image archive, the archive
+// is read as is instead, and the disk image is extracted once it is stored in scratch space.
+func (fr *FormatReaders) appendTarDiskReader() error {
+	recorder := &recordingReader{r: fr.TopReader(), recording: true}
+	tr := tar.NewReader(recorder)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			if fr.diskPath != "" {
+				return errors.Errorf("disk image %q not found in tar archive", fr.diskPath)
+			}
+			return errors.New("no disk image found in tar archive")
+		}
+		if err != nil {
+			return errors.Wrap(err, "could not read tar header")
+		}
+		if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeRegA {
+			continue
+		}
+		if recorder.recording {
+			recorder.recording = false
+			if isImageArchiveFile(hdr.Name) {
+				klog.V(2).Infof("tar: found image archive file %q\n", hdr.Name)
+				// the headers read so far are re-read by the next reader
+				fr.appendReader(rdrMulti, bytes.NewReader(recorder.buf.Bytes()))
+				fr.ImageArchive = true
+				fr.Convert = true
+				fr.RequiresScratch = true
+				return nil
+			}
+			recorder.buf = bytes.Buffer{}
+		}
+		if fr.diskPath == "" || cleanTarPath(hdr.Name) == cleanTarPath(fr.diskPath) {
+			klog.V(2).Infof("tar: extracting disk image %q\n", hdr.Name)
+			fr.appendReader(rdrTypM["tar"], &tarDiskReader{tr: tr, name: hdr.Name, single: fr.diskPath == ""})
+			fr.Archived = true
+			return nil
+		}
+	}
+}
+
+// cleanTarPath returns the path of a tar entry without leading slashes, so entry names can be compared.
+func cleanTarPath(name string) string {
+	return path.Clean("/" + name)[1:]
+}
+
+// recordingReader records the data read from a reader, until recording is stopped.
+type recordingReader struct {
+	r         io.Reader
+	buf       bytes.Buffer
+	recording bool
+}
+
+func (r *recordingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if r.recording {
+		r.buf.Write(p[:n])
+	}
+	return n, err
+}
+
+// tarDiskReader reads the disk image stored in a tar archive. If the disk image has to be the single file in the
+// archive, the rest of the archive is read once the disk image has been read, and an error is returned instead of
+// io.EOF if the archive contains another file.
+type tarDiskReader struct {
+	tr     *tar.Reader
+	name   string
+	single bool
+	err    error
+}
+
+func (r *tarDiskReader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	n, err := r.tr.Read(p)
+	if err == io.EOF && r.single {
+		err = r.checkSingleFile()
+	}
+	r.err = err
+	return n, err
+}
+
+func (r *tarDiskReader) checkSingleFile() error {
+	for {
+		hdr, err := r.tr.Next()
+		if err == io.EOF {
+			return io.EOF
+		}
+		if err != nil {
+			return errors.Wrap(err, "could not read tar header")
+		}
+		if hdr.Typeflag == tar.TypeReg || hdr.Typeflag == tar.TypeRegA {
+			return errors.Errorf("tar archive contains more than one file, %q and %q, the disk path has to be set", r.name, hdr.Name)
+		}
+	}
+}
+
 // Return the matching header, if one is found, from the passed-in map of known headers. After a
 // successful read append a multi-reader to the receiver's reader stack.
 // Note: .iso files are not detected here but rather in the Size() function.
@@ -228,8 +417,9 @@ func (fr *FormatReaders) matchHeader(knownHdrs *image.Headers) (*image.Header, e
 	if err != nil {
 		return nil, err
 	}
-	// append multi-reader so that the header data can be re-read by subsequent readers
-	fr.appendReader(rdrMulti, bytes.NewReader(fr.buf))
+	// append multi-reader so that the header data can be re-read by subsequent readers. The header is copied
+	// since buf is reused for the next header, and a decompressor may not have consumed this one yet.
+	fr.appendReader(rdrMulti, bytes.NewReader(append([]byte(nil), fr.buf...)))
 
 	// loop through known headers until a match
 	for format, kh := range *knownHdrs {
@@ -260,7 +450,89 @@ func (fr *FormatReaders) Close() (rtnerr error) {
 	return rtnerr
 }
 
+// HasChecksum returns true if the stream is verified against a checksum.
+func (fr *FormatReaders) HasChecksum() bool {
+	return fr.checksumReader != nil
+}
+
+// VerifyChecksum reads any data left in the source stream, that was not needed by the readers, and compares the hash
+// of the stream against the expected checksum. ErrChecksumMismatch is returned if they don't match.
+func (fr *FormatReaders) VerifyChecksum() error {
+	if fr.checksumReader == nil {
+		return nil
+	}
+	if _, err := io.Copy(ioutil.Discard, fr.checksumReader); err != nil {
+		return errors.Wrap(err, "could not read remainder of stream to verify checksum")
+	}
+	if !fr.checksumReader.checksum.Matches(fr.checksumReader.hash) {
+		return errors.Wrapf(ErrChecksumMismatch, "expected %s, got %s:%s", fr.checksumReader.checksum,
+			fr.checksumReader.checksum.Algorithm, hex.EncodeToString(fr.checksumReader.hash.Sum(nil)))
+	}
+	klog.V(1).Infof("Verified checksum %s\n", fr.checksumReader.checksum)
+	return nil
+}
+
+// restartChecksum discards the hashed data, and hashes the passed in reader instead. This is used when a transfer is
+// resumed, and the start of the stream is read from what has already been written instead of the source.
+func (fr *FormatReaders) restartChecksum(prefix io.Reader) error {
+	if fr.checksumReader == nil {
+		return nil
+	}
+	fr.checksumReader.hash.Reset()
+	_, err := io.Copy(fr.checksumReader.hash, prefix)
+	return err
+}
+
+// restartChecksumFromFile hashes the first offset bytes of the file, instead of the data read from the source so far.
+func (fr *FormatReaders) restartChecksumFromFile(fileName string, offset int64) error {
+	if !fr.HasChecksum() {
+		return nil
+	}
+	file, err := os.Open(fileName)
+	if err != nil {
+		return errors.Wrapf(err, "could not open %q to hash transferred data", fileName)
+	}
+	defer file.Close()
+	if err := fr.restartChecksum(io.LimitReader(file, offset)); err != nil {
+		return errors.Wrapf(err, "could not hash transferred data in %q", fileName)
+	}
+	return nil
+}
+
+// resume replaces the stream of the source, which the readers read through the passed in counting reader, with the
+// passed in body, whose data starts at the passed in offset of the source. The checksum is restarted with the data
+// already written to the file, and the progress is set to the offset. The returned reader bypasses the format readers,
+// which is safe since only data that is written as is gets resumed.
+func (fr *FormatReaders) resume(source *util.CountingReader, body io.ReadCloser, fileName string, offset int64) (io.Reader, error) {
+	if err := fr.restartChecksumFromFile(fileName, offset); err != nil {
+		body.Close()
+		return nil, err
+	}
+	// Swap the stream of the source for the new one, so the idle poller, the progress and the checksum keep working.
+	source.Reader.Close()
+	source.Reader = body
+	if fr.progressReader != nil {
+		atomic.StoreUint64(&fr.progressReader.Current, uint64(offset))
+		return fr.progressReader, nil
+	}
+	if fr.checksumReader != nil {
+		return fr.checksumReader, nil
+	}
+	return source, nil
+}
+
 // StartProgressUpdate starts the go routine to automatically update the progress on a set interval.
+// Nothing is updated if the size of the data is unknown.
 func (fr *FormatReaders) StartProgressUpdate() {
-	fr.progressReader.StartTimedUpdate()
+	if fr.progressReader != nil {
+		fr.progressReader.StartTimedUpdate()
+	}
+}
+
+// StopProgressUpdate marks the data as transferred, so the progress is set to 100% and no longer updated. This is
+// needed when the end of the stream is not read, like the padding after the end of a tar archive.
+func (fr *FormatReaders) StopProgressUpdate() {
+	if fr.progressReader != nil {
+		fr.progressReader.SetDone(true)
+	}
 }
@@ -1,8 +1,16 @@
 package importer
 
 import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"crypto/sha256"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"math/rand"
 	"os"
 	"path/filepath"
 	"strings"
@@ -10,7 +18,9 @@ import (
 	. "github.com/onsi/ginkgo"
 	"github.com/onsi/ginkgo/extensions/table"
 	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
 
+	cdiv1 "kubevirt.io/containerized-data-importer/pkg/apis/core/v1alpha1"
 	"kubevirt.io/containerized-data-importer/pkg/image"
 	"kubevirt.io/containerized-data-importer/tests/utils"
 )
@@ -26,6 +36,8 @@ var (
 	archiveFilePath, _        = utils.ArchiveFiles(archiveFileNameWithoutExt, os.TempDir(), tinyCoreFilePath, cirrosFilePath)
 	archiveFileNameWithoutExt = strings.TrimSuffix(archiveFileName, filepath.Ext(archiveFileName))
 	cirrosFilePath            = filepath.Join(imageDir, cirrosFileName)
+	numbersZstFilePath        = filepath.Join(imageDir, "numbers.txt"+image.ExtZst)
+	numbersBz2FilePath        = filepath.Join(imageDir, "numbers.txt"+image.ExtBz2)
 	stringRdr                 = strings.NewReader("test data for reader 1")
 )
 
@@ -46,7 +58,7 @@ var _ = Describe("Format Readers", func() {
 		Expect(err).ToNot(HaveOccurred())
 		defer f.Close()
 
-		fr, err = NewFormatReaders(f, uint64(0))
+		fr, err = NewFormatReaders(f, uint64(0), "", cdiv1.DataVolumeKubeVirt, "")
 		if wantErr {
 			Expect(err).To(HaveOccurred())
 		} else {
@@ -61,7 +73,7 @@ var _ = Describe("Format Readers", func() {
 	},
 		table.Entry("successfully construct a xz reader", tinyCoreXzFilePath, 4, false, true, false),              // [stream, multi-r, xz, multi-r] convert = false
 		table.Entry("successfully construct a gz reader", tinyCoreGzFilePath, 4, false, true, false),              // [stream, multi-r, gz, multi-r] convert = false
-		table.Entry("successfully return the base reader when archived", archiveFilePath, 3, false, false, false), // [stream, multi-r, multi-r] convert = false
+		table.Entry("successfully construct a tar reader", archiveFilePath, 4, false, true, false),                // [stream, multi-r, tar, multi-r] convert = false
 		table.Entry("successfully construct qcow2 reader", cirrosFilePath, 2, false, false, true),                 // [stream, multi-r] convert = true
 		table.Entry("successfully construct .iso reader", tinyCoreFilePath, 2, false, false, false),               // [stream, multi-r] convert = false
 	)
@@ -70,7 +82,7 @@ var _ = Describe("Format Readers", func() {
 		f, err := os.Open(cirrosFilePath)
 		Expect(err).ToNot(HaveOccurred())
 		defer f.Close()
-		fr, err = NewFormatReaders(f, uint64(0))
+		fr, err = NewFormatReaders(f, uint64(0), "", cdiv1.DataVolumeKubeVirt, "")
 		Expect(err).ToNot(HaveOccurred())
 		By("Verifying there are currently 2 readers")
 		Expect(len(fr.readers)).To(Equal(2))
@@ -89,4 +101,247 @@ var _ = Describe("Format Readers", func() {
 		table.Entry("should append io.reader", rdrGz, stringRdr, 3, false),
 		table.Entry("should append io.Multireader", rdrMulti, stringRdr, 3, false),
 	)
+
+	table.DescribeTable("can decompress", func(filename string) {
+		f, err := os.Open(filename)
+		Expect(err).ToNot(HaveOccurred())
+		defer f.Close()
+
+		fr, err = NewFormatReaders(f, uint64(0), "", cdiv1.DataVolumeKubeVirt, "")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(fr.Archived).To(BeTrue())
+		Expect(fr.Convert).To(BeFalse())
+		Expect(len(fr.readers)).To(Equal(4)) // [stream, multi-r, zst/bz2, multi-r]
+		result, err := ioutil.ReadAll(fr.TopReader())
+		Expect(err).ToNot(HaveOccurred())
+		// the test files contain the numbered lines "line 00000" to "line 09999"
+		var expected bytes.Buffer
+		for i := 0; i < 10000; i++ {
+			fmt.Fprintf(&expected, "line %05d\n", i)
+		}
+		Expect(result).To(Equal(expected.Bytes()))
+	},
+		table.Entry("a zstd file", numbersZstFilePath),
+		table.Entry("a bzip2 file", numbersBz2FilePath),
+	)
+
+	table.DescribeTable("can detect image formats converted from scratch space", func(magic []byte, offset int, compress bool) {
+		data := make([]byte, 4096)
+		// random data after the header, so the compressed stream is larger than the header
+		rand.Read(data[image.MaxExpectedHdrSize:])
+		copy(data[offset:], magic)
+		if compress {
+			var buf bytes.Buffer
+			gz := gzip.NewWriter(&buf)
+			_, err := gz.Write(data)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(gz.Close()).To(Succeed())
+			data = buf.Bytes()
+		}
+		var err error
+		fr, err = NewFormatReaders(ioutil.NopCloser(bytes.NewReader(data)), uint64(0), "", cdiv1.DataVolumeKubeVirt, "")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(fr.Convert).To(BeTrue())
+		Expect(fr.RequiresScratch).To(BeTrue())
+		Expect(fr.Archived).To(Equal(compress))
+	},
+		table.Entry("vmdk", []byte("KDMV"), 0, false),
+		table.Entry("vhd", []byte("conectix"), 0, false),
+		table.Entry("vhdx", []byte("vhdxfile"), 0, false),
+		table.Entry("vdi", []byte{0x7F, 0x10, 0xDA, 0xBE}, 0x40, false),
+		table.Entry("gzipped vmdk", []byte("KDMV"), 0, true),
+	)
+
+	It("can detect a zip archive without reading its entries", func() {
+		var buf bytes.Buffer
+		zw := zip.NewWriter(&buf)
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: "disk.img.gz", Method: zip.Store})
+		Expect(err).ToNot(HaveOccurred())
+		gz := gzip.NewWriter(w)
+		// random data, so the archive is larger than the header
+		data := make([]byte, 4096)
+		rand.Read(data)
+		_, err = gz.Write(data)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(gz.Close()).To(Succeed())
+		Expect(zw.Close()).To(Succeed())
+
+		fr, err = NewFormatReaders(ioutil.NopCloser(bytes.NewReader(buf.Bytes())), uint64(0), "", cdiv1.DataVolumeKubeVirt, "")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(fr.Zipped).To(BeTrue())
+		Expect(fr.Archived).To(BeFalse())
+		Expect(fr.Convert).To(BeFalse())
+		data, err = ioutil.ReadAll(fr.TopReader())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(data).To(Equal(buf.Bytes()))
+	})
+
+	It("can detect a compressed image archive and read it as is", func() {
+		disk := make([]byte, 4096)
+		rand.Read(disk)
+		archive := createTestOCIArchive(nil, createTestImage(createTestLayer(true, testLayerFile{name: "disk/disk.img", data: disk})))
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		_, err := gz.Write(archive)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(gz.Close()).To(Succeed())
+
+		fr, err = NewFormatReaders(ioutil.NopCloser(bytes.NewReader(buf.Bytes())), uint64(0), "", cdiv1.DataVolumeKubeVirt, "")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(fr.ImageArchive).To(BeTrue())
+		Expect(fr.Convert).To(BeTrue())
+		Expect(fr.RequiresScratch).To(BeTrue())
+		data, err := ioutil.ReadAll(fr.TopReader())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(data).To(Equal(archive))
+	})
+
+	Context("with a tar archive", func() {
+		var (
+			disk  []byte
+			qcow2 []byte
+		)
+
+		createTar := func(compress bool, files ...string) []byte {
+			var buf bytes.Buffer
+			tw := tar.NewWriter(&buf)
+			Expect(tw.WriteHeader(&tar.Header{Name: "images/", Typeflag: tar.TypeDir, Mode: 0755})).To(Succeed())
+			for _, name := range files {
+				data := disk
+				if strings.HasSuffix(name, ".qcow2") {
+					data = qcow2
+				}
+				Expect(tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(data))})).To(Succeed())
+				_, err := tw.Write(data)
+				Expect(err).ToNot(HaveOccurred())
+			}
+			Expect(tw.Close()).To(Succeed())
+			if !compress {
+				return buf.Bytes()
+			}
+			var gzBuf bytes.Buffer
+			gz := gzip.NewWriter(&gzBuf)
+			_, err := gz.Write(buf.Bytes())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(gz.Close()).To(Succeed())
+			return gzBuf.Bytes()
+		}
+
+		BeforeEach(func() {
+			disk = make([]byte, 4096)
+			rand.Read(disk)
+			qcow2 = make([]byte, 4096)
+			// random data after the header, so the compressed archive is larger than the header
+			rand.Read(qcow2[image.MaxExpectedHdrSize:])
+			copy(qcow2, []byte{'Q', 'F', 'I', 0xfb})
+		})
+
+		table.DescribeTable("should read the disk image", func(compress bool, diskPath string, convert bool, files ...string) {
+			var err error
+			fr, err = NewFormatReaders(ioutil.NopCloser(bytes.NewReader(createTar(compress, files...))), uint64(0), "", cdiv1.DataVolumeKubeVirt, diskPath)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(fr.Archived).To(BeTrue())
+			Expect(fr.Convert).To(Equal(convert))
+			data, err := ioutil.ReadAll(fr.TopReader())
+			Expect(err).ToNot(HaveOccurred())
+			if convert {
+				Expect(data).To(Equal(qcow2))
+			} else {
+				Expect(data).To(Equal(disk))
+			}
+		},
+			table.Entry("that is the single file in the archive", false, "", false, "images/disk.img"),
+			table.Entry("that is the single file in a gzipped archive", true, "", false, "images/disk.img"),
+			table.Entry("and detect its format", true, "", true, "images/disk.qcow2"),
+			table.Entry("at the disk path", false, "/images/disk.qcow2", true, "images/README", "images/disk.qcow2", "images/disk.qcow2.sha256"),
+		)
+
+		It("should fail if the disk image is not the single file in the archive", func() {
+			var err error
+			fr, err = NewFormatReaders(ioutil.NopCloser(bytes.NewReader(createTar(false, "images/disk.img", "images/README"))), uint64(0), "", cdiv1.DataVolumeKubeVirt, "")
+			Expect(err).ToNot(HaveOccurred())
+			_, err = ioutil.ReadAll(fr.TopReader())
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("more than one file"))
+		})
+
+		It("should fail if the disk path is not in the archive", func() {
+			var err error
+			fr, err = NewFormatReaders(ioutil.NopCloser(bytes.NewReader(createTar(false, "images/disk.img"))), uint64(0), "", cdiv1.DataVolumeKubeVirt, "disk.img")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("not found in tar archive"))
+		})
+
+		It("should not read the archive with the archive content type", func() {
+			archive := createTar(false, "images/disk.img", "images/README")
+			var err error
+			fr, err = NewFormatReaders(ioutil.NopCloser(bytes.NewReader(archive)), uint64(0), "", cdiv1.DataVolumeArchive, "")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(fr.Archived).To(BeFalse())
+			data, err := ioutil.ReadAll(fr.TopReader())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(data).To(Equal(archive))
+		})
+	})
+
+	Context("with a checksum", func() {
+		var (
+			data       []byte
+			compressed []byte
+		)
+
+		BeforeEach(func() {
+			data = bytes.Repeat([]byte("checksum test data "), 10000)
+			var buf bytes.Buffer
+			gz := gzip.NewWriter(&buf)
+			_, err := gz.Write(data)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(gz.Close()).To(Succeed())
+			compressed = buf.Bytes()
+		})
+
+		It("should verify the checksum of the compressed stream", func() {
+			var err error
+			fr, err = NewFormatReaders(ioutil.NopCloser(bytes.NewReader(compressed)), uint64(0), fmt.Sprintf("sha256:%x", sha256.Sum256(compressed)), cdiv1.DataVolumeKubeVirt, "")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(fr.HasChecksum()).To(BeTrue())
+			Expect(fr.Archived).To(BeTrue())
+			result, err := ioutil.ReadAll(fr.TopReader())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result).To(Equal(data))
+			Expect(fr.VerifyChecksum()).To(Succeed())
+		})
+
+		It("should verify the checksum when the readers did not read the entire stream", func() {
+			var err error
+			fr, err = NewFormatReaders(ioutil.NopCloser(bytes.NewReader(data)), uint64(0), fmt.Sprintf("md5:%x", md5.Sum(data)), cdiv1.DataVolumeKubeVirt, "")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(fr.VerifyChecksum()).To(Succeed())
+		})
+
+		It("should fail with a checksum mismatch", func() {
+			var err error
+			fr, err = NewFormatReaders(ioutil.NopCloser(bytes.NewReader(compressed)), uint64(0), fmt.Sprintf("sha256:%x", sha256.Sum256(data)), cdiv1.DataVolumeKubeVirt, "")
+			Expect(err).ToNot(HaveOccurred())
+			_, err = ioutil.ReadAll(fr.TopReader())
+			Expect(err).ToNot(HaveOccurred())
+			err = fr.VerifyChecksum()
+			Expect(errors.Cause(err)).To(Equal(ErrChecksumMismatch))
+			Expect(err.Error()).To(ContainSubstring(fmt.Sprintf("got sha256:%x", sha256.Sum256(compressed))))
+		})
+
+		It("should fail with an invalid checksum", func() {
+			var err error
+			fr, err = NewFormatReaders(ioutil.NopCloser(bytes.NewReader(data)), uint64(0), "sha1:abc", cdiv1.DataVolumeKubeVirt, "")
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should not verify anything without a checksum", func() {
+			var err error
+			fr, err = NewFormatReaders(ioutil.NopCloser(bytes.NewReader(data)), uint64(0), "", cdiv1.DataVolumeKubeVirt, "")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(fr.HasChecksum()).To(BeFalse())
+			Expect(fr.VerifyChecksum()).To(Succeed())
+		})
+	})
 })
@@ -0,0 +1,376 @@
+package importer
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+	jose "gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+
+	"k8s.io/klog"
+
+	cdiv1 "kubevirt.io/containerized-data-importer/pkg/apis/core/v1alpha1"
+	"kubevirt.io/containerized-data-importer/pkg/common"
+	"kubevirt.io/containerized-data-importer/pkg/util"
+)
+
+const (
+	// gcsReadOnlyScope is the scope of the access tokens requested for the service account of a GCS source
+	gcsReadOnlyScope = "https://www.googleapis.com/auth/devstorage.read_only"
+	// jwtBearerGrantType is the grant type of the request exchanging a signed JWT for an access token
+	jwtBearerGrantType = "urn:ietf:params:oauth:grant-type:jwt-bearer"
+)
+
+// GCSOptions are the settings of the service a GCS source is imported from.
+type GCSOptions struct {
+	// Endpoint is the URL of the service, defaults to https://storage.googleapis.com
+	Endpoint string
+	// CredentialsFile contains the JSON service account key, the object is read anonymously if the file does not exist
+	CredentialsFile string
+}
+
+// GCSDataSource is the struct containing the information needed to import from a Google Cloud Storage data source.
+// Sequence of phases:
+// 1. Info -> Transfer
+// 2. Transfer -> Process
+// 3. Process -> Convert
+type GCSDataSource struct {
+	// GCS end point
+	ep *url.URL
+	// Reader
+	gcsReader io.ReadCloser
+	// the size of the object
+	size uint64
+	// stack of readers
+	readers *FormatReaders
+	// The image file in scratch space.
+	url *url.URL
+	// the expected checksum of the data, in the form <algorithm>:<hex digest>.
+	checksum string
+	// the path of the disk image, if the source is a tar archive.
+	diskPath string
+}
+
+// gcsObject is the metadata of an object returned by the JSON API.
+type gcsObject struct {
+	// Size is the size of the object in bytes, the API returns it as a string
+	Size string `json:"size"`
+}
+
+// gcsErrorResponse is the error returned by the JSON API.
+type gcsErrorResponse struct {
+	Error struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// NewGCSDataSource creates a new instance of the GCSDataSource
+func NewGCSDataSource(endpoint, checksum, diskPath string, options GCSOptions) (*GCSDataSource, error) {
+	ep, err := ParseEndpoint(endpoint)
+	if err != nil {
+		return nil, errors.Wrapf(err, fmt.Sprintf("unable to parse endpoint %q", endpoint))
+	}
+	gcsReader, size, err := createGCSReader(ep, options)
+	if err != nil {
+		return nil, err
+	}
+	return &GCSDataSource{
+		ep:        ep,
+		gcsReader: gcsReader,
+		size:      size,
+		checksum:  checksum,
+		diskPath:  diskPath,
+	}, nil
+}
+
+// Info is called to get initial information about the data.
+func (gd *GCSDataSource) Info() (ProcessingPhase, error) {
+	var err error
+	gd.readers, err = NewFormatReaders(gd.gcsReader, gd.size, gd.checksum, cdiv1.DataVolumeKubeVirt, gd.diskPath)
+	if err != nil {
+		klog.Errorf("Error creating readers: %v", err)
+		return ProcessingPhaseError, err
+	}
+	if !gd.readers.Convert {
+		// Downloading a raw file, we can write that directly to the target.
+		return ProcessingPhaseTransferDataFile, nil
+	}
+
+	return ProcessingPhaseTransferScratch, nil
+}
+
+// Transfer is called to transfer the data from the source to a temporary location.
+func (gd *GCSDataSource) Transfer(path string) (ProcessingPhase, error) {
+	if util.GetAvailableSpace(path) <= int64(0) {
+		//Path provided is invalid.
+		return ProcessingPhaseError, ErrInvalidPath
+	}
+	file := filepath.Join(path, tempFile)
+	gd.readers.StartProgressUpdate()
+	err := util.StreamDataToFile(gd.readers.TopReader(), file)
+	if err != nil {
+		return ProcessingPhaseError, err
+	}
+	if err := gd.readers.VerifyChecksum(); err != nil {
+		return ProcessingPhaseError, err
+	}
+	if file, err = gd.readers.extractImageArchive(file); err != nil {
+		return ProcessingPhaseError, err
+	}
+	// If streaming succeeded, then parsing the file into URL will also succeed, no need to check error status
+	gd.url, _ = url.Parse(file)
+	return ProcessingPhaseProcess, nil
+}
+
+// TransferFile is called to transfer the data from the source to the passed in file.
+func (gd *GCSDataSource) TransferFile(fileName string) (ProcessingPhase, error) {
+	gd.readers.StartProgressUpdate()
+	err := util.StreamDataToFile(gd.readers.TopReader(), fileName)
+	if err != nil {
+		return ProcessingPhaseError, err
+	}
+	if err := gd.readers.VerifyChecksum(); err != nil {
+		return ProcessingPhaseError, err
+	}
+	return ProcessingPhaseResize, nil
+}
+
+// Process is called to do any special processing before giving the url to the data back to the processor
+func (gd *GCSDataSource) Process() (ProcessingPhase, error) {
+	return ProcessingPhaseConvert, nil
+}
+
+// GetURL returns the url that the data processor can use when converting the data.
+func (gd *GCSDataSource) GetURL() *url.URL {
+	return gd.url
+}
+
+// Close closes any readers or other open resources.
+func (gd *GCSDataSource) Close() error {
+	var err error
+	if gd.readers != nil {
+		err = gd.readers.Close()
+	} else if gd.gcsReader != nil {
+		err = gd.gcsReader.Close()
+	}
+	return err
+}
+
+// createGCSReader gets the metadata of a gs://<bucket>/<object> url with the JSON API, and returns a reader of the
+// object and its size.
+func createGCSReader(ep *url.URL, options GCSOptions) (io.ReadCloser, uint64, error) {
+	bucket := ep.Host
+	object := strings.TrimPrefix(ep.Path, "/")
+	if bucket == "" || object == "" {
+		return nil, uint64(0), errors.Errorf("invalid gcs url %q, expected gs://<bucket>/<object>", ep.String())
+	}
+	client, err := getGCSClient(options)
+	if err != nil {
+		return nil, uint64(0), err
+	}
+	endpoint := options.Endpoint
+	if endpoint == "" {
+		endpoint = common.DefaultGCSEndpoint
+	}
+	objectURL := strings.TrimSuffix(endpoint, "/") + "/storage/v1/b/" + url.PathEscape(bucket) + "/o/" + url.PathEscape(object)
+
+	klog.V(2).Infof("Attempting to get metadata of object %q via GCS JSON API\n", ep.String())
+	resp, err := gcsGet(client, objectURL)
+	if err != nil {
+		return nil, uint64(0), errors.Wrapf(err, "could not get gcs object: \"%s/%s\"", bucket, object)
+	}
+	defer resp.Body.Close()
+	var obj gcsObject
+	if err := json.NewDecoder(resp.Body).Decode(&obj); err != nil {
+		return nil, uint64(0), errors.Wrapf(err, "could not parse metadata of gcs object: \"%s/%s\"", bucket, object)
+	}
+	size, err := strconv.ParseUint(obj.Size, 10, 64)
+	if err != nil {
+		klog.Warningf("Unable to parse size %q of gcs object \"%s/%s\", progress will not be reported\n", obj.Size, bucket, object)
+		size = 0
+	}
+
+	klog.V(2).Infof("Attempting to get object %q via GCS JSON API\n", ep.String())
+	resp, err = gcsGet(client, objectURL+"?alt=media")
+	if err != nil {
+		return nil, uint64(0), errors.Wrapf(err, "could not get gcs object: \"%s/%s\"", bucket, object)
+	}
+	return resp.Body, size, nil
+}
+
+// gcsGet gets a url of the JSON API, the error message of the API is returned if the request fails.
+func gcsGet(client *http.Client, rawURL string) (*http.Response, error) {
+	resp, err := client.Get(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		var errResp gcsErrorResponse
+		if err := json.NewDecoder(resp.Body).Decode(&errResp); err == nil && errResp.Error.Message != "" {
+			return nil, errors.Errorf("expected status code 200, got %d: %s", resp.StatusCode, errResp.Error.Message)
+		}
+		return nil, errors.Errorf("expected status code 200, got %d. Status: %s", resp.StatusCode, resp.Status)
+	}
+	return resp, nil
+}
+
+// getGCSClient returns an http client authorized with the access tokens of the service account in the credentials
+// file, or an anonymous client if there is no credentials file.
+func getGCSClient(options GCSOptions) (*http.Client, error) {
+	client, err := createHTTPClient("", "")
+	if err != nil {
+		return nil, err
+	}
+	if options.CredentialsFile == "" {
+		return client, nil
+	}
+	data, err := ioutil.ReadFile(options.CredentialsFile)
+	if os.IsNotExist(err) {
+		klog.V(2).Infoln("No service account key, reading the gcs object anonymously")
+		return client, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read the service account key")
+	}
+	// The token requests are not authorized, they use their own client
+	ts, err := newServiceAccountTokenSource(data, &http.Client{Transport: client.Transport})
+	if err != nil {
+		return nil, err
+	}
+	client.Transport = &oauth2.Transport{
+		Source: oauth2.ReuseTokenSource(nil, ts),
+		Base:   client.Transport,
+	}
+	return client, nil
+}
+
+// serviceAccountKey is the JSON key of a Google service account.
+type serviceAccountKey struct {
+	Type         string `json:"type"`
+	ClientEmail  string `json:"client_email"`
+	PrivateKeyID string `json:"private_key_id"`
+	PrivateKey   string `json:"private_key"`
+	TokenURI     string `json:"token_uri"`
+}
+
+// serviceAccountTokenSource gets access tokens of a service account, by exchanging a JWT signed with the private key
+// of the service account.
+type serviceAccountTokenSource struct {
+	client   *http.Client
+	email    string
+	tokenURI string
+	signer   jose.Signer
+}
+
+// serviceAccountClaims are the claims of the JWT exchanged for an access token.
+type serviceAccountClaims struct {
+	Issuer   string `json:"iss"`
+	Scope    string `json:"scope"`
+	Audience string `json:"aud"`
+	IssuedAt int64  `json:"iat"`
+	Expiry   int64  `json:"exp"`
+}
+
+// serviceAccountTokenResponse is the response of the token endpoint.
+type serviceAccountTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+func newServiceAccountTokenSource(data []byte, client *http.Client) (*serviceAccountTokenSource, error) {
+	var key serviceAccountKey
+	if err := json.Unmarshal(data, &key); err != nil {
+		return nil, errors.Wrap(err, "could not parse the service account key")
+	}
+	if key.Type != "service_account" || key.ClientEmail == "" || key.TokenURI == "" {
+		return nil, errors.New("invalid service account key, expected a service_account key with a client_email and token_uri")
+	}
+	block, _ := pem.Decode([]byte(key.PrivateKey))
+	if block == nil {
+		return nil, errors.New("invalid service account key, the private key is not PEM encoded")
+	}
+	privateKey, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		privateKey, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "could not parse the private key of the service account")
+	}
+	rsaKey, ok := privateKey.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("invalid service account key, the private key is not an RSA key")
+	}
+	opts := (&jose.SignerOptions{}).WithType("JWT")
+	if key.PrivateKeyID != "" {
+		opts = opts.WithHeader("kid", key.PrivateKeyID)
+	}
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: rsaKey}, opts)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create the signer of the service account")
+	}
+	return &serviceAccountTokenSource{
+		client:   client,
+		email:    key.ClientEmail,
+		tokenURI: key.TokenURI,
+		signer:   signer,
+	}, nil
+}
+
+func (ts *serviceAccountTokenSource) Token() (*oauth2.Token, error) {
+	now := time.Now()
+	assertion, err := jwt.Signed(ts.signer).Claims(serviceAccountClaims{
+		Issuer:   ts.email,
+		Scope:    gcsReadOnlyScope,
+		Audience: ts.tokenURI,
+		IssuedAt: now.Unix(),
+		Expiry:   now.Add(time.Hour).Unix(),
+	}).CompactSerialize()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not sign the service account token request")
+	}
+	klog.V(2).Infof("Getting an access token of service account %s\n", ts.email)
+	resp, err := ts.client.PostForm(ts.tokenURI, url.Values{
+		"grant_type": {jwtBearerGrantType},
+		"assertion":  {assertion},
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "could not get an access token of the service account")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, errors.Errorf("could not get an access token of the service account, expected status code 200, got %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	var tokenResp serviceAccountTokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
+		return nil, errors.Wrap(err, "could not parse the access token of the service account")
+	}
+	if tokenResp.AccessToken == "" {
+		return nil, errors.New("no access token in the token response of the service account")
+	}
+	token := &oauth2.Token{
+		AccessToken: tokenResp.AccessToken,
+		TokenType:   tokenResp.TokenType,
+	}
+	if tokenResp.ExpiresIn > 0 {
+		token.Expiry = now.Add(time.Duration(tokenResp.ExpiresIn) * time.Second)
+	}
+	return token, nil
+}
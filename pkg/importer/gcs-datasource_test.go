@@ -0,0 +1,240 @@
+package importer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+// fakeGCSServer serves the objects of a bucket with the subset of the GCS JSON API the importer uses, and exchanges
+// JWTs signed with the key of a service account for access tokens.
+type fakeGCSServer struct {
+	*httptest.Server
+	bucket  string
+	objects map[string][]byte
+	// the public key of the service account, if set the objects require an access token
+	publicKey   *rsa.PublicKey
+	accessToken string
+	// the claims of the last token request
+	claims serviceAccountClaims
+}
+
+func newFakeGCSServer(bucket string) *fakeGCSServer {
+	s := &fakeGCSServer{
+		bucket:  bucket,
+		objects: map[string][]byte{},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+func (s *fakeGCSServer) writeError(w http.ResponseWriter, code int, message string) {
+	w.WriteHeader(code)
+	fmt.Fprintf(w, `{"error": {"code": %d, "message": %q}}`, code, message)
+}
+
+func (s *fakeGCSServer) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/token" {
+		s.serveToken(w, r)
+		return
+	}
+	if s.publicKey != nil && r.Header.Get("Authorization") != "Bearer "+s.accessToken {
+		s.writeError(w, http.StatusUnauthorized, "Anonymous caller does not have storage.objects.get access")
+		return
+	}
+	prefix := "/storage/v1/b/" + s.bucket + "/o/"
+	if !strings.HasPrefix(r.URL.Path, prefix) {
+		s.writeError(w, http.StatusNotFound, "The specified bucket does not exist.")
+		return
+	}
+	data, ok := s.objects[strings.TrimPrefix(r.URL.Path, prefix)]
+	if !ok {
+		s.writeError(w, http.StatusNotFound, "No such object")
+		return
+	}
+	if r.URL.Query().Get("alt") == "media" {
+		w.Write(data)
+		return
+	}
+	fmt.Fprintf(w, `{"kind": "storage#object", "bucket": %q, "size": "%d"}`, s.bucket, len(data))
+}
+
+func (s *fakeGCSServer) serveToken(w http.ResponseWriter, r *http.Request) {
+	token, err := jwt.ParseSigned(r.FormValue("assertion"))
+	if err != nil || r.FormValue("grant_type") != jwtBearerGrantType {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if err := token.Claims(s.publicKey, &s.claims); err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"error": "invalid_grant", "error_description": "Invalid JWT Signature."}`))
+		return
+	}
+	fmt.Fprintf(w, `{"access_token": %q, "token_type": "Bearer", "expires_in": 3599}`, s.accessToken)
+}
+
+// createServiceAccountKey writes the JSON key of a service account to a file, and returns the key.
+func createServiceAccountKey(fileName, tokenURI string) *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	Expect(err).NotTo(HaveOccurred())
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	Expect(err).NotTo(HaveOccurred())
+	data, err := json.Marshal(serviceAccountKey{
+		Type:         "service_account",
+		ClientEmail:  "importer@project.iam.gserviceaccount.com",
+		PrivateKeyID: "key-id",
+		PrivateKey:   string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		TokenURI:     tokenURI,
+	})
+	Expect(err).NotTo(HaveOccurred())
+	Expect(ioutil.WriteFile(fileName, data, 0600)).To(Succeed())
+	return key
+}
+
+var _ = Describe("GCS data source", func() {
+	var (
+		gd     *GCSDataSource
+		server *fakeGCSServer
+		tmpDir string
+		err    error
+	)
+
+	BeforeEach(func() {
+		server = newFakeGCSServer("bucket")
+		// Random data, so the compressed object is larger than the headers that are checked
+		data := make([]byte, 4096)
+		_, err = rand.Read(data)
+		Expect(err).NotTo(HaveOccurred())
+		server.objects["images/disk.img"] = data
+		tmpDir, err = ioutil.TempDir("", "gcs")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		if gd != nil {
+			gd.Close()
+			gd = nil
+		}
+		server.Close()
+		os.RemoveAll(tmpDir)
+	})
+
+	It("Should read a public object anonymously, and write raw data directly to the target", func() {
+		gd, err = NewGCSDataSource("gs://bucket/images/disk.img", "", "", GCSOptions{
+			Endpoint:        server.URL,
+			CredentialsFile: filepath.Join(tmpDir, "missing.json"),
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(gd.size).To(Equal(uint64(4096)))
+		phase, err := gd.Info()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(phase).To(Equal(ProcessingPhaseTransferDataFile))
+		Expect(gd.readers.progressReader).NotTo(BeNil())
+		target := filepath.Join(tmpDir, "disk.img")
+		phase, err = gd.TransferFile(target)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(phase).To(Equal(ProcessingPhaseResize))
+		data, err := ioutil.ReadFile(target)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(data).To(Equal(server.objects["images/disk.img"]))
+	})
+
+	It("Should decompress a compressed object", func() {
+		var buf bytes.Buffer
+		gzw := gzip.NewWriter(&buf)
+		_, err := gzw.Write(server.objects["images/disk.img"])
+		Expect(err).NotTo(HaveOccurred())
+		Expect(gzw.Close()).To(Succeed())
+		server.objects["images/disk.img.gz"] = buf.Bytes()
+
+		gd, err = NewGCSDataSource("gs://bucket/images/disk.img.gz", "", "", GCSOptions{Endpoint: server.URL})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = gd.Info()
+		Expect(err).NotTo(HaveOccurred())
+		target := filepath.Join(tmpDir, "disk.img")
+		_, err = gd.TransferFile(target)
+		Expect(err).NotTo(HaveOccurred())
+		data, err := ioutil.ReadFile(target)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(data).To(Equal(server.objects["images/disk.img"]))
+	})
+
+	It("Should verify the checksum of the object", func() {
+		gd, err = NewGCSDataSource("gs://bucket/images/disk.img", "sha256:"+strings.Repeat("0", 64), "", GCSOptions{Endpoint: server.URL})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = gd.Info()
+		Expect(err).NotTo(HaveOccurred())
+		_, err = gd.TransferFile(filepath.Join(tmpDir, "disk.img"))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Should get an access token with the service account key", func() {
+		credentialsFile := filepath.Join(tmpDir, "credentials.json")
+		key := createServiceAccountKey(credentialsFile, server.URL+"/token")
+		server.publicKey = &key.PublicKey
+		server.accessToken = "access-token"
+
+		gd, err = NewGCSDataSource("gs://bucket/images/disk.img", "", "", GCSOptions{
+			Endpoint:        server.URL,
+			CredentialsFile: credentialsFile,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		data, err := ioutil.ReadAll(gd.gcsReader)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(data).To(Equal(server.objects["images/disk.img"]))
+		Expect(server.claims.Issuer).To(Equal("importer@project.iam.gserviceaccount.com"))
+		Expect(server.claims.Scope).To(Equal(gcsReadOnlyScope))
+		Expect(server.claims.Audience).To(Equal(server.URL + "/token"))
+	})
+
+	It("Should fail if the token endpoint rejects the service account key", func() {
+		credentialsFile := filepath.Join(tmpDir, "credentials.json")
+		createServiceAccountKey(credentialsFile, server.URL+"/token")
+		other, err := rsa.GenerateKey(rand.Reader, 2048)
+		Expect(err).NotTo(HaveOccurred())
+		server.publicKey = &other.PublicKey
+
+		gd, err = NewGCSDataSource("gs://bucket/images/disk.img", "", "", GCSOptions{
+			Endpoint:        server.URL,
+			CredentialsFile: credentialsFile,
+		})
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("Invalid JWT Signature"))
+	})
+
+	It("Should fail on an invalid service account key", func() {
+		credentialsFile := filepath.Join(tmpDir, "credentials.json")
+		Expect(ioutil.WriteFile(credentialsFile, []byte(`{"type": "authorized_user"}`), 0600)).To(Succeed())
+		gd, err = NewGCSDataSource("gs://bucket/images/disk.img", "", "", GCSOptions{
+			Endpoint:        server.URL,
+			CredentialsFile: credentialsFile,
+		})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Should fail with the message of the API, if the object does not exist", func() {
+		gd, err = NewGCSDataSource("gs://bucket/images/other.img", "", "", GCSOptions{Endpoint: server.URL})
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("No such object"))
+	})
+
+	It("Should fail on a url without an object", func() {
+		gd, err = NewGCSDataSource("gs://bucket", "", "", GCSOptions{Endpoint: server.URL})
+		Expect(err).To(HaveOccurred())
+	})
+})
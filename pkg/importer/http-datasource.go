@@ -25,10 +25,12 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"os"
 	"path"
 	"path/filepath"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/pkg/errors"
@@ -36,7 +38,9 @@ import (
 	"k8s.io/klog"
 
 	cdiv1 "kubevirt.io/containerized-data-importer/pkg/apis/core/v1alpha1"
+	"kubevirt.io/containerized-data-importer/pkg/common"
 	"kubevirt.io/containerized-data-importer/pkg/util"
+	prometheusutil "kubevirt.io/containerized-data-importer/pkg/util/prometheus"
 )
 
 const (
@@ -51,6 +55,17 @@ const (
 // 2a. Transfer -> Process if content type is kube virt
 // 2b. Transfer -> Complete if content type is archive (Transfer is called with the target instead of the scratch space). Non block PVCs only.
 // 3. Process -> Convert
+// If a checksum is specified, the source is always transferred, so the checksum can be verified before conversion.
+// If extra headers or a client certificate are specified, the source is always transferred, since QEMU-IMG cannot send
+// them.
+// If the content type is kube virt and the source is a tar archive, the disk image is extracted from the archive while
+// it is transferred, like a compressed image.
+// If the tar archive is an image archive, it is transferred to scratch space as is, and the disk image is extracted from
+// the image before it is converted.
+// If multiple connections are requested and the endpoint supports range requests, data that is written as is gets
+// transferred with concurrent range requests, and is always transferred instead of passed straight to conversion.
+// Data that is written as is, to either the scratch space or the target file, is checkpointed. If the transfer is
+// interrupted, the next attempt resumes it with a Range request when the endpoint supports that.
 type HTTPDataSource struct {
 	httpReader io.ReadCloser
 	ctx        context.Context
@@ -66,18 +81,68 @@ type HTTPDataSource struct {
 	url *url.URL
 	// true if we are using a custom CA (and thus have to use scratch storage)
 	customCA bool
+	// the directory of the client certificate, which has to be presented by the http client and thus requires scratch storage too.
+	clientCertDir string
 	// the content length reported by the http server.
 	contentLength uint64
+	// credentials, extra headers and cert dir, needed to make additional requests to the endpoint.
+	creds   *httpCredentials
+	certDir string
+	// the ETag, Last-Modified and Accept-Ranges headers reported by the http server.
+	etag         string
+	lastModified string
+	acceptRanges bool
+	// the expected checksum of the data, in the form <algorithm>:<hex digest>.
+	checksum string
+	// the number of connections to use to transfer the data.
+	connections int
+	// the path of the disk image, if the source is a tar archive.
+	diskPath string
+	// the progress of a zip archive, while it is stored in scratch space and while it is extracted.
+	zipProgress *zipProgress
+}
+
+// HTTPOptions are the settings of the http endpoint a source is imported from.
+type HTTPOptions struct {
+	// CertDir contains the certs of the CAs that signed the certificate of the endpoint
+	CertDir string
+	// ClientCertDir contains the client certificate presented to the endpoint if it requests one, in tls.crt and
+	// tls.key
+	ClientCertDir string
+	// Checksum is the expected checksum of the data, in the form <algorithm>:<hex digest>
+	Checksum string
+	// DiskPath is the path of the disk image, if the source is a tar archive
+	DiskPath string
+	// Connections is the number of connections the data is transferred with, 0 and 1 use a single connection
+	Connections int
+	// ExtraHeaders are sent with every request, in the form <name>: <value>
+	ExtraHeaders []string
+	// SecretExtraHeaders are only sent with the requests to the host of the endpoint, like the basic auth of the
+	// access key and secret key
+	SecretExtraHeaders []string
 }
 
 // NewHTTPDataSource creates a new instance of the http data provider.
-func NewHTTPDataSource(endpoint, accessKey, secKey, certDir string, contentType cdiv1.DataVolumeContentType) (*HTTPDataSource, error) {
+func NewHTTPDataSource(endpoint, accessKey, secKey string, contentType cdiv1.DataVolumeContentType, options HTTPOptions) (*HTTPDataSource, error) {
 	ep, err := ParseEndpoint(endpoint)
 	if err != nil {
 		return nil, errors.Wrapf(err, fmt.Sprintf("unable to parse endpoint %q", endpoint))
 	}
+	creds, err := newHTTPCredentials(accessKey, secKey, options.ExtraHeaders, options.SecretExtraHeaders)
+	if err != nil {
+		return nil, err
+	}
 	ctx, cancel := context.WithCancel(context.Background())
-	httpReader, contentLength, err := createHTTPReader(ctx, ep, accessKey, secKey, certDir)
+	var (
+		httpReader    io.ReadCloser
+		contentLength uint64
+		header        http.Header
+	)
+	err = retry("http request", func() error {
+		var err error
+		httpReader, contentLength, header, err = createHTTPReader(ctx, ep, creds, options.CertDir, options.ClientCertDir)
+		return err
+	})
 	if err != nil {
 		cancel()
 		return nil, err
@@ -92,8 +157,17 @@ func NewHTTPDataSource(endpoint, accessKey, secKey, certDir string, contentType
 		httpReader:    httpReader,
 		contentType:   contentType,
 		endpoint:      ep,
-		customCA:      certDir != "",
+		customCA:      options.CertDir != "" || os.Getenv(common.ImporterProxyCertDirVar) != "",
+		clientCertDir: options.ClientCertDir,
 		contentLength: contentLength,
+		creds:         creds,
+		certDir:       options.CertDir,
+		etag:          header.Get("ETag"),
+		lastModified:  header.Get("Last-Modified"),
+		acceptRanges:  header.Get("Accept-Ranges") == "bytes",
+		checksum:      options.Checksum,
+		connections:   options.Connections,
+		diskPath:      options.DiskPath,
 	}
 	// We know this is a counting reader, so no need to check.
 	countingReader := httpReader.(*util.CountingReader)
@@ -104,8 +178,12 @@ func NewHTTPDataSource(endpoint, accessKey, secKey, certDir string, contentType
 // Info is called to get initial information about the data.
 func (hs *HTTPDataSource) Info() (ProcessingPhase, error) {
 	var err error
-	hs.readers, err = NewFormatReaders(hs.httpReader, hs.contentLength)
+	hs.readers, err = NewFormatReaders(hs.httpReader, hs.contentLength, hs.checksum, hs.contentType, hs.diskPath)
 	if hs.contentType == cdiv1.DataVolumeArchive {
+		if err == nil && hs.readers.Zipped {
+			// A zip archive cannot be extracted while it is streamed, it is stored in scratch space first.
+			return ProcessingPhaseTransferScratch, nil
+		}
 		return ProcessingPhaseTransferDataDir, nil
 	}
 	if err != nil {
@@ -114,7 +192,7 @@ func (hs *HTTPDataSource) Info() (ProcessingPhase, error) {
 	}
 	// The readers now contain all the information needed to determine if we can stream directly or if we need scratch space to download
 	// the file to, before converting.
-	if !hs.readers.Archived && !hs.customCA && hs.readers.Convert {
+	if !hs.readers.Archived && !hs.customCA && hs.clientCertDir == "" && !hs.creds.hasHeaders() && hs.readers.Convert && !hs.readers.RequiresScratch && !hs.readers.HasChecksum() && !hs.canTransferInParallel() {
 		// We can pass straight to conversion from the endpoint. No scratch required.
 		hs.url = hs.endpoint
 		return ProcessingPhaseConvert, nil
@@ -133,30 +211,108 @@ func (hs *HTTPDataSource) Transfer(path string) (ProcessingPhase, error) {
 			return ProcessingPhaseError, ErrInvalidPath
 		}
 		file := filepath.Join(path, tempFile)
-		err := util.StreamDataToFile(hs.readers.TopReader(), file)
+		err := hs.streamDataToFile(file)
 		if err != nil {
 			return ProcessingPhaseError, err
 		}
+		if err := hs.readers.VerifyChecksum(); err != nil {
+			return ProcessingPhaseError, err
+		}
+		if file, err = hs.readers.extractImageArchive(file); err != nil {
+			return ProcessingPhaseError, err
+		}
 		// If we successfully wrote to the file, then the parse will succeed.
 		hs.url, _ = url.Parse(file)
 		return ProcessingPhaseProcess, nil
 	} else if hs.contentType == cdiv1.DataVolumeArchive {
+		if hs.readers.Zipped {
+			return hs.transferZip(path)
+		}
+		hs.readers.StartProgressUpdate()
 		if err := util.UnArchiveTar(hs.readers.TopReader(), path); err != nil {
 			return ProcessingPhaseError, errors.Wrap(err, "unable to untar files from endpoint")
 		}
+		if err := hs.readers.VerifyChecksum(); err != nil {
+			return ProcessingPhaseError, err
+		}
+		hs.readers.StopProgressUpdate()
 		hs.url = nil
 		return ProcessingPhaseComplete, nil
 	}
 	return ProcessingPhaseError, errors.Errorf("Unknown content type: %s", hs.contentType)
 }
 
+// transferZip is called twice for a zip archive. First the archive is stored in the passed in scratch space, then it
+// is extracted to the passed in target directory.
+func (hs *HTTPDataSource) transferZip(path string) (ProcessingPhase, error) {
+	if hs.url == nil {
+		if util.GetAvailableSpace(path) <= int64(0) {
+			//Path provided is invalid.
+			return ProcessingPhaseError, ErrInvalidPath
+		}
+		file := filepath.Join(path, tempFile)
+		hs.zipProgress = &zipProgress{
+			ProgressReader: prometheusutil.NewProgressReader(nil, 2*hs.contentLength, progress, ownerUID),
+		}
+		hs.zipProgress.StartTimedUpdate()
+		if err := util.StreamDataToFile(io.TeeReader(hs.readers.TopReader(), hs.zipProgress), file); err != nil {
+			return ProcessingPhaseError, err
+		}
+		if err := hs.readers.VerifyChecksum(); err != nil {
+			return ProcessingPhaseError, err
+		}
+		// If we successfully wrote to the file, then the parse will succeed.
+		hs.url, _ = url.Parse(file)
+		return ProcessingPhaseTransferDataDir, nil
+	}
+	file, err := os.Open(hs.url.Path)
+	if err != nil {
+		return ProcessingPhaseError, errors.Wrap(err, "could not open zip file")
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return ProcessingPhaseError, errors.Wrap(err, "could not stat zip file")
+	}
+	hs.zipProgress.file = file
+	if err := util.UnArchiveZip(hs.zipProgress, info.Size(), path); err != nil {
+		return ProcessingPhaseError, errors.Wrap(err, "unable to unzip files from endpoint")
+	}
+	hs.zipProgress.SetDone(true)
+	hs.url = nil
+	return ProcessingPhaseComplete, nil
+}
+
+// zipProgress reports the progress of a zip archive. The first half of the progress is the download of the archive to
+// scratch space, the second half its extraction, which reads the stored archive at random offsets.
+type zipProgress struct {
+	*prometheusutil.ProgressReader
+	file io.ReaderAt
+}
+
+// Write counts the bytes of the archive that are downloaded.
+func (p *zipProgress) Write(b []byte) (int, error) {
+	atomic.AddUint64(&p.Current, uint64(len(b)))
+	return len(b), nil
+}
+
+// ReadAt reads the stored archive, and counts the bytes that are read while it is extracted.
+func (p *zipProgress) ReadAt(b []byte, off int64) (int, error) {
+	n, err := p.file.ReadAt(b, off)
+	atomic.AddUint64(&p.Current, uint64(n))
+	return n, err
+}
+
 // TransferFile is called to transfer the data from the source to the passed in file.
 func (hs *HTTPDataSource) TransferFile(fileName string) (ProcessingPhase, error) {
 	hs.readers.StartProgressUpdate()
-	err := util.StreamDataToFile(hs.readers.TopReader(), fileName)
+	err := hs.streamDataToFile(fileName)
 	if err != nil {
 		return ProcessingPhaseError, err
 	}
+	if err := hs.readers.VerifyChecksum(); err != nil {
+		return ProcessingPhaseError, err
+	}
 	return ProcessingPhaseResize, nil
 }
 
@@ -185,12 +341,104 @@ func (hs *HTTPDataSource) Close() error {
 	return err
 }
 
-func createHTTPClient(certDir string) (*http.Client, error) {
+// streamDataToFile writes the data from the endpoint to the passed in file. If the data is written as is, and the
+// endpoint allows validating that it did not change, the transfer is checkpointed so it can be resumed later.
+func (hs *HTTPDataSource) streamDataToFile(fileName string) error {
+	if hs.readers.Archived || util.GetAvailableSpaceBlock(fileName) >= 0 {
+		// Decompressed data cannot be resumed at an offset, and block devices have no place to store a checkpoint.
+		return util.StreamDataToFile(hs.readers.TopReader(), fileName)
+	}
+	if hs.canTransferInParallel() {
+		return hs.transferInParallel(fileName)
+	}
+	current := &transferCheckpoint{
+		URL:           hs.redactedEndpoint(),
+		ETag:          hs.etag,
+		LastModified:  hs.lastModified,
+		ContentLength: hs.contentLength,
+	}
+	if current.validator() == "" {
+		klog.V(2).Infof("Endpoint %q does not provide an ETag or Last-Modified header, not checkpointing transfer", hs.redactedEndpoint())
+		return util.StreamDataToFile(hs.readers.TopReader(), fileName)
+	}
+	if !hs.acceptRanges {
+		return streamDataToFileWithCheckpoint(hs.readers.TopReader(), fileName, current)
+	}
+	previous, err := loadCheckpoint(fileName)
+	if err != nil {
+		klog.Warningf("Ignoring checkpoint: %v", err)
+	}
+	if current.matches(previous) && previous.Offset > 0 {
+		// The data of the request the data source was created with is not used, the transfer continues where the
+		// previous attempt stopped.
+		return streamDataToFileWithResume(nil, fileName, current, hs.resume)
+	}
+	return streamDataToFileWithResume(hs.readers.TopReader(), fileName, current, hs.resume)
+}
+
+// redactedEndpoint returns the endpoint without the basic auth credentials, for use in logs and checkpoints.
+func (hs *HTTPDataSource) redactedEndpoint() string {
+	return redactURL(hs.endpoint)
+}
+
+// redactURL returns the passed in url without its user info, so the credentials in it are not logged or stored.
+func redactURL(ep *url.URL) string {
+	redacted := *ep
+	redacted.User = nil
+	return redacted.String()
+}
+
+// resume requests the data from the endpoint starting at the offset in the checkpoint. The returned reader bypasses
+// the format readers, which is safe since only data that is written as is gets checkpointed. The returned offset is
+// where the data from the reader starts, it is 0 if the endpoint decided to return the entire content. If the data is
+// verified against a checksum, the data already written to the file is hashed before the transfer continues.
+func (hs *HTTPDataSource) resume(checkpoint *transferCheckpoint, fileName string) (io.Reader, int64, error) {
+	client, err := createHTTPClient(hs.certDir, hs.clientCertDir)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "Error creating http client")
+	}
+	client.CheckRedirect = hs.creds.checkRedirect
+	// http.NewRequest can only return error on invalid METHOD, or invalid url. Here the METHOD is always GET, and the url is always valid, thus error cannot happen.
+	req, _ := http.NewRequest("GET", hs.endpoint.String(), nil)
+	req = req.WithContext(hs.ctx)
+	hs.creds.setHeaders(req, hs.endpoint)
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-", checkpoint.Offset))
+	req.Header.Set("If-Range", checkpoint.validator())
+	klog.V(1).Infof("Attempting to resume transfer of %q at offset %d\n", hs.redactedEndpoint(), checkpoint.Offset)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "HTTP request errored")
+	}
+	offset := checkpoint.Offset
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		klog.V(1).Infof("Resuming transfer at offset %d", offset)
+	case http.StatusOK:
+		klog.V(1).Infof("Endpoint returned the entire content, restarting transfer")
+		offset = 0
+	default:
+		resp.Body.Close()
+		klog.Errorf("http: expected status code 206, got %d", resp.StatusCode)
+		return nil, 0, newHTTPStatusError(resp.StatusCode, "expected status code 206, got %d. Status: %s", resp.StatusCode, resp.Status)
+	}
+	reader, err := hs.readers.resume(hs.httpReader.(*util.CountingReader), resp.Body, fileName, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	return reader, offset, nil
+}
+
+// createHTTPClient returns a client that trusts the certs in certDir, and the trusted CAs of the import proxy in the
+// directory of the IMPORTER_PROXY_CERT_DIR env var, in addition to the system certs. The client presents the client certificate in clientCertDir if the server requests
+// one. Requests go through the proxy in the HTTP_PROXY, HTTPS_PROXY and NO_PROXY env vars.
+func createHTTPClient(certDir, clientCertDir string) (*http.Client, error) {
 	client := &http.Client{
 		// Don't set timeout here, since that will be an absolute timeout, we need a relative to last progress timeout.
 	}
 
-	if certDir == "" {
+	proxyCertDir := os.Getenv(common.ImporterProxyCertDirVar)
+	if certDir == "" && proxyCertDir == "" && clientCertDir == "" {
+		// The default transport uses the proxy of the env vars
 		return client, nil
 	}
 
@@ -200,9 +448,56 @@ func createHTTPClient(certDir string) (*http.Client, error) {
 		return nil, errors.Wrap(err, "Error getting system certs")
 	}
 
+	if certDir != "" {
+		if err := appendCertsFromDir(certPool, certDir); err != nil {
+			return nil, err
+		}
+	}
+
+	if proxyCertDir != "" {
+		klog.Infof("Adding the trusted CAs of the import proxy")
+		if err := appendCertsFromDir(certPool, proxyCertDir); err != nil {
+			return nil, err
+		}
+	}
+
+	tlsConfig := &tls.Config{
+		RootCAs: certPool,
+	}
+	if err := loadClientCert(tlsConfig, clientCertDir); err != nil {
+		return nil, err
+	}
+
+	client.Transport = &http.Transport{
+		Proxy:           http.ProxyFromEnvironment,
+		TLSClientConfig: tlsConfig,
+	}
+
+	return client, nil
+}
+
+// loadClientCert adds the client certificate and private key in the files of clientCertDir to the TLS config, if
+// clientCertDir is set.
+func loadClientCert(tlsConfig *tls.Config, clientCertDir string) error {
+	if clientCertDir == "" {
+		return nil
+	}
+	certFile := filepath.Join(clientCertDir, common.ImporterClientCertFile)
+	keyFile := filepath.Join(clientCertDir, common.ImporterClientKeyFile)
+	klog.Infof("Using the client certificate in %s", certFile)
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return errors.Wrapf(err, "Error loading the client certificate in %s", clientCertDir)
+	}
+	tlsConfig.Certificates = []tls.Certificate{cert}
+	return nil
+}
+
+// appendCertsFromDir adds the certs in the files of certDir to the pool.
+func appendCertsFromDir(certPool *x509.CertPool, certDir string) error {
 	files, err := ioutil.ReadDir(certDir)
 	if err != nil {
-		return nil, errors.Wrapf(err, "Error listing files in %s", certDir)
+		return errors.Wrapf(err, "Error listing files in %s", certDir)
 	}
 
 	for _, file := range files {
@@ -216,7 +511,7 @@ func createHTTPClient(certDir string) (*http.Client, error) {
 
 		certs, err := ioutil.ReadFile(fp)
 		if err != nil {
-			return nil, errors.Wrapf(err, "Error reading file %s", fp)
+			return errors.Wrapf(err, "Error reading file %s", fp)
 		}
 
 		if ok := certPool.AppendCertsFromPEM(certs); !ok {
@@ -224,63 +519,52 @@ func createHTTPClient(certDir string) (*http.Client, error) {
 		}
 	}
 
-	client.Transport = &http.Transport{
-		TLSClientConfig: &tls.Config{
-			RootCAs: certPool,
-		},
-	}
-
-	return client, nil
+	return nil
 }
 
-func createHTTPReader(ctx context.Context, ep *url.URL, accessKey, secKey, certDir string) (io.ReadCloser, uint64, error) {
-	client, err := createHTTPClient(certDir)
+func createHTTPReader(ctx context.Context, ep *url.URL, creds *httpCredentials, certDir, clientCertDir string) (io.ReadCloser, uint64, http.Header, error) {
+	client, err := createHTTPClient(certDir, clientCertDir)
 	if err != nil {
-		return nil, uint64(0), errors.Wrap(err, "Error creating http client")
+		return nil, uint64(0), nil, errors.Wrap(err, "Error creating http client")
 	}
 
-	client.CheckRedirect = func(r *http.Request, via []*http.Request) error {
-		if len(accessKey) > 0 && len(secKey) > 0 {
-			r.SetBasicAuth(accessKey, secKey) // Redirects will lose basic auth, so reset them manually
-		}
-		return nil
-	}
+	// Redirects only keep some of the headers, so they are set again
+	client.CheckRedirect = creds.checkRedirect
 
-	total, err := getContentLength(client, ep, accessKey, secKey)
+	total, err := getContentLength(client, ep, creds)
 	if err != nil {
-		return nil, total, err
+		return nil, total, nil, err
 	}
 	// http.NewRequest can only return error on invalid METHOD, or invalid url. Here the METHOD is always GET, and the url is always valid, thus error cannot happen.
 	req, _ := http.NewRequest("GET", ep.String(), nil)
 
 	req = req.WithContext(ctx)
-	if len(accessKey) > 0 && len(secKey) > 0 {
-		req.SetBasicAuth(accessKey, secKey)
-	}
-	klog.V(2).Infof("Attempting to get object %q via http client\n", ep.String())
+	creds.setHeaders(req, ep)
+	klog.V(2).Infof("Attempting to get object %q via http client\n", redactURL(ep))
 	resp, err := client.Do(req)
 	if err != nil {
-		return nil, uint64(0), errors.Wrap(err, "HTTP request errored")
+		return nil, uint64(0), nil, errors.Wrap(err, "HTTP request errored")
 	}
 	if resp.StatusCode != 200 {
+		resp.Body.Close()
 		klog.Errorf("http: expected status code 200, got %d", resp.StatusCode)
-		return nil, uint64(0), errors.Errorf("expected status code 200, got %d. Status: %s", resp.StatusCode, resp.Status)
+		return nil, uint64(0), nil, newHTTPStatusError(resp.StatusCode, "expected status code 200, got %d. Status: %s", resp.StatusCode, resp.Status)
 	}
 	countingReader := &util.CountingReader{
 		Reader:  resp.Body,
 		Current: 0,
 	}
-	return countingReader, total, nil
+	return countingReader, total, resp.Header, nil
 }
 
 func (hs *HTTPDataSource) pollProgress(reader *util.CountingReader, idleTime, pollInterval time.Duration) {
-	count := reader.Current
+	count := atomic.LoadUint64(&reader.Current)
 	lastUpdate := time.Now()
 	for {
-		if count < reader.Current {
+		if current := atomic.LoadUint64(&reader.Current); count < current {
 			// Some progress was made, reset now.
 			lastUpdate = time.Now()
-			count = reader.Current
+			count = current
 		}
 
 		if time.Until(lastUpdate.Add(idleTime)).Nanoseconds() < 0 {
@@ -300,24 +584,23 @@ func (hs *HTTPDataSource) pollProgress(reader *util.CountingReader, idleTime, po
 	}
 }
 
-func getContentLength(client *http.Client, ep *url.URL, accessKey, secKey string) (uint64, error) {
+func getContentLength(client *http.Client, ep *url.URL, creds *httpCredentials) (uint64, error) {
 	req, err := http.NewRequest("HEAD", ep.String(), nil)
 	if err != nil {
 		return uint64(0), errors.Wrap(err, "could not create HTTP request")
 	}
-	if len(accessKey) > 0 && len(secKey) > 0 {
-		req.SetBasicAuth(accessKey, secKey)
-	}
+	creds.setHeaders(req, ep)
 
-	klog.V(2).Infof("Attempting to HEAD %q via http client\n", ep.String())
+	klog.V(2).Infof("Attempting to HEAD %q via http client\n", redactURL(ep))
 	resp, err := client.Do(req)
 	if err != nil {
 		return uint64(0), errors.Wrap(err, "HTTP request errored")
 	}
 
 	if resp.StatusCode != 200 {
+		resp.Body.Close()
 		klog.Errorf("http: expected status code 200, got %d", resp.StatusCode)
-		return uint64(0), errors.Errorf("expected status code 200, got %d. Status: %s", resp.StatusCode, resp.Status)
+		return uint64(0), newHTTPStatusError(resp.StatusCode, "expected status code 200, got %d. Status: %s", resp.StatusCode, resp.Status)
 	}
 
 	for k, v := range resp.Header {
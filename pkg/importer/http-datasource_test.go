@@ -1,8 +1,14 @@
 package importer
 
 import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"crypto/tls"
 	"crypto/x509"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
@@ -12,14 +18,20 @@ import (
 	"path"
 	"path/filepath"
 	"reflect"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	. "github.com/onsi/ginkgo"
 	"github.com/onsi/ginkgo/extensions/table"
 	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+	dto "github.com/prometheus/client_model/go"
 
 	cdiv1 "kubevirt.io/containerized-data-importer/pkg/apis/core/v1alpha1"
+	"kubevirt.io/containerized-data-importer/pkg/common"
 	"kubevirt.io/containerized-data-importer/pkg/util"
 	"kubevirt.io/containerized-data-importer/pkg/util/cert"
 	"kubevirt.io/containerized-data-importer/pkg/util/cert/triple"
@@ -70,14 +82,14 @@ var _ = Describe("Http data source", func() {
 	})
 
 	It("NewHTTPDataSource should fail when called with an invalid endpoint", func() {
-		_, err = NewHTTPDataSource("httpd://!@#$%^&*()dgsdd&3r53/invalid", "", "", "", cdiv1.DataVolumeKubeVirt)
+		_, err = NewHTTPDataSource("httpd://!@#$%^&*()dgsdd&3r53/invalid", "", "", cdiv1.DataVolumeKubeVirt, HTTPOptions{})
 		Expect(err).To(HaveOccurred())
 		Expect(strings.Contains(err.Error(), "unable to parse endpoint")).To(BeTrue())
 	})
 
 	It("endpoint User object should be set when accessKey and secKey are not blank", func() {
 		image := ts.URL + "/" + cirrosFileName
-		dp, err = NewHTTPDataSource(image, "user", "password", "", cdiv1.DataVolumeKubeVirt)
+		dp, err = NewHTTPDataSource(image, "user", "password", cdiv1.DataVolumeKubeVirt, HTTPOptions{})
 		Expect(err).NotTo(HaveOccurred())
 		user := dp.endpoint.User
 		Expect("user").To(Equal(user.Username()))
@@ -88,7 +100,7 @@ var _ = Describe("Http data source", func() {
 
 	It("NewHTTPDataSource should fail when called with an invalid certdir", func() {
 		image := ts.URL + "/" + cirrosFileName
-		_, err = NewHTTPDataSource(image, "", "", "/invaliddir", cdiv1.DataVolumeKubeVirt)
+		_, err = NewHTTPDataSource(image, "", "", cdiv1.DataVolumeKubeVirt, HTTPOptions{CertDir: "/invaliddir"})
 		Expect(err).To(HaveOccurred())
 	})
 
@@ -97,7 +109,7 @@ var _ = Describe("Http data source", func() {
 		if image != "" {
 			image = ts.URL + "/" + image
 		}
-		dp, err = NewHTTPDataSource(image, "", "", "", contentType)
+		dp, err = NewHTTPDataSource(image, "", "", contentType, HTTPOptions{})
 		Expect(err).NotTo(HaveOccurred())
 		newPhase, err := dp.Info()
 		if !wantErr {
@@ -118,13 +130,185 @@ var _ = Describe("Http data source", func() {
 	)
 
 	It("calling info with raw image should return TransferDataFile", func() {
-		dp, err = NewHTTPDataSource(ts.URL+"/"+tinyCoreGz, "", "", "", cdiv1.DataVolumeKubeVirt)
+		dp, err = NewHTTPDataSource(ts.URL+"/"+tinyCoreGz, "", "", cdiv1.DataVolumeKubeVirt, HTTPOptions{})
 		Expect(err).NotTo(HaveOccurred())
 		newPhase, err := dp.Info()
 		Expect(err).NotTo(HaveOccurred())
 		Expect(ProcessingPhaseTransferDataFile).To(Equal(newPhase))
 	})
 
+	It("calling info with a vmdk image should return TransferScratch", func() {
+		vmdk := make([]byte, 4096)
+		copy(vmdk, "KDMV")
+		flushRead = vmdk
+		vmdkServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.ServeContent(w, r, "disk.vmdk", time.Time{}, bytes.NewReader(vmdk))
+		}))
+		defer vmdkServer.Close()
+		dp, err = NewHTTPDataSource(vmdkServer.URL+"/disk.vmdk", "", "", cdiv1.DataVolumeKubeVirt, HTTPOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		newPhase, err := dp.Info()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ProcessingPhaseTransferScratch).To(Equal(newPhase))
+	})
+
+	It("should extract the disk image from a tar archive with the kubevirt content type", func() {
+		disk := make([]byte, 4096)
+		copy(disk[1024:], "data in the middle")
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		Expect(tw.WriteHeader(&tar.Header{Name: "README", Typeflag: tar.TypeReg, Mode: 0644, Size: 6})).To(Succeed())
+		_, err = tw.Write([]byte("readme"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tw.WriteHeader(&tar.Header{Name: "disk.img", Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(disk))})).To(Succeed())
+		_, err = tw.Write(disk)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tw.Close()).To(Succeed())
+		tarServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.ServeContent(w, r, "disk.tar", time.Time{}, bytes.NewReader(buf.Bytes()))
+		}))
+		defer tarServer.Close()
+
+		dp, err = NewHTTPDataSource(tarServer.URL+"/disk.tar", "", "", cdiv1.DataVolumeKubeVirt, HTTPOptions{DiskPath: "disk.img"})
+		Expect(err).NotTo(HaveOccurred())
+		newPhase, err := dp.Info()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ProcessingPhaseTransferDataFile).To(Equal(newPhase))
+		newPhase, err = dp.TransferFile(filepath.Join(tmpDir, "disk.img"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ProcessingPhaseResize).To(Equal(newPhase))
+		data, err := ioutil.ReadFile(filepath.Join(tmpDir, "disk.img"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(data).To(Equal(disk))
+	})
+
+	It("should store a zip archive in scratch space and extract it to the target directory", func() {
+		var buf bytes.Buffer
+		zw := zip.NewWriter(&buf)
+		w, err := zw.Create("dir/file.txt")
+		Expect(err).NotTo(HaveOccurred())
+		_, err = w.Write([]byte("zipped"))
+		Expect(err).NotTo(HaveOccurred())
+		// a stored image, so the archive is larger than the header
+		disk := make([]byte, 4096)
+		copy(disk[1024:], "data in the middle")
+		w, err = zw.CreateHeader(&zip.FileHeader{Name: "disk.img", Method: zip.Store})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = w.Write(disk)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(zw.Close()).To(Succeed())
+		zipServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.ServeContent(w, r, "archive.zip", time.Time{}, bytes.NewReader(buf.Bytes()))
+		}))
+		defer zipServer.Close()
+		targetDir := filepath.Join(tmpDir, "target")
+
+		dp, err = NewHTTPDataSource(zipServer.URL+"/archive.zip", "", "", cdiv1.DataVolumeArchive, HTTPOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		newPhase, err := dp.Info()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ProcessingPhaseTransferScratch).To(Equal(newPhase))
+		newPhase, err = dp.Transfer("/imaninvalidpath")
+		Expect(err).To(Equal(ErrInvalidPath))
+		Expect(ProcessingPhaseError).To(Equal(newPhase))
+		newPhase, err = dp.Transfer(tmpDir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ProcessingPhaseTransferDataDir).To(Equal(newPhase))
+		newPhase, err = dp.Transfer(targetDir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ProcessingPhaseComplete).To(Equal(newPhase))
+		data, err := ioutil.ReadFile(filepath.Join(targetDir, "dir", "file.txt"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).To(Equal("zipped"))
+		data, err = ioutil.ReadFile(filepath.Join(targetDir, "disk.img"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(data).To(Equal(disk))
+	})
+
+	It("should report the progress of the download and the extraction of a zip archive", func() {
+		var buf bytes.Buffer
+		zw := zip.NewWriter(&buf)
+		// a stored file, so the archive is larger than the header
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: "file.txt", Method: zip.Store})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = w.Write(bytes.Repeat([]byte("zipped data "), 10000))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(zw.Close()).To(Succeed())
+		zipServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.ServeContent(w, r, "archive.zip", time.Time{}, bytes.NewReader(buf.Bytes()))
+		}))
+		defer zipServer.Close()
+
+		// A label of its own, so the progress of the other tests does not interfere
+		defer func(uid string) { ownerUID = uid }(ownerUID)
+		ownerUID = "zip-progress"
+		dp, err = NewHTTPDataSource(zipServer.URL+"/archive.zip", "", "", cdiv1.DataVolumeArchive, HTTPOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		newPhase, err := dp.Info()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ProcessingPhaseTransferScratch).To(Equal(newPhase))
+		newPhase, err = dp.Transfer(tmpDir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ProcessingPhaseTransferDataDir).To(Equal(newPhase))
+		By("Checking the download is the first half of the progress")
+		Eventually(importProgress, 5*time.Second, 100*time.Millisecond).Should(BeNumerically("==", 50))
+		newPhase, err = dp.Transfer(filepath.Join(tmpDir, "target"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ProcessingPhaseComplete).To(Equal(newPhase))
+		Expect(atomic.LoadUint64(&dp.zipProgress.Current)).To(BeNumerically(">", buf.Len()))
+		Eventually(importProgress, 5*time.Second, 100*time.Millisecond).Should(BeNumerically("==", 100))
+	})
+
+	It("should report the progress of the extraction of a tar archive", func() {
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		data := bytes.Repeat([]byte("archived data "), 10000)
+		Expect(tw.WriteHeader(&tar.Header{Name: "file.txt", Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(data))})).To(Succeed())
+		_, err := tw.Write(data)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tw.Close()).To(Succeed())
+		tarServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.ServeContent(w, r, "archive.tar", time.Time{}, bytes.NewReader(buf.Bytes()))
+		}))
+		defer tarServer.Close()
+
+		defer func(uid string) { ownerUID = uid }(ownerUID)
+		ownerUID = "tar-progress"
+		dp, err = NewHTTPDataSource(tarServer.URL+"/archive.tar", "", "", cdiv1.DataVolumeArchive, HTTPOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		newPhase, err := dp.Info()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ProcessingPhaseTransferDataDir).To(Equal(newPhase))
+		newPhase, err = dp.Transfer(tmpDir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ProcessingPhaseComplete).To(Equal(newPhase))
+		Expect(dp.readers.progressReader.IsDone()).To(BeTrue())
+		Eventually(importProgress, 5*time.Second, 100*time.Millisecond).Should(BeNumerically("==", 100))
+	})
+
+	It("should store an image archive in scratch space and extract its disk image", func() {
+		disk := make([]byte, 4096)
+		copy(disk[1024:], "data in the middle")
+		archive := createTestOCIArchive(nil, createTestImage(createTestLayer(true, testLayerFile{name: "disk/disk.img", data: disk})))
+		archiveServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.ServeContent(w, r, "disk.tar", time.Time{}, bytes.NewReader(archive))
+		}))
+		defer archiveServer.Close()
+
+		dp, err = NewHTTPDataSource(archiveServer.URL+"/disk.tar", "", "", cdiv1.DataVolumeKubeVirt, HTTPOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		newPhase, err := dp.Info()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ProcessingPhaseTransferScratch).To(Equal(newPhase))
+		newPhase, err = dp.Transfer(tmpDir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ProcessingPhaseProcess).To(Equal(newPhase))
+		Expect(dp.GetURL().Path).To(Equal(filepath.Join(tmpDir, imageArchiveDiskFile)))
+		data, err := ioutil.ReadFile(dp.GetURL().Path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(data).To(Equal(disk))
+	})
+
 	table.DescribeTable("calling transfer should", func(image string, contentType cdiv1.DataVolumeContentType, expectedPhase ProcessingPhase, scratchPath string, want []byte, wantErr bool) {
 		flushRead = want
 		if scratchPath == "" {
@@ -133,7 +317,7 @@ var _ = Describe("Http data source", func() {
 		if image != "" {
 			image = ts.URL + "/" + image
 		}
-		dp, err = NewHTTPDataSource(image, "", "", "", contentType)
+		dp, err = NewHTTPDataSource(image, "", "", contentType, HTTPOptions{})
 		Expect(err).NotTo(HaveOccurred())
 		_, err := dp.Info()
 		Expect(err).NotTo(HaveOccurred())
@@ -164,7 +348,7 @@ var _ = Describe("Http data source", func() {
 	)
 
 	It("TransferFile should succeed when writing to valid file, and reading raw gz", func() {
-		dp, err = NewHTTPDataSource(ts.URL+"/"+tinyCoreGz, "", "", "", cdiv1.DataVolumeKubeVirt)
+		dp, err = NewHTTPDataSource(ts.URL+"/"+tinyCoreGz, "", "", cdiv1.DataVolumeKubeVirt, HTTPOptions{})
 		Expect(err).NotTo(HaveOccurred())
 		result, err := dp.Info()
 		Expect(err).NotTo(HaveOccurred())
@@ -175,7 +359,7 @@ var _ = Describe("Http data source", func() {
 	})
 
 	It("TransferFile should succeed when writing to valid file and reading raw xz", func() {
-		dp, err = NewHTTPDataSource(ts.URL+"/"+tinyCoreXz, "", "", "", cdiv1.DataVolumeKubeVirt)
+		dp, err = NewHTTPDataSource(ts.URL+"/"+tinyCoreXz, "", "", cdiv1.DataVolumeKubeVirt, HTTPOptions{})
 		Expect(err).NotTo(HaveOccurred())
 		result, err := dp.Info()
 		Expect(err).NotTo(HaveOccurred())
@@ -186,7 +370,7 @@ var _ = Describe("Http data source", func() {
 	})
 
 	It("TransferFile should fail on streaming error", func() {
-		dp, err = NewHTTPDataSource(ts.URL+"/"+tinyCoreGz, "", "", "", cdiv1.DataVolumeKubeVirt)
+		dp, err = NewHTTPDataSource(ts.URL+"/"+tinyCoreGz, "", "", cdiv1.DataVolumeKubeVirt, HTTPOptions{})
 		Expect(err).NotTo(HaveOccurred())
 		result, err := dp.Info()
 		Expect(err).NotTo(HaveOccurred())
@@ -198,7 +382,7 @@ var _ = Describe("Http data source", func() {
 
 	It("calling Process should return Convert", func() {
 		flushRead = cirrosData
-		dp, err = NewHTTPDataSource(ts.URL+"/"+cirrosFileName, "", "", "", cdiv1.DataVolumeKubeVirt)
+		dp, err = NewHTTPDataSource(ts.URL+"/"+cirrosFileName, "", "", cdiv1.DataVolumeKubeVirt, HTTPOptions{})
 		Expect(err).NotTo(HaveOccurred())
 		_, err := dp.Info()
 		Expect(err).NotTo(HaveOccurred())
@@ -208,6 +392,379 @@ var _ = Describe("Http data source", func() {
 	})
 })
 
+var _ = Describe("Http data source resume", func() {
+	var (
+		ts          *httptest.Server
+		dp          *HTTPDataSource
+		tmpDir      string
+		data        []byte
+		etag        string
+		rangeHeader string
+	)
+
+	BeforeEach(func() {
+		var err error
+		data = bytes.Repeat([]byte("resumable data "), 100000)
+		etag = "\"v1\""
+		rangeHeader = ""
+		ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == "GET" && r.Header.Get("Range") != "" {
+				rangeHeader = r.Header.Get("Range")
+			}
+			w.Header().Set("ETag", etag)
+			http.ServeContent(w, r, "disk.img", time.Time{}, bytes.NewReader(data))
+		}))
+		tmpDir, err = ioutil.TempDir("", "resume")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		if dp != nil {
+			dp.Close()
+		}
+		os.RemoveAll(tmpDir)
+		ts.Close()
+	})
+
+	It("should resume an interrupted transfer with a range request", func() {
+		fileName := filepath.Join(tmpDir, "disk.img")
+		Expect(ioutil.WriteFile(fileName, data[:300000], 0644)).To(Succeed())
+		checkpoint := &transferCheckpoint{URL: ts.URL + "/disk.img", Offset: 300000, ETag: etag, ContentLength: uint64(len(data))}
+		Expect(checkpoint.save(fileName)).To(Succeed())
+
+		var err error
+		dp, err = NewHTTPDataSource(ts.URL+"/disk.img", "", "", cdiv1.DataVolumeKubeVirt, HTTPOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		phase, err := dp.Info()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(phase).To(Equal(ProcessingPhaseTransferDataFile))
+		phase, err = dp.TransferFile(fileName)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(phase).To(Equal(ProcessingPhaseResize))
+		Expect(rangeHeader).To(Equal("bytes=300000-"))
+		written, err := ioutil.ReadFile(fileName)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(bytes.Equal(written, data)).To(BeTrue())
+		_, err = os.Stat(checkpointFileName(fileName))
+		Expect(os.IsNotExist(err)).To(BeTrue())
+	})
+
+	It("should verify the checksum of a resumed transfer", func() {
+		fileName := filepath.Join(tmpDir, "disk.img")
+		Expect(ioutil.WriteFile(fileName, data[:300000], 0644)).To(Succeed())
+		checkpoint := &transferCheckpoint{URL: ts.URL + "/disk.img", Offset: 300000, ETag: etag, ContentLength: uint64(len(data))}
+		Expect(checkpoint.save(fileName)).To(Succeed())
+
+		var err error
+		dp, err = NewHTTPDataSource(ts.URL+"/disk.img", "", "", cdiv1.DataVolumeKubeVirt, HTTPOptions{Checksum: fmt.Sprintf("sha256:%x", sha256.Sum256(data))})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = dp.Info()
+		Expect(err).NotTo(HaveOccurred())
+		phase, err := dp.TransferFile(fileName)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(phase).To(Equal(ProcessingPhaseResize))
+		Expect(rangeHeader).To(Equal("bytes=300000-"))
+	})
+
+	It("should fail a resumed transfer if the data written before does not match the checksum", func() {
+		fileName := filepath.Join(tmpDir, "disk.img")
+		Expect(ioutil.WriteFile(fileName, bytes.Repeat([]byte("x"), 300000), 0644)).To(Succeed())
+		checkpoint := &transferCheckpoint{URL: ts.URL + "/disk.img", Offset: 300000, ETag: etag, ContentLength: uint64(len(data))}
+		Expect(checkpoint.save(fileName)).To(Succeed())
+
+		var err error
+		dp, err = NewHTTPDataSource(ts.URL+"/disk.img", "", "", cdiv1.DataVolumeKubeVirt, HTTPOptions{Checksum: fmt.Sprintf("sha256:%x", sha256.Sum256(data))})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = dp.Info()
+		Expect(err).NotTo(HaveOccurred())
+		phase, err := dp.TransferFile(fileName)
+		Expect(errors.Cause(err)).To(Equal(ErrChecksumMismatch))
+		Expect(phase).To(Equal(ProcessingPhaseError))
+	})
+
+	It("should not store the basic auth credentials in the checkpoint", func() {
+		ts.Close()
+		ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("ETag", etag)
+			w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+			if r.Method == "HEAD" {
+				return
+			}
+			// Send part of the body and drop the connection
+			w.Write(data[:300000])
+			w.(http.Flusher).Flush()
+			conn, _, err := w.(http.Hijacker).Hijack()
+			Expect(err).NotTo(HaveOccurred())
+			conn.Close()
+		}))
+		fileName := filepath.Join(tmpDir, "disk.img")
+
+		var err error
+		dp, err = NewHTTPDataSource(ts.URL+"/disk.img", "user", "secretkey", cdiv1.DataVolumeKubeVirt, HTTPOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = dp.Info()
+		Expect(err).NotTo(HaveOccurred())
+		_, err = dp.TransferFile(fileName)
+		Expect(err).To(HaveOccurred())
+		content, err := ioutil.ReadFile(checkpointFileName(fileName))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(content)).NotTo(ContainSubstring("secretkey"))
+		checkpoint, err := loadCheckpoint(fileName)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(checkpoint.URL).To(Equal(ts.URL + "/disk.img"))
+	})
+
+	It("should resume the transfer with a range request when the connection is closed while the body is read", func() {
+		cut := true
+		ts.Close()
+		ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("ETag", etag)
+			if r.Method == "GET" && r.Header.Get("Range") == "" && cut {
+				// Send part of the body and drop the connection
+				cut = false
+				w.Header().Set("Accept-Ranges", "bytes")
+				w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+				w.Write(data[:300000])
+				w.(http.Flusher).Flush()
+				conn, _, err := w.(http.Hijacker).Hijack()
+				Expect(err).NotTo(HaveOccurred())
+				conn.Close()
+				return
+			}
+			if r.Method == "GET" && r.Header.Get("Range") != "" {
+				rangeHeader = r.Header.Get("Range")
+			}
+			http.ServeContent(w, r, "disk.img", time.Time{}, bytes.NewReader(data))
+		}))
+		fileName := filepath.Join(tmpDir, "disk.img")
+		retries := RetryCount()
+
+		var err error
+		dp, err = NewHTTPDataSource(ts.URL+"/disk.img", "", "", cdiv1.DataVolumeKubeVirt, HTTPOptions{Checksum: fmt.Sprintf("sha256:%x", sha256.Sum256(data))})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = dp.Info()
+		Expect(err).NotTo(HaveOccurred())
+		phase, err := dp.TransferFile(fileName)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(phase).To(Equal(ProcessingPhaseResize))
+		Expect(rangeHeader).To(Equal("bytes=300000-"))
+		Expect(RetryCount() - retries).To(Equal(1))
+		written, err := ioutil.ReadFile(fileName)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(bytes.Equal(written, data)).To(BeTrue())
+		_, err = os.Stat(checkpointFileName(fileName))
+		Expect(os.IsNotExist(err)).To(BeTrue())
+	})
+
+	It("should restart the transfer if the endpoint changed", func() {
+		fileName := filepath.Join(tmpDir, "disk.img")
+		Expect(ioutil.WriteFile(fileName, []byte("stale data"), 0644)).To(Succeed())
+		checkpoint := &transferCheckpoint{URL: ts.URL + "/disk.img", Offset: 10, ETag: "\"v0\"", ContentLength: uint64(len(data))}
+		Expect(checkpoint.save(fileName)).To(Succeed())
+
+		var err error
+		dp, err = NewHTTPDataSource(ts.URL+"/disk.img", "", "", cdiv1.DataVolumeKubeVirt, HTTPOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = dp.Info()
+		Expect(err).NotTo(HaveOccurred())
+		_, err = dp.TransferFile(fileName)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rangeHeader).To(BeEmpty())
+		written, err := ioutil.ReadFile(fileName)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(bytes.Equal(written, data)).To(BeTrue())
+	})
+})
+
+var _ = Describe("Http data source parallel transfer", func() {
+	var (
+		ts        *httptest.Server
+		dp        *HTTPDataSource
+		tmpDir    string
+		data      []byte
+		ranges    []string
+		rangeMtx  sync.Mutex
+		failRange string
+	)
+
+	BeforeEach(func() {
+		var err error
+		data = bytes.Repeat([]byte("parallel data "), 100000)
+		ranges = nil
+		failRange = ""
+		ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == "GET" && r.Header.Get("Range") != "" {
+				rangeMtx.Lock()
+				ranges = append(ranges, r.Header.Get("Range"))
+				rangeMtx.Unlock()
+			}
+			w.Header().Set("ETag", "\"v1\"")
+			if failRange != "" && r.Header.Get("Range") == failRange {
+				// Send part of the range and drop the connection
+				w.Header().Set("Content-Range", fmt.Sprintf("bytes 0-349999/%d", len(data)))
+				w.Header().Set("Content-Length", "350000")
+				w.WriteHeader(http.StatusPartialContent)
+				w.Write(data[:100000])
+				w.(http.Flusher).Flush()
+				conn, _, err := w.(http.Hijacker).Hijack()
+				Expect(err).NotTo(HaveOccurred())
+				conn.Close()
+				return
+			}
+			http.ServeContent(w, r, "disk.img", time.Time{}, bytes.NewReader(data))
+		}))
+		tmpDir, err = ioutil.TempDir("", "parallel")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		if dp != nil {
+			dp.Close()
+		}
+		os.RemoveAll(tmpDir)
+		ts.Close()
+	})
+
+	table.DescribeTable("should split", func(size int64, count int, expected []byteRange) {
+		defer func(size int64) { minRangeSize = size }(minRangeSize)
+		minRangeSize = 10
+		Expect(splitRanges(size, count)).To(Equal(expected))
+	},
+		table.Entry("into the requested number of ranges", int64(100), 4, []byteRange{{0, 24}, {25, 49}, {50, 74}, {75, 99}}),
+		table.Entry("with the remainder in the last range", int64(103), 2, []byteRange{{0, 50}, {51, 102}}),
+		table.Entry("into fewer ranges if they would be too small", int64(25), 4, []byteRange{{0, 11}, {12, 24}}),
+		table.Entry("into a single range if the data is small", int64(5), 4, []byteRange{{0, 4}}),
+	)
+
+	It("should download the data with multiple range requests", func() {
+		defer func(size int64) { minRangeSize = size }(minRangeSize)
+		minRangeSize = 1024
+		fileName := filepath.Join(tmpDir, "disk.img")
+		var err error
+		dp, err = NewHTTPDataSource(ts.URL+"/disk.img", "", "", cdiv1.DataVolumeKubeVirt, HTTPOptions{Checksum: fmt.Sprintf("sha256:%x", sha256.Sum256(data)), Connections: 4})
+		Expect(err).NotTo(HaveOccurred())
+		phase, err := dp.Info()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(phase).To(Equal(ProcessingPhaseTransferDataFile))
+		phase, err = dp.TransferFile(fileName)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(phase).To(Equal(ProcessingPhaseResize))
+		Expect(ranges).To(HaveLen(4))
+		Expect(ranges).To(ContainElement("bytes=0-349999"))
+		written, err := ioutil.ReadFile(fileName)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(bytes.Equal(written, data)).To(BeTrue())
+	})
+
+	It("should fail if the data does not match the checksum", func() {
+		defer func(size int64) { minRangeSize = size }(minRangeSize)
+		minRangeSize = 1024
+		var err error
+		dp, err = NewHTTPDataSource(ts.URL+"/disk.img", "", "", cdiv1.DataVolumeKubeVirt, HTTPOptions{Checksum: "md5:5d41402abc4b2a76b9719d911017c592", Connections: 4})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = dp.Info()
+		Expect(err).NotTo(HaveOccurred())
+		_, err = dp.TransferFile(filepath.Join(tmpDir, "disk.img"))
+		Expect(errors.Cause(err)).To(Equal(ErrChecksumMismatch))
+		Expect(ranges).To(HaveLen(4))
+	})
+
+	It("should only request the missing parts of an interrupted transfer", func() {
+		defer func(size int64) { minRangeSize = size }(minRangeSize)
+		minRangeSize = 1024
+		defer func(interval int64) { checkpointInterval = interval }(checkpointInterval)
+		checkpointInterval = 4096
+		// The range is not requested again by the same transfer
+		defer SetRetryOptions(retryOptions)
+		SetRetryOptions(RetryOptions{})
+		fileName := filepath.Join(tmpDir, "disk.img")
+		failRange = "bytes=0-349999"
+		var err error
+		dp, err = NewHTTPDataSource(ts.URL+"/disk.img", "", "", cdiv1.DataVolumeKubeVirt, HTTPOptions{Connections: 4})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = dp.Info()
+		Expect(err).NotTo(HaveOccurred())
+		_, err = dp.TransferFile(fileName)
+		Expect(err).To(HaveOccurred())
+		checkpoint, err := loadCheckpoint(fileName)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(checkpoint.Ranges).To(HaveLen(4))
+		Expect(checkpoint.Ranges[0].Start).To(BeNumerically(">", 0))
+		dp.Close()
+
+		By("Resuming the transfer")
+		failRange = ""
+		ranges = nil
+		dp, err = NewHTTPDataSource(ts.URL+"/disk.img", "", "", cdiv1.DataVolumeKubeVirt, HTTPOptions{Checksum: fmt.Sprintf("sha256:%x", sha256.Sum256(data)), Connections: 4})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = dp.Info()
+		Expect(err).NotTo(HaveOccurred())
+		phase, err := dp.TransferFile(fileName)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(phase).To(Equal(ProcessingPhaseResize))
+		Expect(ranges).NotTo(ContainElement(HavePrefix("bytes=0-")))
+		Expect(ranges).To(ContainElement(fmt.Sprintf("bytes=%d-349999", checkpoint.Ranges[0].Start)))
+		written, err := ioutil.ReadFile(fileName)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(bytes.Equal(written, data)).To(BeTrue())
+		_, err = os.Stat(checkpointFileName(fileName))
+		Expect(os.IsNotExist(err)).To(BeTrue())
+	})
+
+	It("should request the rest of a range again when its connection is closed while the body is read", func() {
+		defer func(size int64) { minRangeSize = size }(minRangeSize)
+		minRangeSize = 1024
+		fileName := filepath.Join(tmpDir, "disk.img")
+		failRange = "bytes=0-349999"
+		retries := RetryCount()
+		var err error
+		dp, err = NewHTTPDataSource(ts.URL+"/disk.img", "", "", cdiv1.DataVolumeKubeVirt, HTTPOptions{Checksum: fmt.Sprintf("sha256:%x", sha256.Sum256(data)), Connections: 4})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = dp.Info()
+		Expect(err).NotTo(HaveOccurred())
+		phase, err := dp.TransferFile(fileName)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(phase).To(Equal(ProcessingPhaseResize))
+		Expect(ranges).To(ContainElement("bytes=100000-349999"))
+		Expect(RetryCount() - retries).To(Equal(1))
+		written, err := ioutil.ReadFile(fileName)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(bytes.Equal(written, data)).To(BeTrue())
+	})
+
+	It("should resume the checkpoint of a single stream with multiple range requests", func() {
+		defer func(size int64) { minRangeSize = size }(minRangeSize)
+		minRangeSize = 1024
+		fileName := filepath.Join(tmpDir, "disk.img")
+		Expect(ioutil.WriteFile(fileName, data[:300000], 0644)).To(Succeed())
+		checkpoint := &transferCheckpoint{URL: ts.URL + "/disk.img", Offset: 300000, ETag: "\"v1\"", ContentLength: uint64(len(data))}
+		Expect(checkpoint.save(fileName)).To(Succeed())
+		var err error
+		dp, err = NewHTTPDataSource(ts.URL+"/disk.img", "", "", cdiv1.DataVolumeKubeVirt, HTTPOptions{Connections: 4})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = dp.Info()
+		Expect(err).NotTo(HaveOccurred())
+		_, err = dp.TransferFile(fileName)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ranges).To(HaveLen(4))
+		Expect(ranges).To(ContainElement("bytes=300000-574999"))
+		written, err := ioutil.ReadFile(fileName)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(bytes.Equal(written, data)).To(BeTrue())
+	})
+
+	It("should use a single stream with one connection", func() {
+		var err error
+		dp, err = NewHTTPDataSource(ts.URL+"/disk.img", "", "", cdiv1.DataVolumeKubeVirt, HTTPOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = dp.Info()
+		Expect(err).NotTo(HaveOccurred())
+		_, err = dp.TransferFile(filepath.Join(tmpDir, "disk.img"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ranges).To(BeEmpty())
+	})
+})
+
 var _ = Describe("Http client", func() {
 	var tempDir string
 
@@ -233,7 +790,7 @@ var _ = Describe("Http client", func() {
 	})
 
 	It("should load the cert", func() {
-		client, err := createHTTPClient(tempDir)
+		client, err := createHTTPClient(tempDir, "")
 		Expect(err).ToNot(HaveOccurred())
 
 		transport := client.Transport.(*http.Transport)
@@ -248,11 +805,98 @@ var _ = Describe("Http client", func() {
 		Expect(len(activeCAs.Subjects())).Should(Equal(len(systemCAs.Subjects()) + 1))
 	})
 
+	It("should trust the CAs of the import proxy and use the proxy of the env vars", func() {
+		keyPair, err := triple.NewCA("proxy.cdi.kubevirt.io")
+		Expect(err).ToNot(HaveOccurred())
+		proxyCertDir, err := ioutil.TempDir("", "proxycerts")
+		Expect(err).ToNot(HaveOccurred())
+		defer os.RemoveAll(proxyCertDir)
+		Expect(ioutil.WriteFile(filepath.Join(proxyCertDir, "ca.pem"), cert.EncodeCertPEM(keyPair.Cert), 0644)).To(Succeed())
+		os.Setenv(common.ImporterProxyCertDirVar, proxyCertDir)
+		defer os.Unsetenv(common.ImporterProxyCertDirVar)
+
+		client, err := createHTTPClient("", "")
+		Expect(err).ToNot(HaveOccurred())
+		transport := client.Transport.(*http.Transport)
+		Expect(transport.Proxy).ToNot(BeNil())
+		systemCAs, err := x509.SystemCertPool()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(len(transport.TLSClientConfig.RootCAs.Subjects())).Should(Equal(len(systemCAs.Subjects()) + 1))
+
+		client, err = createHTTPClient(tempDir, "")
+		Expect(err).ToNot(HaveOccurred())
+		transport = client.Transport.(*http.Transport)
+		Expect(len(transport.TLSClientConfig.RootCAs.Subjects())).Should(Equal(len(systemCAs.Subjects()) + 2))
+	})
+})
+
+var _ = Describe("Http client certificate", func() {
+	var certDir, clientCertDir string
+
+	BeforeEach(func() {
+		var err error
+		certDir, err = ioutil.TempDir("", "certs")
+		Expect(err).ToNot(HaveOccurred())
+		clientCertDir, err = ioutil.TempDir("", "client-cert")
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(certDir)
+		os.RemoveAll(clientCertDir)
+	})
+
+	It("should present the client certificate to a server that requires one", func() {
+		clientCAs := createTestClientCert(clientCertDir)
+		ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.TLS.PeerCertificates).To(HaveLen(1))
+			Expect(r.TLS.PeerCertificates[0].Subject.CommonName).To(Equal("importer"))
+			w.Header().Add("Content-Length", "25")
+			w.WriteHeader(http.StatusOK)
+		}))
+		ts.TLS = &tls.Config{
+			ClientAuth: tls.RequireAndVerifyClientCert,
+			ClientCAs:  clientCAs,
+		}
+		ts.StartTLS()
+		defer ts.Close()
+		Expect(ioutil.WriteFile(filepath.Join(certDir, "tls.crt"), cert.EncodeCertPEM(ts.Certificate()), 0644)).To(Succeed())
+		ep, err := url.Parse(ts.URL)
+		Expect(err).ToNot(HaveOccurred())
+
+		r, total, _, err := createHTTPReader(context.Background(), ep, &httpCredentials{}, certDir, clientCertDir)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(uint64(25)).To(Equal(total))
+		Expect(r.Close()).To(Succeed())
+
+		_, _, _, err = createHTTPReader(context.Background(), ep, &httpCredentials{}, certDir, "")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should fail if the client certificate is missing", func() {
+		_, err := createHTTPClient("", clientCertDir)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("client certificate"))
+	})
 })
 
+// createTestClientCert writes a client certificate and its key in the tls.crt and tls.key files of the passed in
+// directory, and returns the pool of the CA that signed the certificate.
+func createTestClientCert(dir string) *x509.CertPool {
+	ca, err := triple.NewCA("client-ca.cdi.kubevirt.io")
+	Expect(err).ToNot(HaveOccurred())
+	keyPair, err := triple.NewClientKeyPair(ca, "importer", nil)
+	Expect(err).ToNot(HaveOccurred())
+	Expect(ioutil.WriteFile(filepath.Join(dir, common.ImporterClientCertFile), cert.EncodeCertPEM(keyPair.Cert), 0644)).To(Succeed())
+	Expect(ioutil.WriteFile(filepath.Join(dir, common.ImporterClientKeyFile), cert.EncodePrivateKeyPEM(keyPair.Key), 0600)).To(Succeed())
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Cert)
+	return pool
+}
+
 var _ = Describe("Http reader", func() {
 	It("should fail when passed an invalid cert directory", func() {
-		_, total, err := createHTTPReader(context.Background(), nil, "", "", "/invalid")
+		_, total, _, err := createHTTPReader(context.Background(), nil, &httpCredentials{}, "/invalid", "")
 		Expect(err).To(HaveOccurred())
 		Expect(uint64(0)).To(Equal(total))
 	})
@@ -269,7 +913,7 @@ var _ = Describe("Http reader", func() {
 		defer ts.Close()
 		ep, err := url.Parse(ts.URL)
 		Expect(err).ToNot(HaveOccurred())
-		r, total, err := createHTTPReader(context.Background(), ep, "user", "password", "")
+		r, total, _, err := createHTTPReader(context.Background(), ep, &httpCredentials{accessKey: "user", secKey: "password"}, "", "")
 		Expect(err).ToNot(HaveOccurred())
 		Expect(uint64(25)).To(Equal(total))
 		err = r.Close()
@@ -292,7 +936,7 @@ var _ = Describe("Http reader", func() {
 		defer ts.Close()
 		ep, err := url.Parse(ts.URL)
 		Expect(err).ToNot(HaveOccurred())
-		r, total, err := createHTTPReader(context.Background(), ep, "user", "password", "")
+		r, total, _, err := createHTTPReader(context.Background(), ep, &httpCredentials{accessKey: "user", secKey: "password"}, "", "")
 		Expect(err).ToNot(HaveOccurred())
 		Expect(uint64(25)).To(Equal(total))
 		err = r.Close()
@@ -313,7 +957,7 @@ var _ = Describe("Http reader", func() {
 		defer ts.Close()
 		ep, err := url.Parse(ts.URL)
 		Expect(err).ToNot(HaveOccurred())
-		r, total, err := createHTTPReader(context.Background(), ep, "", "", "")
+		r, total, _, err := createHTTPReader(context.Background(), ep, &httpCredentials{}, "", "")
 		Expect(err).ToNot(HaveOccurred())
 		Expect(uint64(25)).To(Equal(total))
 		err = r.Close()
@@ -327,13 +971,154 @@ var _ = Describe("Http reader", func() {
 		defer ts.Close()
 		ep, err := url.Parse(ts.URL)
 		Expect(err).ToNot(HaveOccurred())
-		_, total, err := createHTTPReader(context.Background(), ep, "", "", "")
+		_, total, _, err := createHTTPReader(context.Background(), ep, &httpCredentials{}, "", "")
 		Expect(err).To(HaveOccurred())
 		Expect(uint64(0)).To(Equal(total))
 		Expect("expected status code 200, got 500. Status: 500 Internal Server Error").To(Equal(err.Error()))
 	})
 })
 
+var _ = Describe("Http extra headers", func() {
+	var tmpDir string
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "headers")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(tmpDir)
+	})
+
+	It("should send the extra headers and the bearer token with every request", func() {
+		defer func(size int64) { minRangeSize = size }(minRangeSize)
+		minRangeSize = 1024
+		data := bytes.Repeat([]byte("header data "), 1000)
+		requests := 0
+		var mtx sync.Mutex
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mtx.Lock()
+			requests++
+			mtx.Unlock()
+			if r.Header.Get("Authorization") != "Bearer secret-token" || r.Header.Get("X-Repository") != "images" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Header().Set("ETag", "\"v1\"")
+			http.ServeContent(w, r, "disk.img", time.Time{}, bytes.NewReader(data))
+		}))
+		defer ts.Close()
+		dp, err := NewHTTPDataSource(ts.URL+"/disk.img", "", "", cdiv1.DataVolumeKubeVirt, HTTPOptions{Connections: 2, ExtraHeaders: []string{"X-Repository: images"}, SecretExtraHeaders: []string{"Authorization: Bearer secret-token"}})
+		Expect(err).NotTo(HaveOccurred())
+		defer dp.Close()
+		_, err = dp.Info()
+		Expect(err).NotTo(HaveOccurred())
+		fileName := filepath.Join(tmpDir, "disk.img")
+		_, err = dp.TransferFile(fileName)
+		Expect(err).NotTo(HaveOccurred())
+		written, err := ioutil.ReadFile(fileName)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(bytes.Equal(written, data)).To(BeTrue())
+		// The HEAD and GET requests, and the two range requests
+		Expect(requests).To(Equal(4))
+	})
+
+	It("should only send the credentials to the host of the endpoint when redirected", func() {
+		redirTs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer w.WriteHeader(http.StatusOK)
+			_, _, ok := r.BasicAuth()
+			Expect(ok).To(BeFalse())
+			Expect(r.Header.Get("X-Api-Key")).To(BeEmpty())
+			Expect(r.Header.Get("X-Repository")).To(Equal("images"))
+			w.Header().Add("Content-Length", "25")
+		}))
+		defer redirTs.Close()
+		redirURL, err := url.Parse(redirTs.URL)
+		Expect(err).ToNot(HaveOccurred())
+		// The servers listen on 127.0.0.1, localhost is another host
+		redirURL.Host = "localhost:" + redirURL.Port()
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.Header.Get("X-Api-Key")).To(Equal("secret-key"))
+			http.Redirect(w, r, redirURL.String(), http.StatusFound)
+		}))
+		defer ts.Close()
+		ep, err := url.Parse(ts.URL)
+		Expect(err).ToNot(HaveOccurred())
+		creds, err := newHTTPCredentials("user", "password", []string{"X-Repository: images"}, []string{"X-Api-Key: secret-key"})
+		Expect(err).ToNot(HaveOccurred())
+		r, total, _, err := createHTTPReader(context.Background(), ep, creds, "", "")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(uint64(25)).To(Equal(total))
+		Expect(r.Close()).To(Succeed())
+	})
+
+	table.DescribeTable("should decide if the credentials are sent", func(endpoint, target string, expected bool) {
+		endpointURL, err := url.Parse(endpoint)
+		Expect(err).ToNot(HaveOccurred())
+		targetURL, err := url.Parse(target)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(sendsCredentials(endpointURL, targetURL)).To(Equal(expected))
+	},
+		table.Entry("to the same host", "https://repo.example.com/disk.img", "https://repo.example.com/blobs/disk.img", true),
+		table.Entry("to another port of the same host", "http://repo.example.com:8080/disk.img", "http://repo.example.com:8081/disk.img", true),
+		table.Entry("to the same host with https", "http://repo.example.com/disk.img", "https://repo.example.com/disk.img", true),
+		table.Entry("not to the same host with http", "https://repo.example.com/disk.img", "http://repo.example.com/disk.img", false),
+		table.Entry("not to a subdomain", "https://example.com/disk.img", "https://cdn.example.com/disk.img", false),
+		table.Entry("not to another host", "https://repo.example.com/disk.img", "https://bucket.s3.amazonaws.com/disk.img?X-Amz-Signature=abc", false),
+	)
+
+	It("should fail on an invalid header without its value in the error", func() {
+		_, err := newHTTPCredentials("", "", nil, []string{"X-Api-Key secret-key"})
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).ToNot(ContainSubstring("secret-key"))
+		_, err = newHTTPCredentials("", "", []string{"Bad Header: value"}, nil)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should not stream to conversion if extra headers are sent", func() {
+		// The header of a qcow2 image of 1M
+		qcow2 := make([]byte, 512)
+		copy(qcow2, "QFI\xfb\x00\x00\x00\x03")
+		qcow2[26] = 0x10
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.ServeContent(w, r, "disk.qcow2", time.Time{}, bytes.NewReader(qcow2))
+		}))
+		defer ts.Close()
+		dp, err := NewHTTPDataSource(ts.URL+"/disk.qcow2", "", "", cdiv1.DataVolumeKubeVirt, HTTPOptions{ExtraHeaders: []string{"X-Repository: images"}})
+		Expect(err).NotTo(HaveOccurred())
+		defer dp.Close()
+		phase, err := dp.Info()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(phase).To(Equal(ProcessingPhaseTransferScratch))
+	})
+
+	It("should read the secret extra headers and bearer tokens of mounted secrets", func() {
+		// A mounted secret has links to the files of a hidden directory
+		for i, keys := range []map[string]string{{"token": "secret-token\n"}, {"b": "X-Api-Key: secret-key", "a": "X-Repository: images"}} {
+			dataDir := filepath.Join(tmpDir, strconv.Itoa(i), "..data")
+			Expect(os.MkdirAll(dataDir, 0755)).To(Succeed())
+			for key, value := range keys {
+				Expect(ioutil.WriteFile(filepath.Join(dataDir, key), []byte(value), 0644)).To(Succeed())
+				Expect(os.Symlink(filepath.Join("..data", key), filepath.Join(tmpDir, strconv.Itoa(i), key))).To(Succeed())
+			}
+		}
+		headers, err := ReadSecretExtraHeaders(tmpDir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(headers).To(Equal([]string{"Authorization: Bearer secret-token", "X-Repository: images", "X-Api-Key: secret-key"}))
+		headers, err = ReadSecretExtraHeaders(filepath.Join(tmpDir, "missing"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(headers).To(BeEmpty())
+	})
+})
+
+// importProgress returns the value of the import progress metric.
+func importProgress() float64 {
+	metric := &dto.Metric{}
+	Expect(progress.WithLabelValues(ownerUID).Write(metric)).To(Succeed())
+	return *metric.Counter.Value
+}
+
 var _ = Describe("http pollprogress", func() {
 	It("Should properly finish with valid reader", func() {
 		By("Creating context for the transfer, we have the ability to cancel it")
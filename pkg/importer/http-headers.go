@@ -0,0 +1,185 @@
+/*
+Copyright 2020 The CDI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package importer
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/http/httpguts"
+
+	"k8s.io/klog"
+)
+
+const (
+	// secretHeaderToken is the key of a secret of extra headers that holds a bearer token instead of a header
+	secretHeaderToken = "token"
+	// maxRedirects is the number of redirects followed before a request fails, like the default of the http client
+	maxRedirects = 10
+)
+
+// httpCredentials are the credentials and the extra headers added to the requests to an http endpoint. The extra
+// headers are sent to every host the endpoint redirects to. The credentials, which are the basic auth of the access key
+// and secret key, and the headers read from secrets, are only sent to the host of the endpoint. A redirect to another
+// host, or from https to http, drops them.
+type httpCredentials struct {
+	accessKey string
+	secKey    string
+	// headers sent with every request
+	extraHeaders http.Header
+	// headers sent with the requests to the host of the endpoint only
+	secretHeaders http.Header
+}
+
+// newHTTPCredentials parses the extra headers and secret extra headers, in the form <name>: <value>. The values of the
+// secret headers are left out of errors, so they never end up in the logs or the termination message.
+func newHTTPCredentials(accessKey, secKey string, extraHeaders, secretExtraHeaders []string) (*httpCredentials, error) {
+	creds := &httpCredentials{
+		accessKey:     accessKey,
+		secKey:        secKey,
+		extraHeaders:  http.Header{},
+		secretHeaders: http.Header{},
+	}
+	for _, header := range extraHeaders {
+		name, value, err := parseHeader(header)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid extra header %q", header)
+		}
+		creds.extraHeaders.Add(name, value)
+	}
+	for i, header := range secretExtraHeaders {
+		name, value, err := parseHeader(header)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid secret extra header #%d", i)
+		}
+		creds.secretHeaders.Add(name, value)
+	}
+	return creds, nil
+}
+
+// parseHeader splits a header in the form <name>: <value>.
+func parseHeader(header string) (string, string, error) {
+	i := strings.Index(header, ":")
+	if i < 0 {
+		return "", "", errors.New("expected <name>: <value>")
+	}
+	name, value := strings.TrimSpace(header[:i]), strings.TrimSpace(header[i+1:])
+	if !httpguts.ValidHeaderFieldName(name) {
+		return "", "", errors.New("invalid header name")
+	}
+	if !httpguts.ValidHeaderFieldValue(value) {
+		return "", "", errors.Errorf("invalid value of header %s", name)
+	}
+	return name, value, nil
+}
+
+// hasHeaders returns true if extra headers have to be sent with the requests, which only the http client can do.
+func (c *httpCredentials) hasHeaders() bool {
+	return len(c.extraHeaders) > 0 || len(c.secretHeaders) > 0
+}
+
+// setHeaders sets the extra headers of the request, and the credentials if the request goes to the host of the
+// endpoint. A token in the secret headers takes precedence over the basic auth.
+func (c *httpCredentials) setHeaders(req *http.Request, endpoint *url.URL) {
+	for name, values := range c.extraHeaders {
+		req.Header[name] = values
+	}
+	if !sendsCredentials(endpoint, req.URL) {
+		// The http client copies the headers of the original request, only some of them are dropped for other hosts
+		req.Header.Del("Authorization")
+		for name := range c.secretHeaders {
+			req.Header.Del(name)
+		}
+		return
+	}
+	if len(c.accessKey) > 0 && len(c.secKey) > 0 {
+		req.SetBasicAuth(c.accessKey, c.secKey)
+	}
+	for name, values := range c.secretHeaders {
+		req.Header[name] = values
+	}
+}
+
+// checkRedirect sets the headers of a redirected request, the first request of via went to the endpoint.
+func (c *httpCredentials) checkRedirect(r *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return errors.Errorf("stopped after %d redirects", maxRedirects)
+	}
+	c.setHeaders(r, via[0].URL)
+	return nil
+}
+
+// sendsCredentials returns true if the credentials of the endpoint can be sent to the passed in url, which is the case
+// if it is on the same host, and does not downgrade https to http. The port is not compared, like the http client does
+// for the Authorization header.
+func sendsCredentials(endpoint, target *url.URL) bool {
+	if !strings.EqualFold(endpoint.Hostname(), target.Hostname()) {
+		return false
+	}
+	return endpoint.Scheme != "https" || target.Scheme == "https"
+}
+
+// ReadSecretExtraHeaders reads the extra headers from the secrets mounted in the subdirectories of the passed in
+// directory. Every key of a secret holds a header in the form <name>: <value>, except the token key, which holds a
+// bearer token. No headers are returned if the directory does not exist.
+func ReadSecretExtraHeaders(dir string) ([]string, error) {
+	secrets, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not list the secrets of extra headers in %s", dir)
+	}
+	var headers []string
+	for _, secret := range secrets {
+		if !secret.IsDir() || strings.HasPrefix(secret.Name(), ".") {
+			continue
+		}
+		secretDir := filepath.Join(dir, secret.Name())
+		keys, err := ioutil.ReadDir(secretDir)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not list the extra headers in %s", secretDir)
+		}
+		// The keys of a mounted secret are links to the files of a hidden directory, which are skipped
+		var names []string
+		for _, key := range keys {
+			if !strings.HasPrefix(key.Name(), ".") {
+				names = append(names, key.Name())
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			data, err := ioutil.ReadFile(filepath.Join(secretDir, name))
+			if err != nil {
+				return nil, errors.Wrapf(err, "could not read the extra header %s in %s", name, secretDir)
+			}
+			value := strings.TrimSpace(string(data))
+			if name == secretHeaderToken {
+				value = "Authorization: Bearer " + value
+			}
+			headers = append(headers, value)
+		}
+		klog.V(1).Infof("Read %d extra headers from %s\n", len(names), secretDir)
+	}
+	return headers, nil
+}
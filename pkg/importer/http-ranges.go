@@ -0,0 +1,336 @@
+/*
+Copyright 2020 The CDI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package importer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+
+	"k8s.io/klog"
+
+	cdiv1 "kubevirt.io/containerized-data-importer/pkg/apis/core/v1alpha1"
+	"kubevirt.io/containerized-data-importer/pkg/util"
+)
+
+// may be overridden in tests
+var minRangeSize = int64(16 * 1024 * 1024)
+
+// byteRange is an inclusive range of bytes, like in a Range header.
+type byteRange struct {
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+}
+
+// splitRanges splits size bytes into at most count ranges, none of them smaller than minRangeSize.
+func splitRanges(size int64, count int) []byteRange {
+	if int64(count) > size/minRangeSize {
+		count = int(size / minRangeSize)
+	}
+	if count < 1 {
+		count = 1
+	}
+	ranges := make([]byteRange, 0, count)
+	rangeSize := size / int64(count)
+	start := int64(0)
+	for i := 0; i < count; i++ {
+		end := start + rangeSize - 1
+		if i == count-1 {
+			end = size - 1
+		}
+		ranges = append(ranges, byteRange{Start: start, End: end})
+		start = end + 1
+	}
+	return ranges
+}
+
+// canTransferInParallel returns true if the data can be fetched with multiple range requests and written as is.
+func (hs *HTTPDataSource) canTransferInParallel() bool {
+	return hs.connections > 1 && hs.acceptRanges && hs.contentLength > 0 && hs.contentType == cdiv1.DataVolumeKubeVirt &&
+		!hs.readers.Archived && len(splitRanges(int64(hs.contentLength), hs.connections)) > 1
+}
+
+// rangeWriter writes a range to a file starting at its offset, and reports the number of bytes written to the progress.
+// If the transfer is checkpointed, the offset is periodically synced to disk and recorded in the checkpoint.
+type rangeWriter struct {
+	writer     *util.SparseWriter
+	progress   *rangeProgress
+	index      int
+	offset     int64
+	end        int64
+	lastSaved  int64
+	checkpoint *rangeCheckpoint
+}
+
+func (w *rangeWriter) Write(p []byte) (int, error) {
+	n, err := w.writer.Write(p)
+	w.offset += int64(n)
+	w.progress.add(n)
+	if err == nil && w.checkpoint != nil && w.offset-w.lastSaved >= checkpointInterval {
+		err = w.flush()
+	}
+	return n, err
+}
+
+// flush writes the pending zero blocks, and records the offset of the range in the checkpoint.
+func (w *rangeWriter) flush() error {
+	if err := w.writer.Flush(); err != nil {
+		return err
+	}
+	if w.checkpoint == nil {
+		return nil
+	}
+	if err := w.checkpoint.update(w.index, w.offset); err != nil {
+		return err
+	}
+	w.lastSaved = w.offset
+	return nil
+}
+
+// rangeCheckpoint is the checkpoint of a parallel transfer. It keeps the part of every range that has not been
+// synced to disk yet, so an interrupted transfer only requests the missing parts.
+type rangeCheckpoint struct {
+	lock       sync.Mutex
+	file       *os.File
+	fileName   string
+	checkpoint *transferCheckpoint
+}
+
+// update syncs the file, and then saves the checkpoint with the range at the index starting at the passed in offset.
+func (c *rangeCheckpoint) update(index int, offset int64) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if err := c.file.Sync(); err != nil {
+		return errors.Wrapf(err, "could not sync %q", c.fileName)
+	}
+	c.checkpoint.Ranges[index].Start = offset
+	return c.checkpoint.save(c.fileName)
+}
+
+// pendingRanges returns the ranges that are still missing according to the previous checkpoint, or nil if the
+// transfer has to start over. The rest of a transfer that was checkpointed with a single stream is split into ranges.
+func pendingRanges(previous *transferCheckpoint, size int64, connections int) []byteRange {
+	var ranges []byteRange
+	switch {
+	case len(previous.Ranges) > 0:
+		ranges = previous.Ranges
+	case previous.Offset > 0:
+		for _, r := range splitRanges(size-previous.Offset, connections) {
+			ranges = append(ranges, byteRange{Start: r.Start + previous.Offset, End: r.End + previous.Offset})
+		}
+	default:
+		return nil
+	}
+	pending := []byteRange{}
+	for _, r := range ranges {
+		if r.Start <= r.End {
+			pending = append(pending, r)
+		}
+	}
+	return pending
+}
+
+// rangeProgress adds the bytes written by all the range requests to the counters of the single stream, so the idle
+// poller and the progress keep working.
+type rangeProgress struct {
+	countingReader *util.CountingReader
+	progressReader *util.CountingReader
+}
+
+func (p *rangeProgress) add(n int) {
+	atomic.AddUint64(&p.countingReader.Current, uint64(n))
+	if p.progressReader != nil {
+		atomic.AddUint64(&p.progressReader.Current, uint64(n))
+	}
+}
+
+// transferInParallel downloads the data from the endpoint into the passed in file, using concurrent range requests.
+// The single stream opened when the data source was created is closed, since its data is not needed anymore. If the
+// endpoint allows validating that the data did not change, the parts of the ranges that are written are checkpointed,
+// and an interrupted transfer only requests the missing parts. If the data is verified against a checksum, the file
+// is hashed once the download completes.
+func (hs *HTTPDataSource) transferInParallel(fileName string) error {
+	size := int64(hs.contentLength)
+	current := &transferCheckpoint{
+		URL:           hs.redactedEndpoint(),
+		ETag:          hs.etag,
+		LastModified:  hs.lastModified,
+		ContentLength: hs.contentLength,
+	}
+	previous, err := loadCheckpoint(fileName)
+	if err != nil {
+		klog.Warningf("Ignoring checkpoint: %v", err)
+	}
+	var ranges []byteRange
+	if current.matches(previous) {
+		ranges = pendingRanges(previous, size, hs.connections)
+	}
+	resumed := ranges != nil
+	if !resumed {
+		ranges = splitRanges(size, hs.connections)
+	}
+	remaining := int64(0)
+	for _, r := range ranges {
+		remaining += r.End - r.Start + 1
+	}
+	if resumed {
+		klog.V(1).Infof("Resuming download of %d of %d bytes from %q using %d connections\n", remaining, size, hs.redactedEndpoint(), len(ranges))
+	} else {
+		klog.V(1).Infof("Downloading %d bytes from %q using %d connections\n", size, hs.redactedEndpoint(), len(ranges))
+	}
+
+	countingReader := hs.httpReader.(*util.CountingReader)
+	countingReader.Reader.Close()
+	countingReader.Reader = http.NoBody
+	progress := &rangeProgress{countingReader: countingReader}
+	if hs.readers.progressReader != nil {
+		atomic.StoreUint64(&hs.readers.progressReader.Current, uint64(size-remaining))
+		progress.progressReader = &hs.readers.progressReader.CountingReader
+	}
+
+	var file *os.File
+	if resumed {
+		file, err = os.OpenFile(fileName, os.O_WRONLY, os.ModePerm)
+	} else {
+		if err := removeCheckpoint(fileName); err != nil {
+			return err
+		}
+		file, err = os.OpenFile(fileName, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, os.ModePerm)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "could not open file %q", fileName)
+	}
+	defer file.Close()
+	if err := file.Truncate(size); err != nil {
+		return errors.Wrapf(err, "could not allocate file %q", fileName)
+	}
+	var checkpoint *rangeCheckpoint
+	if current.validator() != "" {
+		current.Ranges = ranges
+		checkpoint = &rangeCheckpoint{file: file, fileName: fileName, checkpoint: current}
+		if err := current.save(fileName); err != nil {
+			return err
+		}
+	} else {
+		klog.V(2).Infof("Endpoint %q does not provide an ETag or Last-Modified header, not checkpointing transfer", hs.redactedEndpoint())
+	}
+
+	client, err := createHTTPClient(hs.certDir, hs.clientCertDir)
+	if err != nil {
+		return errors.Wrap(err, "Error creating http client")
+	}
+	client.CheckRedirect = hs.creds.checkRedirect
+
+	ctx, cancel := context.WithCancel(hs.ctx)
+	defer cancel()
+	errChan := make(chan error, len(ranges))
+	var wg sync.WaitGroup
+	for i, r := range ranges {
+		// The file is already allocated, the zero blocks are left as holes.
+		writer, err := util.NewSparseWriter(file, r.Start)
+		if err != nil {
+			cancel()
+			errChan <- err
+			break
+		}
+		wg.Add(1)
+		go func(w *rangeWriter) {
+			defer wg.Done()
+			if err := hs.transferRange(ctx, client, w); err != nil {
+				errChan <- err
+				// Stop the other requests, the transfer failed.
+				cancel()
+			}
+		}(&rangeWriter{writer: writer, progress: progress, index: i, offset: r.Start, end: r.End, lastSaved: r.Start, checkpoint: checkpoint})
+	}
+	wg.Wait()
+	close(errChan)
+	if err := <-errChan; err != nil {
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		return errors.Wrapf(err, "could not sync %q", fileName)
+	}
+	if err := removeCheckpoint(fileName); err != nil {
+		return err
+	}
+	countingReader.SetDone(true)
+	return hs.readers.restartChecksumFromFile(fileName, size)
+}
+
+// transferRange downloads the rest of the range of the writer from the endpoint, and writes it at the same offset in
+// the file. If the request fails with a retryable error, like a connection that is closed while the body is read, the
+// rest of the range is requested again. Whether it succeeds or not, the part that was written is recorded in the
+// checkpoint.
+func (hs *HTTPDataSource) transferRange(ctx context.Context, client *http.Client, w *rangeWriter) error {
+	start := w.offset
+	err := retry(fmt.Sprintf("request of range %d-%d", start, w.end), func() error {
+		return hs.requestRange(ctx, client, w)
+	})
+	if flushErr := w.flush(); flushErr != nil {
+		if err != nil {
+			klog.Errorf("Unable to save checkpoint: %v\n", flushErr)
+		} else {
+			err = flushErr
+		}
+	}
+	if err != nil {
+		return errors.Wrapf(err, "unable to write range %d-%d", start, w.end)
+	}
+	return nil
+}
+
+// requestRange requests the rest of the range of the writer from the endpoint, and copies it to the writer.
+func (hs *HTTPDataSource) requestRange(ctx context.Context, client *http.Client, w *rangeWriter) error {
+	start := w.offset
+	// http.NewRequest can only return error on invalid METHOD, or invalid url. Here the METHOD is always GET, and the url is always valid, thus error cannot happen.
+	req, _ := http.NewRequest("GET", hs.endpoint.String(), nil)
+	req = req.WithContext(ctx)
+	hs.creds.setHeaders(req, hs.endpoint)
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, w.end))
+	// Make sure all the ranges come from the same version of the source.
+	if hs.etag != "" {
+		req.Header.Set("If-Range", hs.etag)
+	} else if hs.lastModified != "" {
+		req.Header.Set("If-Range", hs.lastModified)
+	}
+	klog.V(3).Infof("Requesting range %d-%d of %q\n", start, w.end, hs.redactedEndpoint())
+	resp, err := client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "HTTP request errored")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent {
+		klog.Errorf("http: expected status code 206, got %d", resp.StatusCode)
+		return newHTTPStatusError(resp.StatusCode, "expected status code 206 for range %d-%d, got %d. Status: %s", start, w.end, resp.StatusCode, resp.Status)
+	}
+	length := w.end - start + 1
+	written, err := io.Copy(w, io.LimitReader(resp.Body, length))
+	if err != nil {
+		return err
+	}
+	if written != length {
+		return errors.Wrapf(io.ErrUnexpectedEOF, "range %d-%d ended after %d bytes", start, w.end, written)
+	}
+	return nil
+}
@@ -0,0 +1,381 @@
+/*
+Copyright 2018 The CDI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package importer
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+
+	"k8s.io/klog"
+
+	cdiv1 "kubevirt.io/containerized-data-importer/pkg/apis/core/v1alpha1"
+	"kubevirt.io/containerized-data-importer/pkg/util"
+)
+
+const (
+	// imageArchiveDiskFile is the file in scratch space the disk image of an image archive is extracted to
+	imageArchiveDiskFile = "tmpdisk"
+	// ociLayoutIndex is the index of the images of an OCI image layout, or an oci-archive
+	ociLayoutIndex = "index.json"
+	// dockerArchiveManifest is the manifest of the images of a docker-archive
+	dockerArchiveManifest = "manifest.json"
+	// imageArchiveReleaseSize is how much of a layer is read before the space of the data that was read is released
+	imageArchiveReleaseSize = 16 << 20
+)
+
+// imageArchiveFileRegexp matches the files of an OCI image layout, and the files written by docker save and skopeo
+// copy to a docker-archive.
+var imageArchiveFileRegexp = regexp.MustCompile(`^(oci-layout|index\.json|manifest\.json|repositories|blobs/sha(256|384|512)/[a-f0-9]+|[a-f0-9]{64}(\.tar|\.json|/layer\.tar|/VERSION|/json))$`)
+
+// imageArchive is a docker-archive, oci-archive or OCI image layout tarball stored in a file. Its files are indexed,
+// so the manifests and the layers can be read in any order.
+type imageArchive struct {
+	file *os.File
+	// the offset and size of the regular files, by path
+	files map[string]imageArchiveFile
+	// the targets of the symbolic and hard links, by path
+	links map[string]string
+	// the files whose space is released as they are read, by path
+	releasable map[string]bool
+}
+
+// imageArchiveFile is the data of a file in an image archive.
+type imageArchiveFile struct {
+	offset int64
+	size   int64
+}
+
+// dockerArchiveImage is an image in the manifest of a docker-archive. The layers are the paths of the layer files,
+// starting with the bottom layer.
+type dockerArchiveImage struct {
+	Config   string   `json:"Config"`
+	RepoTags []string `json:"RepoTags"`
+	Layers   []string `json:"Layers"`
+}
+
+// isImageArchiveFile checks if the file of a tar archive is a file of an image archive.
+func isImageArchiveFile(name string) bool {
+	return imageArchiveFileRegexp.MatchString(cleanTarPath(name))
+}
+
+// extractImageArchive extracts the disk image of the image archive stored in the passed in file, and returns the path
+// of the disk image, which replaces the archive in its directory. The file is returned as is if the stream is not an
+// image archive.
+// The space of the layers is released while the disk image is extracted, so the archive and the disk image do not
+// have to fit in the scratch space together, unless the file system of the scratch space cannot punch holes.
+func (fr *FormatReaders) extractImageArchive(file string) (string, error) {
+	if !fr.ImageArchive {
+		return file, nil
+	}
+	disk := filepath.Join(filepath.Dir(file), imageArchiveDiskFile)
+	if err := extractImageArchiveDisk(file, fr.diskPath, disk); err != nil {
+		return "", err
+	}
+	// The scratch space of the archive is needed for the conversion of the disk image
+	if err := os.Remove(file); err != nil {
+		return "", errors.Wrap(err, "could not remove the image archive")
+	}
+	return disk, nil
+}
+
+// extractImageArchiveDisk finds the disk image matching the disk path in the image of an image archive, like the disk
+// image of a registry image, and writes it decompressed to the disk file. The layers are released as they are read,
+// the archive cannot be read again afterwards.
+func extractImageArchiveDisk(archive, diskPath, disk string) error {
+	if _, err := path.Match(diskPath, ""); err != nil {
+		return errors.Wrapf(err, "invalid disk path %q", diskPath)
+	}
+	a, err := openImageArchive(archive)
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+	layers, err := a.layersTopDown()
+	if err != nil {
+		return err
+	}
+	containerDisk, err := findContainerDisk(a.openLayer, layers, diskPath)
+	if err != nil {
+		return errors.Wrap(err, "Failed to read image archive")
+	}
+	// The layers are not read again once the disk image has been found
+	a.releasable = a.releasableLayers(layers)
+	diskReader, _, err := containerDisk.open(a.openLayer)
+	if err != nil {
+		return errors.Wrap(err, "Failed to read image archive")
+	}
+	defer diskReader.Close()
+	// The size is not passed in, the progress of the import was reported while the archive was transferred
+	readers, err := NewFormatReaders(diskReader, uint64(0), "", cdiv1.DataVolumeKubeVirt, "")
+	if err != nil {
+		return err
+	}
+	if err := util.StreamDataToFile(readers.TopReader(), disk); err != nil {
+		return err
+	}
+	return diskReader.verify()
+}
+
+// openImageArchive opens the image archive stored in the passed in file, and indexes its files.
+func openImageArchive(name string) (*imageArchive, error) {
+	// The file is opened for writing too, to release the space of the layers
+	file, err := os.OpenFile(name, os.O_RDWR, 0)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not open image archive")
+	}
+	a := &imageArchive{
+		file:  file,
+		files: map[string]imageArchiveFile{},
+		links: map[string]string{},
+	}
+	tr := tar.NewReader(file)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return a, nil
+		}
+		if err != nil {
+			file.Close()
+			return nil, errors.Wrap(err, "could not read image archive")
+		}
+		name := cleanTarPath(hdr.Name)
+		switch hdr.Typeflag {
+		case tar.TypeReg, tar.TypeRegA:
+			// The tar reader reads the file directly, it is positioned at the data of the entry
+			offset, err := file.Seek(0, io.SeekCurrent)
+			if err != nil {
+				file.Close()
+				return nil, errors.Wrap(err, "could not read image archive")
+			}
+			a.files[name] = imageArchiveFile{offset: offset, size: hdr.Size}
+		case tar.TypeSymlink:
+			a.links[name] = cleanTarPath(path.Join(path.Dir(name), hdr.Linkname))
+		case tar.TypeLink:
+			a.links[name] = cleanTarPath(hdr.Linkname)
+		}
+	}
+}
+
+// layersTopDown returns the layers of the image of the archive, starting with the top layer. The layers of an OCI
+// image are referenced by digest, and the layers of a docker-archive by path.
+func (a *imageArchive) layersTopDown() ([]string, error) {
+	if _, ok := a.files[ociLayoutIndex]; ok {
+		return a.ociLayersTopDown()
+	}
+	if _, ok := a.files[dockerArchiveManifest]; ok {
+		return a.dockerLayersTopDown()
+	}
+	return nil, errors.Errorf("no %s or %s found in the image archive", ociLayoutIndex, dockerArchiveManifest)
+}
+
+// ociLayersTopDown returns the layers of the image of an OCI image layout. If the index has more than one image, the
+// image for the platform of the node is used.
+func (a *imageArchive) ociLayersTopDown() ([]string, error) {
+	platform, err := parseImagePlatform("")
+	if err != nil {
+		return nil, err
+	}
+	manifest := &registryManifest{}
+	if err := a.readJSON(ociLayoutIndex, manifest); err != nil {
+		return nil, err
+	}
+	if len(manifest.Manifests) == 0 {
+		return nil, errors.Errorf("no image in the %s of the image archive", ociLayoutIndex)
+	}
+	for depth := 0; manifest.isList(); depth++ {
+		if depth == maxManifestListDepth {
+			return nil, errors.New("indexes of the image archive are nested too deeply")
+		}
+		desc := manifest.selectPlatform(platform)
+		if desc == nil && len(manifest.Manifests) == 1 {
+			// The platform of an image is optional in an index, a single image is used whatever its platform
+			desc = &manifest.Manifests[0]
+		}
+		if desc == nil {
+			return nil, errors.Errorf("no image for %s in the image archive, available: %s", platform, strings.Join(manifest.platforms(), ", "))
+		}
+		klog.V(1).Infof("Using the image %s of the image archive\n", desc.Digest)
+		manifest = &registryManifest{}
+		if err := a.readJSON(desc.Digest, manifest); err != nil {
+			return nil, err
+		}
+	}
+	return manifest.layersTopDown(), nil
+}
+
+// dockerLayersTopDown returns the layers of the image of a docker-archive, which has to contain a single image.
+func (a *imageArchive) dockerLayersTopDown() ([]string, error) {
+	var images []dockerArchiveImage
+	if err := a.readJSON(dockerArchiveManifest, &images); err != nil {
+		return nil, err
+	}
+	if len(images) != 1 {
+		return nil, errors.Errorf("image archive contains %d images, expected a single image", len(images))
+	}
+	klog.V(1).Infof("Using the image %s of the image archive\n", strings.Join(images[0].RepoTags, ", "))
+	var layers []string
+	for i := len(images[0].Layers) - 1; i >= 0; i-- {
+		layers = append(layers, images[0].Layers[i])
+	}
+	return layers, nil
+}
+
+// readJSON parses the json file, or blob, with the passed in path or digest.
+func (a *imageArchive) readJSON(name string, v interface{}) error {
+	r, err := a.openLayer(name)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	data, err := ioutil.ReadAll(io.LimitReader(r, maxManifestSize))
+	if err != nil {
+		return errors.Wrapf(err, "could not read %s of the image archive", name)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return errors.Wrapf(err, "could not parse %s of the image archive", name)
+	}
+	return nil
+}
+
+// releasableLayers returns the files of the passed in layers that are only used once by the image, so their space can
+// be released as they are read. docker save links the layers that are shared, and an OCI image may use the same blob
+// for two layers.
+func (a *imageArchive) releasableLayers(layers []string) map[string]bool {
+	uses := map[string]int{}
+	for _, layer := range layers {
+		if name, _, err := layerFile(layer); err == nil {
+			uses[a.resolve(name)]++
+		}
+	}
+	releasable := map[string]bool{}
+	for name, n := range uses {
+		releasable[name] = n == 1
+	}
+	return releasable
+}
+
+// layerFile returns the path of the file with the passed in path, or of the blob with the passed in digest, along with
+// the digest of the blob. A path cannot contain a colon, a digest is <algorithm>:<hex digest>.
+func layerFile(name string) (string, *util.Checksum, error) {
+	if !strings.Contains(name, ":") {
+		return name, nil, nil
+	}
+	checksum, err := util.ParseChecksum(name)
+	if err != nil || checksum == nil {
+		return "", nil, errors.Errorf("invalid blob digest %q", name)
+	}
+	return path.Join("blobs", checksum.Algorithm, checksum.Digest), checksum, nil
+}
+
+// openLayer opens the file with the passed in path, or the blob with the passed in digest.
+func (a *imageArchive) openLayer(name string) (io.ReadCloser, error) {
+	file, checksum, err := layerFile(name)
+	if err != nil {
+		return nil, err
+	}
+	body, err := a.open(file)
+	if err != nil || checksum == nil {
+		return body, err
+	}
+	return &blobReader{
+		body:   body,
+		digest: checksum,
+		hash:   checksum.NewHash(),
+	}, nil
+}
+
+// resolve returns the path of the file the passed in path links to, or the path itself if it is not a link.
+func (a *imageArchive) resolve(name string) string {
+	name = cleanTarPath(name)
+	// docker save links the layers that are shared by several images, a loop of links is not followed forever
+	for i := 0; i <= len(a.links); i++ {
+		target, ok := a.links[name]
+		if !ok {
+			break
+		}
+		name = target
+	}
+	return name
+}
+
+// open returns a reader of the file with the passed in path, following links.
+func (a *imageArchive) open(name string) (io.ReadCloser, error) {
+	name = a.resolve(name)
+	f, ok := a.files[name]
+	if !ok {
+		return nil, errors.Errorf("%s not found in the image archive", name)
+	}
+	data := io.NewSectionReader(a.file, f.offset, f.size)
+	if a.releasable[name] {
+		return &releasingReader{file: a.file, reader: data, offset: f.offset, released: f.offset}, nil
+	}
+	return ioutil.NopCloser(data), nil
+}
+
+// Close closes the file of the archive.
+func (a *imageArchive) Close() error {
+	return a.file.Close()
+}
+
+// releasingReader reads a file of an image archive, and punches a hole in the archive for the data it has read, so the
+// space of a layer is released while the disk image is extracted from it. The data is kept if the file system cannot
+// punch holes.
+type releasingReader struct {
+	file   *os.File
+	reader io.Reader
+	// the offsets in the archive of the data that was read, and of the data that was released
+	offset   int64
+	released int64
+	failed   bool
+}
+
+func (r *releasingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.offset += int64(n)
+	if r.offset-r.released >= imageArchiveReleaseSize {
+		r.release()
+	}
+	return n, err
+}
+
+// Close releases the rest of the data that was read.
+func (r *releasingReader) Close() error {
+	r.release()
+	return nil
+}
+
+func (r *releasingReader) release() {
+	if r.failed || r.offset == r.released {
+		return
+	}
+	if err := unix.Fallocate(int(r.file.Fd()), unix.FALLOC_FL_PUNCH_HOLE|unix.FALLOC_FL_KEEP_SIZE, r.released, r.offset-r.released); err != nil {
+		klog.V(3).Infof("Punching a hole in %s failed, the image archive is kept until the disk image is extracted: %v\n", r.file.Name(), err)
+		r.failed = true
+		return
+	}
+	r.released = r.offset
+}
@@ -0,0 +1,267 @@
+package importer
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+
+	cdiv1 "kubevirt.io/containerized-data-importer/pkg/apis/core/v1alpha1"
+)
+
+var _ = Describe("Image archive", func() {
+	var (
+		tmpDir  string
+		rawDisk = make([]byte, 65536)
+		base    []byte
+	)
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "scratch")
+		Expect(err).NotTo(HaveOccurred())
+		base = createTestLayer(true, testLayerFile{name: "bin/sh", data: []byte("shell")})
+		rand.Read(rawDisk)
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(tmpDir)
+	})
+
+	extract := func(archive []byte, diskPath string) ([]byte, error) {
+		file := filepath.Join(tmpDir, tempFile)
+		Expect(ioutil.WriteFile(file, archive, 0600)).To(Succeed())
+		disk := filepath.Join(tmpDir, imageArchiveDiskFile)
+		if err := extractImageArchiveDisk(file, diskPath, disk); err != nil {
+			return nil, err
+		}
+		return ioutil.ReadFile(disk)
+	}
+
+	It("Should detect the files of image archives", func() {
+		Expect(isImageArchiveFile("oci-layout")).To(BeTrue())
+		Expect(isImageArchiveFile("./blobs/sha256/" + strings.Repeat("a", 64))).To(BeTrue())
+		Expect(isImageArchiveFile(strings.Repeat("0", 64) + "/VERSION")).To(BeTrue())
+		Expect(isImageArchiveFile(strings.Repeat("0", 64) + ".json")).To(BeTrue())
+		Expect(isImageArchiveFile("disk.img")).To(BeFalse())
+		Expect(isImageArchiveFile("disk/manifest.json")).To(BeFalse())
+	})
+
+	It("Should extract the disk image of an oci-archive", func() {
+		archive := createTestOCIArchive(nil, createTestImage(base, createTestLayer(true, testLayerFile{name: "disk/disk.img", data: rawDisk})))
+		data, err := extract(archive, "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(data).To(Equal(rawDisk))
+	})
+
+	It("Should extract the disk image of the image for the platform of the node", func() {
+		other := createTestImage(createTestLayer(true, testLayerFile{name: "disk/disk.img", data: []byte("other")}))
+		node := createTestImage(createTestLayer(true, testLayerFile{name: "disk/disk.img", data: rawDisk}))
+		archive := createTestOCIArchive([]map[string]interface{}{
+			{"digest": testDigest(other.manifest), "platform": map[string]string{"os": "plan9", "architecture": "mips"}},
+			{"digest": testDigest(node.manifest), "platform": map[string]string{"os": runtime.GOOS, "architecture": runtime.GOARCH}},
+		}, other, node)
+		data, err := extract(archive, "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(data).To(Equal(rawDisk))
+	})
+
+	It("Should extract the disk image matching the disk path", func() {
+		archive := createTestOCIArchive(nil, createTestImage(createTestLayer(false,
+			testLayerFile{name: "disk/other.img", data: []byte("other")},
+			testLayerFile{name: "images/disk.img", data: rawDisk})))
+		data, err := extract(archive, "images/*.img")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(data).To(Equal(rawDisk))
+	})
+
+	It("Should return an error if a file of another layer matches the disk path", func() {
+		lower := createTestLayer(true, testLayerFile{name: "disk/disk.img", data: rawDisk})
+		upper := createTestLayer(true, testLayerFile{name: "disk/README.md", data: []byte("readme")})
+		_, err := extract(createTestOCIArchive(nil, createTestImage(lower, upper)), "")
+		Expect(err).To(HaveOccurred())
+		Expect(errors.Cause(err)).To(Equal(ErrAmbiguousDiskImage))
+		_, err = os.Stat(filepath.Join(tmpDir, imageArchiveDiskFile))
+		Expect(os.IsNotExist(err)).To(BeTrue())
+	})
+
+	It("Should return an error if a blob does not match its digest", func() {
+		archive := createTestOCIArchive(nil, createTestImage(createTestLayer(false, testLayerFile{name: "disk/disk.img", data: rawDisk})))
+		// Change the last byte of the disk image
+		i := bytes.Index(archive, rawDisk) + len(rawDisk) - 1
+		archive[i]++
+		_, err := extract(archive, "")
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("does not match its data"))
+	})
+
+	It("Should extract and decompress the disk image of a docker-archive with linked layers", func() {
+		var compressed bytes.Buffer
+		gz := gzip.NewWriter(&compressed)
+		gz.Write(rawDisk)
+		gz.Close()
+		layer := createTestLayer(false, testLayerFile{name: "disk/disk.img.gz", data: compressed.Bytes()})
+		baseID, diskID := strings.Repeat("1", 64), strings.Repeat("2", 64)
+		archive := createTestTar(
+			testArchiveFile{name: baseID + "/layer.tar", data: createTestLayer(false, testLayerFile{name: "bin/sh", data: []byte("shell")})},
+			testArchiveFile{name: "shared/layer.tar", data: layer},
+			testArchiveFile{name: diskID + "/layer.tar", link: "../shared/layer.tar"},
+			testArchiveFile{name: "manifest.json", data: testJSON([]map[string]interface{}{
+				{"Config": "config.json", "RepoTags": []string{"disk:latest"}, "Layers": []string{baseID + "/layer.tar", diskID + "/layer.tar"}},
+			})},
+		)
+		data, err := extract(archive, "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(data).To(Equal(rawDisk))
+	})
+
+	It("Should return an error if a docker-archive contains more than one image", func() {
+		archive := createTestTar(testArchiveFile{name: "manifest.json", data: testJSON([]map[string]interface{}{
+			{"Config": "a.json", "Layers": []string{}},
+			{"Config": "b.json", "Layers": []string{}},
+		})})
+		_, err := extract(archive, "")
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("contains 2 images"))
+	})
+
+	It("Should return an error if the archive has no index or manifest", func() {
+		_, err := extract(createTestTar(testArchiveFile{name: "oci-layout", data: []byte("{}")}), "")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Should release the space of the layers while the disk image is extracted", func() {
+		// Random data is not compressed, so the layer takes as much space as the disk image
+		largeDisk := make([]byte, 2*imageArchiveReleaseSize)
+		rand.Read(largeDisk)
+		archive := createTestOCIArchive(nil, createTestImage(base, createTestLayer(true, testLayerFile{name: "disk/disk.img", data: largeDisk})))
+		file := filepath.Join(tmpDir, tempFile)
+		Expect(ioutil.WriteFile(file, archive, 0600)).To(Succeed())
+		probe, err := os.OpenFile(filepath.Join(tmpDir, "probe"), os.O_CREATE|os.O_RDWR, 0600)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = probe.Write(make([]byte, 1<<20))
+		Expect(err).NotTo(HaveOccurred())
+		err = unix.Fallocate(int(probe.Fd()), unix.FALLOC_FL_PUNCH_HOLE|unix.FALLOC_FL_KEEP_SIZE, 0, 1<<20)
+		probe.Close()
+		if err != nil {
+			Skip("the file system of the temporary directory cannot punch holes")
+		}
+		disk := filepath.Join(tmpDir, imageArchiveDiskFile)
+		Expect(extractImageArchiveDisk(file, "", disk)).To(Succeed())
+		data, err := ioutil.ReadFile(disk)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(data).To(Equal(largeDisk))
+		info, err := os.Stat(file)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Size()).To(BeNumerically(">", len(largeDisk)))
+		// The archive keeps the manifests and the base layer, which was read, but is a lot smaller than the disk
+		Expect(info.Sys().(*syscall.Stat_t).Blocks * 512).To(BeNumerically("<", len(largeDisk)/2))
+	})
+
+	It("Should replace the archive with the extracted disk image", func() {
+		archive := createTestOCIArchive(nil, createTestImage(createTestLayer(true, testLayerFile{name: "disk/disk.img", data: rawDisk})))
+		fr, err := NewFormatReaders(ioutil.NopCloser(bytes.NewReader(archive)), uint64(0), "", cdiv1.DataVolumeKubeVirt, "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fr.ImageArchive).To(BeTrue())
+		file := filepath.Join(tmpDir, tempFile)
+		Expect(ioutil.WriteFile(file, archive, 0600)).To(Succeed())
+		disk, err := fr.extractImageArchive(file)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(disk).To(Equal(filepath.Join(tmpDir, imageArchiveDiskFile)))
+		_, err = os.Stat(file)
+		Expect(os.IsNotExist(err)).To(BeTrue())
+	})
+})
+
+type testArchiveFile struct {
+	name string
+	data []byte
+	// the target of a symbolic link
+	link string
+}
+
+// testImage is the manifest of an image and its layers, from the bottom layer up.
+type testImage struct {
+	manifest []byte
+	layers   [][]byte
+}
+
+func testJSON(v interface{}) []byte {
+	data, err := json.Marshal(v)
+	Expect(err).NotTo(HaveOccurred())
+	return data
+}
+
+// createTestImage returns an OCI image with the passed in layers, from the bottom layer up.
+func createTestImage(layers ...[]byte) testImage {
+	var descriptors []map[string]interface{}
+	for _, layer := range layers {
+		descriptors = append(descriptors, map[string]interface{}{
+			"mediaType": "application/vnd.oci.image.layer.v1.tar+gzip",
+			"size":      len(layer),
+			"digest":    testDigest(layer),
+		})
+	}
+	return testImage{
+		manifest: testJSON(map[string]interface{}{
+			"schemaVersion": 2,
+			"mediaType":     "application/vnd.oci.image.manifest.v1+json",
+			"layers":        descriptors,
+		}),
+		layers: layers,
+	}
+}
+
+// createTestOCIArchive returns an oci-archive of the passed in images with the passed in index, which references the
+// first image if it is nil.
+func createTestOCIArchive(index []map[string]interface{}, images ...testImage) []byte {
+	if index == nil {
+		index = []map[string]interface{}{{"digest": testDigest(images[0].manifest)}}
+	}
+	// The blobs are written first, like skopeo does
+	var files []testArchiveFile
+	for _, image := range images {
+		for _, layer := range append([][]byte{image.manifest}, image.layers...) {
+			files = append(files, testArchiveFile{name: "blobs/sha256/" + strings.TrimPrefix(testDigest(layer), "sha256:"), data: layer})
+		}
+	}
+	files = append(files,
+		testArchiveFile{name: "oci-layout", data: []byte(`{"imageLayoutVersion": "1.0.0"}`)},
+		testArchiveFile{name: "index.json", data: testJSON(map[string]interface{}{"schemaVersion": 2, "manifests": index})})
+	return createTestTar(files...)
+}
+
+// createTestTar returns a tar archive with the passed in files and links, the directories of the files are added.
+func createTestTar(files ...testArchiveFile) []byte {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	dirs := map[string]bool{}
+	for _, file := range files {
+		if dir := filepath.Dir(file.name); dir != "." && !dirs[dir] {
+			dirs[dir] = true
+			Expect(tw.WriteHeader(&tar.Header{Name: dir + "/", Mode: 0755, Typeflag: tar.TypeDir})).To(Succeed())
+		}
+		hdr := &tar.Header{Name: file.name, Mode: 0644, Size: int64(len(file.data)), Typeflag: tar.TypeReg}
+		if file.link != "" {
+			hdr.Typeflag = tar.TypeSymlink
+			hdr.Linkname = file.link
+		}
+		Expect(tw.WriteHeader(hdr)).To(Succeed())
+		_, err := tw.Write(file.data)
+		Expect(err).NotTo(HaveOccurred())
+	}
+	Expect(tw.Close()).To(Succeed())
+	return buf.Bytes()
+}
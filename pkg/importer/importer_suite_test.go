@@ -5,6 +5,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -30,6 +31,11 @@ func TestImporter(t *testing.T) {
 	RunSpecsWithDefaultAndCustomReporters(t, "Importer Suite", reporters.NewReporters())
 }
 
+var _ = BeforeSuite(func() {
+	// The tests of failing requests do not wait for the backoff of the retries
+	SetRetryOptions(RetryOptions{Retries: 2, Backoff: time.Millisecond, MaxBackoff: time.Millisecond})
+})
+
 var _ = AfterSuite(func() {
 	for _, filename := range testfiles {
 		os.Remove(filepath.Join(os.TempDir(), filename))
@@ -0,0 +1,111 @@
+package importer
+
+import (
+	"bufio"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"k8s.io/klog"
+)
+
+const (
+	// nbdPSKFile is the name of the PSK file in the directory of the TLS credentials of an NBD source
+	nbdPSKFile = "keys.psk"
+	// nbdCACertFile is the name of the CA certificates in the directory of the TLS credentials of an NBD source
+	nbdCACertFile = "ca-cert.pem"
+)
+
+// NBDDataSource is the struct containing the information needed to import the export of a network block device server.
+// qemu-img reads the export directly, so no data is transferred before the conversion.
+// Sequence of phases:
+// 1. Info -> Convert
+type NBDDataSource struct {
+	// The url of the export, including the TLS credentials
+	url *url.URL
+}
+
+// NewNBDDataSource creates a new instance of the NBDDataSource. The endpoint is a url like nbd://<host>:<port>/<export>.
+// If the directory of the TLS credentials contains a PSK file or CA certificates, the export is read with TLS.
+func NewNBDDataSource(endpoint, tlsDir string) (*NBDDataSource, error) {
+	ep, err := ParseEndpoint(endpoint)
+	if err != nil {
+		return nil, errors.Wrapf(err, fmt.Sprintf("unable to parse endpoint %q", endpoint))
+	}
+	if ep.Scheme != "nbd" || ep.Hostname() == "" {
+		return nil, errors.Errorf("invalid nbd url %q, expected nbd://<host>:<port>/<export>", endpoint)
+	}
+	tlsQuery, err := nbdTLSQuery(tlsDir)
+	if err != nil {
+		return nil, err
+	}
+	if tlsQuery != nil {
+		ep.Scheme = "nbds"
+		ep.RawQuery = tlsQuery.Encode()
+	}
+	return &NBDDataSource{
+		url: ep,
+	}, nil
+}
+
+// nbdTLSQuery returns the query parameters selecting the TLS credentials in the passed in directory, or nil if there
+// are none. The username of a PSK is the one of the first key in the PSK file.
+func nbdTLSQuery(tlsDir string) (url.Values, error) {
+	if tlsDir == "" {
+		return nil, nil
+	}
+	file, err := os.Open(filepath.Join(tlsDir, nbdPSKFile))
+	if err == nil {
+		defer file.Close()
+		scanner := bufio.NewScanner(file)
+		if !scanner.Scan() || !strings.Contains(scanner.Text(), ":") {
+			return nil, errors.Errorf("invalid %s, expected lines of <username>:<hex key>", nbdPSKFile)
+		}
+		username := strings.SplitN(scanner.Text(), ":", 2)[0]
+		klog.V(2).Infof("Reading the nbd export with the PSK of %s\n", username)
+		return url.Values{"tls-creds-dir": {tlsDir}, "tls-username": {username}}, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, errors.Wrapf(err, "could not read %s", nbdPSKFile)
+	}
+	if _, err := os.Stat(filepath.Join(tlsDir, nbdCACertFile)); err == nil {
+		klog.V(2).Infoln("Reading the nbd export with x509 certificates")
+		return url.Values{"tls-creds-dir": {tlsDir}}, nil
+	}
+	klog.V(2).Infoln("No TLS credentials, reading the nbd export without TLS")
+	return nil, nil
+}
+
+// Info is called to get initial information about the data. The export is converted directly from the server.
+func (nd *NBDDataSource) Info() (ProcessingPhase, error) {
+	return ProcessingPhaseConvert, nil
+}
+
+// Transfer is not supported, the export is converted directly from the server.
+func (nd *NBDDataSource) Transfer(path string) (ProcessingPhase, error) {
+	return ProcessingPhaseError, errors.New("transfer not supported for nbd data sources")
+}
+
+// TransferFile is not supported, the export is converted directly from the server.
+func (nd *NBDDataSource) TransferFile(fileName string) (ProcessingPhase, error) {
+	return ProcessingPhaseError, errors.New("transfer file not supported for nbd data sources")
+}
+
+// Process is called to do any special processing before giving the url to the data back to the processor
+func (nd *NBDDataSource) Process() (ProcessingPhase, error) {
+	return ProcessingPhaseConvert, nil
+}
+
+// GetURL returns the url that the data processor can use when converting the data.
+func (nd *NBDDataSource) GetURL() *url.URL {
+	return nd.url
+}
+
+// Close closes any readers or other open resources.
+func (nd *NBDDataSource) Close() error {
+	return nil
+}
@@ -0,0 +1,92 @@
+package importer
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"kubevirt.io/containerized-data-importer/pkg/image"
+)
+
+// convertRecordingQEMUOperations records the url of the image converted to raw.
+type convertRecordingQEMUOperations struct {
+	image.QEMUOperations
+	convertedURL *url.URL
+}
+
+func (o *convertRecordingQEMUOperations) ConvertToRawStream(url *url.URL, dest string) error {
+	o.convertedURL = url
+	return o.QEMUOperations.ConvertToRawStream(url, dest)
+}
+
+var _ = Describe("NBD data source", func() {
+	var tmpDir string
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "nbd")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(tmpDir)
+	})
+
+	It("Should convert the export directly from the server", func() {
+		nd, err := NewNBDDataSource("nbd://nbd-server:10809/disk", filepath.Join(tmpDir, "missing"))
+		Expect(err).NotTo(HaveOccurred())
+		qemuOperations := &convertRecordingQEMUOperations{
+			QEMUOperations: NewFakeQEMUOperations(nil, nil, fakeInfoRet, nil, nil, nil),
+		}
+		replaceQEMUOperations(qemuOperations, func() {
+			dp := NewDataProcessor(nd, filepath.Join(tmpDir, "disk.img"), tmpDir, "scratchDataDir", "")
+			Expect(dp.ProcessData()).To(Succeed())
+		})
+		Expect(qemuOperations.convertedURL.String()).To(Equal("nbd://nbd-server:10809/disk"))
+	})
+
+	It("Should read the export with the PSK in the TLS credentials", func() {
+		Expect(ioutil.WriteFile(filepath.Join(tmpDir, nbdPSKFile), []byte("importer:0123456789abcdef\nother:fedcba9876543210\n"), 0600)).To(Succeed())
+		nd, err := NewNBDDataSource("nbd://nbd-server/disk", tmpDir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(nd.GetURL().Scheme).To(Equal("nbds"))
+		Expect(nd.GetURL().Query().Get("tls-creds-dir")).To(Equal(tmpDir))
+		Expect(nd.GetURL().Query().Get("tls-username")).To(Equal("importer"))
+	})
+
+	It("Should read the export with the x509 certificates in the TLS credentials", func() {
+		Expect(ioutil.WriteFile(filepath.Join(tmpDir, nbdCACertFile), []byte("certificate"), 0600)).To(Succeed())
+		nd, err := NewNBDDataSource("nbd://nbd-server/disk", tmpDir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(nd.GetURL().Scheme).To(Equal("nbds"))
+		Expect(nd.GetURL().Query().Get("tls-creds-dir")).To(Equal(tmpDir))
+		Expect(nd.GetURL().Query().Get("tls-username")).To(BeEmpty())
+	})
+
+	It("Should fail on an invalid PSK file", func() {
+		Expect(ioutil.WriteFile(filepath.Join(tmpDir, nbdPSKFile), []byte("0123456789abcdef\n"), 0600)).To(Succeed())
+		_, err := NewNBDDataSource("nbd://nbd-server/disk", tmpDir)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Should fail on a url that is not an nbd url", func() {
+		_, err := NewNBDDataSource("http://nbd-server/disk", "")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Should not transfer the export", func() {
+		nd, err := NewNBDDataSource("nbd://nbd-server/disk", "")
+		Expect(err).NotTo(HaveOccurred())
+		phase, err := nd.Info()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(phase).To(Equal(ProcessingPhaseConvert))
+		_, err = nd.Transfer(tmpDir)
+		Expect(err).To(HaveOccurred())
+		_, err = nd.TransferFile(filepath.Join(tmpDir, "disk.img"))
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,586 @@
+/*
+Copyright 2020 The CDI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package importer
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"runtime"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"k8s.io/klog"
+
+	"kubevirt.io/containerized-data-importer/pkg/util"
+)
+
+const (
+	// registryURLPrefix is the prefix of the url of a container image
+	registryURLPrefix = "docker://"
+	// dockerHubRegistry is the registry of the images that are not prefixed with a registry host
+	dockerHubRegistry = "registry-1.docker.io"
+	// defaultImageTag is the tag of an image that is referenced without a tag or digest
+	defaultImageTag = "latest"
+	// maxManifestSize is the size of the largest manifest that is accepted
+	maxManifestSize = 4 << 20
+	// signedSchema1ManifestType is the media type of a signed schema 1 manifest
+	signedSchema1ManifestType = "application/vnd.docker.distribution.manifest.v1+prettyjws"
+	// manifestListMediaType is the media type of a docker manifest list
+	manifestListMediaType = "application/vnd.docker.distribution.manifest.list.v2+json"
+	// ociIndexMediaType is the media type of an OCI image index
+	ociIndexMediaType = "application/vnd.oci.image.index.v1+json"
+	// maxManifestListDepth is the number of nested manifest lists that are followed to the image of a platform
+	maxManifestListDepth = 4
+)
+
+// registryManifestMediaTypes are the media types of the manifests that are accepted from the registry
+var registryManifestMediaTypes = []string{
+	"application/vnd.docker.distribution.manifest.v2+json",
+	manifestListMediaType,
+	"application/vnd.oci.image.manifest.v1+json",
+	ociIndexMediaType,
+	signedSchema1ManifestType,
+	"application/vnd.docker.distribution.manifest.v1+json",
+}
+
+// imageReference is a container image in a registry.
+type imageReference struct {
+	// the host and port of the registry
+	registry string
+	// the name of the repository, like library/fedora
+	repository string
+	// the tag or digest of the image
+	reference string
+}
+
+// registryManifest is an image manifest, or a manifest list or OCI index that references the manifests of an image
+// for each platform.
+type registryManifest struct {
+	SchemaVersion int                  `json:"schemaVersion"`
+	MediaType     string               `json:"mediaType"`
+	Layers        []registryDescriptor `json:"layers"`    // schemaVersion 2
+	FsLayers      []registryDescriptor `json:"fsLayers"`  // schemaVersion 1
+	Manifests     []registryDescriptor `json:"manifests"` // manifest list or OCI index
+	// the digest of the manifest
+	digest string
+}
+
+// registryDescriptor describes a layer, or the manifest of a platform in a manifest list.
+type registryDescriptor struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`  // schemaVersion 2
+	Size      int64  `json:"size"`    // schemaVersion 2
+	BlobSum   string `json:"blobSum"` // schemaVersion 1
+	Platform  struct {
+		Architecture string `json:"architecture"`
+		OS           string `json:"os"`
+		Variant      string `json:"variant"`
+	} `json:"platform"`
+}
+
+// imagePlatform is the platform the image of a manifest list is selected for.
+type imagePlatform struct {
+	os           string
+	architecture string
+	// the variant of the cpu, any variant matches if it is empty
+	variant string
+}
+
+// registryClient reads the manifests and blobs of an image with the docker registry HTTP API V2.
+type registryClient struct {
+	client *http.Client
+	ref    *imageReference
+	// the url of the API of the registry, like https://registry:5000/v2/
+	baseURL   string
+	accessKey string
+	secKey    string
+	// the challenge of the registry, if it requires authorization
+	challenge *authChallenge
+	// the value of the Authorization header of the requests to the registry
+	authorization string
+}
+
+// authChallenge is the authentication scheme and parameters of a WWW-Authenticate header.
+type authChallenge struct {
+	scheme string
+	params map[string]string
+}
+
+// blobReader reads a blob of the registry, and verifies its digest once it has been read.
+type blobReader struct {
+	body     io.ReadCloser
+	digest   *util.Checksum
+	hash     hash.Hash
+	verified bool
+	err      error
+}
+
+// parseImageReference parses the url of an image, like docker://<registry>/<repository>:<tag> or
+// docker://<registry>/<repository>@<digest>. Images without a registry are in docker hub.
+func parseImageReference(endpoint string) (*imageReference, error) {
+	if !strings.HasPrefix(endpoint, registryURLPrefix) {
+		return nil, errors.Errorf("invalid image url %q, expected %s<registry>/<repository>:<tag>", endpoint, registryURLPrefix)
+	}
+	name := strings.TrimPrefix(endpoint, registryURLPrefix)
+	ref := &imageReference{reference: defaultImageTag}
+	if i := strings.Index(name, "@"); i >= 0 {
+		if _, err := util.ParseChecksum(name[i+1:]); err != nil {
+			return nil, errors.Wrapf(err, "invalid digest of image url %q", endpoint)
+		}
+		ref.reference = name[i+1:]
+		name = name[:i]
+	}
+	// The tag is ignored if the image is referenced by digest
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		if ref.reference == defaultImageTag {
+			ref.reference = name[i+1:]
+		}
+		name = name[:i]
+	}
+	parts := strings.SplitN(name, "/", 2)
+	if len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		ref.registry, name = parts[0], parts[1]
+	} else {
+		ref.registry = dockerHubRegistry
+	}
+	if ref.registry == "docker.io" || ref.registry == "index.docker.io" {
+		ref.registry = dockerHubRegistry
+	}
+	if name == "" || ref.reference == "" {
+		return nil, errors.Errorf("invalid image url %q, expected %s<registry>/<repository>:<tag>", endpoint, registryURLPrefix)
+	}
+	if ref.registry == dockerHubRegistry && !strings.Contains(name, "/") {
+		name = "library/" + name
+	}
+	ref.repository = name
+	return ref, nil
+}
+
+// String returns the image in the form <registry>/<repository>:<tag> or <registry>/<repository>@<digest>.
+func (r *imageReference) String() string {
+	if strings.Contains(r.reference, ":") {
+		return r.registry + "/" + r.repository + "@" + r.reference
+	}
+	return r.registry + "/" + r.repository + ":" + r.reference
+}
+
+// newRegistryClient creates a client of the registry of the image, and authenticates with the registry. The
+// certificates in certDir are trusted in addition to the system certificates, and the client certificate in
+// clientCertDir is presented to the registry. If insecureTLS is true, the certificate of the registry is not verified,
+// and the registry is accessed with http if it does not support https.
+func newRegistryClient(ref *imageReference, accessKey, secKey, certDir, clientCertDir string, insecureTLS bool) (*registryClient, error) {
+	client, err := createHTTPClient(certDir, clientCertDir)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error creating http client")
+	}
+	if insecureTLS {
+		klog.Infof("Disabling TLS verification for registry %s", ref.registry)
+		tlsConfig := &tls.Config{
+			InsecureSkipVerify: true,
+		}
+		if err := loadClientCert(tlsConfig, clientCertDir); err != nil {
+			return nil, err
+		}
+		client.Transport = &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: tlsConfig,
+		}
+	}
+	c := &registryClient{
+		client:    client,
+		ref:       ref,
+		accessKey: accessKey,
+		secKey:    secKey,
+	}
+	resp, err := c.ping("https")
+	if err != nil && insecureTLS {
+		klog.Warningf("Unable to reach registry %s with https, trying http: %v\n", ref.registry, err)
+		resp, err = c.ping("http")
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return c, nil
+	case http.StatusUnauthorized:
+		c.challenge = parseAuthChallenge(resp.Header.Get("WWW-Authenticate"))
+		if err := c.authorize(); err != nil {
+			return nil, err
+		}
+		return c, nil
+	}
+	return nil, newHTTPStatusError(resp.StatusCode, "registry %s does not support the registry API, status: %s", ref.registry, resp.Status)
+}
+
+// ping requests the base url of the API of the registry with the passed in scheme, the response tells if the
+// registry requires authorization.
+func (c *registryClient) ping(scheme string) (*http.Response, error) {
+	c.baseURL = scheme + "://" + c.ref.registry + "/v2/"
+	resp, err := c.client.Get(c.baseURL)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not reach registry %s", c.ref.registry)
+	}
+	resp.Body.Close()
+	return resp, nil
+}
+
+// parseAuthChallenge parses a WWW-Authenticate header, like Bearer realm="https://auth.io/token",service="registry".
+func parseAuthChallenge(header string) *authChallenge {
+	challenge := &authChallenge{params: map[string]string{}}
+	parts := strings.SplitN(strings.TrimSpace(header), " ", 2)
+	challenge.scheme = strings.ToLower(parts[0])
+	if len(parts) < 2 {
+		return challenge
+	}
+	params := parts[1]
+	for params != "" {
+		i := strings.Index(params, "=")
+		if i < 0 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(params[:i]))
+		params = strings.TrimSpace(params[i+1:])
+		value := ""
+		if strings.HasPrefix(params, `"`) {
+			// A quoted value, which may contain commas and escaped characters
+			j := 1
+			for ; j < len(params) && params[j] != '"'; j++ {
+				if params[j] == '\\' && j+1 < len(params) {
+					j++
+				}
+				value += string(params[j])
+			}
+			params = params[j+1:]
+		} else {
+			j := strings.Index(params, ",")
+			if j < 0 {
+				j = len(params)
+			}
+			value = strings.TrimSpace(params[:j])
+			params = params[j:]
+		}
+		challenge.params[key] = value
+		params = strings.TrimLeft(strings.TrimSpace(params), ",")
+	}
+	return challenge
+}
+
+// authorize sets the authorization of the requests to the registry, from the challenge of the registry.
+func (c *registryClient) authorize() error {
+	switch c.challenge.scheme {
+	case "basic":
+		if c.accessKey == "" || c.secKey == "" {
+			return errors.Errorf("registry %s requires credentials", c.ref.registry)
+		}
+		req, _ := http.NewRequest("GET", c.baseURL, nil)
+		req.SetBasicAuth(c.accessKey, c.secKey)
+		c.authorization = req.Header.Get("Authorization")
+		return nil
+	case "bearer":
+		return c.requestToken()
+	}
+	return errors.Errorf("unsupported authentication scheme %q of registry %s", c.challenge.scheme, c.ref.registry)
+}
+
+// requestToken gets a token to pull the repository of the image from the token server of the registry. The
+// credentials, if any, are sent to the token server.
+func (c *registryClient) requestToken() error {
+	realm, err := url.Parse(c.challenge.params["realm"])
+	if err != nil || realm.Host == "" {
+		return errors.Errorf("invalid token realm %q of registry %s", c.challenge.params["realm"], c.ref.registry)
+	}
+	query := realm.Query()
+	if service, ok := c.challenge.params["service"]; ok {
+		query.Set("service", service)
+	}
+	query.Set("scope", "repository:"+c.ref.repository+":pull")
+	realm.RawQuery = query.Encode()
+	// http.NewRequest can only return error on invalid METHOD, or invalid url. Here the METHOD is always GET, and the url is always valid, thus error cannot happen.
+	req, _ := http.NewRequest("GET", realm.String(), nil)
+	if c.accessKey != "" && c.secKey != "" {
+		req.SetBasicAuth(c.accessKey, c.secKey)
+	}
+	klog.V(2).Infof("Requesting a token to pull %s from %s\n", c.ref.repository, realm.Host)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "could not request a registry token")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return newHTTPStatusError(resp.StatusCode, "could not get a token to pull %s, status: %s", c.ref.repository, resp.Status)
+	}
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxManifestSize)).Decode(&token); err != nil {
+		return errors.Wrap(err, "could not parse registry token")
+	}
+	if token.Token == "" {
+		token.Token = token.AccessToken
+	}
+	if token.Token == "" {
+		return errors.New("token server returned an empty token")
+	}
+	c.authorization = "Bearer " + token.Token
+	return nil
+}
+
+// get sends a request to the registry API, the request is retried if it fails with a transient error.
+func (c *registryClient) get(path string, accept []string) (*http.Response, error) {
+	var resp *http.Response
+	err := retry("registry request "+path, func() error {
+		var err error
+		resp, err = c.request(path, accept)
+		return err
+	})
+	return resp, err
+}
+
+// request sends a request to the registry API. A new token is requested once if the token expired.
+func (c *registryClient) request(path string, accept []string) (*http.Response, error) {
+	for retry := 0; ; retry++ {
+		// http.NewRequest can only return error on invalid METHOD, or invalid url. Here the METHOD is always GET, and the url is always valid, thus error cannot happen.
+		req, _ := http.NewRequest("GET", c.baseURL+c.ref.repository+"/"+path, nil)
+		if len(accept) > 0 {
+			req.Header.Set("Accept", strings.Join(accept, ", "))
+		}
+		if c.authorization != "" {
+			// The header is not sent to other hosts the request is redirected to, like the storage of the blobs
+			req.Header.Set("Authorization", c.authorization)
+		}
+		resp, err := c.client.Do(req)
+		if err != nil {
+			return nil, errors.Wrapf(err, "registry request %s failed", path)
+		}
+		if resp.StatusCode == http.StatusUnauthorized && retry == 0 && c.challenge != nil && c.challenge.scheme == "bearer" {
+			resp.Body.Close()
+			if err := c.requestToken(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, newHTTPStatusError(resp.StatusCode, "registry request %s failed, status: %s", path, resp.Status)
+		}
+		return resp, nil
+	}
+}
+
+// getManifest gets the manifest of the image with the passed in tag or digest. A manifest requested by digest is
+// verified against it.
+func (c *registryClient) getManifest(reference string) (*registryManifest, error) {
+	resp, err := c.get("manifests/"+reference, registryManifestMediaTypes)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not get manifest of %s", c.ref)
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxManifestSize))
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not read manifest of %s", c.ref)
+	}
+	manifest := &registryManifest{}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, errors.Wrapf(err, "could not parse manifest of %s", c.ref)
+	}
+	if manifest.MediaType == "" {
+		manifest.MediaType = resp.Header.Get("Content-Type")
+	}
+	if manifest.MediaType == signedSchema1ManifestType {
+		// The digest of a signed schema 1 manifest is computed without its signatures, so it is taken from the registry
+		manifest.digest = resp.Header.Get("Docker-Content-Digest")
+		return manifest, nil
+	}
+	// A tag cannot contain a colon, a digest is <algorithm>:<hex digest>
+	if strings.Contains(reference, ":") {
+		checksum, err := util.ParseChecksum(reference)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid manifest digest %q", reference)
+		}
+		hash := checksum.NewHash()
+		hash.Write(data)
+		if !checksum.Matches(hash) {
+			return nil, errors.Errorf("digest of the manifest of %s does not match its data", c.ref)
+		}
+		manifest.digest = reference
+		return manifest, nil
+	}
+	sum := sha256.Sum256(data)
+	manifest.digest = "sha256:" + hex.EncodeToString(sum[:])
+	return manifest, nil
+}
+
+// resolveManifest gets the manifest of the image, and returns it with the digest the tag of the image resolved to.
+// For a manifest list or OCI index, the manifest of the image for the passed in platform is returned, with the
+// digest of the list.
+func (c *registryClient) resolveManifest(platform *imagePlatform) (*registryManifest, string, error) {
+	manifest, err := c.getManifest(c.ref.reference)
+	if err != nil {
+		return nil, "", err
+	}
+	digest := manifest.digest
+	klog.V(1).Infof("Image %s resolved to %s\n", c.ref, digest)
+	// An OCI index may reference other indexes
+	for depth := 0; manifest.isList(); depth++ {
+		if depth == maxManifestListDepth {
+			return nil, "", errors.Errorf("manifest lists of %s are nested too deeply", c.ref)
+		}
+		desc := manifest.selectPlatform(platform)
+		if desc == nil {
+			return nil, "", errors.Errorf("no image for %s in the manifest list of %s, available: %s", platform, c.ref, strings.Join(manifest.platforms(), ", "))
+		}
+		klog.V(1).Infof("Using the image for %s, %s\n", platform, desc.Digest)
+		if manifest, err = c.getManifest(desc.Digest); err != nil {
+			return nil, "", err
+		}
+	}
+	return manifest, digest, nil
+}
+
+// parseImagePlatform parses a platform like <os>/<architecture>/<variant>, where every part is optional. The os and
+// architecture of the node the importer runs on are used for the missing parts.
+func parseImagePlatform(platform string) (*imagePlatform, error) {
+	parts := strings.Split(platform, "/")
+	if len(parts) > 3 {
+		return nil, errors.Errorf("invalid image platform %q, expected <os>/<architecture>/<variant>", platform)
+	}
+	parts = append(parts, "", "")
+	p := &imagePlatform{os: parts[0], architecture: parts[1], variant: parts[2]}
+	if p.os == "" {
+		p.os = runtime.GOOS
+	}
+	if p.architecture == "" {
+		p.architecture = runtime.GOARCH
+	}
+	return p, nil
+}
+
+func (p *imagePlatform) String() string {
+	if p.variant == "" {
+		return p.os + "/" + p.architecture
+	}
+	return p.os + "/" + p.architecture + "/" + p.variant
+}
+
+// matches checks if the manifest of a manifest list is an image for the platform.
+func (p *imagePlatform) matches(desc *registryDescriptor) bool {
+	if desc.Platform.OS != p.os || desc.Platform.Architecture != p.architecture {
+		return false
+	}
+	return p.variant == "" || normalizeVariant(p.architecture, desc.Platform.Variant) == normalizeVariant(p.architecture, p.variant)
+}
+
+// normalizeVariant returns the variant of an architecture that images without a variant are built for.
+func normalizeVariant(architecture, variant string) string {
+	if architecture == "arm64" && variant == "" {
+		return "v8"
+	}
+	return variant
+}
+
+// isList checks if the manifest is a manifest list or OCI index, rather than the manifest of an image.
+func (m *registryManifest) isList() bool {
+	// The media type of an OCI index is optional, and registries may serve it as plain json
+	return m.MediaType == manifestListMediaType || m.MediaType == ociIndexMediaType || len(m.Manifests) > 0
+}
+
+// selectPlatform returns the manifest of the image for the platform in a manifest list, nil if it has none.
+func (m *registryManifest) selectPlatform(platform *imagePlatform) *registryDescriptor {
+	for i := range m.Manifests {
+		if platform.matches(&m.Manifests[i]) {
+			return &m.Manifests[i]
+		}
+	}
+	return nil
+}
+
+// platforms returns the platforms of the images in a manifest list.
+func (m *registryManifest) platforms() []string {
+	var platforms []string
+	for _, desc := range m.Manifests {
+		p := &imagePlatform{os: desc.Platform.OS, architecture: desc.Platform.Architecture, variant: desc.Platform.Variant}
+		platforms = append(platforms, p.String())
+	}
+	return platforms
+}
+
+// layersTopDown returns the digests of the layers of the image, starting with the top layer.
+func (m *registryManifest) layersTopDown() []string {
+	var digests []string
+	if m.SchemaVersion == 1 {
+		// The layers of a schema 1 manifest are listed from the top
+		for _, l := range m.FsLayers {
+			digests = append(digests, l.BlobSum)
+		}
+		return digests
+	}
+	for i := len(m.Layers) - 1; i >= 0; i-- {
+		digests = append(digests, m.Layers[i].Digest)
+	}
+	return digests
+}
+
+// openBlob returns a reader of a blob of the image, which returns an error instead of io.EOF if the data does not
+// match the digest.
+func (c *registryClient) openBlob(digest string) (*blobReader, error) {
+	checksum, err := util.ParseChecksum(digest)
+	if err != nil || checksum == nil {
+		return nil, errors.Errorf("invalid blob digest %q", digest)
+	}
+	resp, err := c.get("blobs/"+digest, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not get blob %s", digest)
+	}
+	return &blobReader{
+		body:   resp.Body,
+		digest: checksum,
+		hash:   checksum.NewHash(),
+	}, nil
+}
+
+func (r *blobReader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	n, err := r.body.Read(p)
+	r.hash.Write(p[:n])
+	if err == io.EOF && !r.verified {
+		r.verified = true
+		if !r.digest.Matches(r.hash) {
+			err = errors.Errorf("digest of blob %s does not match its data", r.digest)
+		}
+	}
+	if err != nil {
+		r.err = err
+	}
+	return n, err
+}
+
+// Close closes the response of the blob.
+func (r *blobReader) Close() error {
+	return r.body.Close()
+}
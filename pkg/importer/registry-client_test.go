@@ -0,0 +1,336 @@
+package importer
+
+import (
+	"crypto/tls"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+const testImageDigest = "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+var testNodePlatform = &imagePlatform{os: runtime.GOOS, architecture: runtime.GOARCH}
+
+var _ = Describe("Registry client", func() {
+	var registry *fakeRegistry
+
+	AfterEach(func() {
+		if registry != nil {
+			registry.close()
+			registry = nil
+		}
+	})
+
+	table.DescribeTable("Parse image reference", func(endpoint string, expected *imageReference, expectErr bool) {
+		ref, err := parseImageReference(endpoint)
+		if expectErr {
+			Expect(err).To(HaveOccurred())
+		} else {
+			Expect(err).NotTo(HaveOccurred())
+		}
+		Expect(ref).To(Equal(expected))
+	},
+		table.Entry("docker hub image", "docker://fedora", &imageReference{registry: dockerHubRegistry, repository: "library/fedora", reference: "latest"}, false),
+		table.Entry("docker hub image with a tag", "docker://kubevirt/fedora-cloud-registry-disk-demo:v1", &imageReference{registry: dockerHubRegistry, repository: "kubevirt/fedora-cloud-registry-disk-demo", reference: "v1"}, false),
+		table.Entry("docker.io image", "docker://docker.io/fedora:31", &imageReference{registry: dockerHubRegistry, repository: "library/fedora", reference: "31"}, false),
+		table.Entry("image with a registry port", "docker://registry:5000/vmdisks/fedora", &imageReference{registry: "registry:5000", repository: "vmdisks/fedora", reference: "latest"}, false),
+		table.Entry("image with a digest", "docker://quay.io/kubevirt/cirros@"+testImageDigest, &imageReference{registry: "quay.io", repository: "kubevirt/cirros", reference: testImageDigest}, false),
+		table.Entry("image with a tag and a digest", "docker://localhost/cirros:v1@"+testImageDigest, &imageReference{registry: "localhost", repository: "cirros", reference: testImageDigest}, false),
+		table.Entry("url without the docker scheme", "http://registry/image", nil, true),
+		table.Entry("url without a repository", "docker://", nil, true),
+		table.Entry("image with an invalid digest", "docker://registry:5000/image@sha256:1234", nil, true),
+	)
+
+	table.DescribeTable("Parse authentication challenge", func(header string, expected *authChallenge) {
+		Expect(parseAuthChallenge(header)).To(Equal(expected))
+	},
+		table.Entry("bearer challenge", `Bearer realm="https://auth.docker.io/token",service="registry.docker.io"`,
+			&authChallenge{scheme: "bearer", params: map[string]string{"realm": "https://auth.docker.io/token", "service": "registry.docker.io"}}),
+		table.Entry("challenge with a quoted comma and unquoted values", `Bearer realm="https://auth/token", scope="repository:a:pull,push", error=invalid_token`,
+			&authChallenge{scheme: "bearer", params: map[string]string{"realm": "https://auth/token", "scope": "repository:a:pull,push", "error": "invalid_token"}}),
+		table.Entry("basic challenge", `Basic realm="Registry Realm"`, &authChallenge{scheme: "basic", params: map[string]string{"realm": "Registry Realm"}}),
+		table.Entry("challenge without parameters", "Basic", &authChallenge{scheme: "basic", params: map[string]string{}}),
+	)
+
+	table.DescribeTable("Parse image platform", func(platform string, expected *imagePlatform, expectErr bool) {
+		p, err := parseImagePlatform(platform)
+		if expectErr {
+			Expect(err).To(HaveOccurred())
+		} else {
+			Expect(err).NotTo(HaveOccurred())
+		}
+		Expect(p).To(Equal(expected))
+	},
+		table.Entry("platform of the node", "", &imagePlatform{os: runtime.GOOS, architecture: runtime.GOARCH}, false),
+		table.Entry("os and architecture", "linux/arm64", &imagePlatform{os: "linux", architecture: "arm64"}, false),
+		table.Entry("os, architecture and variant", "linux/arm/v7", &imagePlatform{os: "linux", architecture: "arm", variant: "v7"}, false),
+		table.Entry("architecture of the node", "windows", &imagePlatform{os: "windows", architecture: runtime.GOARCH}, false),
+		table.Entry("os of the node", "/s390x", &imagePlatform{os: runtime.GOOS, architecture: "s390x"}, false),
+		table.Entry("too many parts", "linux/arm/v7/extra", nil, true),
+	)
+
+	table.DescribeTable("Authenticate with the registry", func(auth, accessKey, secKey string, expectErr bool) {
+		registry = newFakeRegistry(false)
+		registry.auth = auth
+		registry.username = "user"
+		registry.password = "secret"
+		registry.addImage("latest")
+		ref, err := parseImageReference(registry.imageURL("latest"))
+		Expect(err).NotTo(HaveOccurred())
+		client, err := newRegistryClient(ref, accessKey, secKey, "", "", true)
+		if expectErr {
+			Expect(err).To(HaveOccurred())
+			return
+		}
+		Expect(err).NotTo(HaveOccurred())
+		_, _, err = client.resolveManifest(testNodePlatform)
+		Expect(err).NotTo(HaveOccurred())
+	},
+		table.Entry("with a token", "bearer", "user", "secret", false),
+		table.Entry("with basic authentication", "basic", "user", "secret", false),
+		table.Entry("with invalid token credentials", "bearer", "user", "wrong", true),
+		table.Entry("without basic authentication credentials", "basic", "", "", true),
+	)
+
+	It("Should request a new token once the token expired", func() {
+		registry = newFakeRegistry(false)
+		registry.auth = "bearer"
+		registry.addImage("latest")
+		ref, err := parseImageReference(registry.imageURL("latest"))
+		Expect(err).NotTo(HaveOccurred())
+		client, err := newRegistryClient(ref, "", "", "", "", true)
+		Expect(err).NotTo(HaveOccurred())
+		// Issuing another token invalidates the token of the client
+		registry.tokens++
+		_, _, err = client.resolveManifest(testNodePlatform)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(registry.tokens).To(Equal(3))
+	})
+
+	It("Should select the image of the current platform in a manifest list", func() {
+		registry = newFakeRegistry(false)
+		other := registry.addImage("", createTestLayer(true, testLayerFile{name: "disk/other.img", data: []byte("other")}))
+		current := registry.addImage("")
+		list := registry.addManifest("latest", "application/vnd.docker.distribution.manifest.list.v2+json", map[string]interface{}{
+			"schemaVersion": 2,
+			"manifests": []map[string]interface{}{
+				{"digest": other, "platform": map[string]string{"os": runtime.GOOS, "architecture": "other"}},
+				{"digest": current, "platform": map[string]string{"os": runtime.GOOS, "architecture": runtime.GOARCH}},
+			},
+		})
+		ref, err := parseImageReference(registry.imageURL("latest"))
+		Expect(err).NotTo(HaveOccurred())
+		client, err := newRegistryClient(ref, "", "", "", "", true)
+		Expect(err).NotTo(HaveOccurred())
+		manifest, digest, err := client.resolveManifest(testNodePlatform)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(manifest.Layers).To(BeEmpty())
+		Expect(manifest.digest).To(Equal(current))
+		Expect(digest).To(Equal(list))
+	})
+
+	It("Should return an error if the manifest list has no image of the current platform", func() {
+		registry = newFakeRegistry(false)
+		registry.addManifest("latest", "application/vnd.oci.image.index.v1+json", map[string]interface{}{
+			"schemaVersion": 2,
+			"manifests": []map[string]interface{}{
+				{"digest": registry.addImage(""), "platform": map[string]string{"os": "other", "architecture": runtime.GOARCH}},
+			},
+		})
+		ref, err := parseImageReference(registry.imageURL("latest"))
+		Expect(err).NotTo(HaveOccurred())
+		client, err := newRegistryClient(ref, "", "", "", "", true)
+		Expect(err).NotTo(HaveOccurred())
+		_, _, err = client.resolveManifest(testNodePlatform)
+		Expect(err).To(HaveOccurred())
+	})
+
+	Context("With a multi-arch image", func() {
+		var images map[string]string
+
+		BeforeEach(func() {
+			registry = newFakeRegistry(false)
+			images = map[string]string{}
+			platforms := []map[string]string{
+				{"os": "linux", "architecture": "amd64"},
+				{"os": "linux", "architecture": "arm64", "variant": "v8"},
+				{"os": "linux", "architecture": "arm", "variant": "v6"},
+				{"os": "linux", "architecture": "arm", "variant": "v7"},
+				{"os": "unknown", "architecture": "unknown"},
+			}
+			manifests := []map[string]interface{}{}
+			for _, platform := range platforms {
+				name := platform["os"] + "/" + platform["architecture"] + "/" + platform["variant"]
+				images[name] = registry.addImage("", createTestLayer(true, testLayerFile{name: "disk/" + platform["architecture"] + ".img", data: []byte(name)}))
+				manifests = append(manifests, map[string]interface{}{"digest": images[name], "platform": platform})
+			}
+			registry.addManifest("latest", "application/vnd.oci.image.index.v1+json", map[string]interface{}{
+				"schemaVersion": 2,
+				"manifests":     manifests,
+			})
+		})
+
+		table.DescribeTable("Should select the image of the platform", func(platform, expected string) {
+			p, err := parseImagePlatform(platform)
+			Expect(err).NotTo(HaveOccurred())
+			ref, err := parseImageReference(registry.imageURL("latest"))
+			Expect(err).NotTo(HaveOccurred())
+			client, err := newRegistryClient(ref, "", "", "", "", true)
+			Expect(err).NotTo(HaveOccurred())
+			manifest, _, err := client.resolveManifest(p)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(manifest.digest).To(Equal(images[expected]))
+		},
+			table.Entry("amd64", "linux/amd64", "linux/amd64/"),
+			table.Entry("arm64 without a variant", "linux/arm64", "linux/arm64/v8"),
+			table.Entry("arm64 with the default variant", "linux/arm64/v8", "linux/arm64/v8"),
+			table.Entry("arm with a variant", "linux/arm/v7", "linux/arm/v7"),
+			table.Entry("arm without a variant", "linux/arm", "linux/arm/v6"),
+		)
+
+		It("Should return an error with the available platforms if the platform has no image", func() {
+			p, err := parseImagePlatform("linux/arm64/v9")
+			Expect(err).NotTo(HaveOccurred())
+			ref, err := parseImageReference(registry.imageURL("latest"))
+			Expect(err).NotTo(HaveOccurred())
+			client, err := newRegistryClient(ref, "", "", "", "", true)
+			Expect(err).NotTo(HaveOccurred())
+			_, _, err = client.resolveManifest(p)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("no image for linux/arm64/v9"))
+			Expect(err.Error()).To(ContainSubstring("linux/amd64, linux/arm64/v8, linux/arm/v6, linux/arm/v7"))
+		})
+	})
+
+	It("Should follow nested OCI indexes without a media type", func() {
+		registry = newFakeRegistry(false)
+		image := registry.addImage("")
+		nested := registry.addManifest("", "", map[string]interface{}{
+			"schemaVersion": 2,
+			"manifests": []map[string]interface{}{
+				{"digest": image, "platform": map[string]string{"os": "linux", "architecture": "arm64"}},
+			},
+		})
+		index := registry.addManifest("latest", "", map[string]interface{}{
+			"schemaVersion": 2,
+			"manifests": []map[string]interface{}{
+				{"digest": nested, "platform": map[string]string{"os": "linux", "architecture": "arm64", "variant": "v8"}},
+			},
+		})
+		ref, err := parseImageReference(registry.imageURL("latest"))
+		Expect(err).NotTo(HaveOccurred())
+		client, err := newRegistryClient(ref, "", "", "", "", true)
+		Expect(err).NotTo(HaveOccurred())
+		manifest, digest, err := client.resolveManifest(&imagePlatform{os: "linux", architecture: "arm64", variant: "v8"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(manifest.digest).To(Equal(image))
+		Expect(digest).To(Equal(index))
+	})
+
+	It("Should resolve the digest of a tag", func() {
+		registry = newFakeRegistry(false)
+		expected := registry.addImage("v1")
+		ref, err := parseImageReference(registry.imageURL("v1"))
+		Expect(err).NotTo(HaveOccurred())
+		client, err := newRegistryClient(ref, "", "", "", "", true)
+		Expect(err).NotTo(HaveOccurred())
+		_, digest, err := client.resolveManifest(testNodePlatform)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(digest).To(Equal(expected))
+	})
+
+	It("Should return an error if a manifest does not match its digest", func() {
+		registry = newFakeRegistry(false)
+		digest := registry.addImage("")
+		registry.manifests[digest] = registry.manifests[registry.addImage("", createTestLayer(true))]
+		ref, err := parseImageReference(registry.imageURL(digest))
+		Expect(err).NotTo(HaveOccurred())
+		client, err := newRegistryClient(ref, "", "", "", "", true)
+		Expect(err).NotTo(HaveOccurred())
+		_, _, err = client.resolveManifest(testNodePlatform)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("does not match"))
+	})
+
+	It("Should return an error if the manifest does not exist", func() {
+		registry = newFakeRegistry(false)
+		ref, err := parseImageReference(registry.imageURL("missing"))
+		Expect(err).NotTo(HaveOccurred())
+		client, err := newRegistryClient(ref, "", "", "", "", true)
+		Expect(err).NotTo(HaveOccurred())
+		_, _, err = client.resolveManifest(testNodePlatform)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("404"))
+	})
+
+	Context("With a TLS registry", func() {
+		var certDir string
+
+		BeforeEach(func() {
+			registry = newFakeRegistry(true)
+			registry.addImage("latest")
+			var err error
+			certDir, err = ioutil.TempDir("", "certs")
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(certDir)
+		})
+
+		It("Should trust the certificates of the cert dir", func() {
+			cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: registry.server.Certificate().Raw})
+			Expect(ioutil.WriteFile(filepath.Join(certDir, "tls.crt"), cert, 0644)).To(Succeed())
+			ref, err := parseImageReference(registry.imageURL("latest"))
+			Expect(err).NotTo(HaveOccurred())
+			_, err = newRegistryClient(ref, "", "", certDir, "", false)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("Should return an error if the certificate of the registry is not trusted", func() {
+			ref, err := parseImageReference(registry.imageURL("latest"))
+			Expect(err).NotTo(HaveOccurred())
+			_, err = newRegistryClient(ref, "", "", certDir, "", false)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("Should present the client certificate to a registry that requires one", func() {
+			clientCertDir, err := ioutil.TempDir("", "client-cert")
+			Expect(err).NotTo(HaveOccurred())
+			defer os.RemoveAll(clientCertDir)
+			clientCAs := createTestClientCert(clientCertDir)
+			registry.server.Close()
+			registry.server = httptest.NewUnstartedServer(registry)
+			registry.server.TLS = &tls.Config{
+				ClientAuth: tls.RequireAndVerifyClientCert,
+				ClientCAs:  clientCAs,
+			}
+			registry.server.StartTLS()
+			cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: registry.server.Certificate().Raw})
+			Expect(ioutil.WriteFile(filepath.Join(certDir, "tls.crt"), cert, 0644)).To(Succeed())
+			ref, err := parseImageReference(registry.imageURL("latest"))
+			Expect(err).NotTo(HaveOccurred())
+			_, err = newRegistryClient(ref, "", "", certDir, clientCertDir, false)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = newRegistryClient(ref, "", "", "", clientCertDir, true)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = newRegistryClient(ref, "", "", certDir, "", false)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("Should not verify the certificate of an insecure registry", func() {
+			ref, err := parseImageReference(registry.imageURL("latest"))
+			Expect(err).NotTo(HaveOccurred())
+			client, err := newRegistryClient(ref, "", "", "", "", true)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(client.baseURL).To(HavePrefix("https://"))
+		})
+	})
+})
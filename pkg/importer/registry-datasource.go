@@ -17,9 +17,14 @@ limitations under the License.
 package importer
 
 import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
 	"io/ioutil"
 	"net/url"
-	"os"
+	"path"
 	"path/filepath"
 	"strings"
 
@@ -27,45 +32,144 @@ import (
 
 	"k8s.io/klog"
 
-	"kubevirt.io/containerized-data-importer/pkg/image"
+	cdiv1 "kubevirt.io/containerized-data-importer/pkg/apis/core/v1alpha1"
 	"kubevirt.io/containerized-data-importer/pkg/util"
+	"kubevirt.io/containerized-data-importer/third_party/forked/golang/zstd"
 )
 
 const (
 	//containerDiskImageDir - Expected disk image location in container image as described in
 	//https://github.com/kubevirt/kubevirt/blob/master/docs/container-register-disks.md
 	containerDiskImageDir = "disk"
+	// whiteoutPrefix is the prefix of the name of a file that removes the file of a lower layer
+	whiteoutPrefix = ".wh."
+	// whiteoutOpaqueDir is the name of a file that removes the contents of its directory in the lower layers
+	whiteoutOpaqueDir = ".wh..wh..opq"
 )
 
-// RegistryDataSource is the struct containing the information needed to import from a registry data source.
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// ErrAmbiguousDiskImage is returned if more than one file of a registry image matches the disk path.
+var ErrAmbiguousDiskImage = errors.New("more than one disk image found, the disk path has to match a single file")
+
+// RegistryDataSource is the struct containing the information needed to import from a registry data source. The
+// layers of the image are read from the top layer down, until the layer containing the disk image is found, and only
+// the disk image file is streamed from that layer.
 // Sequence of phases:
-// 1. Info -> Transfer
+// 1. Info -> Transfer, or TransferDataFile if the disk image is raw
 // 2. Transfer -> Process
-// 3. Process -> Convert (In the process phase the container image layers are extracted, and the url is pointed to the file determined to be the disk image)
+// 3. Process -> Convert
 type RegistryDataSource struct {
-	endpoint    string
-	accessKey   string
-	secKey      string
-	certDir     string
-	insecureTLS bool
-	imageDir    string
-	//The discovered image file in scratch space.
+	// the disk image file in the layer of the image
+	diskReader *containerDiskReader
+	// the size of the disk image file
+	size uint64
+	// stack of readers
+	readers *FormatReaders
+	// The image file in scratch space.
 	url *url.URL
+	// the digest of the manifest the image resolved to
+	imageDigest string
 }
 
-// NewRegistryDataSource creates a new instance of the Registry Data Source.
-func NewRegistryDataSource(endpoint, accessKey, secKey, certDir string, insecureTLS bool) *RegistryDataSource {
-	return &RegistryDataSource{
-		endpoint:    endpoint,
-		accessKey:   accessKey,
-		secKey:      secKey,
-		certDir:     certDir,
-		insecureTLS: insecureTLS,
+// containerDiskReader reads the disk image file from a layer of an image. Once the file has been read, the rest of
+// the layer is read to verify its digest.
+type containerDiskReader struct {
+	tr *tar.Reader
+	// the uncompressed layer
+	layer io.Reader
+	blob  io.ReadCloser
+	// the path of the disk image, and the disk path it matches
+	name     string
+	diskPath string
+	// the files removed by the upper layers
+	removed *whiteouts
+	// the result of reading the rest of the layer
+	verified bool
+	err      error
+}
+
+// whiteouts are the files and directories of the lower layers of an image that were removed by the upper layers.
+type whiteouts struct {
+	// the removed files and directories
+	removed map[string]bool
+	// the directories whose contents were removed
+	opaque map[string]bool
+}
+
+// RegistryOptions are the settings of the registry an image is imported from.
+type RegistryOptions struct {
+	// CertDir contains the certificates the registry is trusted with, in addition to the system certificates
+	CertDir string
+	// ClientCertDir contains the client certificate presented to the registry, in tls.crt and tls.key
+	ClientCertDir string
+	// InsecureTLS disables the verification of the certificate of the registry, and allows http
+	InsecureTLS bool
+	// Platform selects the image of a manifest list, like linux/arm64/v8. The os and architecture of the node are
+	// used if they are missing.
+	Platform string
+	// DiskPath is the path of the disk image in the image, or a pattern like disk/*.qcow2. If empty, the disk image
+	// is the file in the disk directory.
+	DiskPath string
+}
+
+// NewRegistryDataSource creates a new instance of the Registry Data Source, the endpoint is the url of the image,
+// like docker://<registry>/<repository>:<tag>.
+func NewRegistryDataSource(endpoint, accessKey, secKey string, options RegistryOptions) (*RegistryDataSource, error) {
+	ref, err := parseImageReference(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	platform, err := parseImagePlatform(options.Platform)
+	if err != nil {
+		return nil, err
+	}
+	var client *registryClient
+	err = retry("registry connection", func() error {
+		var err error
+		client, err = newRegistryClient(ref, accessKey, secKey, options.CertDir, options.ClientCertDir, options.InsecureTLS)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	manifest, imageDigest, err := client.resolveManifest(platform)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := path.Match(options.DiskPath, ""); err != nil {
+		return nil, errors.Wrapf(err, "invalid disk path %q", options.DiskPath)
 	}
+	openLayer := func(digest string) (io.ReadCloser, error) {
+		return client.openBlob(digest)
+	}
+	diskReader, size, err := openContainerDisk(openLayer, manifest.layersTopDown(), options.DiskPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to read registry image %s", ref)
+	}
+	return &RegistryDataSource{
+		diskReader:  diskReader,
+		size:        size,
+		imageDigest: imageDigest,
+	}, nil
 }
 
-// Info is called to get initial information about the data. No information available for registry currently.
+// Info is called to get initial information about the data.
 func (rd *RegistryDataSource) Info() (ProcessingPhase, error) {
+	var err error
+	rd.readers, err = NewFormatReaders(rd.diskReader, rd.size, "", cdiv1.DataVolumeKubeVirt, "")
+	if err != nil {
+		klog.Errorf("Error creating readers: %v", err)
+		return ProcessingPhaseError, err
+	}
+	if !rd.readers.Convert {
+		// Downloading a raw file, we can write that directly to the target.
+		return ProcessingPhaseTransferDataFile, nil
+	}
+
 	return ProcessingPhaseTransferScratch, nil
 }
 
@@ -75,32 +179,35 @@ func (rd *RegistryDataSource) Transfer(path string) (ProcessingPhase, error) {
 		// Path provided is invalid.
 		return ProcessingPhaseError, ErrInvalidPath
 	}
-	rd.imageDir = filepath.Join(path, containerDiskImageDir)
-
-	klog.V(1).Infof("Copying registry image to scratch space.")
-	err := image.CopyRegistryImage(rd.endpoint, path, containerDiskImageDir, rd.accessKey, rd.secKey, rd.certDir, rd.insecureTLS)
+	file := filepath.Join(path, tempFile)
+	rd.readers.StartProgressUpdate()
+	err := util.StreamDataToFile(rd.readers.TopReader(), file)
 	if err != nil {
-		return ProcessingPhaseError, errors.Wrapf(err, "Failed to read registry image")
+		return ProcessingPhaseError, err
 	}
-
+	if err := rd.diskReader.verify(); err != nil {
+		return ProcessingPhaseError, err
+	}
+	// If streaming succeeded, then parsing the file into URL will also succeed, no need to check error status
+	rd.url, _ = url.Parse(file)
 	return ProcessingPhaseProcess, nil
 }
 
 // TransferFile is called to transfer the data from the source to the passed in file.
 func (rd *RegistryDataSource) TransferFile(fileName string) (ProcessingPhase, error) {
-	return ProcessingPhaseError, errors.New("Transferfile should not be called")
+	rd.readers.StartProgressUpdate()
+	err := util.StreamDataToFile(rd.readers.TopReader(), fileName)
+	if err != nil {
+		return ProcessingPhaseError, err
+	}
+	if err := rd.diskReader.verify(); err != nil {
+		return ProcessingPhaseError, err
+	}
+	return ProcessingPhaseResize, nil
 }
 
 // Process is called to do any special processing before giving the url to the data back to the processor
 func (rd *RegistryDataSource) Process() (ProcessingPhase, error) {
-	imageFile, err := getImageFileName(rd.imageDir)
-	if err != nil {
-		return ProcessingPhaseError, errors.Wrapf(err, "Cannot locate image file")
-	}
-
-	// imageFile and rd.imageDir are both valid, thus the Join will be valid, and the parse will work, no need to check for parse errors
-	rd.url, _ = url.Parse(filepath.Join(rd.imageDir, imageFile))
-	klog.V(3).Infof("Successfully found file. VM disk image filename is %s", rd.url.String())
 	return ProcessingPhaseConvert, nil
 }
 
@@ -109,43 +216,324 @@ func (rd *RegistryDataSource) GetURL() *url.URL {
 	return rd.url
 }
 
+// ImageDigest returns the digest of the manifest the image resolved to, which identifies the imported image even if
+// it was referenced by a tag.
+func (rd *RegistryDataSource) ImageDigest() string {
+	return rd.imageDigest
+}
+
 // Close closes any readers or other open resources.
 func (rd *RegistryDataSource) Close() error {
-	// No-op, no open readers
+	if rd.readers != nil {
+		return rd.readers.Close()
+	}
+	return rd.diskReader.Close()
+}
+
+// containerDisk is the disk image of an image found by findContainerDisk.
+type containerDisk struct {
+	// the layer of the disk image, and the path of the disk image in the layer
+	layer string
+	name  string
+	// the disk path the disk image matches
+	diskPath string
+	// the files removed by the layers above the layer of the disk image
+	removed *whiteouts
+}
+
+// openContainerDisk finds the disk image matching the disk path in the image, and returns a reader of the file and its
+// size.
+func openContainerDisk(openLayer func(string) (io.ReadCloser, error), layers []string, diskPath string) (*containerDiskReader, uint64, error) {
+	disk, err := findContainerDisk(openLayer, layers, diskPath)
+	if err != nil {
+		return nil, uint64(0), err
+	}
+	return disk.open(openLayer)
+}
+
+// findContainerDisk finds the disk image matching the disk path in the image. The layers are opened with the passed
+// in function, from the top layer down, and the first matching file that was not removed by an upper layer is the disk
+// image. The layers below it are read too, and an error is returned if one of them has another matching file that was
+// not removed, so the disk path has to match a single file of the whole image. Another matching file in the layer of
+// the disk image itself is only found once the disk image has been read, by the verify of its reader.
+func findContainerDisk(openLayer func(string) (io.ReadCloser, error), layers []string, diskPath string) (*containerDisk, error) {
+	removed := newWhiteouts()
+	for i, digest := range layers {
+		klog.V(2).Infof("Looking for the disk image in layer %s\n", digest)
+		var disk *containerDisk
+		layerWhiteouts, err := scanLayer(openLayer, digest, func(hdr *tar.Header, name string) bool {
+			if !isContainerDisk(hdr, name, diskPath, removed) {
+				return true
+			}
+			disk = &containerDisk{
+				layer:    digest,
+				name:     name,
+				diskPath: diskPath,
+				removed:  removed,
+			}
+			return false
+		})
+		if err != nil {
+			return nil, err
+		}
+		if disk != nil {
+			if err := disk.checkLowerLayers(openLayer, layers[i+1:]); err != nil {
+				return nil, err
+			}
+			return disk, nil
+		}
+		removed.merge(layerWhiteouts)
+	}
+	if diskPath != "" {
+		return nil, errors.Errorf("no disk image matching %q found in the image", diskPath)
+	}
+	return nil, errors.Errorf("no disk image found in the %s directory of the image", containerDiskImageDir)
+}
+
+// checkLowerLayers reads the layers below the layer of the disk image, and returns an error if one of them has another
+// file matching the disk path that was not removed by the layers above it. A file with the path of the disk image is
+// replaced by the disk image.
+func (d *containerDisk) checkLowerLayers(openLayer func(string) (io.ReadCloser, error), lower []string) error {
+	removed := newWhiteouts()
+	removed.merge(d.removed)
+	var others []string
+	for _, digest := range lower {
+		klog.V(2).Infof("Looking for other disk images in layer %s\n", digest)
+		layerWhiteouts, err := scanLayer(openLayer, digest, func(hdr *tar.Header, name string) bool {
+			if name != d.name && isContainerDisk(hdr, name, d.diskPath, removed) {
+				others = append(others, name)
+			}
+			return true
+		})
+		if err != nil {
+			return err
+		}
+		removed.merge(layerWhiteouts)
+	}
+	if len(others) == 0 {
+		return nil
+	}
+	// The whiteouts of the layer of the disk image may follow the disk image, so the whole layer is read to check if
+	// they remove the other files.
+	diskLayerWhiteouts, err := scanLayer(openLayer, d.layer, func(*tar.Header, string) bool {
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	for _, name := range others {
+		if !diskLayerWhiteouts.hides(name) {
+			return ambiguousDiskImageError(d.name, name, d.diskPath)
+		}
+	}
 	return nil
 }
 
-func getImageFileName(dir string) (string, error) {
-	if _, err := os.Stat(dir); os.IsNotExist(err) {
-		klog.Errorf("image directory does not exist")
-		return "", errors.Errorf("image directory does not exist")
+// open opens the layer of the disk image, and returns a reader of the disk image and its size.
+func (d *containerDisk) open(openLayer func(string) (io.ReadCloser, error)) (*containerDiskReader, uint64, error) {
+	blob, err := openLayer(d.layer)
+	if err != nil {
+		return nil, uint64(0), err
+	}
+	layer, err := uncompressedLayer(blob)
+	if err != nil {
+		blob.Close()
+		return nil, uint64(0), err
+	}
+	tr := tar.NewReader(layer)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			blob.Close()
+			return nil, uint64(0), errors.Errorf("disk image %s not found in layer %s", d.name, d.layer)
+		}
+		if err != nil {
+			blob.Close()
+			return nil, uint64(0), errors.Wrapf(err, "could not read layer %s", d.layer)
+		}
+		if name := cleanTarPath(hdr.Name); name == d.name && isContainerDisk(hdr, name, d.diskPath, d.removed) {
+			klog.V(1).Infof("VM disk image filename is %s, size %d\n", name, hdr.Size)
+			return &containerDiskReader{
+				tr:       tr,
+				layer:    layer,
+				blob:     blob,
+				name:     name,
+				diskPath: d.diskPath,
+				removed:  d.removed,
+			}, uint64(hdr.Size), nil
+		}
 	}
+}
 
-	entries, err := ioutil.ReadDir(dir)
+// scanLayer reads the entries of a layer, and calls visit with the entries that are not whiteouts until it returns
+// false. It returns the whiteouts of the layer, which are only complete if the whole layer was read, in which case
+// the digest of the layer is verified too.
+func scanLayer(openLayer func(string) (io.ReadCloser, error), digest string, visit func(hdr *tar.Header, name string) bool) (*whiteouts, error) {
+	blob, err := openLayer(digest)
+	if err != nil {
+		return nil, err
+	}
+	defer blob.Close()
+	layer, err := uncompressedLayer(blob)
 	if err != nil {
-		klog.Errorf("Error reading directory")
-		return "", errors.Wrapf(err, "image file does not exist in image directory")
+		return nil, err
+	}
+	// The whiteouts of a layer only apply to the layers below it
+	layerWhiteouts := newWhiteouts()
+	tr := tar.NewReader(layer)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not read layer %s", digest)
+		}
+		name := cleanTarPath(hdr.Name)
+		if strings.HasPrefix(path.Base(name), whiteoutPrefix) {
+			layerWhiteouts.add(name)
+			continue
+		}
+		if !visit(hdr, name) {
+			return layerWhiteouts, nil
+		}
+	}
+	if err := drainLayer(layer, blob); err != nil {
+		return nil, errors.Wrapf(err, "could not read layer %s", digest)
+	}
+	return layerWhiteouts, nil
+}
+
+// ambiguousDiskImageError returns the error of a disk path that matches two files.
+func ambiguousDiskImageError(name, other, diskPath string) error {
+	if diskPath == "" {
+		return errors.Wrapf(ErrAmbiguousDiskImage, "%s and %s are in the %s directory", name, other, containerDiskImageDir)
+	}
+	return errors.Wrapf(ErrAmbiguousDiskImage, "%s and %s match %q", name, other, diskPath)
+}
+
+// isContainerDisk checks if the entry of a layer is a disk image, which is a regular file matching the disk path, or
+// in the disk directory if the disk path is empty, that was not removed by an upper layer.
+func isContainerDisk(hdr *tar.Header, name, diskPath string, removed *whiteouts) bool {
+	if (hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeRegA) || strings.HasPrefix(path.Base(name), whiteoutPrefix) {
+		return false
 	}
+	if diskPath == "" {
+		if path.Dir(name) != containerDiskImageDir {
+			return false
+		}
+	} else if matched, _ := path.Match(cleanTarPath(diskPath), name); !matched {
+		return false
+	}
+	return !removed.hides(name)
+}
+
+// uncompressedLayer returns a reader of the tar archive of a layer, which is either uncompressed, or compressed with
+// gzip or zstd.
+func uncompressedLayer(blob io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(blob)
+	// A layer shorter than the magic numbers is an uncompressed archive, or invalid
+	magic, _ := br.Peek(len(zstdMagic))
+	if bytes.HasPrefix(magic, gzipMagic) {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not read gzip compressed layer")
+		}
+		return gz, nil
+	}
+	if bytes.HasPrefix(magic, zstdMagic) {
+		return zstd.NewReader(br), nil
+	}
+	return br, nil
+}
 
-	if len(entries) == 0 {
-		klog.Errorf("image file does not exist in image directory - directory is empty ")
-		return "", errors.New("image file does not exist in image directory - directory is empty")
+// drainLayer reads the rest of a layer, so its digest is verified.
+func drainLayer(layer io.Reader, blob io.Reader) error {
+	if _, err := io.Copy(ioutil.Discard, layer); err != nil {
+		return err
 	}
+	_, err := io.Copy(ioutil.Discard, blob)
+	return err
+}
 
-	fileinfo := entries[len(entries)-1]
-	if fileinfo.IsDir() {
-		klog.Errorf("image file does not exist in image directory contains another directory ")
-		return "", errors.New("image directory contains another directory")
+func (r *containerDiskReader) Read(p []byte) (int, error) {
+	n, err := r.tr.Read(p)
+	if err == io.EOF {
+		if verr := r.verify(); verr != nil {
+			err = verr
+		}
 	}
+	return n, err
+}
 
-	filename := fileinfo.Name()
+// verify reads the rest of the layer after the disk image, and returns an error if the layer has another disk image,
+// or if the digest of the layer does not match its data.
+func (r *containerDiskReader) verify() error {
+	if !r.verified {
+		r.verified = true
+		r.err = r.checkSingleDisk()
+		if r.err == nil {
+			if err := drainLayer(r.layer, r.blob); err != nil {
+				r.err = errors.Wrap(err, "could not read the layer of the disk image")
+			}
+		}
+	}
+	return r.err
+}
 
-	if len(strings.TrimSpace(filename)) == 0 {
-		klog.Errorf("image file does not exist in image directory - file has no name ")
-		return "", errors.New("image file does has no name")
+func (r *containerDiskReader) checkSingleDisk() error {
+	for {
+		hdr, err := r.tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrap(err, "could not read the layer of the disk image")
+		}
+		if name := cleanTarPath(hdr.Name); isContainerDisk(hdr, name, r.diskPath, r.removed) {
+			return ambiguousDiskImageError(r.name, name, r.diskPath)
+		}
 	}
+}
 
-	klog.V(1).Infof("VM disk image filename is %s", filename)
+// Close closes the layer.
+func (r *containerDiskReader) Close() error {
+	return r.blob.Close()
+}
 
-	return filename, nil
+func newWhiteouts() *whiteouts {
+	return &whiteouts{
+		removed: map[string]bool{},
+		opaque:  map[string]bool{},
+	}
+}
+
+// add records the whiteout file with the passed in path.
+func (w *whiteouts) add(name string) {
+	dir, base := path.Dir(name), path.Base(name)
+	if base == whiteoutOpaqueDir {
+		w.opaque[dir] = true
+	} else {
+		w.removed[path.Join(dir, strings.TrimPrefix(base, whiteoutPrefix))] = true
+	}
+}
+
+// merge adds the passed in whiteouts, once the layer they were found in has been read.
+func (w *whiteouts) merge(other *whiteouts) {
+	for name := range other.removed {
+		w.removed[name] = true
+	}
+	for dir := range other.opaque {
+		w.opaque[dir] = true
+	}
+}
+
+// hides returns true if the file, or one of its directories, was removed.
+func (w *whiteouts) hides(name string) bool {
+	for ; name != "." && name != ""; name = path.Dir(name) {
+		if w.removed[name] || w.opaque[path.Dir(name)] {
+			return true
+		}
+	}
+	return false
 }
@@ -1,202 +1,511 @@
 package importer
 
 import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
 	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	. "github.com/onsi/ginkgo"
 	"github.com/onsi/ginkgo/extensions/table"
 	. "github.com/onsi/gomega"
 	"github.com/pkg/errors"
-
-	"kubevirt.io/containerized-data-importer/pkg/image"
-	"kubevirt.io/containerized-data-importer/pkg/util"
 )
 
-var (
-	imageFile = filepath.Join(imageDir, "registry-image.tar")
+const (
+	testRegistryRepository = "kubevirt/disk"
+	testDockerManifestType = "application/vnd.docker.distribution.manifest.v2+json"
+	testDockerLayerType    = "application/vnd.docker.image.rootfs.diff.tar.gzip"
 )
 
 var _ = Describe("Registry data source", func() {
-	var tmpDir string
-	var err error
-	var ds *RegistryDataSource
+	var (
+		tmpDir   string
+		registry *fakeRegistry
+		ds       *RegistryDataSource
+		rawDisk  = make([]byte, 65536)
+		qcowDisk = append([]byte("QFI\xfb\x00\x00\x00\x03"), make([]byte, 4096)...)
+		base     []byte
+	)
 
 	BeforeEach(func() {
+		var err error
 		tmpDir, err = ioutil.TempDir("", "scratch")
 		Expect(err).NotTo(HaveOccurred())
-		By("tmpDir: " + tmpDir)
+		registry = newFakeRegistry(false)
+		base = createTestLayer(true, testLayerFile{name: "bin/sh", data: []byte("shell")})
+		// Random data, so the disk image is not smaller than the headers of the formats once it is compressed
+		rand.Read(rawDisk)
 	})
 
 	AfterEach(func() {
-		os.RemoveAll(tmpDir)
 		if ds != nil {
-			err = ds.Close()
-			Expect(err).NotTo(HaveOccurred())
+			ds.Close()
 			ds = nil
 		}
+		registry.close()
+		os.RemoveAll(tmpDir)
 	})
 
-	It("should return transfer after info is called", func() {
-		ds = NewRegistryDataSource("", "", "", "", true)
+	It("Should write a raw disk image directly to the target, after checking the lower layers", func() {
+		top := createTestLayer(true, testLayerFile{name: "disk/"}, testLayerFile{name: "disk/disk.img", data: rawDisk})
+		digest := registry.addImage("latest", base, top)
+		var err error
+		ds, err = NewRegistryDataSource(registry.imageURL("latest"), "", "", RegistryOptions{InsecureTLS: true})
+		Expect(err).NotTo(HaveOccurred())
 		result, err := ds.Info()
 		Expect(err).NotTo(HaveOccurred())
-		Expect(ProcessingPhaseTransferScratch).To(Equal(result))
+		Expect(result).To(Equal(ProcessingPhaseTransferDataFile))
+		result, err = ds.TransferFile(filepath.Join(tmpDir, "disk.img"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).To(Equal(ProcessingPhaseResize))
+		data, err := ioutil.ReadFile(filepath.Join(tmpDir, "disk.img"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(data).To(Equal(rawDisk))
+		// The top layer is read up to the disk image to find it, then the base layer is checked before the disk image
+		// is read
+		Expect(registry.requestedBlobs()).To(Equal([]string{testDigest(top), testDigest(base), testDigest(top)}))
+		Expect(ds.ImageDigest()).To(Equal(digest))
 	})
 
-	table.DescribeTable("Transfer should ", func(ep, accKey, secKey, certDir, scratchPath string, insecureRegistry bool, skopeoOperations image.SkopeoOperations, wantErr bool) {
-		if scratchPath == "" {
-			scratchPath = tmpDir
-		}
-		ds = NewRegistryDataSource(ep, accKey, secKey, certDir, insecureRegistry)
-		By("Replacing Skopeo Operations")
-		replaceSkopeoOperations(skopeoOperations, func() {
-			// Need to pass in a real path if we don't want scratch space needed error.
-			result, err := ds.Transfer(scratchPath)
-			if !wantErr {
-				Expect(err).NotTo(HaveOccurred())
-				Expect(ProcessingPhaseProcess).To(Equal(result))
-				Expect(filepath.Join(scratchPath, containerDiskImageDir)).To(Equal(ds.imageDir))
-			} else {
-				Expect(err).To(HaveOccurred())
-				Expect(ProcessingPhaseError).To(Equal(result))
-			}
+	It("Should import an image referenced by digest", func() {
+		digest := registry.addImage("", createTestLayer(true, testLayerFile{name: "disk/disk.img", data: rawDisk}))
+		var err error
+		ds, err = NewRegistryDataSource(registry.imageURL(digest), "", "", RegistryOptions{InsecureTLS: true})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ds.ImageDigest()).To(Equal(digest))
+		Expect(ds.size).To(Equal(uint64(len(rawDisk))))
+	})
+
+	It("Should import the image of the platform of a multi-arch image", func() {
+		amd64 := registry.addImage("", createTestLayer(true, testLayerFile{name: "disk/disk.img", data: []byte("amd64")}))
+		arm64 := registry.addImage("", createTestLayer(true, testLayerFile{name: "disk/disk.img", data: rawDisk}))
+		list := registry.addManifest("latest", "application/vnd.docker.distribution.manifest.list.v2+json", map[string]interface{}{
+			"schemaVersion": 2,
+			"manifests": []map[string]interface{}{
+				{"digest": amd64, "platform": map[string]string{"os": "linux", "architecture": "amd64"}},
+				{"digest": arm64, "platform": map[string]string{"os": "linux", "architecture": "arm64", "variant": "v8"}},
+			},
 		})
+		var err error
+		ds, err = NewRegistryDataSource(registry.imageURL("latest"), "", "", RegistryOptions{InsecureTLS: true, Platform: "linux/arm64"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ds.size).To(Equal(uint64(len(rawDisk))))
+		Expect(ds.ImageDigest()).To(Equal(list))
+	})
+
+	It("Should return an error if the platform is invalid", func() {
+		registry.addImage("latest", createTestLayer(true, testLayerFile{name: "disk/disk.img", data: rawDisk}))
+		_, err := NewRegistryDataSource(registry.imageURL("latest"), "", "", RegistryOptions{InsecureTLS: true, Platform: "linux/arm/v7/extra"})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Should decompress a compressed raw disk image in an uncompressed layer", func() {
+		var compressed bytes.Buffer
+		gz := gzip.NewWriter(&compressed)
+		gz.Write(rawDisk)
+		gz.Close()
+		registry.addImage("latest", base, createTestLayer(false, testLayerFile{name: "./disk/disk.img.gz", data: compressed.Bytes()}))
+		var err error
+		ds, err = NewRegistryDataSource(registry.imageURL("latest"), "", "", RegistryOptions{InsecureTLS: true})
+		Expect(err).NotTo(HaveOccurred())
+		result, err := ds.Info()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).To(Equal(ProcessingPhaseTransferDataFile))
+		_, err = ds.TransferFile(filepath.Join(tmpDir, "disk.img"))
+		Expect(err).NotTo(HaveOccurred())
+		data, err := ioutil.ReadFile(filepath.Join(tmpDir, "disk.img"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(data).To(Equal(rawDisk))
+	})
+
+	It("Should store a disk image that has to be converted in scratch space", func() {
+		registry.addImage("latest", base, createTestLayer(true, testLayerFile{name: "disk/disk.qcow2", data: qcowDisk}))
+		var err error
+		ds, err = NewRegistryDataSource(registry.imageURL("latest"), "", "", RegistryOptions{InsecureTLS: true})
+		Expect(err).NotTo(HaveOccurred())
+		result, err := ds.Info()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).To(Equal(ProcessingPhaseTransferScratch))
+		result, err = ds.Transfer(tmpDir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).To(Equal(ProcessingPhaseProcess))
+		data, err := ioutil.ReadFile(filepath.Join(tmpDir, tempFile))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(data).To(Equal(qcowDisk))
+		result, err = ds.Process()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).To(Equal(ProcessingPhaseConvert))
+		Expect(ds.GetURL()).To(Equal(&url.URL{Path: filepath.Join(tmpDir, tempFile)}))
+	})
+
+	It("Should return an error on an invalid scratch space", func() {
+		registry.addImage("latest", createTestLayer(true, testLayerFile{name: "disk/disk.qcow2", data: qcowDisk}))
+		var err error
+		ds, err = NewRegistryDataSource(registry.imageURL("latest"), "", "", RegistryOptions{InsecureTLS: true})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = ds.Info()
+		Expect(err).NotTo(HaveOccurred())
+		result, err := ds.Transfer("/invalid")
+		Expect(err).To(Equal(ErrInvalidPath))
+		Expect(result).To(Equal(ProcessingPhaseError))
+	})
+
+	It("Should skip the disk images removed by the upper layers", func() {
+		lower := createTestLayer(true,
+			testLayerFile{name: "disk/a.img", data: []byte("removed")},
+			testLayerFile{name: "disk/b.img", data: rawDisk})
+		upper := createTestLayer(true, testLayerFile{name: "disk/.wh.a.img"}, testLayerFile{name: "etc/motd", data: []byte("hi")})
+		registry.addImage("latest", lower, upper)
+		var err error
+		ds, err = NewRegistryDataSource(registry.imageURL("latest"), "", "", RegistryOptions{InsecureTLS: true})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = ds.Info()
+		Expect(err).NotTo(HaveOccurred())
+		_, err = ds.TransferFile(filepath.Join(tmpDir, "disk.img"))
+		Expect(err).NotTo(HaveOccurred())
+		data, err := ioutil.ReadFile(filepath.Join(tmpDir, "disk.img"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(data).To(Equal(rawDisk))
+	})
+
+	It("Should use a disk image added in the layer that removed the disk directory", func() {
+		lower := createTestLayer(true, testLayerFile{name: "disk/old.img", data: []byte("removed")})
+		upper := createTestLayer(true, testLayerFile{name: "disk/.wh..wh..opq"}, testLayerFile{name: "disk/new.img", data: rawDisk})
+		registry.addImage("latest", lower, upper)
+		var err error
+		ds, err = NewRegistryDataSource(registry.imageURL("latest"), "", "", RegistryOptions{InsecureTLS: true})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ds.size).To(Equal(uint64(len(rawDisk))))
+	})
+
+	It("Should return an error if the disk directory was removed", func() {
+		lower := createTestLayer(true, testLayerFile{name: "disk/disk.img", data: rawDisk})
+		upper := createTestLayer(true, testLayerFile{name: ".wh.disk"})
+		registry.addImage("latest", lower, upper)
+		_, err := NewRegistryDataSource(registry.imageURL("latest"), "", "", RegistryOptions{InsecureTLS: true})
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("no disk image found"))
+	})
+
+	It("Should return an error if the image has no disk image", func() {
+		registry.addImage("latest", base)
+		_, err := NewRegistryDataSource(registry.imageURL("latest"), "", "", RegistryOptions{InsecureTLS: true})
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("no disk image found"))
+	})
+
+	table.DescribeTable("Should import the disk image matching the disk path", func(diskPath string) {
+		registry.addImage("latest", base, createTestLayer(true,
+			testLayerFile{name: "disk/README.md", data: []byte("readme")},
+			testLayerFile{name: "disk/vendor-a.qcow2", data: []byte("other")},
+			testLayerFile{name: "disk/vendor-b.img", data: rawDisk},
+			testLayerFile{name: "images/tools.iso", data: []byte("tools")}))
+		var err error
+		ds, err = NewRegistryDataSource(registry.imageURL("latest"), "", "", RegistryOptions{InsecureTLS: true, DiskPath: diskPath})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = ds.Info()
+		Expect(err).NotTo(HaveOccurred())
+		_, err = ds.TransferFile(filepath.Join(tmpDir, "disk.img"))
+		Expect(err).NotTo(HaveOccurred())
+		data, err := ioutil.ReadFile(filepath.Join(tmpDir, "disk.img"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(data).To(Equal(rawDisk))
 	},
-		table.Entry("successfully return Process on valid scratch space and empty user parameters", "endpoint", "", "", "", "", true, NewFakeSkopeoOperations("endpoint", "", "", "", true, nil), false),
-		table.Entry("successfully return Process on valid scratch space and parameters", "endpoint", "username", "password", "/path/to/cert", "", true, NewFakeSkopeoOperations("endpoint", "username", "password", "/path/to/cert", true, nil), false),
-		table.Entry("return Error on invalid scratch space", "endpoint", "", "", "", "/invalid", true, NewFakeSkopeoOperations("endpoint", "", "", "", true, nil), true),
-		table.Entry("return Error on valid scratch space, but CopyImage failed", "endpoint", "", "", "", "", true, NewSkopeoAllErrors(), true),
+		table.Entry("with a path", "disk/vendor-b.img"),
+		table.Entry("with an absolute path", "/disk/vendor-b.img"),
+		table.Entry("with a pattern", "disk/*.img"),
+		table.Entry("with a pattern of a character class", "disk/vendor-[b-z].*"),
 	)
 
-	table.DescribeTable("Process should ", func(scratchPath string, wantErr bool) {
-		ds = NewRegistryDataSource("", "", "", "", true)
-		if scratchPath == "" {
-			scratchPath = tmpDir
-			err := os.Mkdir(filepath.Join(scratchPath, containerDiskImageDir), os.ModeDir)
-			Expect(err).NotTo(HaveOccurred())
-			err = util.CopyFile(cirrosFilePath, filepath.Join(scratchPath, containerDiskImageDir, cirrosFileName))
-			Expect(err).NotTo(HaveOccurred())
-		}
-		ds.imageDir = filepath.Join(scratchPath, containerDiskImageDir)
-		result, err := ds.Process()
-		if !wantErr {
-			Expect(err).NotTo(HaveOccurred())
-			Expect(ProcessingPhaseConvert).To(Equal(result))
-			imageFileName, err := url.Parse(filepath.Join(scratchPath, containerDiskImageDir, cirrosFileName))
-			Expect(err).NotTo(HaveOccurred())
-			Expect(imageFileName).To(Equal(ds.GetURL()))
-		} else {
-			Expect(err).To(HaveOccurred())
-			Expect(ProcessingPhaseError).To(Equal(result))
-		}
+	table.DescribeTable("Should return an error if more than one file matches the disk path", func(diskPath string, files ...testLayerFile) {
+		registry.addImage("latest", base, createTestLayer(true, files...))
+		var err error
+		ds, err = NewRegistryDataSource(registry.imageURL("latest"), "", "", RegistryOptions{InsecureTLS: true, DiskPath: diskPath})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = ds.Info()
+		Expect(err).NotTo(HaveOccurred())
+		_, err = ds.TransferFile(filepath.Join(tmpDir, "disk.img"))
+		Expect(err).To(HaveOccurred())
+		Expect(errors.Cause(err)).To(Equal(ErrAmbiguousDiskImage))
+		Expect(err.Error()).To(ContainSubstring("disk/a.img and disk/b"))
 	},
-		table.Entry("successfully return Convert on valid image file", "", false),
-		table.Entry("return Error on invalid image file", "/invalid", true),
+		table.Entry("with a pattern", "disk/*.img", testLayerFile{name: "disk/a.img", data: rawDisk}, testLayerFile{name: "disk/b.img", data: rawDisk}),
+		table.Entry("with a file besides the disk image in the disk directory", "", testLayerFile{name: "disk/a.img", data: rawDisk}, testLayerFile{name: "disk/b.txt", data: []byte("readme")}),
 	)
 
-	It("TransferFile should not be called", func() {
-		ds = NewRegistryDataSource("", "", "", "", true)
-		result, err := ds.TransferFile("file")
+	It("Should return an error before reading the disk image if a file of a lower layer matches the disk path", func() {
+		lower := createTestLayer(true, testLayerFile{name: "disk/old.img", data: []byte("old")})
+		upper := createTestLayer(true, testLayerFile{name: "disk/new.img", data: rawDisk})
+		registry.addImage("latest", lower, upper)
+		_, err := NewRegistryDataSource(registry.imageURL("latest"), "", "", RegistryOptions{InsecureTLS: true, DiskPath: "disk/*.img"})
 		Expect(err).To(HaveOccurred())
-		Expect(ProcessingPhaseError).To(Equal(result))
+		Expect(errors.Cause(err)).To(Equal(ErrAmbiguousDiskImage))
+		Expect(err.Error()).To(ContainSubstring("disk/new.img and disk/old.img"))
 	})
 
-	It("getImageFileName should return an error with non-existing image directory", func() {
-		_, err := getImageFileName("/invalid")
+	It("Should return an error if the disk image of a lower layer is next to a file of an upper layer", func() {
+		lower := createTestLayer(true, testLayerFile{name: "disk/disk.img", data: rawDisk})
+		upper := createTestLayer(true, testLayerFile{name: "disk/README.md", data: []byte("readme")})
+		registry.addImage("latest", lower, upper)
+		_, err := NewRegistryDataSource(registry.imageURL("latest"), "", "", RegistryOptions{InsecureTLS: true})
 		Expect(err).To(HaveOccurred())
-		Expect("image directory does not exist").To(Equal(err.Error()))
+		Expect(errors.Cause(err)).To(Equal(ErrAmbiguousDiskImage))
 	})
 
-	It("getImageFileName should return an error with invalid image directory", func() {
-		file, err := os.Create(filepath.Join(tmpDir, "test"))
+	It("Should ignore the files of the lower layers removed by the layer of the disk image", func() {
+		lower := createTestLayer(true, testLayerFile{name: "disk/old.img", data: []byte("old")})
+		// The whiteout follows the disk image, it is only found once the whole layer is read
+		upper := createTestLayer(true, testLayerFile{name: "disk/new.img", data: rawDisk}, testLayerFile{name: "disk/.wh.old.img"})
+		registry.addImage("latest", lower, upper)
+		var err error
+		ds, err = NewRegistryDataSource(registry.imageURL("latest"), "", "", RegistryOptions{InsecureTLS: true, DiskPath: "disk/*.img"})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = ds.Info()
 		Expect(err).NotTo(HaveOccurred())
-		_, err = getImageFileName(file.Name())
+		_, err = ds.TransferFile(filepath.Join(tmpDir, "disk.img"))
+		Expect(err).NotTo(HaveOccurred())
+		data, err := ioutil.ReadFile(filepath.Join(tmpDir, "disk.img"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(data).To(Equal(rawDisk))
+	})
+
+	It("Should return an error if no file matches the disk path", func() {
+		registry.addImage("latest", base, createTestLayer(true, testLayerFile{name: "disk/disk.img", data: rawDisk}))
+		_, err := NewRegistryDataSource(registry.imageURL("latest"), "", "", RegistryOptions{InsecureTLS: true, DiskPath: "disk/*.qcow2"})
 		Expect(err).To(HaveOccurred())
-		Expect(strings.Contains(err.Error(), "image file does not exist in image directory")).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring(`no disk image matching "disk/*.qcow2"`))
 	})
 
-	It("getImageFileName should return an error with empty image directory", func() {
-		err := os.Mkdir(filepath.Join(tmpDir, containerDiskImageDir), os.ModeDir)
-		Expect(err).NotTo(HaveOccurred())
-		_, err = getImageFileName(filepath.Join(tmpDir, containerDiskImageDir))
+	It("Should return an error if the disk path is an invalid pattern", func() {
+		registry.addImage("latest", base, createTestLayer(true, testLayerFile{name: "disk/disk.img", data: rawDisk}))
+		_, err := NewRegistryDataSource(registry.imageURL("latest"), "", "", RegistryOptions{InsecureTLS: true, DiskPath: "disk/[a"})
 		Expect(err).To(HaveOccurred())
-		Expect("image file does not exist in image directory - directory is empty").To(Equal(err.Error()))
+		Expect(err.Error()).To(ContainSubstring("invalid disk path"))
 	})
 
-	It("getImageFileName should return an error with image directory containing another directory", func() {
-		err := os.Mkdir(filepath.Join(tmpDir, containerDiskImageDir), os.ModeDir)
+	It("Should return an error if the layer of the disk image does not match its digest", func() {
+		layer := createTestLayer(false, testLayerFile{name: "disk/disk.img", data: rawDisk})
+		digest := registry.addImage("latest", layer)
+		manifest := &registryManifest{}
+		Expect(json.Unmarshal(registry.manifests[digest].data, manifest)).To(Succeed())
+		// Append data after the end of the archive, it is read once the disk image has been read
+		registry.blobs[manifest.Layers[0].Digest] = append(layer, make([]byte, 1024)...)
+		var err error
+		ds, err = NewRegistryDataSource(registry.imageURL("latest"), "", "", RegistryOptions{InsecureTLS: true})
 		Expect(err).NotTo(HaveOccurred())
-		err = os.Mkdir(filepath.Join(tmpDir, containerDiskImageDir, "anotherdir"), os.ModeDir)
+		_, err = ds.Info()
 		Expect(err).NotTo(HaveOccurred())
-		_, err = getImageFileName(filepath.Join(tmpDir, containerDiskImageDir))
+		_, err = ds.TransferFile(filepath.Join(tmpDir, "disk.img"))
 		Expect(err).To(HaveOccurred())
-		Expect("image directory contains another directory").To(Equal(err.Error()))
+		Expect(err.Error()).To(ContainSubstring("does not match"))
 	})
 
-	It("getImageFileName should return an error with zero length filename", func() {
-		err := os.Mkdir(filepath.Join(tmpDir, containerDiskImageDir), os.ModeDir)
-		Expect(err).NotTo(HaveOccurred())
-		_, err = os.Create(filepath.Join(tmpDir, containerDiskImageDir, " "))
+	It("Should read the layers of a schema 1 manifest from the top", func() {
+		lower := registry.addBlob(createTestLayer(true, testLayerFile{name: "disk/disk.img", data: []byte("lower")}))
+		upper := registry.addBlob(createTestLayer(true, testLayerFile{name: "disk/disk.img", data: rawDisk}))
+		registry.addManifest("v1", "application/vnd.docker.distribution.manifest.v1+prettyjws", map[string]interface{}{
+			"schemaVersion": 1,
+			"fsLayers":      []map[string]string{{"blobSum": upper}, {"blobSum": lower}},
+		})
+		var err error
+		ds, err = NewRegistryDataSource(registry.imageURL("v1"), "", "", RegistryOptions{InsecureTLS: true})
 		Expect(err).NotTo(HaveOccurred())
-		_, err = getImageFileName(filepath.Join(tmpDir, containerDiskImageDir))
-		Expect(err).To(HaveOccurred())
-		Expect("image file does has no name").To(Equal(err.Error()))
+		Expect(ds.size).To(Equal(uint64(len(rawDisk))))
+		Expect(registry.requestedBlobs()).To(Equal([]string{upper, lower, upper}))
 	})
 })
 
-type fakeSkopeoOperations struct {
-	ep               string
-	accKey           string
-	secKey           string
-	certDir          string
-	insecureRegistry bool
-	e1               error
+// fakeRegistry is a registry serving the images of a single repository, with the docker registry HTTP API V2.
+type fakeRegistry struct {
+	server *httptest.Server
+	// the manifests, by tag and digest
+	manifests map[string]fakeManifest
+	blobs     map[string][]byte
+	// the authentication the registry requires, empty, basic or bearer
+	auth     string
+	username string
+	password string
+	// the number of tokens that were issued, only the last one is valid
+	tokens int
+	mutex  sync.Mutex
+	// the digests of the blobs that were requested
+	blobRequests []string
+}
+
+type fakeManifest struct {
+	mediaType string
+	data      []byte
+}
+
+// testLayerFile is a file of a layer, a name ending with a slash is a directory.
+type testLayerFile struct {
+	name string
+	data []byte
+}
+
+func newFakeRegistry(secure bool) *fakeRegistry {
+	r := &fakeRegistry{
+		manifests: map[string]fakeManifest{},
+		blobs:     map[string][]byte{},
+	}
+	if secure {
+		r.server = httptest.NewTLSServer(r)
+	} else {
+		r.server = httptest.NewServer(r)
+	}
+	return r
+}
+
+func (r *fakeRegistry) close() {
+	r.server.Close()
+}
+
+// imageURL returns the url of the image with the passed in tag, or digest.
+func (r *fakeRegistry) imageURL(reference string) string {
+	separator := ":"
+	if strings.HasPrefix(reference, "sha256:") {
+		separator = "@"
+	}
+	return registryURLPrefix + r.server.Listener.Addr().String() + "/" + testRegistryRepository + separator + reference
+}
+
+func testDigest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
 }
 
-func replaceSkopeoOperations(replacement image.SkopeoOperations, f func()) {
-	orig := image.SkopeoInterface
-	if replacement != nil {
-		image.SkopeoInterface = replacement
-		defer func() { image.SkopeoInterface = orig }()
+// addBlob adds a blob to the registry and returns its digest.
+func (r *fakeRegistry) addBlob(data []byte) string {
+	digest := testDigest(data)
+	r.blobs[digest] = data
+	return digest
+}
+
+// addManifest adds a manifest with the passed in tag and returns its digest.
+func (r *fakeRegistry) addManifest(tag, mediaType string, manifest interface{}) string {
+	data, err := json.Marshal(manifest)
+	Expect(err).NotTo(HaveOccurred())
+	digest := testDigest(data)
+	r.manifests[digest] = fakeManifest{mediaType: mediaType, data: data}
+	if tag != "" {
+		r.manifests[tag] = r.manifests[digest]
+	}
+	return digest
+}
+
+// addImage adds an image with the passed in layers, from the bottom layer up, and returns the digest of its manifest.
+func (r *fakeRegistry) addImage(tag string, layers ...[]byte) string {
+	var descriptors []map[string]interface{}
+	for _, layer := range layers {
+		descriptors = append(descriptors, map[string]interface{}{
+			"mediaType": testDockerLayerType,
+			"size":      len(layer),
+			"digest":    r.addBlob(layer),
+		})
 	}
-	f()
+	return r.addManifest(tag, testDockerManifestType, map[string]interface{}{
+		"schemaVersion": 2,
+		"mediaType":     testDockerManifestType,
+		"layers":        descriptors,
+	})
+}
+
+func (r *fakeRegistry) requestedBlobs() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]string(nil), r.blobRequests...)
 }
 
-func NewSkopeoAllErrors() image.SkopeoOperations {
-	err := errors.New("skopeo should not be called from this test override with replaceSkopeoOperations")
-	return &fakeSkopeoOperations{
-		e1: err,
+func (r *fakeRegistry) authorized(req *http.Request) bool {
+	switch r.auth {
+	case "basic":
+		username, password, ok := req.BasicAuth()
+		return ok && username == r.username && password == r.password
+	case "bearer":
+		return req.Header.Get("Authorization") == fmt.Sprintf("Bearer token-%d", r.tokens)
 	}
+	return true
 }
 
-func NewFakeSkopeoOperations(ep, accKey, secKey, certDir string, insecureRegistry bool, e1 error) image.SkopeoOperations {
-	return &fakeSkopeoOperations{
-		ep:               ep,
-		accKey:           accKey,
-		secKey:           secKey,
-		certDir:          certDir,
-		insecureRegistry: insecureRegistry,
-		e1:               e1,
+func (r *fakeRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if req.URL.Path == "/token" {
+		username, password, _ := req.BasicAuth()
+		if username != r.username || password != r.password ||
+			req.URL.Query().Get("scope") != "repository:"+testRegistryRepository+":pull" || req.URL.Query().Get("service") != "fake-registry" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		r.tokens++
+		fmt.Fprintf(w, `{"token": "token-%d"}`, r.tokens)
+		return
+	}
+	if !r.authorized(req) {
+		if r.auth == "basic" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="fake-registry"`)
+		} else {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="fake-registry"`, r.server.URL))
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+		return
 	}
+	if req.URL.Path == "/v2/" {
+		return
+	}
+	path := strings.TrimPrefix(req.URL.Path, "/v2/"+testRegistryRepository+"/")
+	if strings.HasPrefix(path, "manifests/") {
+		if manifest, ok := r.manifests[strings.TrimPrefix(path, "manifests/")]; ok {
+			w.Header().Set("Content-Type", manifest.mediaType)
+			w.Write(manifest.data)
+			return
+		}
+	} else if strings.HasPrefix(path, "blobs/") {
+		digest := strings.TrimPrefix(path, "blobs/")
+		if blob, ok := r.blobs[digest]; ok {
+			r.blobRequests = append(r.blobRequests, digest)
+			w.Write(blob)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNotFound)
 }
 
-func (o *fakeSkopeoOperations) CopyImage(url, dest, accessKey, secKey, certDir string, insecureRegistry bool) error {
-	if o.e1 != nil {
-		return o.e1
+// createTestLayer returns a layer with the passed in files, compressed with gzip if compress is true.
+func createTestLayer(compress bool, files ...testLayerFile) []byte {
+	var layer bytes.Buffer
+	tw := tar.NewWriter(&layer)
+	for _, file := range files {
+		hdr := &tar.Header{Name: file.name, Mode: 0644, Size: int64(len(file.data)), Typeflag: tar.TypeReg}
+		if strings.HasSuffix(file.name, "/") {
+			hdr.Mode = 0755
+			hdr.Typeflag = tar.TypeDir
+		}
+		Expect(tw.WriteHeader(hdr)).To(Succeed())
+		_, err := tw.Write(file.data)
+		Expect(err).NotTo(HaveOccurred())
 	}
-	dest = filepath.Dir(dest)
-	dest = strings.Replace(dest, "dir:", "", 1)
-	if err := util.UnArchiveLocalTar(imageFile, dest); err != nil {
-		return errors.Wrap(err, "could not extract layer tar")
+	Expect(tw.Close()).To(Succeed())
+	if !compress {
+		return layer.Bytes()
 	}
-	Expect(o.ep).To(Equal(url))
-	Expect(o.accKey).To(Equal(accessKey))
-	Expect(o.secKey).To(Equal(secKey))
-	Expect(o.certDir).To(Equal(certDir))
-	Expect(o.insecureRegistry).To(Equal(insecureRegistry))
-	return nil
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	_, err := gz.Write(layer.Bytes())
+	Expect(err).NotTo(HaveOccurred())
+	Expect(gz.Close()).To(Succeed())
+	return compressed.Bytes()
 }
@@ -0,0 +1,174 @@
+/*
+Copyright 2020 The CDI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package importer
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	minio "github.com/minio/minio-go"
+	"github.com/pkg/errors"
+
+	"k8s.io/klog"
+
+	"kubevirt.io/containerized-data-importer/pkg/common"
+)
+
+// RetryOptions are the settings of the retries of the requests to a source that fail with a transient error, like a
+// timeout, a reset connection or a 5xx status.
+type RetryOptions struct {
+	// Retries is the number of times a request is retried, 0 disables the retries
+	Retries int
+	// Backoff is the delay before the first retry, it doubles with every retry
+	Backoff time.Duration
+	// MaxBackoff is the longest delay between two retries
+	MaxBackoff time.Duration
+}
+
+var (
+	retryOptions = RetryOptions{
+		Retries:    common.DefaultImportRetries,
+		Backoff:    common.DefaultImportRetryBackoff,
+		MaxBackoff: common.DefaultImportRetryMaxBackoff,
+	}
+	// the number of retries of all the data sources, updated atomically
+	retryCount int32
+	// sleepFunc waits for the backoff of a retry
+	sleepFunc = time.Sleep
+)
+
+// httpStatusError is returned when a source responds to a request with an unexpected status code.
+type httpStatusError struct {
+	code    int
+	message string
+}
+
+func (e *httpStatusError) Error() string {
+	return e.message
+}
+
+// newHTTPStatusError returns an httpStatusError of the passed in status code, with a stack trace like the errors of
+// errors.Errorf.
+func newHTTPStatusError(code int, format string, args ...interface{}) error {
+	return errors.WithStack(&httpStatusError{code: code, message: fmt.Sprintf(format, args...)})
+}
+
+// SetRetryOptions sets how the data sources retry the requests to their source. Negative values are replaced with 0.
+func SetRetryOptions(options RetryOptions) {
+	if options.Retries < 0 {
+		options.Retries = 0
+	}
+	if options.Backoff < 0 {
+		options.Backoff = 0
+	}
+	if options.MaxBackoff < options.Backoff {
+		options.MaxBackoff = options.Backoff
+	}
+	retryOptions = options
+}
+
+// RetryCount returns the number of times the data sources retried a request to their source.
+func RetryCount() int {
+	return int(atomic.LoadInt32(&retryCount))
+}
+
+// retry calls fn until it succeeds, it returns an error that is not retryable, or the retries are used up. The delay
+// between two attempts starts at the backoff of the retry options and doubles every time, up to the max backoff.
+func retry(description string, fn func() error) error {
+	backoff := retryOptions.Backoff
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || !isRetryableError(err) {
+			return err
+		}
+		if attempt >= retryOptions.Retries {
+			if attempt > 0 {
+				return errors.Wrapf(err, "%s failed after %d attempts", description, attempt+1)
+			}
+			return err
+		}
+		atomic.AddInt32(&retryCount, 1)
+		klog.Warningf("%s failed, retrying in %s: %v\n", description, backoff, err)
+		sleepFunc(backoff)
+		backoff *= 2
+		if backoff > retryOptions.MaxBackoff {
+			backoff = retryOptions.MaxBackoff
+		}
+	}
+}
+
+// isRetryableError returns true if the error is transient, so the request that failed with it may succeed if it is
+// sent again. Timeouts, connections that were refused, reset or closed early, and the 408, 429 and 5xx status codes
+// are transient. Anything else, like a 401 or 404 status code, or a checksum mismatch, is fatal.
+func isRetryableError(err error) bool {
+	for err != nil {
+		switch e := err.(type) {
+		case *httpStatusError:
+			return isRetryableStatus(e.code)
+		case minio.ErrorResponse:
+			// The status code of the error is only set if the object store responded
+			if e.StatusCode != 0 {
+				return isRetryableStatus(e.StatusCode)
+			}
+		}
+		switch err {
+		case io.EOF, io.ErrUnexpectedEOF, syscall.ECONNRESET, syscall.ECONNREFUSED, syscall.ECONNABORTED, syscall.EPIPE, syscall.ETIMEDOUT:
+			return true
+		case ErrChecksumMismatch, ErrAmbiguousDiskImage:
+			return false
+		}
+		if t, ok := err.(interface{ Timeout() bool }); ok && t.Timeout() {
+			return true
+		}
+		err = unwrapError(err)
+	}
+	return false
+}
+
+// isRetryableStatus returns true if a request that failed with the passed in status code may succeed later.
+func isRetryableStatus(code int) bool {
+	switch code {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// unwrapError returns the error the passed in error wraps, like the cause of an error of the errors package, or the
+// error of a failed http request, network operation or system call. It returns nil if the error does not wrap another
+// error.
+func unwrapError(err error) error {
+	switch e := err.(type) {
+	case interface{ Cause() error }:
+		return e.Cause()
+	case *url.Error:
+		return e.Err
+	case *net.OpError:
+		return e.Err
+	case *os.SyscallError:
+		return e.Err
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package importer
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"syscall"
+	"time"
+
+	minio "github.com/minio/minio-go"
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+
+	cdiv1 "kubevirt.io/containerized-data-importer/pkg/apis/core/v1alpha1"
+)
+
+var _ = Describe("Retry", func() {
+	table.DescribeTable("should classify", func(err error, retryable bool) {
+		Expect(isRetryableError(err)).To(Equal(retryable))
+	},
+		table.Entry("a 503 status as retryable", newHTTPStatusError(http.StatusServiceUnavailable, "unavailable"), true),
+		table.Entry("a 429 status as retryable", errors.Wrap(newHTTPStatusError(http.StatusTooManyRequests, "slow down"), "request failed"), true),
+		table.Entry("a 401 status as fatal", newHTTPStatusError(http.StatusUnauthorized, "unauthorized"), false),
+		table.Entry("a 404 status as fatal", errors.Wrap(newHTTPStatusError(http.StatusNotFound, "not found"), "request failed"), false),
+		table.Entry("a 500 s3 error as retryable", errors.Wrap(minio.ErrorResponse{Code: "InternalError", StatusCode: 500}, "stat failed"), true),
+		table.Entry("a 403 s3 error as fatal", minio.ErrorResponse{Code: "AccessDenied", StatusCode: 403}, false),
+		table.Entry("a reset connection as retryable", errors.Wrap(&url.Error{Op: "Get", URL: "http://source", Err: &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}}, "HTTP request errored"), true),
+		table.Entry("a refused connection as retryable", &url.Error{Op: "Get", URL: "http://source", Err: &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}}, true),
+		table.Entry("a connection closed early as retryable", &url.Error{Op: "Get", URL: "http://source", Err: io.EOF}, true),
+		table.Entry("a timeout as retryable", errors.Wrap(&url.Error{Op: "Get", URL: "http://source", Err: context.DeadlineExceeded}, "HTTP request errored"), true),
+		table.Entry("a checksum mismatch as fatal", errors.Wrap(ErrChecksumMismatch, "transfer failed"), false),
+		table.Entry("a cancelled request as fatal", &url.Error{Op: "Get", URL: "http://source", Err: context.Canceled}, false),
+		table.Entry("any other error as fatal", errors.New("invalid endpoint"), false),
+	)
+
+	It("should retry a transient error until the request succeeds", func() {
+		retries := RetryCount()
+		attempts := 0
+		err := retry("request", func() error {
+			attempts++
+			if attempts < 3 {
+				return newHTTPStatusError(http.StatusBadGateway, "bad gateway")
+			}
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(attempts).To(Equal(3))
+		Expect(RetryCount() - retries).To(Equal(2))
+	})
+
+	It("should give up once the retries are used up", func() {
+		attempts := 0
+		err := retry("request", func() error {
+			attempts++
+			return newHTTPStatusError(http.StatusServiceUnavailable, "unavailable")
+		})
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("request failed after 3 attempts: unavailable"))
+		Expect(attempts).To(Equal(3))
+	})
+
+	It("should not retry a fatal error", func() {
+		attempts := 0
+		err := retry("request", func() error {
+			attempts++
+			return newHTTPStatusError(http.StatusNotFound, "not found")
+		})
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(Equal("not found"))
+		Expect(attempts).To(Equal(1))
+	})
+
+	It("should double the backoff up to the max backoff", func() {
+		defer SetRetryOptions(retryOptions)
+		defer func() { sleepFunc = time.Sleep }()
+		SetRetryOptions(RetryOptions{Retries: 4, Backoff: time.Second, MaxBackoff: 5 * time.Second})
+		var backoffs []time.Duration
+		sleepFunc = func(d time.Duration) {
+			backoffs = append(backoffs, d)
+		}
+		retry("request", func() error {
+			return newHTTPStatusError(http.StatusServiceUnavailable, "unavailable")
+		})
+		Expect(backoffs).To(Equal([]time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second}))
+	})
+
+	It("should not retry if the retries are disabled", func() {
+		defer SetRetryOptions(retryOptions)
+		SetRetryOptions(RetryOptions{Retries: -1})
+		attempts := 0
+		err := retry("request", func() error {
+			attempts++
+			return newHTTPStatusError(http.StatusServiceUnavailable, "unavailable")
+		})
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(Equal("unavailable"))
+		Expect(attempts).To(Equal(1))
+	})
+
+	Context("of an http source", func() {
+		var (
+			ts       *httptest.Server
+			requests int
+			failures int
+			status   int
+			dp       *HTTPDataSource
+		)
+
+		BeforeEach(func() {
+			requests = 0
+			dp = nil
+			ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				if requests <= failures {
+					w.WriteHeader(status)
+					return
+				}
+				w.Write([]byte("hello"))
+			}))
+		})
+
+		AfterEach(func() {
+			ts.Close()
+			if dp != nil {
+				dp.Close()
+			}
+		})
+
+		It("should open the source after a 503 status", func() {
+			failures, status = 1, http.StatusServiceUnavailable
+			var err error
+			dp, err = NewHTTPDataSource(ts.URL, "", "", cdiv1.DataVolumeKubeVirt, HTTPOptions{})
+			Expect(err).NotTo(HaveOccurred())
+			data, err := ioutil.ReadAll(dp.httpReader)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(data)).To(Equal("hello"))
+			// The failed HEAD, then the HEAD and the GET of the retry
+			Expect(requests).To(Equal(3))
+		})
+
+		It("should fail without a retry on a 404 status", func() {
+			failures, status = 10, http.StatusNotFound
+			var err error
+			dp, err = NewHTTPDataSource(ts.URL, "", "", cdiv1.DataVolumeKubeVirt, HTTPOptions{})
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("expected status code 200, got 404"))
+			Expect(requests).To(Equal(1))
+		})
+	})
+})
@@ -1,26 +1,77 @@
 package importer
 
 import (
+	"encoding/xml"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"net/http"
 	"net/url"
 	"path/filepath"
 	"strings"
 
 	minio "github.com/minio/minio-go"
+	"github.com/minio/minio-go/pkg/credentials"
 	"github.com/pkg/errors"
 
 	"k8s.io/klog"
 
+	cdiv1 "kubevirt.io/containerized-data-importer/pkg/apis/core/v1alpha1"
 	"kubevirt.io/containerized-data-importer/pkg/common"
 	"kubevirt.io/containerized-data-importer/pkg/util"
 )
 
 // S3Client is the interface to the used S3 client.
 type S3Client interface {
-	GetObject(bucketName, objectName string, opts minio.GetObjectOptions) (*minio.Object, error)
+	GetObject(bucketName, objectName string, opts minio.GetObjectOptions) (S3Object, error)
 }
 
+// S3Object is the interface to an object of the used S3 client. The object is only requested by the first call to
+// Read or Stat.
+type S3Object interface {
+	io.ReadCloser
+	Stat() (minio.ObjectInfo, error)
+}
+
+// minioClient is the S3Client of a minio client.
+type minioClient struct {
+	*minio.Client
+}
+
+// GetObject returns the object of the minio client.
+func (c *minioClient) GetObject(bucketName, objectName string, opts minio.GetObjectOptions) (S3Object, error) {
+	object, err := c.Client.GetObject(bucketName, objectName, opts)
+	if err != nil {
+		return nil, err
+	}
+	return object, nil
+}
+
+// S3Options are the settings of the object store an S3 source is imported from.
+type S3Options struct {
+	// Endpoint is the host and optional port of the object store, defaults to s3.amazonaws.com
+	Endpoint string
+	// Region is the region of the bucket, if not set it is looked up
+	Region string
+	// AddressingStyle is how the bucket is addressed, if not set it is selected from the endpoint
+	AddressingStyle cdiv1.S3AddressingStyle
+	// Secure connects to the endpoint with TLS
+	Secure bool
+	// CertDir contains the certs of the CAs that signed the certificate of the endpoint
+	CertDir string
+	// SessionToken is the session token of temporary credentials
+	SessionToken string
+	// RoleARN is the role assumed with the web identity token, instead of using the access and secret keys
+	RoleARN string
+	// STSEndpoint is the URL of the STS service the role is assumed with, defaults to https://sts.amazonaws.com
+	STSEndpoint string
+	// WebIdentityTokenFile contains the web identity token the role is assumed with
+	WebIdentityTokenFile string
+}
+
+// stsRoleSessionName identifies the importer in the sessions of the assumed roles.
+const stsRoleSessionName = "cdi-importer"
+
 // may be overridden in tests
 var newClientFunc = getS3Client
 
@@ -38,19 +89,31 @@ type S3DataSource struct {
 	secKey string
 	// Reader
 	s3Reader io.ReadCloser
+	// the size of the object, 0 if unknown
+	size uint64
+	// the ETag of the object, empty if the object store did not report one
+	etag string
+	// requests the object again from an offset, to resume a transfer
+	readFrom func(offset int64) (io.ReadCloser, int64, error)
 	// stack of readers
 	readers *FormatReaders
 	// The image file in scratch space.
 	url *url.URL
+	// the expected checksum of the data, in the form <algorithm>:<hex digest>.
+	checksum string
+	// the path of the disk image, if the source is a tar archive.
+	diskPath string
+	// the settings of the object store
+	options S3Options
 }
 
 // NewS3DataSource creates a new instance of the S3DataSource
-func NewS3DataSource(endpoint, accessKey, secKey string) (*S3DataSource, error) {
+func NewS3DataSource(endpoint, accessKey, secKey, checksum, diskPath string, options S3Options) (*S3DataSource, error) {
 	ep, err := ParseEndpoint(endpoint)
 	if err != nil {
 		return nil, errors.Wrapf(err, fmt.Sprintf("unable to parse endpoint %q", endpoint))
 	}
-	s3Reader, err := createS3Reader(ep, accessKey, secKey)
+	object, err := createS3Reader(ep, accessKey, secKey, options)
 	if err != nil {
 		return nil, err
 	}
@@ -58,14 +121,20 @@ func NewS3DataSource(endpoint, accessKey, secKey string) (*S3DataSource, error)
 		ep:        ep,
 		accessKey: accessKey,
 		secKey:    secKey,
-		s3Reader:  s3Reader,
+		s3Reader:  &util.CountingReader{Reader: object.reader},
+		size:      object.size,
+		etag:      object.etag,
+		readFrom:  object.readFrom,
+		checksum:  checksum,
+		diskPath:  diskPath,
+		options:   options,
 	}, nil
 }
 
 // Info is called to get initial information about the data.
 func (sd *S3DataSource) Info() (ProcessingPhase, error) {
 	var err error
-	sd.readers, err = NewFormatReaders(sd.s3Reader, uint64(0))
+	sd.readers, err = NewFormatReaders(sd.s3Reader, sd.size, sd.checksum, cdiv1.DataVolumeKubeVirt, sd.diskPath)
 	if err != nil {
 		klog.Errorf("Error creating readers: %v", err)
 		return ProcessingPhaseError, err
@@ -85,10 +154,17 @@ func (sd *S3DataSource) Transfer(path string) (ProcessingPhase, error) {
 		return ProcessingPhaseError, ErrInvalidPath
 	}
 	file := filepath.Join(path, tempFile)
-	err := util.StreamDataToFile(sd.readers.TopReader(), file)
+	sd.readers.StartProgressUpdate()
+	err := sd.streamDataToFile(file)
 	if err != nil {
 		return ProcessingPhaseError, err
 	}
+	if err := sd.readers.VerifyChecksum(); err != nil {
+		return ProcessingPhaseError, err
+	}
+	if file, err = sd.readers.extractImageArchive(file); err != nil {
+		return ProcessingPhaseError, err
+	}
 	// If streaming succeeded, then parsing the file into URL will also succeed, no need to check error status
 	sd.url, _ = url.Parse(file)
 	return ProcessingPhaseProcess, nil
@@ -96,10 +172,14 @@ func (sd *S3DataSource) Transfer(path string) (ProcessingPhase, error) {
 
 // TransferFile is called to transfer the data from the source to the passed in file.
 func (sd *S3DataSource) TransferFile(fileName string) (ProcessingPhase, error) {
-	err := util.StreamDataToFile(sd.readers.TopReader(), fileName)
+	sd.readers.StartProgressUpdate()
+	err := sd.streamDataToFile(fileName)
 	if err != nil {
 		return ProcessingPhaseError, err
 	}
+	if err := sd.readers.VerifyChecksum(); err != nil {
+		return ProcessingPhaseError, err
+	}
 	return ProcessingPhaseResize, nil
 }
 
@@ -122,22 +202,318 @@ func (sd *S3DataSource) Close() error {
 	return err
 }
 
-func createS3Reader(ep *url.URL, accessKey, secKey string) (io.ReadCloser, error) {
+// streamDataToFile writes the data of the object to the passed in file. If the data is written as is, and the object
+// store reported the ETag of the object, the transfer is checkpointed. If reading the object fails with a retryable
+// error, the rest of the object is requested again from the checkpoint, and a later attempt resumes the transfer.
+func (sd *S3DataSource) streamDataToFile(fileName string) error {
+	_, swappable := sd.s3Reader.(*util.CountingReader)
+	if sd.readers.Archived || sd.etag == "" || sd.readFrom == nil || !swappable || util.GetAvailableSpaceBlock(fileName) >= 0 {
+		return util.StreamDataToFile(sd.readers.TopReader(), fileName)
+	}
+	current := &transferCheckpoint{
+		URL:           sd.redactedEndpoint(),
+		ETag:          sd.etag,
+		ContentLength: sd.size,
+	}
+	previous, err := loadCheckpoint(fileName)
+	if err != nil {
+		klog.Warningf("Ignoring checkpoint: %v", err)
+	}
+	if current.matches(previous) && previous.Offset > 0 {
+		return streamDataToFileWithResume(nil, fileName, current, sd.resume)
+	}
+	return streamDataToFileWithResume(sd.readers.TopReader(), fileName, current, sd.resume)
+}
+
+// resume requests the object again starting at the offset in the checkpoint, and swaps it for the object being read.
+func (sd *S3DataSource) resume(checkpoint *transferCheckpoint, fileName string) (io.Reader, int64, error) {
+	klog.V(1).Infof("Attempting to resume transfer of %q at offset %d\n", checkpoint.URL, checkpoint.Offset)
+	body, offset, err := sd.readFrom(checkpoint.Offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	reader, err := sd.readers.resume(sd.s3Reader.(*util.CountingReader), body, fileName, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	return reader, offset, nil
+}
+
+// redactedEndpoint returns the endpoint without its user info and query, which holds the signature of a pre-signed
+// url, for use in logs and checkpoints.
+func (sd *S3DataSource) redactedEndpoint() string {
+	redacted := *sd.ep
+	redacted.User = nil
+	redacted.RawQuery = ""
+	return redacted.String()
+}
+
+// s3Source is the object of an S3 source.
+type s3Source struct {
+	reader io.ReadCloser
+	// the size of the object, 0 if it is unknown
+	size uint64
+	// the ETag of the object, empty if the object store did not report one
+	etag string
+	// readFrom requests the object again starting at the offset, if the object did not change. It returns the reader
+	// and the offset the data starts at, which is 0 if the entire object is returned.
+	readFrom func(offset int64) (io.ReadCloser, int64, error)
+}
+
+// sizedReader is the reader of an object of known size. The minio client ends an object with io.EOF when its
+// connection is closed early, which is turned into io.ErrUnexpectedEOF so the object is requested again.
+type sizedReader struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func (r *sizedReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.remaining -= int64(n)
+	if err == io.EOF && r.remaining > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// createS3Reader returns the object, with a reader of its data.
+func createS3Reader(ep *url.URL, accessKey, secKey string, options S3Options) (*s3Source, error) {
+	if isPresignedURL(ep) {
+		return createPresignedReader(ep, options.CertDir)
+	}
 	klog.V(3).Infoln("Using S3 client to get data")
 	bucket := ep.Host
 	object := strings.Trim(ep.Path, "/")
-	mc, err := newClientFunc(accessKey, secKey, false)
+	mc, err := newClientFunc(accessKey, secKey, options)
 	if err != nil {
 		return nil, errors.Wrapf(err, "could not build minio client for %q", ep.Host)
 	}
 	klog.V(2).Infof("Attempting to get object %q via S3 client\n", ep.String())
-	objectReader, err := mc.GetObject(bucket, object, minio.GetObjectOptions{})
+	// GetObject does not send the request, the stat of the object does, so the stat is retried along with it.
+	var objectReader S3Object
+	var info minio.ObjectInfo
+	err = retry("s3 request", func() error {
+		var err error
+		objectReader, err = mc.GetObject(bucket, object, minio.GetObjectOptions{})
+		if err != nil {
+			return err
+		}
+		info, err = objectReader.Stat()
+		if err != nil {
+			objectReader.Close()
+			return err
+		}
+		return nil
+	})
 	if err != nil {
 		return nil, errors.Wrapf(err, "could not get s3 object: \"%s/%s\"", bucket, object)
 	}
-	return objectReader, nil
+	source := &s3Source{reader: objectReader, etag: info.ETag}
+	if info.Size <= 0 {
+		return source, nil
+	}
+	source.size = uint64(info.Size)
+	source.reader = &sizedReader{ReadCloser: objectReader, remaining: info.Size}
+	source.readFrom = func(offset int64) (io.ReadCloser, int64, error) {
+		// The object is requested by the first read, which fails if the ETag of the object changed.
+		opts := minio.GetObjectOptions{}
+		if err := opts.SetMatchETag(info.ETag); err != nil {
+			return nil, 0, err
+		}
+		if offset > 0 {
+			if err := opts.SetRange(offset, 0); err != nil {
+				return nil, 0, err
+			}
+		}
+		objectReader, err := mc.GetObject(bucket, object, opts)
+		if err != nil {
+			return nil, 0, errors.Wrapf(err, "could not get s3 object: \"%s/%s\"", bucket, object)
+		}
+		return &sizedReader{ReadCloser: objectReader, remaining: info.Size - offset}, offset, nil
+	}
+	return source, nil
+}
+
+func getS3Client(accessKey, secKey string, options S3Options) (S3Client, error) {
+	endpoint := options.Endpoint
+	if endpoint == "" {
+		endpoint = common.ImporterS3Host
+	}
+	var bucketLookup minio.BucketLookupType
+	switch options.AddressingStyle {
+	case "":
+		bucketLookup = minio.BucketLookupAuto
+	case cdiv1.S3AddressingPath:
+		bucketLookup = minio.BucketLookupPath
+	case cdiv1.S3AddressingVirtualHost:
+		bucketLookup = minio.BucketLookupDNS
+	default:
+		return nil, errors.Errorf("unknown addressing style %q", options.AddressingStyle)
+	}
+	creds := credentials.NewStaticV4(accessKey, secKey, options.SessionToken)
+	if options.RoleARN != "" {
+		stsEndpoint := options.STSEndpoint
+		if stsEndpoint == "" {
+			stsEndpoint = common.DefaultS3STSEndpoint
+		}
+		stsClient, err := createHTTPClient(options.CertDir, "")
+		if err != nil {
+			return nil, err
+		}
+		klog.V(3).Infof("Assuming role %q with STS endpoint %q\n", options.RoleARN, stsEndpoint)
+		creds = credentials.New(&stsWebIdentity{
+			client:    stsClient,
+			endpoint:  stsEndpoint,
+			roleARN:   options.RoleARN,
+			tokenFile: options.WebIdentityTokenFile,
+		})
+	}
+	klog.V(3).Infof("Connecting to S3 endpoint %q, region %q, addressing style %q, secure %t\n", endpoint, options.Region, options.AddressingStyle, options.Secure)
+	client, err := minio.NewWithOptions(endpoint, &minio.Options{
+		Creds:        creds,
+		Secure:       options.Secure,
+		Region:       options.Region,
+		BucketLookup: bucketLookup,
+	})
+	if err != nil {
+		return nil, err
+	}
+	httpClient, err := createHTTPClient(options.CertDir, "")
+	if err != nil {
+		return nil, err
+	}
+	if httpClient.Transport != nil {
+		// The default transport of minio uses the proxy of the env vars, but does not trust additional certs
+		client.SetCustomTransport(httpClient.Transport)
+	}
+	return &minioClient{client}, nil
 }
 
-func getS3Client(accessKey, secKey string, secure bool) (S3Client, error) {
-	return minio.NewV4(common.ImporterS3Host, accessKey, secKey, secure)
+// isPresignedURL returns true if the url is a pre-signed http or https object url, with a version 4 or version 2
+// signature in its query.
+func isPresignedURL(ep *url.URL) bool {
+	if ep.Scheme != "http" && ep.Scheme != "https" {
+		return false
+	}
+	query := ep.Query()
+	return query.Get("X-Amz-Signature") != "" || (query.Get("Signature") != "" && query.Get("AWSAccessKeyId") != "")
+}
+
+// createPresignedReader gets a pre-signed object url. The signature in the url grants access to the object, so no
+// credentials are needed, and the query is left out of the logs and errors.
+func createPresignedReader(ep *url.URL, certDir string) (*s3Source, error) {
+	redacted := *ep
+	redacted.RawQuery = ""
+	client, err := createHTTPClient(certDir, "")
+	if err != nil {
+		return nil, errors.Wrap(err, "Error creating http client")
+	}
+	// get requests the object, the range and If-Range headers are only set to resume a transfer
+	get := func(header http.Header, expected int) (*http.Response, error) {
+		// http.NewRequest can only return error on invalid METHOD, or invalid url. Here the METHOD is always GET, and the url is always valid, thus error cannot happen.
+		req, _ := http.NewRequest("GET", ep.String(), nil)
+		for key := range header {
+			req.Header.Set(key, header.Get(key))
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			if urlErr, ok := err.(*url.Error); ok {
+				err = urlErr.Err
+			}
+			return nil, errors.Wrapf(err, "could not get pre-signed object %q", redacted.String())
+		}
+		if resp.StatusCode != http.StatusOK && resp.StatusCode != expected {
+			resp.Body.Close()
+			return nil, newHTTPStatusError(resp.StatusCode, "could not get pre-signed object %q, expected status code %d, got %d. Status: %s", redacted.String(), expected, resp.StatusCode, resp.Status)
+		}
+		return resp, nil
+	}
+	klog.V(2).Infof("Attempting to get pre-signed object %q via http client\n", redacted.String())
+	var resp *http.Response
+	err = retry("pre-signed s3 request", func() error {
+		resp, err = get(nil, http.StatusOK)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	source := &s3Source{reader: resp.Body, etag: resp.Header.Get("ETag")}
+	if resp.ContentLength > 0 {
+		source.size = uint64(resp.ContentLength)
+	}
+	if source.etag != "" && resp.Header.Get("Accept-Ranges") == "bytes" {
+		source.readFrom = func(offset int64) (io.ReadCloser, int64, error) {
+			klog.V(1).Infof("Attempting to resume transfer of pre-signed object %q at offset %d\n", redacted.String(), offset)
+			header := http.Header{}
+			header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+			header.Set("If-Range", source.etag)
+			resp, err := get(header, http.StatusPartialContent)
+			if err != nil {
+				return nil, 0, err
+			}
+			if resp.StatusCode == http.StatusOK {
+				klog.V(1).Infof("Object store returned the entire object, restarting transfer")
+				offset = 0
+			}
+			return resp.Body, offset, nil
+		}
+	}
+	return source, nil
+}
+
+// stsWebIdentity is a credentials provider that assumes a role with a web identity token, like the token of a
+// service account, and returns the temporary credentials of the role. The token is read again every time the
+// credentials expire, since it is rotated.
+type stsWebIdentity struct {
+	credentials.Expiry
+	client    *http.Client
+	endpoint  string
+	roleARN   string
+	tokenFile string
+}
+
+// stsErrorResponse is the error returned by the STS service.
+type stsErrorResponse struct {
+	Error struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	} `xml:"Error"`
+}
+
+// Retrieve assumes the role and returns its temporary credentials.
+func (p *stsWebIdentity) Retrieve() (credentials.Value, error) {
+	token, err := ioutil.ReadFile(p.tokenFile)
+	if err != nil {
+		return credentials.Value{}, errors.Wrap(err, "could not read web identity token")
+	}
+	form := url.Values{}
+	form.Set("Action", "AssumeRoleWithWebIdentity")
+	form.Set("Version", "2011-06-15")
+	form.Set("RoleArn", p.roleARN)
+	form.Set("RoleSessionName", stsRoleSessionName)
+	form.Set("WebIdentityToken", strings.TrimSpace(string(token)))
+	resp, err := p.client.PostForm(p.endpoint, form)
+	if err != nil {
+		return credentials.Value{}, errors.Wrapf(err, "could not assume role %q", p.roleARN)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		stsErr := stsErrorResponse{}
+		if xml.NewDecoder(resp.Body).Decode(&stsErr) == nil && stsErr.Error.Code != "" {
+			return credentials.Value{}, errors.Errorf("could not assume role %q: %s: %s", p.roleARN, stsErr.Error.Code, stsErr.Error.Message)
+		}
+		return credentials.Value{}, errors.Errorf("could not assume role %q: %s", p.roleARN, resp.Status)
+	}
+	result := credentials.AssumeRoleWithWebIdentityResponse{}
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return credentials.Value{}, errors.Wrapf(err, "could not parse the credentials of role %q", p.roleARN)
+	}
+	p.SetExpiration(result.Result.Credentials.Expiration, credentials.DefaultExpiryWindow)
+	klog.V(1).Infof("Assumed role %q, the credentials expire at %s\n", p.roleARN, result.Result.Credentials.Expiration)
+	return credentials.Value{
+		AccessKeyID:     result.Result.Credentials.AccessKey,
+		SecretAccessKey: result.Result.Credentials.SecretKey,
+		SessionToken:    result.Result.Credentials.SessionToken,
+		SignerType:      credentials.SignatureV4,
+	}, nil
 }
@@ -1,10 +1,20 @@
 package importer
 
 import (
+	"bytes"
+	"encoding/pem"
+	"fmt"
+	"io"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
 	"path/filepath"
 	"reflect"
+	"strconv"
+	"strings"
+	"time"
 
 	. "github.com/onsi/ginkgo"
 	"github.com/onsi/ginkgo/extensions/table"
@@ -12,6 +22,8 @@ import (
 
 	minio "github.com/minio/minio-go"
 	"github.com/pkg/errors"
+
+	cdiv1 "kubevirt.io/containerized-data-importer/pkg/apis/core/v1alpha1"
 )
 
 var _ = Describe("S3 data source", func() {
@@ -37,19 +49,19 @@ var _ = Describe("S3 data source", func() {
 	})
 
 	It("NewS3DataSource should Error, when passed in an invalid endpoint", func() {
-		sd, err = NewS3DataSource("thisisinvalid#$%#ep", "", "")
+		sd, err = NewS3DataSource("thisisinvalid#$%#ep", "", "", "", "", S3Options{})
 		Expect(err).To(HaveOccurred())
 	})
 
 	It("NewS3DataSource should Error, when failing to create minio client", func() {
 		newClientFunc = failMockS3Client
-		sd, err = NewS3DataSource("http://amazon.com", "", "")
+		sd, err = NewS3DataSource("http://amazon.com", "", "", "", "", S3Options{})
 		Expect(err).To(HaveOccurred())
 	})
 
 	It("NewS3DataSource should Error, when failing to get object", func() {
 		newClientFunc = createErrMockS3Client
-		sd, err = NewS3DataSource("http://amazon.com", "", "")
+		sd, err = NewS3DataSource("http://amazon.com", "", "", "", "", S3Options{})
 		Expect(err).To(HaveOccurred())
 	})
 
@@ -59,7 +71,7 @@ var _ = Describe("S3 data source", func() {
 		Expect(err).NotTo(HaveOccurred())
 		err = file.Close()
 		Expect(err).NotTo(HaveOccurred())
-		sd, err = NewS3DataSource("http://amazon.com", "", "")
+		sd, err = NewS3DataSource("http://amazon.com", "", "", "", "", S3Options{})
 		Expect(err).NotTo(HaveOccurred())
 		// Replace minio.Object with a reader we can use.
 		sd.s3Reader = file
@@ -72,7 +84,7 @@ var _ = Describe("S3 data source", func() {
 		// Don't need to defer close, since ud.Close will close the reader
 		file, err := os.Open(cirrosFilePath)
 		Expect(err).NotTo(HaveOccurred())
-		sd, err = NewS3DataSource("http://amazon.com", "", "")
+		sd, err = NewS3DataSource("http://amazon.com", "", "", "", "", S3Options{})
 		Expect(err).NotTo(HaveOccurred())
 		// Replace minio.Object with a reader we can use.
 		sd.s3Reader = file
@@ -85,7 +97,7 @@ var _ = Describe("S3 data source", func() {
 		// Don't need to defer close, since ud.Close will close the reader
 		file, err := os.Open(tinyCoreFilePath)
 		Expect(err).NotTo(HaveOccurred())
-		sd, err = NewS3DataSource("http://amazon.com", "", "")
+		sd, err = NewS3DataSource("http://amazon.com", "", "", "", "", S3Options{})
 		Expect(err).NotTo(HaveOccurred())
 		// Replace minio.Object with a reader we can use.
 		sd.s3Reader = file
@@ -94,6 +106,17 @@ var _ = Describe("S3 data source", func() {
 		Expect(ProcessingPhaseTransferDataFile).To(Equal(result))
 	})
 
+	It("Info should install a progress reader, when the size of the object is known", func() {
+		sd, err = NewS3DataSource("http://amazon.com", "", "", "", "", S3Options{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sd.size).To(Equal(uint64(mockObjectSize)))
+		// Replace minio.Object with a reader we can use.
+		sd.s3Reader = ioutil.NopCloser(strings.NewReader(strings.Repeat("a", mockObjectSize)))
+		_, err = sd.Info()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sd.readers.progressReader).NotTo(BeNil())
+	})
+
 	table.DescribeTable("calling transfer should", func(fileName, scratchPath string, want []byte, wantErr bool) {
 		if scratchPath == "" {
 			scratchPath = tmpDir
@@ -101,7 +124,7 @@ var _ = Describe("S3 data source", func() {
 		sourceFile, err := os.Open(fileName)
 		Expect(err).NotTo(HaveOccurred())
 
-		sd, err = NewS3DataSource("http://amazon.com", "", "")
+		sd, err = NewS3DataSource("http://amazon.com", "", "", "", "", S3Options{})
 		Expect(err).NotTo(HaveOccurred())
 		// Replace minio.Object with a reader we can use.
 		sd.s3Reader = sourceFile
@@ -135,7 +158,7 @@ var _ = Describe("S3 data source", func() {
 		sourceFile, err := os.Open(cirrosFilePath)
 		Expect(err).NotTo(HaveOccurred())
 
-		sd, err = NewS3DataSource("http://amazon.com", "", "")
+		sd, err = NewS3DataSource("http://amazon.com", "", "", "", "", S3Options{})
 		Expect(err).NotTo(HaveOccurred())
 		// Replace minio.Object with a reader we can use.
 		sd.s3Reader = sourceFile
@@ -153,7 +176,7 @@ var _ = Describe("S3 data source", func() {
 		// Don't need to defer close, since ud.Close will close the reader
 		file, err := os.Open(tinyCoreFilePath)
 		Expect(err).NotTo(HaveOccurred())
-		sd, err = NewS3DataSource("http://amazon.com", "", "")
+		sd, err = NewS3DataSource("http://amazon.com", "", "", "", "", S3Options{})
 		Expect(err).NotTo(HaveOccurred())
 		// Replace minio.Object with a reader we can use.
 		sd.s3Reader = file
@@ -169,7 +192,7 @@ var _ = Describe("S3 data source", func() {
 		// Don't need to defer close, since ud.Close will close the reader
 		file, err := os.Open(tinyCoreFilePath)
 		Expect(err).NotTo(HaveOccurred())
-		sd, err = NewS3DataSource("http://amazon.com", "", "")
+		sd, err = NewS3DataSource("http://amazon.com", "", "", "", "", S3Options{})
 		Expect(err).NotTo(HaveOccurred())
 		// Replace minio.Object with a reader we can use.
 		sd.s3Reader = file
@@ -185,7 +208,7 @@ var _ = Describe("S3 data source", func() {
 		// Don't need to defer close, since ud.Close will close the reader
 		file, err := os.Open(cirrosFilePath)
 		Expect(err).NotTo(HaveOccurred())
-		sd, err = NewS3DataSource("http://amazon.com", "", "")
+		sd, err = NewS3DataSource("http://amazon.com", "", "", "", "", S3Options{})
 		Expect(err).NotTo(HaveOccurred())
 		// Replace minio.Object with a reader we can use.
 		sd.s3Reader = file
@@ -194,42 +217,395 @@ var _ = Describe("S3 data source", func() {
 		Expect(ProcessingPhaseConvert).To(Equal(result))
 	})
 
+	It("NewS3DataSource should retry the request of the object after a 503 status", func() {
+		client := &MockMinioClient{statErrors: []error{minio.ErrorResponse{Code: "SlowDown", StatusCode: http.StatusServiceUnavailable}}}
+		newClientFunc = func(accKey, secKey string, options S3Options) (S3Client, error) {
+			return client, nil
+		}
+		sd, err = NewS3DataSource("s3://bucket/disk.img", "", "", "", "", S3Options{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sd.size).To(Equal(uint64(mockObjectSize)))
+		Expect(client.requests).To(Equal(2))
+	})
+
+	It("NewS3DataSource should fail without a retry on a 403 status", func() {
+		client := &MockMinioClient{statErrors: []error{minio.ErrorResponse{Code: "AccessDenied", StatusCode: http.StatusForbidden}}}
+		newClientFunc = func(accKey, secKey string, options S3Options) (S3Client, error) {
+			return client, nil
+		}
+		sd, err = NewS3DataSource("s3://bucket/disk.img", "", "", "", "", S3Options{})
+		Expect(err).To(HaveOccurred())
+		Expect(client.requests).To(Equal(1))
+	})
+
+	It("NewS3DataSource should pass the options to the client", func() {
+		var client S3Client
+		newClientFunc = func(accKey, secKey string, options S3Options) (S3Client, error) {
+			client, err = createMockS3Client(accKey, secKey, options)
+			return client, err
+		}
+		options := S3Options{
+			Endpoint:        "minio.example.com:9000",
+			Region:          "eu-central-1",
+			AddressingStyle: cdiv1.S3AddressingPath,
+			Secure:          true,
+			CertDir:         "/certs",
+		}
+		sd, err = NewS3DataSource("s3://bucket/disk.img", "user", "password", "", "", options)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(client.(*MockMinioClient).options).To(Equal(options))
+	})
+
 	It("GetS3Client should return a real client", func() {
-		_, err := getS3Client("", "", false)
+		_, err := getS3Client("", "", S3Options{})
 		Expect(err).NotTo(HaveOccurred())
 	})
+
+	It("GetS3Client should fail on an unknown addressing style", func() {
+		_, err := getS3Client("", "", S3Options{AddressingStyle: "invalid"})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Should get the object from an S3 compatible endpoint with TLS", func() {
+		var requestPath string
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requestPath = r.URL.Path
+			w.Header().Set("Content-Length", "5")
+			w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+			w.Write([]byte("hello"))
+		}))
+		defer server.Close()
+		certDir := filepath.Join(tmpDir, "certs")
+		Expect(os.Mkdir(certDir, 0755)).To(Succeed())
+		cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+		Expect(ioutil.WriteFile(filepath.Join(certDir, "tls.crt"), cert, 0644)).To(Succeed())
+
+		newClientFunc = getS3Client
+		sd, err = NewS3DataSource("s3://bucket/images/disk.img", "user", "password", "", "", S3Options{
+			Endpoint:        strings.TrimPrefix(server.URL, "https://"),
+			Region:          "us-east-1",
+			AddressingStyle: cdiv1.S3AddressingPath,
+			Secure:          true,
+			CertDir:         certDir,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		data, err := ioutil.ReadAll(sd.s3Reader)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).To(Equal("hello"))
+		Expect(requestPath).To(Equal("/bucket/images/disk.img"))
+	})
+
+	It("Should sign the requests with the session token of temporary credentials", func() {
+		var authorization, securityToken string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authorization = r.Header.Get("Authorization")
+			securityToken = r.Header.Get("X-Amz-Security-Token")
+			w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+			w.Write([]byte("hello"))
+		}))
+		defer server.Close()
+
+		newClientFunc = getS3Client
+		sd, err = NewS3DataSource("s3://bucket/disk.img", "ASIATEMPORARY", "secret", "", "", S3Options{
+			Endpoint:        strings.TrimPrefix(server.URL, "http://"),
+			Region:          "us-east-1",
+			AddressingStyle: cdiv1.S3AddressingPath,
+			SessionToken:    "session-token",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		data, err := ioutil.ReadAll(sd.s3Reader)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).To(Equal("hello"))
+		Expect(authorization).To(ContainSubstring("Credential=ASIATEMPORARY/"))
+		Expect(securityToken).To(Equal("session-token"))
+	})
+
+	It("Should request the rest of the object again when the connection is closed while it is read", func() {
+		data := bytes.Repeat([]byte("s3 object data "), 100000)
+		var rangeHeader, ifMatch string
+		cut := true
+		modified := time.Now().UTC().Truncate(time.Second)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("ETag", "\"v1\"")
+			w.Header().Set("Last-Modified", modified.Format(http.TimeFormat))
+			if r.Method == "GET" && r.Header.Get("Range") == "" && cut {
+				// Send part of the object and drop the connection
+				cut = false
+				w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+				w.Write(data[:300000])
+				w.(http.Flusher).Flush()
+				conn, _, err := w.(http.Hijacker).Hijack()
+				Expect(err).NotTo(HaveOccurred())
+				conn.Close()
+				return
+			}
+			if r.Method == "GET" && r.Header.Get("Range") != "" {
+				rangeHeader = r.Header.Get("Range")
+				ifMatch = r.Header.Get("If-Match")
+			}
+			http.ServeContent(w, r, "disk.img", modified, bytes.NewReader(data))
+		}))
+		defer server.Close()
+		retries := RetryCount()
+
+		newClientFunc = getS3Client
+		sd, err = NewS3DataSource("s3://bucket/disk.img", "user", "password", "", "", S3Options{
+			Endpoint:        strings.TrimPrefix(server.URL, "http://"),
+			Region:          "us-east-1",
+			AddressingStyle: cdiv1.S3AddressingPath,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		result, err := sd.Info()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).To(Equal(ProcessingPhaseTransferDataFile))
+		fileName := filepath.Join(tmpDir, "disk.img")
+		result, err = sd.TransferFile(fileName)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).To(Equal(ProcessingPhaseResize))
+		Expect(rangeHeader).To(Equal("bytes=300000-"))
+		Expect(ifMatch).To(Equal("\"v1\""))
+		Expect(RetryCount() - retries).To(Equal(1))
+		written, err := ioutil.ReadFile(fileName)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(bytes.Equal(written, data)).To(BeTrue())
+		_, err = os.Stat(checkpointFileName(fileName))
+		Expect(os.IsNotExist(err)).To(BeTrue())
+	})
+
+	Context("with a role", func() {
+		var (
+			server        *httptest.Server
+			stsForm       url.Values
+			stsStatus     int
+			authorization string
+			securityToken string
+			tokenFile     string
+		)
+
+		BeforeEach(func() {
+			stsForm = nil
+			stsStatus = http.StatusOK
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodPost {
+					Expect(r.ParseForm()).To(Succeed())
+					stsForm = r.PostForm
+					w.WriteHeader(stsStatus)
+					if stsStatus != http.StatusOK {
+						w.Write([]byte(`<ErrorResponse><Error><Code>AccessDenied</Code><Message>Not authorized to perform sts:AssumeRoleWithWebIdentity</Message></Error></ErrorResponse>`))
+						return
+					}
+					fmt.Fprintf(w, `<AssumeRoleWithWebIdentityResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <AssumeRoleWithWebIdentityResult>
+    <Credentials>
+      <AccessKeyId>ASIAROLE</AccessKeyId>
+      <SecretAccessKey>role-secret</SecretAccessKey>
+      <SessionToken>role-session-token</SessionToken>
+      <Expiration>%s</Expiration>
+    </Credentials>
+  </AssumeRoleWithWebIdentityResult>
+</AssumeRoleWithWebIdentityResponse>`, time.Now().Add(time.Hour).UTC().Format(time.RFC3339))
+					return
+				}
+				authorization = r.Header.Get("Authorization")
+				securityToken = r.Header.Get("X-Amz-Security-Token")
+				w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+				w.Write([]byte("hello"))
+			}))
+			tokenFile = filepath.Join(tmpDir, "token")
+			Expect(ioutil.WriteFile(tokenFile, []byte("service-account-token\n"), 0600)).To(Succeed())
+			newClientFunc = getS3Client
+		})
+
+		AfterEach(func() {
+			server.Close()
+		})
+
+		newRoleDataSource := func() {
+			sd, err = NewS3DataSource("s3://bucket/disk.img", "", "", "", "", S3Options{
+				Endpoint:             strings.TrimPrefix(server.URL, "http://"),
+				Region:               "us-east-1",
+				AddressingStyle:      cdiv1.S3AddressingPath,
+				RoleARN:              "arn:aws:iam::123456789012:role/importer",
+				STSEndpoint:          server.URL,
+				WebIdentityTokenFile: tokenFile,
+			})
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		It("Should assume the role with the web identity token", func() {
+			newRoleDataSource()
+			data, err := ioutil.ReadAll(sd.s3Reader)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(data)).To(Equal("hello"))
+			Expect(stsForm.Get("Action")).To(Equal("AssumeRoleWithWebIdentity"))
+			Expect(stsForm.Get("RoleArn")).To(Equal("arn:aws:iam::123456789012:role/importer"))
+			Expect(stsForm.Get("WebIdentityToken")).To(Equal("service-account-token"))
+			Expect(authorization).To(ContainSubstring("Credential=ASIAROLE/"))
+			Expect(securityToken).To(Equal("role-session-token"))
+		})
+
+		It("Should fail when the role cannot be assumed", func() {
+			stsStatus = http.StatusForbidden
+			sd, err = NewS3DataSource("s3://bucket/disk.img", "", "", "", "", S3Options{
+				Endpoint:             strings.TrimPrefix(server.URL, "http://"),
+				Region:               "us-east-1",
+				AddressingStyle:      cdiv1.S3AddressingPath,
+				RoleARN:              "arn:aws:iam::123456789012:role/importer",
+				STSEndpoint:          server.URL,
+				WebIdentityTokenFile: tokenFile,
+			})
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("AccessDenied"))
+		})
+	})
+
+	Context("with a pre-signed url", func() {
+		var (
+			server *httptest.Server
+			query  url.Values
+		)
+
+		BeforeEach(func() {
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				query = r.URL.Query()
+				if r.URL.Path != "/bucket/disk.img" {
+					w.WriteHeader(http.StatusForbidden)
+					return
+				}
+				w.Write([]byte("hello"))
+			}))
+			// The client is not used for pre-signed urls
+			newClientFunc = failMockS3Client
+		})
+
+		AfterEach(func() {
+			server.Close()
+		})
+
+		It("Should get the object without credentials", func() {
+			sd, err = NewS3DataSource(server.URL+"/bucket/disk.img?X-Amz-Algorithm=AWS4-HMAC-SHA256&X-Amz-Signature=abcdef", "", "", "", "", S3Options{})
+			Expect(err).NotTo(HaveOccurred())
+			data, err := ioutil.ReadAll(sd.s3Reader)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(data)).To(Equal("hello"))
+			Expect(query.Get("X-Amz-Signature")).To(Equal("abcdef"))
+			Expect(sd.size).To(Equal(uint64(5)))
+		})
+
+		It("Should fail without the signature in the error", func() {
+			sd, err = NewS3DataSource(server.URL+"/bucket/other.img?X-Amz-Algorithm=AWS4-HMAC-SHA256&X-Amz-Signature=abcdef", "", "", "", "", S3Options{})
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("403"))
+			Expect(err.Error()).ToNot(ContainSubstring("abcdef"))
+		})
+
+		It("Should request the rest of the object again when the connection is closed while it is read", func() {
+			data := bytes.Repeat([]byte("pre-signed data "), 100000)
+			var rangeHeader string
+			cut := true
+			server.Close()
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				query = r.URL.Query()
+				w.Header().Set("ETag", "\"v1\"")
+				if r.Header.Get("Range") == "" && cut {
+					// Send part of the object and drop the connection
+					cut = false
+					w.Header().Set("Accept-Ranges", "bytes")
+					w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+					w.Write(data[:300000])
+					w.(http.Flusher).Flush()
+					conn, _, err := w.(http.Hijacker).Hijack()
+					Expect(err).NotTo(HaveOccurred())
+					conn.Close()
+					return
+				}
+				rangeHeader = r.Header.Get("Range")
+				http.ServeContent(w, r, "disk.img", time.Time{}, bytes.NewReader(data))
+			}))
+			retries := RetryCount()
+			sd, err = NewS3DataSource(server.URL+"/bucket/disk.img?X-Amz-Algorithm=AWS4-HMAC-SHA256&X-Amz-Signature=abcdef", "", "", "", "", S3Options{})
+			Expect(err).NotTo(HaveOccurred())
+			_, err = sd.Info()
+			Expect(err).NotTo(HaveOccurred())
+			fileName := filepath.Join(tmpDir, "disk.img")
+			_, err = sd.TransferFile(fileName)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(rangeHeader).To(Equal("bytes=300000-"))
+			Expect(query.Get("X-Amz-Signature")).To(Equal("abcdef"))
+			Expect(RetryCount() - retries).To(Equal(1))
+			written, err := ioutil.ReadFile(fileName)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(bytes.Equal(written, data)).To(BeTrue())
+		})
+
+		table.DescribeTable("should detect", func(rawURL string, presigned bool) {
+			ep, err := url.Parse(rawURL)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(isPresignedURL(ep)).To(Equal(presigned))
+		},
+			table.Entry("a version 4 signature", "https://bucket.s3.amazonaws.com/disk.img?X-Amz-Algorithm=AWS4-HMAC-SHA256&X-Amz-Signature=abcdef", true),
+			table.Entry("a version 2 signature", "https://bucket.s3.amazonaws.com/disk.img?AWSAccessKeyId=AKIA&Expires=1&Signature=abcdef", true),
+			table.Entry("a url without a signature", "https://bucket/disk.img", false),
+			table.Entry("an s3 url", "s3://bucket/disk.img?X-Amz-Signature=abcdef", false),
+		)
+	})
 })
 
 // MockMinioClient is a mock minio client
 type MockMinioClient struct {
-	accKey string
-	secKey string
-	secure bool
-	doErr  bool
+	accKey  string
+	secKey  string
+	options S3Options
+	doErr   bool
+	// statErrors are returned by the Stat of the objects, one per object
+	statErrors []error
+	requests   int
 }
 
-func failMockS3Client(accKey, secKey string, secure bool) (S3Client, error) {
+func failMockS3Client(accKey, secKey string, options S3Options) (S3Client, error) {
 	return nil, errors.New("Failed to create client")
 }
 
-func createMockS3Client(accKey, secKey string, secure bool) (S3Client, error) {
+func createMockS3Client(accKey, secKey string, options S3Options) (S3Client, error) {
 	return &MockMinioClient{
-		accKey: accKey,
-		secKey: secKey,
-		secure: secure,
-		doErr:  false,
+		accKey:  accKey,
+		secKey:  secKey,
+		options: options,
+		doErr:   false,
 	}, nil
 }
 
-func createErrMockS3Client(accKey, secKey string, secure bool) (S3Client, error) {
+func createErrMockS3Client(accKey, secKey string, options S3Options) (S3Client, error) {
 	return &MockMinioClient{
 		doErr: true,
 	}, nil
 }
 
-func (mc *MockMinioClient) GetObject(bucketName, objectName string, opts minio.GetObjectOptions) (*minio.Object, error) {
-	if !mc.doErr {
-		return &minio.Object{}, nil
+// mockObjectSize is the size of the objects returned by the mock minio client
+const mockObjectSize = 1024
+
+func (mc *MockMinioClient) GetObject(bucketName, objectName string, opts minio.GetObjectOptions) (S3Object, error) {
+	if mc.doErr {
+		return nil, errors.New("Failed to get object")
+	}
+	mc.requests++
+	object := &mockS3Object{ReadCloser: ioutil.NopCloser(strings.NewReader(strings.Repeat("a", mockObjectSize)))}
+	if len(mc.statErrors) > 0 {
+		object.statErr = mc.statErrors[0]
+		mc.statErrors = mc.statErrors[1:]
+	}
+	return object, nil
+}
+
+// mockS3Object is an object of the mock minio client
+type mockS3Object struct {
+	io.ReadCloser
+	statErr error
+}
+
+func (o *mockS3Object) Stat() (minio.ObjectInfo, error) {
+	if o.statErr != nil {
+		return minio.ObjectInfo{}, o.statErr
 	}
-	return nil, errors.New("Failed to get object")
+	return minio.ObjectInfo{Size: mockObjectSize}, nil
 }
@@ -0,0 +1,384 @@
+package importer
+
+import (
+	"encoding/binary"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// The packet types of version 3 of the SFTP protocol that are used to read a file, as described in
+// https://tools.ietf.org/html/draft-ietf-secsh-filexfer-02
+const (
+	sftpPacketInit    = 1
+	sftpPacketVersion = 2
+	sftpPacketOpen    = 3
+	sftpPacketClose   = 4
+	sftpPacketRead    = 5
+	sftpPacketFstat   = 8
+	sftpPacketStatus  = 101
+	sftpPacketHandle  = 102
+	sftpPacketData    = 103
+	sftpPacketAttrs   = 105
+)
+
+const (
+	sftpProtocolVersion = 3
+	// sftpOpenRead opens a file for reading
+	sftpOpenRead = 0x1
+	// The flags of the attributes of a file
+	sftpAttrSize        = 0x1
+	sftpAttrUIDGID      = 0x2
+	sftpAttrPermissions = 0x4
+	// The status codes of the responses
+	sftpStatusOK  = 0
+	sftpStatusEOF = 1
+	// sftpFileTypeMask and sftpRegularFile are the bits of the permissions giving the type of a file
+	sftpFileTypeMask = 0170000
+	sftpRegularFile  = 0100000
+	// sftpMaxPacketLength is the length of the longest packet that is accepted
+	sftpMaxPacketLength = 1 << 20
+	// sftpReadLength is the length of the data requested by a read
+	sftpReadLength = 32768
+	// sftpMaxPendingReads is the number of reads that are requested before their data is received
+	sftpMaxPendingReads = 16
+)
+
+// sftpClient reads files with version 3 of the SFTP protocol, over a connection to the sftp subsystem of a server.
+type sftpClient struct {
+	conn   io.ReadWriteCloser
+	nextID uint32
+	// the responses that were received before they were waited for, by their request id
+	responses map[uint32]*sftpPacket
+}
+
+// sftpPacket is a packet received from the server, the data follows the request id.
+type sftpPacket struct {
+	packetType byte
+	data       []byte
+}
+
+// sftpFile is an open file of the server, it reads the file sequentially.
+type sftpFile struct {
+	client *sftpClient
+	handle string
+	// the size of the file, 0 if the server did not return it
+	size uint64
+	// the offset of the next read that is requested
+	offset uint64
+	// the reads that were requested, in the order of their offsets
+	pending []sftpRead
+	// the data that was received but not read yet
+	buf []byte
+	err error
+}
+
+// sftpRead is a read that was requested from the server.
+type sftpRead struct {
+	id     uint32
+	offset uint64
+	length uint32
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	return append(b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func appendUint64(b []byte, v uint64) []byte {
+	return appendUint32(appendUint32(b, uint32(v>>32)), uint32(v))
+}
+
+func appendString(b []byte, s string) []byte {
+	return append(appendUint32(b, uint32(len(s))), s...)
+}
+
+func consumeUint32(b []byte) (uint32, []byte, error) {
+	if len(b) < 4 {
+		return 0, nil, errors.New("sftp packet too short")
+	}
+	return binary.BigEndian.Uint32(b), b[4:], nil
+}
+
+func consumeUint64(b []byte) (uint64, []byte, error) {
+	if len(b) < 8 {
+		return 0, nil, errors.New("sftp packet too short")
+	}
+	return binary.BigEndian.Uint64(b), b[8:], nil
+}
+
+func consumeString(b []byte) (string, []byte, error) {
+	length, b, err := consumeUint32(b)
+	if err != nil {
+		return "", nil, err
+	}
+	if uint32(len(b)) < length {
+		return "", nil, errors.New("sftp packet too short")
+	}
+	return string(b[:length]), b[length:], nil
+}
+
+// writeSFTPPacket writes a packet, prefixed by its length.
+func writeSFTPPacket(w io.Writer, packetType byte, data []byte) error {
+	packet := appendUint32(make([]byte, 0, 5+len(data)), uint32(1+len(data)))
+	packet = append(packet, packetType)
+	_, err := w.Write(append(packet, data...))
+	return err
+}
+
+// readSFTPPacket reads a packet, and returns its type and data.
+func readSFTPPacket(r io.Reader) (byte, []byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, nil, err
+	}
+	length := binary.BigEndian.Uint32(header[:4])
+	if length < 1 || length > sftpMaxPacketLength {
+		return 0, nil, errors.Errorf("invalid sftp packet length %d", length)
+	}
+	data := make([]byte, length-1)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return 0, nil, err
+	}
+	return header[4], data, nil
+}
+
+// newSFTPClient negotiates the version of the protocol over the connection, and returns the client.
+func newSFTPClient(conn io.ReadWriteCloser) (*sftpClient, error) {
+	c := &sftpClient{
+		conn:      conn,
+		responses: map[uint32]*sftpPacket{},
+	}
+	if err := writeSFTPPacket(conn, sftpPacketInit, appendUint32(nil, sftpProtocolVersion)); err != nil {
+		return nil, c.connError(err)
+	}
+	packetType, data, err := readSFTPPacket(conn)
+	if err != nil {
+		return nil, c.connError(err)
+	}
+	if packetType != sftpPacketVersion {
+		conn.Close()
+		return nil, errors.Errorf("unexpected sftp packet type %d, expected the version of the server", packetType)
+	}
+	version, _, err := consumeUint32(data)
+	if err != nil || version != sftpProtocolVersion {
+		conn.Close()
+		return nil, errors.Errorf("unsupported sftp version %d, expected %d", version, sftpProtocolVersion)
+	}
+	return c, nil
+}
+
+// connError closes the connection after it failed, the error of closing it explains the failure better, if there is
+// one, like the error of the ssh process.
+func (c *sftpClient) connError(err error) error {
+	if closeErr := c.conn.Close(); closeErr != nil {
+		return closeErr
+	}
+	return errors.Wrap(err, "sftp connection failed")
+}
+
+// request sends a request, and returns its id.
+func (c *sftpClient) request(packetType byte, data []byte) (uint32, error) {
+	id := c.nextID
+	c.nextID++
+	if err := writeSFTPPacket(c.conn, packetType, append(appendUint32(nil, id), data...)); err != nil {
+		return 0, c.connError(err)
+	}
+	return id, nil
+}
+
+// wait returns the response to the request with the passed in id, the responses to other requests are kept.
+func (c *sftpClient) wait(id uint32) (*sftpPacket, error) {
+	for {
+		if packet, ok := c.responses[id]; ok {
+			delete(c.responses, id)
+			return packet, nil
+		}
+		packetType, data, err := readSFTPPacket(c.conn)
+		if err != nil {
+			return nil, c.connError(err)
+		}
+		responseID, data, err := consumeUint32(data)
+		if err != nil {
+			return nil, err
+		}
+		c.responses[responseID] = &sftpPacket{packetType: packetType, data: data}
+	}
+}
+
+// statusError returns the error of a status response, nil if the status is ok.
+func statusError(packet *sftpPacket) error {
+	code, data, err := consumeUint32(packet.data)
+	if err != nil {
+		return err
+	}
+	if code == sftpStatusOK {
+		return nil
+	}
+	message, _, _ := consumeString(data)
+	return errors.Errorf("sftp request failed with status %d: %s", code, message)
+}
+
+// unexpectedPacket returns the error of an unexpected response, which may be a status.
+func unexpectedPacket(packet *sftpPacket, expected string) error {
+	if packet.packetType == sftpPacketStatus {
+		if err := statusError(packet); err != nil {
+			return err
+		}
+	}
+	return errors.Errorf("unexpected sftp packet type %d, expected %s", packet.packetType, expected)
+}
+
+// open opens a file of the server for reading, and gets its size.
+func (c *sftpClient) open(path string) (*sftpFile, error) {
+	// The file is opened without attributes
+	id, err := c.request(sftpPacketOpen, appendUint32(appendUint32(appendString(nil, path), sftpOpenRead), 0))
+	if err != nil {
+		return nil, err
+	}
+	packet, err := c.wait(id)
+	if err != nil {
+		return nil, err
+	}
+	if packet.packetType != sftpPacketHandle {
+		return nil, errors.Wrapf(unexpectedPacket(packet, "a handle"), "could not open %q", path)
+	}
+	handle, _, err := consumeString(packet.data)
+	if err != nil {
+		return nil, err
+	}
+	f := &sftpFile{
+		client: c,
+		handle: handle,
+	}
+	if err := f.stat(); err != nil {
+		f.Close()
+		return nil, errors.Wrapf(err, "could not get the attributes of %q", path)
+	}
+	return f, nil
+}
+
+// stat gets the size of the file, and checks that it is a regular file.
+func (f *sftpFile) stat() error {
+	id, err := f.client.request(sftpPacketFstat, appendString(nil, f.handle))
+	if err != nil {
+		return err
+	}
+	packet, err := f.client.wait(id)
+	if err != nil {
+		return err
+	}
+	if packet.packetType != sftpPacketAttrs {
+		return unexpectedPacket(packet, "attributes")
+	}
+	flags, data, err := consumeUint32(packet.data)
+	if err != nil {
+		return err
+	}
+	if flags&sftpAttrSize != 0 {
+		if f.size, data, err = consumeUint64(data); err != nil {
+			return err
+		}
+	}
+	if flags&sftpAttrUIDGID != 0 {
+		if len(data) < 8 {
+			return errors.New("sftp packet too short")
+		}
+		data = data[8:]
+	}
+	if flags&sftpAttrPermissions != 0 {
+		permissions, _, err := consumeUint32(data)
+		if err != nil {
+			return err
+		}
+		if permissions&sftpFileTypeMask != sftpRegularFile {
+			return errors.New("not a regular file")
+		}
+	}
+	return nil
+}
+
+// requestRead requests the data of the file at the passed in offset.
+func (f *sftpFile) requestRead(offset uint64, length uint32) (sftpRead, error) {
+	id, err := f.client.request(sftpPacketRead, appendUint32(appendUint64(appendString(nil, f.handle), offset), length))
+	return sftpRead{id: id, offset: offset, length: length}, err
+}
+
+// receiveRead receives the data of the first pending read. The reads that follow it are requested first, so the data
+// is received while the server reads the next data.
+func (f *sftpFile) receiveRead() error {
+	for len(f.pending) < sftpMaxPendingReads {
+		read, err := f.requestRead(f.offset, sftpReadLength)
+		if err != nil {
+			return err
+		}
+		f.pending = append(f.pending, read)
+		f.offset += sftpReadLength
+	}
+	read := f.pending[0]
+	f.pending = f.pending[1:]
+	packet, err := f.client.wait(read.id)
+	if err != nil {
+		return err
+	}
+	switch packet.packetType {
+	case sftpPacketStatus:
+		code, _, err := consumeUint32(packet.data)
+		if err == nil && code == sftpStatusEOF {
+			return io.EOF
+		}
+		return unexpectedPacket(packet, "data")
+	case sftpPacketData:
+		data, _, err := consumeString(packet.data)
+		if err != nil {
+			return err
+		}
+		if uint32(len(data)) > read.length {
+			return errors.Errorf("sftp server returned %d bytes, expected at most %d", len(data), read.length)
+		}
+		if uint32(len(data)) < read.length {
+			// The rest of the data is requested before the following reads
+			rest, err := f.requestRead(read.offset+uint64(len(data)), read.length-uint32(len(data)))
+			if err != nil {
+				return err
+			}
+			f.pending = append([]sftpRead{rest}, f.pending...)
+		}
+		f.buf = []byte(data)
+		return nil
+	}
+	return unexpectedPacket(packet, "data")
+}
+
+// Read reads the data of the file.
+func (f *sftpFile) Read(p []byte) (int, error) {
+	for len(f.buf) == 0 && f.err == nil {
+		f.err = f.receiveRead()
+	}
+	if len(f.buf) == 0 {
+		return 0, f.err
+	}
+	n := copy(p, f.buf)
+	f.buf = f.buf[n:]
+	return n, nil
+}
+
+// Close closes the file and the connection to the server.
+func (f *sftpFile) Close() error {
+	id, err := f.client.request(sftpPacketClose, appendString(nil, f.handle))
+	if err != nil {
+		return err
+	}
+	packet, err := f.client.wait(id)
+	if err != nil {
+		return err
+	}
+	if packet.packetType != sftpPacketStatus {
+		err = unexpectedPacket(packet, "a status")
+	} else {
+		err = statusError(packet)
+	}
+	if closeErr := f.client.conn.Close(); closeErr != nil {
+		return closeErr
+	}
+	return err
+}
@@ -0,0 +1,294 @@
+package importer
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+
+	"k8s.io/klog"
+
+	cdiv1 "kubevirt.io/containerized-data-importer/pkg/apis/core/v1alpha1"
+	"kubevirt.io/containerized-data-importer/pkg/common"
+	"kubevirt.io/containerized-data-importer/pkg/util"
+)
+
+const (
+	// defaultSFTPPort is the port of the server, if the url of the file does not have one
+	defaultSFTPPort = "22"
+	// sftpConnectTimeout is the time the connection to the server and the ssh handshake may take
+	sftpConnectTimeout = 30 * time.Second
+)
+
+// SFTPOptions are the settings of the server an SFTP source is imported from.
+type SFTPOptions struct {
+	// HostKey is the public key the server has to present, in the authorized_keys format
+	HostKey string
+	// CredentialsDir contains the credentials of the user, an optional username file and a password or privateKey file
+	CredentialsDir string
+}
+
+// SFTPDataSource is the struct containing the information needed to import a file of an SFTP server.
+// Sequence of phases:
+// 1. Info -> Transfer
+// 2. Transfer -> Process
+// 3. Process -> Convert
+type SFTPDataSource struct {
+	// SFTP end point
+	ep *url.URL
+	// Reader
+	sftpReader io.ReadCloser
+	// the size of the file
+	size uint64
+	// stack of readers
+	readers *FormatReaders
+	// The image file in scratch space.
+	url *url.URL
+	// the expected checksum of the data, in the form <algorithm>:<hex digest>.
+	checksum string
+	// the path of the disk image, if the source is a tar archive.
+	diskPath string
+}
+
+// sftpSession is the sftp subsystem of a server, on an ssh connection.
+type sftpSession struct {
+	client  *ssh.Client
+	session *ssh.Session
+	stdin   io.WriteCloser
+	stdout  io.Reader
+}
+
+// startSFTPSession connects to the ssh server at the passed in address, and starts its sftp subsystem.
+func startSFTPSession(addr string, config *ssh.ClientConfig) (io.ReadWriteCloser, error) {
+	client, err := ssh.Dial("tcp", addr, config)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not connect to the ssh server %s", addr)
+	}
+	session, err := client.NewSession()
+	if err != nil {
+		client.Close()
+		return nil, errors.Wrap(err, "could not open an ssh session")
+	}
+	s := &sftpSession{client: client, session: session}
+	if s.stdin, err = session.StdinPipe(); err != nil {
+		s.Close()
+		return nil, errors.Wrap(err, "could not create the input of the ssh session")
+	}
+	if s.stdout, err = session.StdoutPipe(); err != nil {
+		s.Close()
+		return nil, errors.Wrap(err, "could not create the output of the ssh session")
+	}
+	if err := session.RequestSubsystem("sftp"); err != nil {
+		s.Close()
+		return nil, errors.Wrap(err, "could not start the sftp subsystem")
+	}
+	return s, nil
+}
+
+func (s *sftpSession) Read(p []byte) (int, error) {
+	return s.stdout.Read(p)
+}
+
+func (s *sftpSession) Write(p []byte) (int, error) {
+	return s.stdin.Write(p)
+}
+
+// Close ends the session and closes the connection to the server.
+func (s *sftpSession) Close() error {
+	s.session.Close()
+	return s.client.Close()
+}
+
+// NewSFTPDataSource creates a new instance of the SFTPDataSource, the endpoint is the URL of the file, like
+// sftp://<user>@<host>:<port>/<path>.
+func NewSFTPDataSource(endpoint, checksum, diskPath string, options SFTPOptions) (*SFTPDataSource, error) {
+	ep, err := ParseEndpoint(endpoint)
+	if err != nil {
+		return nil, errors.Wrapf(err, fmt.Sprintf("unable to parse endpoint %q", endpoint))
+	}
+	sftpReader, size, err := createSFTPReader(ep, options)
+	if err != nil {
+		return nil, err
+	}
+	return &SFTPDataSource{
+		ep:         ep,
+		sftpReader: sftpReader,
+		size:       size,
+		checksum:   checksum,
+		diskPath:   diskPath,
+	}, nil
+}
+
+// Info is called to get initial information about the data.
+func (sd *SFTPDataSource) Info() (ProcessingPhase, error) {
+	var err error
+	sd.readers, err = NewFormatReaders(sd.sftpReader, sd.size, sd.checksum, cdiv1.DataVolumeKubeVirt, sd.diskPath)
+	if err != nil {
+		klog.Errorf("Error creating readers: %v", err)
+		return ProcessingPhaseError, err
+	}
+	if !sd.readers.Convert {
+		// Downloading a raw file, we can write that directly to the target.
+		return ProcessingPhaseTransferDataFile, nil
+	}
+
+	return ProcessingPhaseTransferScratch, nil
+}
+
+// Transfer is called to transfer the data from the source to a temporary location.
+func (sd *SFTPDataSource) Transfer(path string) (ProcessingPhase, error) {
+	if util.GetAvailableSpace(path) <= int64(0) {
+		//Path provided is invalid.
+		return ProcessingPhaseError, ErrInvalidPath
+	}
+	file := filepath.Join(path, tempFile)
+	sd.readers.StartProgressUpdate()
+	err := util.StreamDataToFile(sd.readers.TopReader(), file)
+	if err != nil {
+		return ProcessingPhaseError, err
+	}
+	if err := sd.readers.VerifyChecksum(); err != nil {
+		return ProcessingPhaseError, err
+	}
+	if file, err = sd.readers.extractImageArchive(file); err != nil {
+		return ProcessingPhaseError, err
+	}
+	// If streaming succeeded, then parsing the file into URL will also succeed, no need to check error status
+	sd.url, _ = url.Parse(file)
+	return ProcessingPhaseProcess, nil
+}
+
+// TransferFile is called to transfer the data from the source to the passed in file.
+func (sd *SFTPDataSource) TransferFile(fileName string) (ProcessingPhase, error) {
+	sd.readers.StartProgressUpdate()
+	err := util.StreamDataToFile(sd.readers.TopReader(), fileName)
+	if err != nil {
+		return ProcessingPhaseError, err
+	}
+	if err := sd.readers.VerifyChecksum(); err != nil {
+		return ProcessingPhaseError, err
+	}
+	return ProcessingPhaseResize, nil
+}
+
+// Process is called to do any special processing before giving the url to the data back to the processor
+func (sd *SFTPDataSource) Process() (ProcessingPhase, error) {
+	return ProcessingPhaseConvert, nil
+}
+
+// GetURL returns the url that the data processor can use when converting the data.
+func (sd *SFTPDataSource) GetURL() *url.URL {
+	return sd.url
+}
+
+// Close closes any readers or other open resources.
+func (sd *SFTPDataSource) Close() error {
+	var err error
+	if sd.readers != nil {
+		err = sd.readers.Close()
+	} else if sd.sftpReader != nil {
+		err = sd.sftpReader.Close()
+	}
+	return err
+}
+
+// createSFTPReader opens the file with the sftp subsystem of the server, and returns a reader of the file and its size.
+func createSFTPReader(ep *url.URL, options SFTPOptions) (io.ReadCloser, uint64, error) {
+	if ep.Scheme != "sftp" || ep.Hostname() == "" || strings.Trim(ep.Path, "/") == "" {
+		return nil, uint64(0), errors.Errorf("invalid sftp url %q, expected sftp://<host>:<port>/<path>", ep.String())
+	}
+	config, err := sshClientConfig(ep, options)
+	if err != nil {
+		return nil, uint64(0), err
+	}
+	port := ep.Port()
+	if port == "" {
+		port = defaultSFTPPort
+	}
+	// A path starting with /~/ is relative to the home directory of the user
+	path := ep.Path
+	if strings.HasPrefix(path, "/~/") {
+		path = strings.TrimPrefix(path, "/~/")
+	}
+
+	klog.V(2).Infof("Attempting to get file %q via sftp\n", ep.String())
+	conn, err := startSFTPSession(net.JoinHostPort(ep.Hostname(), port), config)
+	if err != nil {
+		return nil, uint64(0), err
+	}
+	client, err := newSFTPClient(conn)
+	if err != nil {
+		return nil, uint64(0), err
+	}
+	file, err := client.open(path)
+	if err != nil {
+		conn.Close()
+		return nil, uint64(0), err
+	}
+	if file.size == 0 {
+		klog.Warningf("Unable to get the size of sftp file %q, progress will not be reported\n", ep.String())
+	}
+	return file, file.size, nil
+}
+
+// sshClientConfig returns the settings of the ssh connection to the server. The server has to present the host key of
+// the options, and the user is authenticated with either the private key or the password in the credentials
+// directory.
+func sshClientConfig(ep *url.URL, options SFTPOptions) (*ssh.ClientConfig, error) {
+	hostKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(options.HostKey))
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid host key of the sftp server")
+	}
+
+	username := ""
+	if ep.User != nil {
+		username = ep.User.Username()
+	}
+	if data, err := ioutil.ReadFile(filepath.Join(options.CredentialsDir, common.KeyUsername)); err == nil {
+		username = strings.TrimSpace(string(data))
+	}
+	if username == "" {
+		return nil, errors.New("no username in the url or the credentials of the sftp source")
+	}
+
+	var auth []ssh.AuthMethod
+	privateKey := filepath.Join(options.CredentialsDir, common.KeyPrivateKey)
+	password := filepath.Join(options.CredentialsDir, common.KeyPassword)
+	if data, err := ioutil.ReadFile(privateKey); err == nil {
+		klog.V(2).Infof("Using the private key of %s to read the sftp file\n", username)
+		signer, err := ssh.ParsePrivateKey(data)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid private key of the sftp source")
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	} else if data, err := ioutil.ReadFile(password); err == nil {
+		klog.V(2).Infof("Using the password of %s to read the sftp file\n", username)
+		secret := strings.TrimRight(string(data), "\r\n")
+		// Servers that only allow keyboard-interactive authentication ask for the password
+		auth = append(auth, ssh.Password(secret), ssh.KeyboardInteractive(func(user, instruction string, questions []string, echos []bool) ([]string, error) {
+			answers := make([]string, len(questions))
+			for i := range answers {
+				answers[i] = secret
+			}
+			return answers, nil
+		}))
+	} else {
+		return nil, errors.Errorf("no %s or %s in the credentials of the sftp source", common.KeyPassword, common.KeyPrivateKey)
+	}
+
+	return &ssh.ClientConfig{
+		User: username,
+		Auth: auth,
+		// The server has to present the pinned host key, and to sign the key exchange with it
+		HostKeyCallback:   ssh.FixedHostKey(hostKey),
+		HostKeyAlgorithms: []string{hostKey.Type()},
+		Timeout:           sftpConnectTimeout,
+	}, nil
+}
@@ -0,0 +1,436 @@
+package importer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"golang.org/x/crypto/ed25519"
+	"golang.org/x/crypto/ssh"
+
+	"kubevirt.io/containerized-data-importer/pkg/common"
+)
+
+const (
+	testSFTPHostKey  = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIKVno3ZtsMKI5aSg0ao8jhBt8VU3nT6fg05nEY4E+a89"
+	testSFTPUser     = "importer"
+	testSFTPPassword = "secret"
+)
+
+// fakeSFTPServer is an ssh server listening on the loopback interface, its sftp subsystem serves files with the subset
+// of the SFTP protocol the importer uses.
+type fakeSFTPServer struct {
+	listener net.Listener
+	config   *ssh.ServerConfig
+	files    map[string][]byte
+	// the host keys of the server, in the authorized_keys format, by type
+	hostKeys map[string]string
+	// maxRead limits the length of the data returned by a read
+	maxRead int
+	mutex   sync.Mutex
+	// the methods the user authenticated with
+	authMethods []string
+}
+
+// newFakeSFTPServer starts a server with an ed25519 and an ecdsa host key, which authenticates the test user with the
+// test password, or the passed in public key.
+func newFakeSFTPServer(userKey ssh.PublicKey) *fakeSFTPServer {
+	s := &fakeSFTPServer{files: map[string][]byte{}, hostKeys: map[string]string{}}
+	s.config = &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			return s.authenticate(conn, "password", string(password) == testSFTPPassword)
+		},
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			return s.authenticate(conn, "publickey", bytes.Equal(key.Marshal(), userKey.Marshal()))
+		},
+	}
+	_, ed25519Key, err := ed25519.GenerateKey(rand.Reader)
+	Expect(err).NotTo(HaveOccurred())
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).NotTo(HaveOccurred())
+	for _, key := range []interface{}{ed25519Key, ecdsaKey} {
+		signer, err := ssh.NewSignerFromKey(key)
+		Expect(err).NotTo(HaveOccurred())
+		s.config.AddHostKey(signer)
+		s.hostKeys[signer.PublicKey().Type()] = string(ssh.MarshalAuthorizedKey(signer.PublicKey()))
+	}
+	s.listener, err = net.Listen("tcp", "127.0.0.1:0")
+	Expect(err).NotTo(HaveOccurred())
+	go s.accept()
+	return s
+}
+
+// url returns the url of a file of the server.
+func (s *fakeSFTPServer) url(user, path string) string {
+	if user != "" {
+		user += "@"
+	}
+	return fmt.Sprintf("sftp://%s%s%s", user, s.listener.Addr().String(), path)
+}
+
+func (s *fakeSFTPServer) authenticate(conn ssh.ConnMetadata, method string, valid bool) (*ssh.Permissions, error) {
+	if conn.User() != testSFTPUser || !valid {
+		return nil, fmt.Errorf("invalid %s of %s", method, conn.User())
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.authMethods = append(s.authMethods, method)
+	return nil, nil
+}
+
+func (s *fakeSFTPServer) methods() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]string(nil), s.authMethods...)
+}
+
+func (s *fakeSFTPServer) close() {
+	s.listener.Close()
+}
+
+func (s *fakeSFTPServer) accept() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+// handle runs the ssh connection, and starts the sftp subsystem of the sessions that request it.
+func (s *fakeSFTPServer) handle(conn net.Conn) {
+	_, channels, requests, err := ssh.NewServerConn(conn, s.config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(requests)
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "unsupported channel type")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+		go func() {
+			for req := range requests {
+				// The payload of a subsystem request is the name of the subsystem, prefixed by its length
+				ok := req.Type == "subsystem" && len(req.Payload) > 4 && string(req.Payload[4:]) == "sftp"
+				req.Reply(ok, nil)
+				if ok {
+					go s.serve(channel)
+				}
+			}
+		}()
+	}
+}
+
+func (s *fakeSFTPServer) serve(channel ssh.Channel) {
+	defer channel.Close()
+	status := func(id, code uint32, message string) []byte {
+		return appendString(appendString(appendUint32(appendUint32(nil, id), code), message), "")
+	}
+	for {
+		packetType, data, err := readSFTPPacket(channel)
+		if err != nil {
+			return
+		}
+		if packetType == sftpPacketInit {
+			writeSFTPPacket(channel, sftpPacketVersion, appendUint32(nil, sftpProtocolVersion))
+			continue
+		}
+		id, data, _ := consumeUint32(data)
+		// The handle of a file is its path
+		handle, data, _ := consumeString(data)
+		file, ok := s.files[handle]
+		if !ok {
+			writeSFTPPacket(channel, sftpPacketStatus, status(id, 2, "No such file"))
+			continue
+		}
+		switch packetType {
+		case sftpPacketOpen:
+			writeSFTPPacket(channel, sftpPacketHandle, appendString(appendUint32(nil, id), handle))
+		case sftpPacketFstat:
+			attrs := appendUint32(appendUint32(nil, id), sftpAttrSize|sftpAttrUIDGID|sftpAttrPermissions)
+			attrs = appendUint32(appendUint32(appendUint32(appendUint64(attrs, uint64(len(file))), 0), 0), 0100644)
+			writeSFTPPacket(channel, sftpPacketAttrs, attrs)
+		case sftpPacketRead:
+			offset, data, _ := consumeUint64(data)
+			length, _, _ := consumeUint32(data)
+			if offset >= uint64(len(file)) {
+				writeSFTPPacket(channel, sftpPacketStatus, status(id, sftpStatusEOF, "EOF"))
+				continue
+			}
+			if s.maxRead > 0 && length > uint32(s.maxRead) {
+				length = uint32(s.maxRead)
+			}
+			end := offset + uint64(length)
+			if end > uint64(len(file)) {
+				end = uint64(len(file))
+			}
+			writeSFTPPacket(channel, sftpPacketData, appendString(appendUint32(nil, id), string(file[offset:end])))
+		case sftpPacketClose:
+			writeSFTPPacket(channel, sftpPacketStatus, status(id, sftpStatusOK, ""))
+		default:
+			writeSFTPPacket(channel, sftpPacketStatus, status(id, 8, "Operation unsupported"))
+		}
+	}
+}
+
+var _ = Describe("SFTP data source", func() {
+	var (
+		sd             *SFTPDataSource
+		server         *fakeSFTPServer
+		credentialsDir string
+		tmpDir         string
+		err            error
+	)
+
+	BeforeEach(func() {
+		userKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		Expect(err).NotTo(HaveOccurred())
+		userPublicKey, err := ssh.NewPublicKey(&userKey.PublicKey)
+		Expect(err).NotTo(HaveOccurred())
+		server = newFakeSFTPServer(userPublicKey)
+		// Random data larger than a read, so it is read with several reads
+		data := make([]byte, 100000)
+		_, err = rand.Read(data)
+		Expect(err).NotTo(HaveOccurred())
+		server.files["/images/disk.img"] = data
+		tmpDir, err = ioutil.TempDir("", "sftp")
+		Expect(err).NotTo(HaveOccurred())
+		credentialsDir = filepath.Join(tmpDir, "credentials")
+		Expect(os.Mkdir(credentialsDir, 0700)).To(Succeed())
+		der, err := x509.MarshalECPrivateKey(userKey)
+		Expect(err).NotTo(HaveOccurred())
+		privateKey := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+		Expect(ioutil.WriteFile(filepath.Join(credentialsDir, common.KeyPrivateKey), privateKey, 0400)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		if sd != nil {
+			sd.Close()
+			sd = nil
+		}
+		server.close()
+		os.RemoveAll(tmpDir)
+	})
+
+	usePassword := func(password string) {
+		Expect(os.Remove(filepath.Join(credentialsDir, common.KeyPrivateKey))).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(credentialsDir, common.KeyPassword), []byte(password), 0400)).To(Succeed())
+	}
+
+	It("Should read a file with the private key, and write raw data directly to the target", func() {
+		sd, err = NewSFTPDataSource(server.url(testSFTPUser, "/images/disk.img"), "", "", SFTPOptions{
+			HostKey:        server.hostKeys[ssh.KeyAlgoED25519] + " root@sftp-server",
+			CredentialsDir: credentialsDir,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sd.size).To(Equal(uint64(100000)))
+		phase, err := sd.Info()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(phase).To(Equal(ProcessingPhaseTransferDataFile))
+		Expect(sd.readers.progressReader).NotTo(BeNil())
+		target := filepath.Join(tmpDir, "disk.img")
+		phase, err = sd.TransferFile(target)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(phase).To(Equal(ProcessingPhaseResize))
+		data, err := ioutil.ReadFile(target)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(data).To(Equal(server.files["/images/disk.img"]))
+		Expect(server.methods()).To(Equal([]string{"publickey"}))
+	})
+
+	It("Should decompress a compressed file", func() {
+		var buf bytes.Buffer
+		gzw := gzip.NewWriter(&buf)
+		_, err := gzw.Write(server.files["/images/disk.img"])
+		Expect(err).NotTo(HaveOccurred())
+		Expect(gzw.Close()).To(Succeed())
+		server.files["/images/disk.img.gz"] = buf.Bytes()
+
+		sd, err = NewSFTPDataSource(server.url(testSFTPUser, "/images/disk.img.gz"), "", "", SFTPOptions{
+			HostKey:        server.hostKeys[ssh.KeyAlgoED25519],
+			CredentialsDir: credentialsDir,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = sd.Info()
+		Expect(err).NotTo(HaveOccurred())
+		target := filepath.Join(tmpDir, "disk.img")
+		_, err = sd.TransferFile(target)
+		Expect(err).NotTo(HaveOccurred())
+		data, err := ioutil.ReadFile(target)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(data).To(Equal(server.files["/images/disk.img"]))
+	})
+
+	It("Should read the rest of the data after short reads", func() {
+		server.maxRead = 1000
+		sd, err = NewSFTPDataSource(server.url(testSFTPUser, "/images/disk.img"), "", "", SFTPOptions{
+			HostKey:        server.hostKeys[ssh.KeyAlgoED25519],
+			CredentialsDir: credentialsDir,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		data, err := ioutil.ReadAll(sd.sftpReader)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(data).To(Equal(server.files["/images/disk.img"]))
+	})
+
+	It("Should verify the checksum of the file", func() {
+		sd, err = NewSFTPDataSource(server.url(testSFTPUser, "/images/disk.img"), "sha256:"+strings.Repeat("0", 64), "", SFTPOptions{
+			HostKey:        server.hostKeys[ssh.KeyAlgoED25519],
+			CredentialsDir: credentialsDir,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = sd.Info()
+		Expect(err).NotTo(HaveOccurred())
+		_, err = sd.TransferFile(filepath.Join(tmpDir, "disk.img"))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Should read a file relative to the home directory with the password and the username of the credentials", func() {
+		server.files["images/disk.img"] = server.files["/images/disk.img"]
+		usePassword(testSFTPPassword + "\n")
+		Expect(ioutil.WriteFile(filepath.Join(credentialsDir, common.KeyUsername), []byte(testSFTPUser+"\n"), 0400)).To(Succeed())
+		sd, err = NewSFTPDataSource(server.url("other", "/~/images/disk.img"), "", "", SFTPOptions{
+			HostKey:        server.hostKeys[ssh.KeyAlgoED25519],
+			CredentialsDir: credentialsDir,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sd.size).To(Equal(uint64(100000)))
+		Expect(server.methods()).To(Equal([]string{"password"}))
+	})
+
+	It("Should answer the keyboard-interactive questions of the server with the password", func() {
+		server.config.PasswordCallback = nil
+		server.config.KeyboardInteractiveCallback = func(conn ssh.ConnMetadata, challenge ssh.KeyboardInteractiveChallenge) (*ssh.Permissions, error) {
+			answers, err := challenge(conn.User(), "", []string{"Password: "}, []bool{false})
+			if err != nil {
+				return nil, err
+			}
+			return server.authenticate(conn, "keyboard-interactive", len(answers) == 1 && answers[0] == testSFTPPassword)
+		}
+		usePassword(testSFTPPassword)
+		sd, err = NewSFTPDataSource(server.url(testSFTPUser, "/images/disk.img"), "", "", SFTPOptions{
+			HostKey:        server.hostKeys[ssh.KeyAlgoED25519],
+			CredentialsDir: credentialsDir,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(server.methods()).To(Equal([]string{"keyboard-interactive"}))
+	})
+
+	It("Should accept the pinned host key of a server with several host keys", func() {
+		sd, err = NewSFTPDataSource(server.url(testSFTPUser, "/images/disk.img"), "", "", SFTPOptions{
+			HostKey:        server.hostKeys[ssh.KeyAlgoECDSA256],
+			CredentialsDir: credentialsDir,
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("Should fail if the server presents another host key", func() {
+		sd, err = NewSFTPDataSource(server.url(testSFTPUser, "/images/disk.img"), "", "", SFTPOptions{
+			HostKey:        testSFTPHostKey,
+			CredentialsDir: credentialsDir,
+		})
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("host key mismatch"))
+		Expect(server.methods()).To(BeEmpty())
+	})
+
+	It("Should fail on a wrong password", func() {
+		usePassword("wrong")
+		sd, err = NewSFTPDataSource(server.url(testSFTPUser, "/images/disk.img"), "", "", SFTPOptions{
+			HostKey:        server.hostKeys[ssh.KeyAlgoED25519],
+			CredentialsDir: credentialsDir,
+		})
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("unable to authenticate"))
+	})
+
+	It("Should fail on a private key the server does not accept", func() {
+		otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		Expect(err).NotTo(HaveOccurred())
+		der, err := x509.MarshalECPrivateKey(otherKey)
+		Expect(err).NotTo(HaveOccurred())
+		privateKey := filepath.Join(credentialsDir, common.KeyPrivateKey)
+		Expect(os.Remove(privateKey)).To(Succeed())
+		Expect(ioutil.WriteFile(privateKey, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0400)).To(Succeed())
+		sd, err = NewSFTPDataSource(server.url(testSFTPUser, "/images/disk.img"), "", "", SFTPOptions{
+			HostKey:        server.hostKeys[ssh.KeyAlgoED25519],
+			CredentialsDir: credentialsDir,
+		})
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("unable to authenticate"))
+	})
+
+	It("Should fail on an invalid private key", func() {
+		privateKey := filepath.Join(credentialsDir, common.KeyPrivateKey)
+		Expect(os.Remove(privateKey)).To(Succeed())
+		Expect(ioutil.WriteFile(privateKey, []byte("private key"), 0400)).To(Succeed())
+		sd, err = NewSFTPDataSource(server.url(testSFTPUser, "/images/disk.img"), "", "", SFTPOptions{
+			HostKey:        server.hostKeys[ssh.KeyAlgoED25519],
+			CredentialsDir: credentialsDir,
+		})
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("invalid private key"))
+	})
+
+	It("Should fail with the message of the server, if the file does not exist", func() {
+		sd, err = NewSFTPDataSource(server.url(testSFTPUser, "/images/other.img"), "", "", SFTPOptions{
+			HostKey:        server.hostKeys[ssh.KeyAlgoED25519],
+			CredentialsDir: credentialsDir,
+		})
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("No such file"))
+	})
+
+	It("Should fail on an invalid host key", func() {
+		sd, err = NewSFTPDataSource(server.url(testSFTPUser, "/images/disk.img"), "", "", SFTPOptions{
+			HostKey:        "ssh-ed25519 not-a-key",
+			CredentialsDir: credentialsDir,
+		})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Should fail without a password or private key", func() {
+		Expect(os.Remove(filepath.Join(credentialsDir, common.KeyPrivateKey))).To(Succeed())
+		sd, err = NewSFTPDataSource(server.url(testSFTPUser, "/images/disk.img"), "", "", SFTPOptions{
+			HostKey:        server.hostKeys[ssh.KeyAlgoED25519],
+			CredentialsDir: credentialsDir,
+		})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Should fail without a username", func() {
+		sd, err = NewSFTPDataSource(server.url("", "/images/disk.img"), "", "", SFTPOptions{
+			HostKey:        server.hostKeys[ssh.KeyAlgoED25519],
+			CredentialsDir: credentialsDir,
+		})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Should fail on a url without a path", func() {
+		sd, err = NewSFTPDataSource(server.url(testSFTPUser, "/"), "", "", SFTPOptions{
+			HostKey:        server.hostKeys[ssh.KeyAlgoED25519],
+			CredentialsDir: credentialsDir,
+		})
+		Expect(err).To(HaveOccurred())
+	})
+})
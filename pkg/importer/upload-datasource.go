@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 
 	"k8s.io/klog"
+	cdiv1 "kubevirt.io/containerized-data-importer/pkg/apis/core/v1alpha1"
 	"kubevirt.io/containerized-data-importer/pkg/util"
 )
 
@@ -23,12 +24,15 @@ type UploadDataSource struct {
 	readers *FormatReaders
 	// url to a file in scratch space.
 	url *url.URL
+	// the expected checksum of the data, in the form <algorithm>:<hex digest>.
+	checksum string
 }
 
 // NewUploadDataSource creates a new instance of an UploadDataSource
-func NewUploadDataSource(stream io.ReadCloser) *UploadDataSource {
+func NewUploadDataSource(stream io.ReadCloser, checksum string) *UploadDataSource {
 	return &UploadDataSource{
-		stream: stream,
+		stream:   stream,
+		checksum: checksum,
 	}
 }
 
@@ -36,7 +40,7 @@ func NewUploadDataSource(stream io.ReadCloser) *UploadDataSource {
 func (ud *UploadDataSource) Info() (ProcessingPhase, error) {
 	var err error
 	// Hardcoded to only accept kubevirt content type.
-	ud.readers, err = NewFormatReaders(ud.stream, uint64(0))
+	ud.readers, err = NewFormatReaders(ud.stream, uint64(0), ud.checksum, cdiv1.DataVolumeKubeVirt, "")
 	if err != nil {
 		klog.Errorf("Error creating readers: %v", err)
 		return ProcessingPhaseError, err
@@ -59,6 +63,12 @@ func (ud *UploadDataSource) Transfer(path string) (ProcessingPhase, error) {
 	if err != nil {
 		return ProcessingPhaseError, err
 	}
+	if err := ud.readers.VerifyChecksum(); err != nil {
+		return ProcessingPhaseError, err
+	}
+	if file, err = ud.readers.extractImageArchive(file); err != nil {
+		return ProcessingPhaseError, err
+	}
 	// If we successfully wrote to the file, then the parse will succeed.
 	ud.url, _ = url.Parse(file)
 	return ProcessingPhaseProcess, nil
@@ -70,6 +80,9 @@ func (ud *UploadDataSource) TransferFile(fileName string) (ProcessingPhase, erro
 	if err != nil {
 		return ProcessingPhaseError, err
 	}
+	if err := ud.readers.VerifyChecksum(); err != nil {
+		return ProcessingPhaseError, err
+	}
 	return ProcessingPhaseResize, nil
 }
 
@@ -100,10 +113,11 @@ type AsyncUploadDataSource struct {
 }
 
 // NewAsyncUploadDataSource creates a new instance of an UploadDataSource
-func NewAsyncUploadDataSource(stream io.ReadCloser) *AsyncUploadDataSource {
+func NewAsyncUploadDataSource(stream io.ReadCloser, checksum string) *AsyncUploadDataSource {
 	return &AsyncUploadDataSource{
 		uploadDataSource: UploadDataSource{
-			stream: stream,
+			stream:   stream,
+			checksum: checksum,
 		},
 		ResumePhase: ProcessingPhaseInfo,
 	}
@@ -125,6 +139,12 @@ func (aud *AsyncUploadDataSource) Transfer(path string) (ProcessingPhase, error)
 	if err != nil {
 		return ProcessingPhaseError, err
 	}
+	if err := aud.uploadDataSource.readers.VerifyChecksum(); err != nil {
+		return ProcessingPhaseError, err
+	}
+	if file, err = aud.uploadDataSource.readers.extractImageArchive(file); err != nil {
+		return ProcessingPhaseError, err
+	}
 	// If we successfully wrote to the file, then the parse will succeed.
 	aud.uploadDataSource.url, _ = url.Parse(file)
 	aud.ResumePhase = ProcessingPhaseProcess
@@ -137,6 +157,9 @@ func (aud *AsyncUploadDataSource) TransferFile(fileName string) (ProcessingPhase
 	if err != nil {
 		return ProcessingPhaseError, err
 	}
+	if err := aud.uploadDataSource.readers.VerifyChecksum(); err != nil {
+		return ProcessingPhaseError, err
+	}
 	aud.ResumePhase = ProcessingPhaseResize
 	return ProcessingPhasePause, nil
 }
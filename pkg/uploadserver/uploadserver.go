@@ -70,6 +70,7 @@ type uploadServerApp struct {
 	keyFile     string
 	certFile    string
 	imageSize   string
+	checksum    string
 	mux         *http.ServeMux
 	uploading   bool
 	processing  bool
@@ -84,7 +85,7 @@ var uploadProcessorFunc = newUploadStreamProcessor
 var uploadProcessorFuncAsync = newAsyncUploadStreamProcessor
 
 // NewUploadServer returns a new instance of uploadServerApp
-func NewUploadServer(bindAddress string, bindPort int, destination, tlsKey, tlsCert, clientCert, clientName, imageSize string) UploadServer {
+func NewUploadServer(bindAddress string, bindPort int, destination, tlsKey, tlsCert, clientCert, clientName, imageSize, checksum string) UploadServer {
 	server := &uploadServerApp{
 		bindAddress: bindAddress,
 		bindPort:    bindPort,
@@ -94,6 +95,7 @@ func NewUploadServer(bindAddress string, bindPort int, destination, tlsKey, tlsC
 		clientCert:  clientCert,
 		clientName:  clientName,
 		imageSize:   imageSize,
+		checksum:    checksum,
 		mux:         http.NewServeMux(),
 		uploading:   false,
 		done:        false,
@@ -277,13 +279,13 @@ func (app *uploadServerApp) uploadHandlerAsync(w http.ResponseWriter, r *http.Re
 
 	klog.Infof("Content type header is %q\n", cdiContentType)
 
-	processor, err := uploadProcessorFuncAsync(r.Body, app.destination, app.imageSize, cdiContentType)
+	processor, err := uploadProcessorFuncAsync(r.Body, app.destination, app.imageSize, app.checksum, cdiContentType)
 
 	app.mutex.Lock()
 
 	if err != nil {
 		klog.Errorf("Saving stream failed: %s", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		writeUploadError(w, err)
 		app.uploading = false
 		app.mutex.Unlock()
 		return
@@ -318,14 +320,14 @@ func (app *uploadServerApp) uploadHandler(w http.ResponseWriter, r *http.Request
 
 	klog.Infof("Content type header is %q\n", cdiContentType)
 
-	err := uploadProcessorFunc(r.Body, app.destination, app.imageSize, cdiContentType)
+	err := uploadProcessorFunc(r.Body, app.destination, app.imageSize, app.checksum, cdiContentType)
 
 	app.mutex.Lock()
 	defer app.mutex.Unlock()
 
 	if err != nil {
 		klog.Errorf("Saving stream failed: %s", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		writeUploadError(w, err)
 		app.uploading = false
 		return
 	}
@@ -338,18 +340,28 @@ func (app *uploadServerApp) uploadHandler(w http.ResponseWriter, r *http.Request
 	klog.Infof("Wrote data to %s", app.destination)
 }
 
-func newAsyncUploadStreamProcessor(stream io.ReadCloser, dest, imageSize, contentType string) (*importer.DataProcessor, error) {
-	uds := importer.NewAsyncUploadDataSource(stream)
+// writeUploadError tells the client the upload failed. A checksum mismatch is reported with the reason, since the
+// client can fix it by uploading the correct data.
+func writeUploadError(w http.ResponseWriter, err error) {
+	if errors.Cause(err) == importer.ErrChecksumMismatch {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusInternalServerError)
+}
+
+func newAsyncUploadStreamProcessor(stream io.ReadCloser, dest, imageSize, checksum, contentType string) (*importer.DataProcessor, error) {
+	uds := importer.NewAsyncUploadDataSource(stream, checksum)
 	processor := importer.NewDataProcessor(uds, dest, common.ImporterVolumePath, common.ScratchDataDir, imageSize)
 	return processor, processor.ProcessDataWithPause()
 }
 
-func newUploadStreamProcessor(stream io.ReadCloser, dest, imageSize, contentType string) error {
+func newUploadStreamProcessor(stream io.ReadCloser, dest, imageSize, checksum, contentType string) error {
 	if contentType == FilesystemCloneContentType {
 		return filesystemCloneProcessor(stream, common.ImporterVolumePath)
 	}
 
-	uds := importer.NewUploadDataSource(stream)
+	uds := importer.NewUploadDataSource(stream, checksum)
 	processor := importer.NewDataProcessor(uds, dest, common.ImporterVolumePath, common.ScratchDataDir, imageSize)
 	return processor.ProcessData()
 }
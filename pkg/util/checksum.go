@@ -0,0 +1,91 @@
+/*
+Copyright 2020 The CDI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"hash"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// checksumAlgorithms maps the supported checksum algorithms to a constructor of their hash, and the length of the
+// hex encoded digest.
+var checksumAlgorithms = map[string]struct {
+	newHash func() hash.Hash
+	hexLen  int
+}{
+	"md5":    {md5.New, md5.Size * 2},
+	"sha256": {sha256.New, sha256.Size * 2},
+	"sha512": {sha512.New, sha512.Size * 2},
+}
+
+// Checksum is an expected digest of a data stream, in the form <algorithm>:<hex digest>.
+type Checksum struct {
+	Algorithm string
+	Digest    string
+}
+
+// ParseChecksum parses a checksum in the form <algorithm>:<hex digest>. An empty string returns a nil checksum.
+func ParseChecksum(checksum string) (*Checksum, error) {
+	if checksum == "" {
+		return nil, nil
+	}
+	parts := strings.SplitN(checksum, ":", 2)
+	if len(parts) != 2 {
+		return nil, errors.Errorf("invalid checksum %q, expected <algorithm>:<hex digest>", checksum)
+	}
+	algorithm := strings.ToLower(parts[0])
+	digest := strings.ToLower(parts[1])
+	alg, ok := checksumAlgorithms[algorithm]
+	if !ok {
+		return nil, errors.Errorf("unsupported checksum algorithm %q, supported algorithms: %s", parts[0], strings.Join(SupportedChecksumAlgorithms(), ", "))
+	}
+	if _, err := hex.DecodeString(digest); err != nil || len(digest) != alg.hexLen {
+		return nil, errors.Errorf("invalid %s digest %q, expected %d hex characters", algorithm, parts[1], alg.hexLen)
+	}
+	return &Checksum{Algorithm: algorithm, Digest: digest}, nil
+}
+
+// SupportedChecksumAlgorithms returns the sorted names of the supported checksum algorithms.
+func SupportedChecksumAlgorithms() []string {
+	algorithms := make([]string, 0, len(checksumAlgorithms))
+	for algorithm := range checksumAlgorithms {
+		algorithms = append(algorithms, algorithm)
+	}
+	sort.Strings(algorithms)
+	return algorithms
+}
+
+// NewHash returns a new hash for the algorithm of the checksum.
+func (c *Checksum) NewHash() hash.Hash {
+	return checksumAlgorithms[c.Algorithm].newHash()
+}
+
+// Matches returns true if the passed in hash has the expected digest.
+func (c *Checksum) Matches(h hash.Hash) bool {
+	return hex.EncodeToString(h.Sum(nil)) == c.Digest
+}
+
+func (c *Checksum) String() string {
+	return c.Algorithm + ":" + c.Digest
+}
@@ -0,0 +1,49 @@
+package util
+
+import (
+	"crypto/sha256"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+const (
+	helloSha256 = "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+	helloMd5    = "5d41402abc4b2a76b9719d911017c592"
+)
+
+var _ = Describe("Checksum", func() {
+	table.DescribeTable("Parse checksum", func(checksum string, expected *Checksum, expectErr bool) {
+		result, err := ParseChecksum(checksum)
+		if expectErr {
+			Expect(err).To(HaveOccurred())
+		} else {
+			Expect(err).NotTo(HaveOccurred())
+		}
+		Expect(result).To(Equal(expected))
+	},
+		table.Entry("empty checksum", "", nil, false),
+		table.Entry("valid sha256", "sha256:"+helloSha256, &Checksum{Algorithm: "sha256", Digest: helloSha256}, false),
+		table.Entry("valid md5", "md5:"+helloMd5, &Checksum{Algorithm: "md5", Digest: helloMd5}, false),
+		table.Entry("upper case", "SHA256:"+strings.ToUpper(helloSha256), &Checksum{Algorithm: "sha256", Digest: helloSha256}, false),
+		table.Entry("valid sha512", "sha512:"+strings.Repeat("a", 128), &Checksum{Algorithm: "sha512", Digest: strings.Repeat("a", 128)}, false),
+		table.Entry("missing algorithm", helloSha256, nil, true),
+		table.Entry("unsupported algorithm", "sha1:"+helloSha256, nil, true),
+		table.Entry("wrong digest length", "sha256:"+helloMd5, nil, true),
+		table.Entry("digest not hex", "md5:"+strings.Repeat("z", 32), nil, true),
+	)
+
+	It("Should match the digest of a hash", func() {
+		checksum, err := ParseChecksum("sha256:" + helloSha256)
+		Expect(err).NotTo(HaveOccurred())
+		h := checksum.NewHash()
+		Expect(h.Size()).To(Equal(sha256.Size))
+		h.Write([]byte("hello"))
+		Expect(checksum.Matches(h)).To(BeTrue())
+		h.Write([]byte("world"))
+		Expect(checksum.Matches(h)).To(BeFalse())
+		Expect(checksum.String()).To(Equal("sha256:" + helloSha256))
+	})
+})
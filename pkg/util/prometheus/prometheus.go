@@ -6,6 +6,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"path"
+	"sync/atomic"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -58,8 +59,9 @@ func (r *ProgressReader) timedUpdateProgress() {
 func (r *ProgressReader) updateProgress() bool {
 	if r.total > 0 {
 		currentProgress := 100.0
-		if !r.Done && r.Current < r.total {
-			currentProgress = float64(r.Current) / float64(r.total) * 100.0
+		current := atomic.LoadUint64(&r.Current)
+		if !r.IsDone() && current < r.total {
+			currentProgress = float64(current) / float64(r.total) * 100.0
 		}
 		metric := &dto.Metric{}
 		r.progress.WithLabelValues(r.ownerUID).Write(metric)
@@ -67,7 +69,7 @@ func (r *ProgressReader) updateProgress() bool {
 			r.progress.WithLabelValues(r.ownerUID).Add(currentProgress - *metric.Counter.Value)
 		}
 		klog.V(1).Infoln(fmt.Sprintf("%.2f", currentProgress))
-		return !r.Done
+		return !r.IsDone()
 	}
 	return false
 }
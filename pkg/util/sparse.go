@@ -0,0 +1,172 @@
+/*
+Copyright 2020 The CDI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"bytes"
+	"os"
+	"unsafe"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+	"k8s.io/klog"
+)
+
+const (
+	// sparseBlockSize is the size of the blocks that are checked for zeroes when writing sparse files.
+	sparseBlockSize = 4096
+	// blkZeroOut is the BLKZEROOUT ioctl, _IO(0x12, 127), which zeroes a range of a block device.
+	blkZeroOut = 0x127f
+	// blkSectorSize is the alignment of the ranges passed to BLKZEROOUT.
+	blkSectorSize = 512
+)
+
+// zeroes is compared to the blocks that are written, and written when the zero blocks cannot be skipped.
+var zeroes = make([]byte, 256*sparseBlockSize)
+
+// SparseWriter writes to a file starting at an offset, without writing the blocks that only contain zeroes. In a
+// regular file the zero blocks past the end of the file are left as holes, and the ones that overwrite existing data
+// are punched out. On a block device the zero blocks are zeroed with the BLKZEROOUT ioctl, which thin provisioned
+// devices turn into discards of the blocks. If the file system or the device cannot do either, the zeroes are written.
+// Discarding the blocks with BLKDISCARD is not enough, since most devices do not guarantee that discarded blocks read
+// back as zeroes. Flush has to be called once all the data is written.
+type SparseWriter struct {
+	file        *os.File
+	offset      int64
+	size        int64
+	blockDevice bool
+	// the run of zero blocks that has not been written yet
+	zeroStart int64
+	zeroLen   int64
+}
+
+// NewSparseWriter creates a new SparseWriter, writing to the passed in file starting at offset.
+func NewSparseWriter(file *os.File, offset int64) (*SparseWriter, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not stat %s", file.Name())
+	}
+	return &SparseWriter{
+		file:        file,
+		offset:      offset,
+		size:        info.Size(),
+		blockDevice: info.Mode()&os.ModeDevice != 0,
+	}, nil
+}
+
+func (w *SparseWriter) Write(p []byte) (int, error) {
+	written := 0
+	for written < len(p) {
+		// find the run of blocks that are all either zero or not
+		zero := isZeroBlock(p[written:])
+		end := written
+		for end < len(p) && isZeroBlock(p[end:]) == zero {
+			end += sparseBlockSize
+		}
+		if end > len(p) {
+			end = len(p)
+		}
+		if zero {
+			if w.zeroLen == 0 {
+				w.zeroStart = w.offset
+			}
+			w.zeroLen += int64(end - written)
+			w.offset += int64(end - written)
+			written = end
+			continue
+		}
+		if err := w.flushZeroes(); err != nil {
+			return written, err
+		}
+		n, err := w.file.WriteAt(p[written:end], w.offset)
+		w.offset += int64(n)
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// Flush zeroes the trailing run of zero blocks, and extends a regular file to the end of the written data.
+func (w *SparseWriter) Flush() error {
+	if err := w.flushZeroes(); err != nil {
+		return err
+	}
+	if w.blockDevice || w.offset <= w.size {
+		return nil
+	}
+	if err := w.file.Truncate(w.offset); err != nil {
+		return errors.Wrapf(err, "could not set size of %s", w.file.Name())
+	}
+	w.size = w.offset
+	return nil
+}
+
+// isZeroBlock returns true if the first block of p only contains zeroes.
+func isZeroBlock(p []byte) bool {
+	if len(p) > sparseBlockSize {
+		p = p[:sparseBlockSize]
+	}
+	return bytes.Equal(p, zeroes[:len(p)])
+}
+
+func (w *SparseWriter) flushZeroes() error {
+	start, length := w.zeroStart, w.zeroLen
+	w.zeroLen = 0
+	if length == 0 {
+		return nil
+	}
+	if w.blockDevice {
+		if start%blkSectorSize == 0 && length%blkSectorSize == 0 {
+			r := [2]uint64{uint64(start), uint64(length)}
+			_, _, errno := unix.Syscall(unix.SYS_IOCTL, w.file.Fd(), blkZeroOut, uintptr(unsafe.Pointer(&r)))
+			if errno == 0 {
+				return nil
+			}
+			klog.V(3).Infof("BLKZEROOUT of %s failed, writing zeroes: %v\n", w.file.Name(), errno)
+		}
+		return w.writeZeroes(start, length)
+	}
+	// Past the end of a regular file there is nothing to overwrite, the file is extended with a hole.
+	if start+length > w.size {
+		length = w.size - start
+	}
+	if length <= 0 {
+		return nil
+	}
+	if err := unix.Fallocate(int(w.file.Fd()), unix.FALLOC_FL_PUNCH_HOLE|unix.FALLOC_FL_KEEP_SIZE, start, length); err != nil {
+		klog.V(3).Infof("Punching a hole in %s failed, writing zeroes: %v\n", w.file.Name(), err)
+		return w.writeZeroes(start, length)
+	}
+	return nil
+}
+
+func (w *SparseWriter) writeZeroes(start, length int64) error {
+	for length > 0 {
+		n := int64(len(zeroes))
+		if n > length {
+			n = length
+		}
+		if _, err := w.file.WriteAt(zeroes[:n], start); err != nil {
+			return errors.Wrapf(err, "could not write zeroes to %s", w.file.Name())
+		}
+		start += n
+		length -= n
+	}
+	return nil
+}
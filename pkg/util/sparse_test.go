@@ -0,0 +1,109 @@
+package util
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+// sparseTestData returns 8MiB of zeroes, with data in the middle and, unless trailingZeroes is set, at the end.
+func sparseTestData(trailingZeroes bool) []byte {
+	data := make([]byte, 8*1024*1024)
+	copy(data[4*1024*1024+100:], "data in the middle")
+	if !trailingZeroes {
+		copy(data[len(data)-10:], "data at the end")
+	}
+	return data
+}
+
+func allocatedBytes(fileName string) int64 {
+	info, err := os.Stat(fileName)
+	Expect(err).ToNot(HaveOccurred())
+	return info.Sys().(*syscall.Stat_t).Blocks * 512
+}
+
+var _ = Describe("SparseWriter", func() {
+	var tmpDir string
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "sparse")
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(tmpDir)
+	})
+
+	table.DescribeTable("Should not write the zero blocks", func(chunkSize int, trailingZeroes bool) {
+		data := sparseTestData(trailingZeroes)
+		fileName := filepath.Join(tmpDir, "disk.img")
+		file, err := os.Create(fileName)
+		Expect(err).ToNot(HaveOccurred())
+		defer file.Close()
+		w, err := NewSparseWriter(file, 0)
+		Expect(err).ToNot(HaveOccurred())
+		for start := 0; start < len(data); start += chunkSize {
+			end := start + chunkSize
+			if end > len(data) {
+				end = len(data)
+			}
+			n, err := w.Write(data[start:end])
+			Expect(err).ToNot(HaveOccurred())
+			Expect(n).To(Equal(end - start))
+		}
+		Expect(w.Flush()).To(Succeed())
+
+		result, err := ioutil.ReadFile(fileName)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result).To(Equal(data))
+		Expect(allocatedBytes(fileName)).To(BeNumerically("<", len(data)/2))
+	},
+		table.Entry("with block sized writes", 32*sparseBlockSize, false),
+		table.Entry("with writes that are not block aligned", 10000, false),
+		table.Entry("when the data ends with zeroes", 32*sparseBlockSize, true),
+	)
+
+	It("Should punch holes in the data it overwrites", func() {
+		fileName := filepath.Join(tmpDir, "disk.img")
+		Expect(ioutil.WriteFile(fileName, bytes.Repeat([]byte{0xff}, 8*1024*1024), 0644)).To(Succeed())
+		Expect(allocatedBytes(fileName)).To(BeNumerically(">=", 8*1024*1024))
+		file, err := os.OpenFile(fileName, os.O_WRONLY, 0644)
+		Expect(err).ToNot(HaveOccurred())
+		defer file.Close()
+		w, err := NewSparseWriter(file, 0)
+		Expect(err).ToNot(HaveOccurred())
+		data := sparseTestData(true)
+		_, err = w.Write(data)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(w.Flush()).To(Succeed())
+
+		result, err := ioutil.ReadFile(fileName)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result).To(Equal(data))
+		Expect(allocatedBytes(fileName)).To(BeNumerically("<", len(data)/2))
+	})
+
+	It("Should write starting at the offset", func() {
+		fileName := filepath.Join(tmpDir, "disk.img")
+		Expect(ioutil.WriteFile(fileName, []byte("header"), 0644)).To(Succeed())
+		file, err := os.OpenFile(fileName, os.O_WRONLY, 0644)
+		Expect(err).ToNot(HaveOccurred())
+		defer file.Close()
+		w, err := NewSparseWriter(file, 6)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = w.Write(append(make([]byte, 2*sparseBlockSize), "data"...))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(w.Flush()).To(Succeed())
+
+		result, err := ioutil.ReadFile(fileName)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result).To(Equal(append(append([]byte("header"), make([]byte, 2*sparseBlockSize)...), "data"...)))
+	})
+})
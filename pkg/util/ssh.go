@@ -0,0 +1,77 @@
+/*
+Copyright 2020 The CDI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// sshKeyTypes are the types of the SSH public keys that are supported as host keys
+var sshKeyTypes = map[string]bool{
+	"ssh-ed25519":         true,
+	"ssh-rsa":             true,
+	"ecdsa-sha2-nistp256": true,
+	"ecdsa-sha2-nistp384": true,
+	"ecdsa-sha2-nistp521": true,
+}
+
+// SSHPublicKey is an SSH public key
+type SSHPublicKey struct {
+	// Type is the type of the key, like ssh-ed25519
+	Type string
+	// Key is the base64 encoded key
+	Key string
+}
+
+// String returns the key in the authorized_keys format, without a comment.
+func (k *SSHPublicKey) String() string {
+	return k.Type + " " + k.Key
+}
+
+// ParseSSHPublicKey parses an SSH public key in the authorized_keys format, like "ssh-ed25519 AAAAC3Nza... comment".
+func ParseSSHPublicKey(key string) (*SSHPublicKey, error) {
+	fields := strings.Fields(key)
+	if len(fields) < 2 {
+		return nil, errors.New("invalid ssh public key, expected <type> <base64 key>")
+	}
+	if !sshKeyTypes[fields[0]] {
+		var types []string
+		for keyType := range sshKeyTypes {
+			types = append(types, keyType)
+		}
+		sort.Strings(types)
+		return nil, errors.Errorf("unsupported ssh public key type %q, supported types are %s", fields[0], strings.Join(types, ", "))
+	}
+	data, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil {
+		return nil, errors.New("invalid ssh public key, the key is not base64 encoded")
+	}
+	// The encoded key starts with its type, as a string prefixed by its length
+	if len(data) < 4 || binary.BigEndian.Uint32(data) != uint32(len(fields[0])) ||
+		len(data) < 4+len(fields[0]) || string(data[4:4+len(fields[0])]) != fields[0] {
+		return nil, errors.Errorf("invalid ssh public key, the key is not of type %s", fields[0])
+	}
+	return &SSHPublicKey{
+		Type: fields[0],
+		Key:  fields[1],
+	}, nil
+}
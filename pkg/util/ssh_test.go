@@ -0,0 +1,37 @@
+package util
+
+import (
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+const (
+	testEd25519Key = "AAAAC3NzaC1lZDI1NTE5AAAAIKVno3ZtsMKI5aSg0ao8jhBt8VU3nT6fg05nEY4E+a89"
+	testECDSAKey   = "AAAAE2VjZHNhLXNoYTItbmlzdHAyNTYAAAAIbmlzdHAyNTYAAABBBM+Ytel3r34kbnXMPLp5s3OEW6d2Xmg0GZkzkVVJPmI9VOG0rn1YucQ0AuZmF9112bxOfFvX6a5RbGQ+uj9yKds="
+)
+
+var _ = Describe("SSH public key", func() {
+	table.DescribeTable("Parse ssh public key", func(key string, expected *SSHPublicKey, expectErr bool) {
+		result, err := ParseSSHPublicKey(key)
+		if expectErr {
+			Expect(err).To(HaveOccurred())
+		} else {
+			Expect(err).NotTo(HaveOccurred())
+		}
+		Expect(result).To(Equal(expected))
+	},
+		table.Entry("ed25519 key", "ssh-ed25519 "+testEd25519Key, &SSHPublicKey{Type: "ssh-ed25519", Key: testEd25519Key}, false),
+		table.Entry("ecdsa key with a comment", "ecdsa-sha2-nistp256 "+testECDSAKey+" root@sftp-server\n", &SSHPublicKey{Type: "ecdsa-sha2-nistp256", Key: testECDSAKey}, false),
+		table.Entry("empty key", "", nil, true),
+		table.Entry("key without a type", testEd25519Key, nil, true),
+		table.Entry("unsupported type", "ssh-dss "+testEd25519Key, nil, true),
+		table.Entry("key that is not base64 encoded", "ssh-ed25519 not-base64!", nil, true),
+		table.Entry("key of another type", "ssh-ed25519 "+testECDSAKey, nil, true),
+	)
+
+	It("Should return the key in the authorized_keys format", func() {
+		key := &SSHPublicKey{Type: "ssh-ed25519", Key: testEd25519Key}
+		Expect(key.String()).To(Equal("ssh-ed25519 " + testEd25519Key))
+	})
+})
@@ -0,0 +1,318 @@
+/*
+Copyright 2020 The CDI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/klog"
+)
+
+// UnArchiveTar unarchives a tar stream using the specified io.Reader to the specified destination. If members are
+// passed in, only the entries matching them, or contained in the matching directories, are extracted.
+//
+// The archive is not trusted. Leading slashes are removed from the entry names, and entries that leave destDir, or
+// hard links that point outside of it, are rejected. Symbolic links are created as is, even if they point outside of
+// destDir, since nothing is written through them: an entry below a symbolic link is rejected, and an entry that
+// replaces a link replaces the link itself. Device nodes and named pipes are skipped, and the setuid,
+// setgid and sticky bits are cleared. Ownership is only preserved when running as root. Runs of zeroes in regular
+// files are not written, so the extracted files are sparse.
+func UnArchiveTar(reader io.Reader, destDir string, members ...string) error {
+	klog.V(1).Infof("begin untar to %s...\n", destDir)
+	destDir, err := filepath.Abs(destDir)
+	if err != nil {
+		return errors.Wrapf(err, "invalid destination %s", destDir)
+	}
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return errors.Wrapf(err, "could not create destination %s", destDir)
+	}
+	ex := &tarExtractor{
+		destDir:   destDir,
+		members:   make([]string, 0, len(members)),
+		keepOwner: os.Geteuid() == 0,
+	}
+	for _, member := range members {
+		name, err := sanitizeTarName(member)
+		if err != nil {
+			return err
+		}
+		ex.members = append(ex.members, name)
+	}
+
+	tr := tar.NewReader(reader)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return errors.Wrap(err, "could not read tar header")
+		}
+		if err := ex.extract(hdr, tr); err != nil {
+			return err
+		}
+	}
+	if err := ex.finish(); err != nil {
+		return err
+	}
+	klog.V(1).Infof("extracted %d entries, %d bytes to %s\n", ex.entries, ex.bytes, destDir)
+	return nil
+}
+
+// UnArchiveLocalTar unarchives a local tar file, optionally gzip compressed, to the specified destination.
+func UnArchiveLocalTar(filePath, destDir string, members ...string) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return errors.Wrap(err, "could not open tar file")
+	}
+	defer file.Close()
+	fileReader := bufio.NewReader(file)
+	var reader io.Reader = fileReader
+	if magic, err := fileReader.Peek(2); err == nil && bytes.Equal(magic, []byte{0x1F, 0x8B}) {
+		gzr, err := gzip.NewReader(fileReader)
+		if err != nil {
+			return errors.Wrap(err, "could not create gzip reader")
+		}
+		defer gzr.Close()
+		reader = gzr
+	}
+	return UnArchiveTar(reader, destDir, members...)
+}
+
+// tarExtractor holds the state of an extraction.
+type tarExtractor struct {
+	destDir   string
+	members   []string
+	keepOwner bool
+	// directories are updated after all the entries are extracted, since extracting their content modifies them
+	dirs    []*tar.Header
+	entries int
+	bytes   int64
+}
+
+// sanitizeTarName returns the cleaned name of an entry, relative to the directory the archive is extracted to. An
+// error is returned if the name leaves that directory.
+func sanitizeTarName(name string) (string, error) {
+	cleaned := filepath.Clean(strings.TrimLeft(filepath.FromSlash(name), string(os.PathSeparator)))
+	if cleaned == ".." || strings.HasPrefix(cleaned, ".."+string(os.PathSeparator)) {
+		return "", errors.Errorf("invalid archive entry %q, it leaves the destination directory", name)
+	}
+	if cleaned == "." {
+		return "", nil
+	}
+	return cleaned, nil
+}
+
+// selected returns true if the entry should be extracted.
+func (ex *tarExtractor) selected(name string) bool {
+	if len(ex.members) == 0 {
+		return true
+	}
+	for _, member := range ex.members {
+		if member == "" || name == member || strings.HasPrefix(name, member+"/") || strings.HasPrefix(member, name+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func (ex *tarExtractor) extract(hdr *tar.Header, r io.Reader) error {
+	name, err := sanitizeTarName(hdr.Name)
+	if err != nil {
+		return err
+	}
+	if !ex.selected(name) {
+		return nil
+	}
+	if name == "" {
+		// The destination directory itself
+		if hdr.Typeflag == tar.TypeDir {
+			ex.dirs = append(ex.dirs, hdr)
+		}
+		return nil
+	}
+	target := filepath.Join(ex.destDir, name)
+	if err := ex.checkParents(name, true); err != nil {
+		return err
+	}
+	klog.V(3).Infof("%s\n", name)
+
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		if err := ex.makeDir(target); err != nil {
+			return err
+		}
+		ex.dirs = append(ex.dirs, hdr)
+	case tar.TypeReg, tar.TypeRegA, tar.TypeGNUSparse:
+		if err := ex.writeFile(target, r); err != nil {
+			return err
+		}
+	case tar.TypeSymlink:
+		if err := removeExisting(target); err != nil {
+			return err
+		}
+		if err := os.Symlink(hdr.Linkname, target); err != nil {
+			return errors.Wrapf(err, "could not create symbolic link %s", target)
+		}
+	case tar.TypeLink:
+		linkName, err := sanitizeTarName(hdr.Linkname)
+		if err != nil {
+			return errors.Errorf("invalid archive entry %q, hard link to %q leaves the destination directory", hdr.Name, hdr.Linkname)
+		}
+		source := filepath.Join(ex.destDir, linkName)
+		if err := ex.checkParents(linkName, false); err != nil {
+			return err
+		}
+		if info, err := os.Lstat(source); err != nil || !info.Mode().IsRegular() {
+			return errors.Errorf("invalid archive entry %q, hard link to %q is not an extracted regular file", hdr.Name, hdr.Linkname)
+		}
+		if err := removeExisting(target); err != nil {
+			return err
+		}
+		if err := os.Link(source, target); err != nil {
+			return errors.Wrapf(err, "could not create hard link %s", target)
+		}
+	case tar.TypeChar, tar.TypeBlock, tar.TypeFifo:
+		klog.Warningf("skipping archive entry %q, device nodes and named pipes are not extracted\n", hdr.Name)
+		return nil
+	default:
+		klog.Warningf("skipping archive entry %q of unsupported type %q\n", hdr.Name, hdr.Typeflag)
+		return nil
+	}
+	ex.entries++
+	if hdr.Typeflag == tar.TypeDir || hdr.Typeflag == tar.TypeLink {
+		// Directories are updated once extracted, a hard link shares the attributes of its source
+		return nil
+	}
+	return ex.setAttributes(target, hdr)
+}
+
+// checkParents makes sure none of the parent directories of an entry is a symbolic link, so nothing is written
+// outside of the destination directory through a link. If create is true, the missing parent directories are created.
+func (ex *tarExtractor) checkParents(name string, create bool) error {
+	path := ex.destDir
+	parts := strings.Split(name, string(os.PathSeparator))
+	for _, part := range parts[:len(parts)-1] {
+		path = filepath.Join(path, part)
+		info, err := os.Lstat(path)
+		if os.IsNotExist(err) && create {
+			if err := os.Mkdir(path, 0755); err != nil {
+				return errors.Wrapf(err, "could not create directory %s", path)
+			}
+			continue
+		}
+		if err != nil {
+			return errors.Wrapf(err, "could not stat %s", path)
+		}
+		if !info.IsDir() {
+			return errors.Errorf("invalid archive entry %q, %s is not a directory", name, path)
+		}
+	}
+	return nil
+}
+
+func (ex *tarExtractor) makeDir(path string) error {
+	info, err := os.Lstat(path)
+	if err == nil && info.IsDir() {
+		return nil
+	}
+	if err := removeExisting(path); err != nil {
+		return err
+	}
+	if err := os.Mkdir(path, 0755); err != nil {
+		return errors.Wrapf(err, "could not create directory %s", path)
+	}
+	return nil
+}
+
+func (ex *tarExtractor) writeFile(path string, r io.Reader) error {
+	if err := removeExisting(path); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return errors.Wrapf(err, "could not create file %s", path)
+	}
+	defer file.Close()
+	w, err := NewSparseWriter(file, 0)
+	if err != nil {
+		return err
+	}
+	written, err := io.Copy(w, r)
+	ex.bytes += written
+	if err != nil {
+		return errors.Wrapf(err, "could not write file %s", path)
+	}
+	return w.Flush()
+}
+
+// setAttributes sets the ownership, permissions and modification time of an extracted entry.
+func (ex *tarExtractor) setAttributes(path string, hdr *tar.Header) error {
+	if ex.keepOwner {
+		if err := os.Lchown(path, hdr.Uid, hdr.Gid); err != nil {
+			return errors.Wrapf(err, "could not change owner of %s", path)
+		}
+	}
+	if hdr.Typeflag == tar.TypeSymlink {
+		return nil
+	}
+	if err := os.Chmod(path, os.FileMode(hdr.Mode).Perm()); err != nil {
+		return errors.Wrapf(err, "could not change mode of %s", path)
+	}
+	if err := os.Chtimes(path, hdr.ModTime, hdr.ModTime); err != nil {
+		return errors.Wrapf(err, "could not change times of %s", path)
+	}
+	return nil
+}
+
+// finish sets the attributes of the extracted directories, deepest first.
+func (ex *tarExtractor) finish() error {
+	for i := len(ex.dirs) - 1; i >= 0; i-- {
+		hdr := ex.dirs[i]
+		name, _ := sanitizeTarName(hdr.Name)
+		if err := ex.setAttributes(filepath.Join(ex.destDir, name), hdr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeExisting removes whatever is at path, unless it is a directory, so a link is replaced instead of followed.
+func removeExisting(path string) error {
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "could not stat %s", path)
+	}
+	if info.IsDir() {
+		return errors.Errorf("could not replace directory %s", path)
+	}
+	if err := os.Remove(path); err != nil {
+		return errors.Wrapf(err, "could not remove %s", path)
+	}
+	return nil
+}
@@ -0,0 +1,195 @@
+package util
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+type tarEntry struct {
+	hdr  tar.Header
+	data []byte
+}
+
+func createTar(entries ...tarEntry) []byte {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, entry := range entries {
+		hdr := entry.hdr
+		hdr.Size = int64(len(entry.data))
+		if hdr.Mode == 0 {
+			hdr.Mode = 0644
+		}
+		Expect(tw.WriteHeader(&hdr)).To(Succeed())
+		_, err := tw.Write(entry.data)
+		Expect(err).ToNot(HaveOccurred())
+	}
+	Expect(tw.Close()).To(Succeed())
+	return buf.Bytes()
+}
+
+func dirEntry(name string) tarEntry {
+	return tarEntry{hdr: tar.Header{Name: name, Typeflag: tar.TypeDir, Mode: 0755}}
+}
+
+func fileEntry(name, data string) tarEntry {
+	return tarEntry{hdr: tar.Header{Name: name, Typeflag: tar.TypeReg}, data: []byte(data)}
+}
+
+func linkEntry(name, target string, typeflag byte) tarEntry {
+	return tarEntry{hdr: tar.Header{Name: name, Typeflag: typeflag, Linkname: target}}
+}
+
+var _ = Describe("UnArchiveTar", func() {
+	var destDir string
+
+	BeforeEach(func() {
+		var err error
+		destDir, err = ioutil.TempDir("", "untar")
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(destDir)
+	})
+
+	It("Should extract files, directories and links", func() {
+		modTime := time.Date(2019, 11, 21, 10, 40, 0, 0, time.UTC)
+		archive := createTar(
+			dirEntry("dir/"),
+			tarEntry{hdr: tar.Header{Name: "dir/script.sh", Typeflag: tar.TypeReg, Mode: 0750, ModTime: modTime}, data: []byte("echo hello")},
+			fileEntry("nested/path/file.txt", "nested"),
+			linkEntry("dir/symlink", "script.sh", tar.TypeSymlink),
+			linkEntry("hardlink", "dir/script.sh", tar.TypeLink),
+		)
+		Expect(UnArchiveTar(bytes.NewReader(archive), destDir)).To(Succeed())
+
+		data, err := ioutil.ReadFile(filepath.Join(destDir, "dir", "script.sh"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(data)).To(Equal("echo hello"))
+		info, err := os.Stat(filepath.Join(destDir, "dir", "script.sh"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(info.Mode().Perm()).To(Equal(os.FileMode(0750)))
+		Expect(info.ModTime().Equal(modTime)).To(BeTrue())
+
+		data, err = ioutil.ReadFile(filepath.Join(destDir, "nested", "path", "file.txt"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(data)).To(Equal("nested"))
+
+		link, err := os.Readlink(filepath.Join(destDir, "dir", "symlink"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(link).To(Equal("script.sh"))
+
+		hardlink, err := os.Stat(filepath.Join(destDir, "hardlink"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(os.SameFile(info, hardlink)).To(BeTrue())
+	})
+
+	It("Should remove the leading slash of absolute paths", func() {
+		archive := createTar(fileEntry("/etc/absolute.txt", "absolute"))
+		Expect(UnArchiveTar(bytes.NewReader(archive), destDir)).To(Succeed())
+		data, err := ioutil.ReadFile(filepath.Join(destDir, "etc", "absolute.txt"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(data)).To(Equal("absolute"))
+	})
+
+	table.DescribeTable("Should reject", func(entries ...tarEntry) {
+		archive := createTar(entries...)
+		Expect(UnArchiveTar(bytes.NewReader(archive), destDir)).ToNot(Succeed())
+		_, err := os.Lstat(filepath.Join(filepath.Dir(destDir), "escaped"))
+		Expect(os.IsNotExist(err)).To(BeTrue())
+	},
+		table.Entry("an entry that leaves the destination", fileEntry("dir/../../escaped", "escaped")),
+		table.Entry("a hard link that leaves the destination", linkEntry("link", "../escaped", tar.TypeLink)),
+		table.Entry("writing through a symbolic link", dirEntry("dir/"), linkEntry("link", "dir", tar.TypeSymlink), fileEntry("link/file", "data")),
+		table.Entry("writing through a symbolic link that leaves the destination",
+			linkEntry("link", "..", tar.TypeSymlink), fileEntry("link/escaped", "escaped")),
+		table.Entry("a hard link through a symbolic link",
+			linkEntry("self", ".", tar.TypeSymlink), linkEntry("up", "self/self/../..", tar.TypeSymlink), linkEntry("link", "up/escaped", tar.TypeLink)),
+	)
+
+	It("Should create symbolic links that point outside the destination as is", func() {
+		archive := createTar(linkEntry("absolute", "/etc/passwd", tar.TypeSymlink), linkEntry("dir/parent", "../../escaped", tar.TypeSymlink))
+		Expect(UnArchiveTar(bytes.NewReader(archive), destDir)).To(Succeed())
+		link, err := os.Readlink(filepath.Join(destDir, "absolute"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(link).To(Equal("/etc/passwd"))
+		link, err = os.Readlink(filepath.Join(destDir, "dir", "parent"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(link).To(Equal("../../escaped"))
+	})
+
+	It("Should replace a symbolic link instead of writing to its target", func() {
+		archive := createTar(fileEntry("target", "target"), linkEntry("link", "target", tar.TypeSymlink), fileEntry("link", "replaced"))
+		Expect(UnArchiveTar(bytes.NewReader(archive), destDir)).To(Succeed())
+		data, err := ioutil.ReadFile(filepath.Join(destDir, "target"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(data)).To(Equal("target"))
+		info, err := os.Lstat(filepath.Join(destDir, "link"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(info.Mode().IsRegular()).To(BeTrue())
+	})
+
+	It("Should skip device nodes and clear the setuid bit", func() {
+		archive := createTar(
+			tarEntry{hdr: tar.Header{Name: "null", Typeflag: tar.TypeChar, Devmajor: 1, Devminor: 3}},
+			tarEntry{hdr: tar.Header{Name: "fifo", Typeflag: tar.TypeFifo}},
+			tarEntry{hdr: tar.Header{Name: "setuid", Typeflag: tar.TypeReg, Mode: 04755}, data: []byte("setuid")},
+		)
+		Expect(UnArchiveTar(bytes.NewReader(archive), destDir)).To(Succeed())
+		_, err := os.Lstat(filepath.Join(destDir, "null"))
+		Expect(os.IsNotExist(err)).To(BeTrue())
+		_, err = os.Lstat(filepath.Join(destDir, "fifo"))
+		Expect(os.IsNotExist(err)).To(BeTrue())
+		info, err := os.Stat(filepath.Join(destDir, "setuid"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(info.Mode() & os.ModeSetuid).To(BeZero())
+		Expect(info.Mode().Perm()).To(Equal(os.FileMode(0755)))
+	})
+
+	It("Should only extract the requested members", func() {
+		archive := createTar(dirEntry("disk/"), fileEntry("disk/disk.img", "disk"), fileEntry("other.txt", "other"))
+		Expect(UnArchiveTar(bytes.NewReader(archive), destDir, "disk/")).To(Succeed())
+		_, err := os.Stat(filepath.Join(destDir, "disk", "disk.img"))
+		Expect(err).ToNot(HaveOccurred())
+		_, err = os.Stat(filepath.Join(destDir, "other.txt"))
+		Expect(os.IsNotExist(err)).To(BeTrue())
+	})
+
+	It("Should write sparse files", func() {
+		data := make([]byte, 10*1024*1024)
+		copy(data[5*1024*1024:], "data in the middle")
+		archive := createTar(tarEntry{hdr: tar.Header{Name: "sparse.img", Typeflag: tar.TypeReg}, data: data})
+		Expect(UnArchiveTar(bytes.NewReader(archive), destDir)).To(Succeed())
+		result, err := ioutil.ReadFile(filepath.Join(destDir, "sparse.img"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result).To(Equal(data))
+		info, err := os.Stat(filepath.Join(destDir, "sparse.img"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(info.Sys().(*syscall.Stat_t).Blocks * 512).To(BeNumerically("<", len(data)))
+	})
+
+	It("Should extract a local gzipped tar", func() {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		_, err := gz.Write(createTar(fileEntry("file.txt", "compressed")))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(gz.Close()).To(Succeed())
+		tarFile := filepath.Join(destDir, "archive.tar.gz")
+		Expect(ioutil.WriteFile(tarFile, buf.Bytes(), 0644)).To(Succeed())
+
+		Expect(UnArchiveLocalTar(tarFile, filepath.Join(destDir, "out"))).To(Succeed())
+		data, err := ioutil.ReadFile(filepath.Join(destDir, "out", "file.txt"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(data)).To(Equal("compressed"))
+	})
+})
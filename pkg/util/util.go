@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"bytes"
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -13,6 +14,8 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -26,9 +29,13 @@ import (
 
 // CountingReader is a reader that keeps track of how much has been read
 type CountingReader struct {
-	Reader  io.ReadCloser
+	Reader io.ReadCloser
+	// Current is the number of bytes read, it is read and updated with the atomic package since the progress is
+	// polled from other goroutines
 	Current uint64
-	Done    bool
+	// Done is true once the end of the stream is read, it is read and updated with IsDone and SetDone
+	Done      bool
+	doneMutex sync.Mutex
 }
 
 // RandAlphaNum provides an implementation to generate a random alpha numeric string of the specified length
@@ -72,11 +79,25 @@ func ParseEnvVar(envVarName string, decode bool) (string, error) {
 // Read reads bytes from the stream and updates the prometheus clone_progress metric according to the progress.
 func (r *CountingReader) Read(p []byte) (n int, err error) {
 	n, err = r.Reader.Read(p)
-	r.Current += uint64(n)
-	r.Done = err == io.EOF
+	atomic.AddUint64(&r.Current, uint64(n))
+	r.SetDone(err == io.EOF)
 	return n, err
 }
 
+// IsDone returns true if the end of the stream has been read.
+func (r *CountingReader) IsDone() bool {
+	r.doneMutex.Lock()
+	defer r.doneMutex.Unlock()
+	return r.Done
+}
+
+// SetDone records if the end of the stream has been read.
+func (r *CountingReader) SetDone(done bool) {
+	r.doneMutex.Lock()
+	defer r.doneMutex.Unlock()
+	r.Done = done
+}
+
 // Close closes the stream
 func (r *CountingReader) Close() error {
 	return r.Reader.Close()
@@ -127,7 +148,8 @@ func MinQuantity(availableSpace, imageSize *resource.Quantity) resource.Quantity
 	return *imageSize
 }
 
-// StreamDataToFile provides a function to stream the specified io.Reader to the specified local file
+// StreamDataToFile provides a function to stream the specified io.Reader to the specified local file. The blocks that
+// only contain zeroes are not written, see SparseWriter.
 func StreamDataToFile(r io.Reader, fileName string) error {
 	var outFile *os.File
 	var err error
@@ -141,8 +163,15 @@ func StreamDataToFile(r io.Reader, fileName string) error {
 		return errors.Wrapf(err, "could not open file %q", fileName)
 	}
 	defer outFile.Close()
+	writer, err := NewSparseWriter(outFile, 0)
+	if err != nil {
+		return err
+	}
 	klog.V(1).Infof("Writing data...\n")
-	if _, err = io.Copy(outFile, r); err != nil {
+	if _, err = io.Copy(writer, r); err == nil {
+		err = writer.Flush()
+	}
+	if err != nil {
 		klog.Errorf("Unable to write file from dataReader: %v\n", err)
 		os.Remove(outFile.Name())
 		return errors.Wrapf(err, "unable to write to file")
@@ -151,45 +180,6 @@ func StreamDataToFile(r io.Reader, fileName string) error {
 	return err
 }
 
-// UnArchiveTar unarchives a tar file and streams its files
-// using the specified io.Reader to the specified destination.
-func UnArchiveTar(reader io.Reader, destDir string, arg ...string) error {
-	klog.V(1).Infof("begin untar to %s...\n", destDir)
-
-	var tarOptions string
-	var args = arg
-	if len(arg) > 0 {
-		tarOptions = arg[0]
-		args = arg[1:]
-	}
-	options := fmt.Sprintf("-%s%s", tarOptions, "xvC")
-	untar := exec.Command("/usr/bin/tar", options, destDir, strings.Join(args, ""))
-	untar.Stdin = reader
-	var errBuf bytes.Buffer
-	untar.Stderr = &errBuf
-	err := untar.Start()
-	if err != nil {
-		return err
-	}
-	err = untar.Wait()
-	if err != nil {
-		klog.V(3).Infof("%s\n", errBuf.String())
-		klog.Errorf("%s\n", err.Error())
-		return err
-	}
-	return nil
-}
-
-// UnArchiveLocalTar unarchives a local tar file to the specified destination.
-func UnArchiveLocalTar(filePath, destDir string, arg ...string) error {
-	file, err := os.Open(filePath)
-	if err != nil {
-		return errors.Wrap(err, "could not open tar file")
-	}
-	fileReader := bufio.NewReader(file)
-	return UnArchiveTar(fileReader, destDir, arg...)
-}
-
 // CopyFile copies a file from one location to another.
 func CopyFile(src, dst string) error {
 	in, err := os.Open(src)
@@ -229,6 +219,46 @@ func WriteTerminationMessageToFile(file, message string) error {
 	return nil
 }
 
+// ImportResult is what the importer reports in its termination message once the data is imported, when it exits
+// to be restarted with scratch space, or when it fails, so the controller can record it on the PVC.
+type ImportResult struct {
+	// Message describes the result, or the error if the import failed
+	Message string `json:"message"`
+	// ImageDigest is the digest of the manifest of the imported registry image
+	ImageDigest string `json:"imageDigest,omitempty"`
+	// Retries is the number of times the importer retried a request to the source that failed with a transient error
+	Retries int `json:"retries,omitempty"`
+}
+
+// WriteImportResult writes the passed in import result as the termination message, in JSON.
+func WriteImportResult(result *ImportResult) error {
+	return WriteImportResultToFile(common.PodTerminationMessageFile, result)
+}
+
+// WriteImportResultToFile writes the passed in import result to the passed in message file, in JSON. Like
+// WriteTerminationMessageToFile, only the first line of the message is written.
+func WriteImportResultToFile(file string, result *ImportResult) error {
+	firstLine := *result
+	if i := strings.IndexByte(firstLine.Message, '\n'); i >= 0 {
+		firstLine.Message = firstLine.Message[:i]
+	}
+	message, err := json.Marshal(&firstLine)
+	if err != nil {
+		return errors.Wrap(err, "could not encode import result")
+	}
+	return WriteTerminationMessageToFile(file, string(message))
+}
+
+// ParseImportResult parses a termination message written by WriteImportResult. It returns nil if the message is not
+// an import result, like the error message of a failed import.
+func ParseImportResult(message string) *ImportResult {
+	result := &ImportResult{}
+	if !strings.HasPrefix(message, "{") || json.Unmarshal([]byte(message), result) != nil {
+		return nil
+	}
+	return result
+}
+
 // CopyDir copies a dir from one location to another.
 func CopyDir(source string, dest string) (err error) {
 	// get properties of source dir
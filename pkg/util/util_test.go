@@ -124,6 +124,30 @@ var _ = Describe("Copy files", func() {
 	})
 })
 
+var _ = Describe("Import result", func() {
+	table.DescribeTable("Parse import result", func(message string, expected *ImportResult) {
+		Expect(ParseImportResult(message)).To(Equal(expected))
+	},
+		table.Entry("result with an image digest", `{"message":"Import Complete","imageDigest":"sha256:1234"}`, &ImportResult{Message: "Import Complete", ImageDigest: "sha256:1234"}),
+		table.Entry("result without an image digest", `{"message":"Import Complete"}`, &ImportResult{Message: "Import Complete"}),
+		table.Entry("result with retries", `{"message":"Import Complete","retries":2}`, &ImportResult{Message: "Import Complete", Retries: 2}),
+		table.Entry("error message", "Unable to process data: {invalid}", nil),
+		table.Entry("invalid json", "{invalid}", nil),
+	)
+
+	It("Should write the first line of the message of a failure", func() {
+		file, err := ioutil.TempFile("", "termination-log")
+		Expect(err).NotTo(HaveOccurred())
+		file.Close()
+		defer os.Remove(file.Name())
+		err = WriteImportResultToFile(file.Name(), &ImportResult{Message: "Unable to process data: failed\nstack trace", Retries: 3})
+		Expect(err).NotTo(HaveOccurred())
+		message, err := ioutil.ReadFile(file.Name())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ParseImportResult(string(message))).To(Equal(&ImportResult{Message: "Unable to process data: failed", Retries: 3}))
+	})
+})
+
 func md5sum(filePath string) (string, error) {
 	var returnMD5String string
 
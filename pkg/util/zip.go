@@ -0,0 +1,139 @@
+/*
+Copyright 2020 The CDI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"k8s.io/klog"
+)
+
+// maxSymlinkTargetSize is the maximum size of the target of a symbolic link stored in a zip archive.
+const maxSymlinkTargetSize = 4096
+
+// UnArchiveLocalZip unarchives a local zip file to the specified destination. If members are passed in, only the
+// entries matching them, or contained in the matching directories, are extracted.
+func UnArchiveLocalZip(filePath, destDir string, members ...string) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return errors.Wrap(err, "could not open zip file")
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return errors.Wrap(err, "could not stat zip file")
+	}
+	return UnArchiveZip(file, info.Size(), destDir, members...)
+}
+
+// UnArchiveZip unarchives a zip archive of the passed in size, read with the specified io.ReaderAt, to the specified
+// destination. If members are passed in, only the entries matching them, or contained in the matching directories,
+// are extracted.
+//
+// The entries are sanitized the same way UnArchiveTar sanitizes the entries of a tar archive. A zip archive does not
+// store ownership, so the extracted entries are owned by the current user.
+func UnArchiveZip(reader io.ReaderAt, size int64, destDir string, members ...string) error {
+	klog.V(1).Infof("begin unzip to %s...\n", destDir)
+	destDir, err := filepath.Abs(destDir)
+	if err != nil {
+		return errors.Wrapf(err, "invalid destination %s", destDir)
+	}
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return errors.Wrapf(err, "could not create destination %s", destDir)
+	}
+	ex := &tarExtractor{
+		destDir: destDir,
+		members: make([]string, 0, len(members)),
+	}
+	for _, member := range members {
+		name, err := sanitizeTarName(member)
+		if err != nil {
+			return err
+		}
+		ex.members = append(ex.members, name)
+	}
+
+	zr, err := zip.NewReader(reader, size)
+	if err != nil {
+		return errors.Wrap(err, "could not open zip file")
+	}
+	for _, f := range zr.File {
+		if err := extractZipEntry(ex, f); err != nil {
+			return err
+		}
+	}
+	if err := ex.finish(); err != nil {
+		return err
+	}
+	klog.V(1).Infof("extracted %d entries, %d bytes to %s\n", ex.entries, ex.bytes, destDir)
+	return nil
+}
+
+// extractZipEntry extracts a single zip entry, by describing it with the tar header the extractor expects.
+func extractZipEntry(ex *tarExtractor, f *zip.File) error {
+	mode := f.Mode()
+	hdr := &tar.Header{
+		Name:    f.Name,
+		Mode:    int64(mode.Perm()),
+		ModTime: f.Modified,
+	}
+	switch {
+	case mode.IsDir():
+		hdr.Typeflag = tar.TypeDir
+	case mode&os.ModeSymlink != 0:
+		hdr.Typeflag = tar.TypeSymlink
+	case mode&os.ModeCharDevice != 0:
+		hdr.Typeflag = tar.TypeChar
+	case mode&os.ModeDevice != 0:
+		hdr.Typeflag = tar.TypeBlock
+	case mode&os.ModeNamedPipe != 0:
+		hdr.Typeflag = tar.TypeFifo
+	case mode&os.ModeSocket != 0:
+		klog.Warningf("skipping zip entry %q, sockets are not extracted\n", f.Name)
+		return nil
+	default:
+		hdr.Typeflag = tar.TypeReg
+	}
+	if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeSymlink {
+		return ex.extract(hdr, nil)
+	}
+
+	rc, err := f.Open()
+	if err != nil {
+		return errors.Wrapf(err, "could not open zip entry %q", f.Name)
+	}
+	defer rc.Close()
+	if hdr.Typeflag == tar.TypeSymlink {
+		// The target of a symbolic link is stored as the content of the entry.
+		target, err := ioutil.ReadAll(io.LimitReader(rc, maxSymlinkTargetSize+1))
+		if err != nil {
+			return errors.Wrapf(err, "could not read zip entry %q", f.Name)
+		}
+		if len(target) > maxSymlinkTargetSize {
+			return errors.Errorf("invalid zip entry %q, symbolic link target is too long", f.Name)
+		}
+		hdr.Linkname = string(target)
+		return ex.extract(hdr, nil)
+	}
+	return ex.extract(hdr, rc)
+}
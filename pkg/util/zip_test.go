@@ -0,0 +1,135 @@
+package util
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+type zipEntry struct {
+	name string
+	mode os.FileMode
+	data string
+}
+
+func createZip(path string, entries ...zipEntry) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, entry := range entries {
+		fh := &zip.FileHeader{Name: entry.name, Method: zip.Deflate}
+		fh.Modified = time.Date(2019, 11, 21, 10, 40, 0, 0, time.UTC)
+		mode := entry.mode
+		if mode == 0 {
+			mode = 0644
+		}
+		fh.SetMode(mode)
+		w, err := zw.CreateHeader(fh)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = w.Write([]byte(entry.data))
+		Expect(err).ToNot(HaveOccurred())
+	}
+	Expect(zw.Close()).To(Succeed())
+	Expect(ioutil.WriteFile(path, buf.Bytes(), 0644)).To(Succeed())
+}
+
+var _ = Describe("UnArchiveLocalZip", func() {
+	var (
+		tmpDir  string
+		zipFile string
+		destDir string
+	)
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "unzip")
+		Expect(err).ToNot(HaveOccurred())
+		zipFile = filepath.Join(tmpDir, "archive.zip")
+		destDir = filepath.Join(tmpDir, "dest")
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(tmpDir)
+	})
+
+	It("Should extract files, directories and links", func() {
+		createZip(zipFile,
+			zipEntry{name: "dir/", mode: os.ModeDir | 0755},
+			zipEntry{name: "dir/script.sh", mode: 0750, data: "echo hello"},
+			zipEntry{name: "nested/path/file.txt", data: "nested"},
+			zipEntry{name: "dir/symlink", mode: os.ModeSymlink | 0777, data: "script.sh"},
+		)
+		Expect(UnArchiveLocalZip(zipFile, destDir)).To(Succeed())
+
+		data, err := ioutil.ReadFile(filepath.Join(destDir, "dir", "script.sh"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(data)).To(Equal("echo hello"))
+		info, err := os.Stat(filepath.Join(destDir, "dir", "script.sh"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(info.Mode().Perm()).To(Equal(os.FileMode(0750)))
+		Expect(info.ModTime().Equal(time.Date(2019, 11, 21, 10, 40, 0, 0, time.UTC))).To(BeTrue())
+
+		data, err = ioutil.ReadFile(filepath.Join(destDir, "nested", "path", "file.txt"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(data)).To(Equal("nested"))
+
+		link, err := os.Readlink(filepath.Join(destDir, "dir", "symlink"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(link).To(Equal("script.sh"))
+	})
+
+	table.DescribeTable("Should reject", func(entries ...zipEntry) {
+		createZip(zipFile, entries...)
+		Expect(UnArchiveLocalZip(zipFile, destDir)).ToNot(Succeed())
+		_, err := os.Lstat(filepath.Join(tmpDir, "escaped"))
+		Expect(os.IsNotExist(err)).To(BeTrue())
+	},
+		table.Entry("an entry that leaves the destination", zipEntry{name: "dir/../../escaped", data: "escaped"}),
+		table.Entry("writing through a symbolic link",
+			zipEntry{name: "dir/", mode: os.ModeDir | 0755}, zipEntry{name: "link", mode: os.ModeSymlink | 0777, data: "dir"}, zipEntry{name: "link/file", data: "data"}),
+		table.Entry("writing through a symbolic link that leaves the destination",
+			zipEntry{name: "link", mode: os.ModeSymlink | 0777, data: ".."}, zipEntry{name: "link/escaped", data: "escaped"}),
+	)
+
+	It("Should create symbolic links that point outside the destination as is", func() {
+		createZip(zipFile, zipEntry{name: "absolute", mode: os.ModeSymlink | 0777, data: "/etc/passwd"})
+		Expect(UnArchiveLocalZip(zipFile, destDir)).To(Succeed())
+		link, err := os.Readlink(filepath.Join(destDir, "absolute"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(link).To(Equal("/etc/passwd"))
+	})
+
+	It("Should skip named pipes and clear the setuid bit", func() {
+		createZip(zipFile,
+			zipEntry{name: "fifo", mode: os.ModeNamedPipe | 0644},
+			zipEntry{name: "setuid", mode: os.ModeSetuid | 0755, data: "setuid"},
+		)
+		Expect(UnArchiveLocalZip(zipFile, destDir)).To(Succeed())
+		_, err := os.Lstat(filepath.Join(destDir, "fifo"))
+		Expect(os.IsNotExist(err)).To(BeTrue())
+		info, err := os.Stat(filepath.Join(destDir, "setuid"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(info.Mode() & os.ModeSetuid).To(BeZero())
+		Expect(info.Mode().Perm()).To(Equal(os.FileMode(0755)))
+	})
+
+	It("Should only extract the requested members", func() {
+		createZip(zipFile, zipEntry{name: "disk/disk.img", data: "disk"}, zipEntry{name: "other.txt", data: "other"})
+		Expect(UnArchiveLocalZip(zipFile, destDir, "disk")).To(Succeed())
+		_, err := os.Stat(filepath.Join(destDir, "disk", "disk.img"))
+		Expect(err).ToNot(HaveOccurred())
+		_, err = os.Stat(filepath.Join(destDir, "other.txt"))
+		Expect(os.IsNotExist(err)).To(BeTrue())
+	})
+
+	It("Should fail on a file that is not a zip archive", func() {
+		Expect(ioutil.WriteFile(zipFile, []byte("not a zip archive"), 0644)).To(Succeed())
+		Expect(UnArchiveLocalZip(zipFile, destDir)).ToNot(Succeed())
+	})
+})
@@ -92,12 +92,12 @@ var _ = Describe("[rfe_id:1347][crit:high][vendor:cnv-qe@redhat.com][level:compo
 			ValidateRBACForResource(f, podExpectedResult, "pods/finalizers", sa)
 
 			secretsExpectedResult := make(map[string]string)
-			secretsExpectedResult["get"] = "no"
+			secretsExpectedResult["get"] = "yes"
 			secretsExpectedResult["list"] = "no"
 			secretsExpectedResult["watch"] = "no"
 			secretsExpectedResult["delete"] = "no"
-			secretsExpectedResult["create"] = "no"
-			secretsExpectedResult["update"] = "no"
+			secretsExpectedResult["create"] = "yes"
+			secretsExpectedResult["update"] = "yes"
 			secretsExpectedResult["patch"] = "no"
 			secretsExpectedResult["deletecollection"] = "no"
 			ValidateRBACForResource(f, secretsExpectedResult, "secrets", sa)